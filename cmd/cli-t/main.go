@@ -175,12 +175,7 @@ func createSubcommand(name string, cmd command.Command) *cobra.Command {
 	}
 
 	// If command defines flags, add them
-	// Checks if cmd has defination of FlagDefiner. extract only that
-	// Lets not force Command to implement FlagDefiner types
-	if flagDefiner, ok := cmd.(command.FlagDefiner); ok {
-		flags := flagDefiner.DefineFlags()
-		command.SetupFlags(cobraCmd, flags)
-	}
+	command.SetupCommand(cobraCmd, cmd)
 
 	return cobraCmd
 }
@@ -20,6 +20,26 @@ type FlagDefiner interface {
 	DefineFlags() []Flag
 }
 
+// FlagsBeforeArgs is an optional interface for commands whose flags all
+// come before the first positional argument. Everything after it is passed
+// on as is, so arguments that look like flags stay arguments
+// (redis-cli LRANGE l 0 -1).
+type FlagsBeforeArgs interface {
+	FlagsBeforeArgs() bool
+}
+
+// SetupCommand adds the flags of cmd to its cobra command, if it defines
+// any, and stops parsing them at the first argument if it asks to
+func SetupCommand(cobraCmd *cobra.Command, cmd Command) {
+	// Lets not force Command to implement these interfaces
+	if flagDefiner, ok := cmd.(FlagDefiner); ok {
+		SetupFlags(cobraCmd, flagDefiner.DefineFlags())
+	}
+	if f, ok := cmd.(FlagsBeforeArgs); ok && f.FlagsBeforeArgs() {
+		cobraCmd.Flags().SetInterspersed(false)
+	}
+}
+
 // SetupFlags adds flags to a cobra command
 func SetupFlags(cobraCmd *cobra.Command, flags []Flag) {
 	for _, flag := range flags {
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"sync"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
 )
 
@@ -132,3 +133,33 @@ func Save(config *Config) error {
 	instance = config
 	return viper.WriteConfig()
 }
+
+// LoadFile reads a tool's own config file (lb.yaml, ...) into out, with a
+// viper of its own so it doesn't mix with the cli-t config. Durations like
+// "5s" decode into time.Duration fields.
+func LoadFile(path string, out interface{}) error {
+	v := viper.New()
+	v.SetConfigFile(path)
+
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("error reading config %s: %w", path, err)
+	}
+	if err := v.Unmarshal(out); err != nil {
+		return fmt.Errorf("error unmarshaling config %s: %w", path, err)
+	}
+	return nil
+}
+
+// WatchFile calls onChange every time the file at path is written, until
+// the process exits
+func WatchFile(path string, onChange func()) error {
+	v := viper.New()
+	v.SetConfigFile(path)
+
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("error reading config %s: %w", path, err)
+	}
+	v.OnConfigChange(func(fsnotify.Event) { onChange() })
+	v.WatchConfig()
+	return nil
+}
@@ -4,9 +4,11 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"cli-t/internal/config"
 
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -285,3 +287,39 @@ func TestToolConfig(t *testing.T) {
 	assert.True(t, ok)
 	assert.Equal(t, []string{"-l", "-w"}, flags)
 }
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tool.yaml")
+	err := os.WriteFile(path, []byte("name: web\ntimeout: 5s\nports: [80, 443]\n"), 0644)
+	require.NoError(t, err)
+
+	var out struct {
+		Name    string        `mapstructure:"name"`
+		Timeout time.Duration `mapstructure:"timeout"`
+		Ports   []int         `mapstructure:"ports"`
+	}
+	require.NoError(t, config.LoadFile(path, &out))
+	assert.Equal(t, "web", out.Name)
+	assert.Equal(t, 5*time.Second, out.Timeout)
+	assert.Equal(t, []int{80, 443}, out.Ports)
+
+	// The cli-t config is left alone
+	assert.NotEqual(t, "web", viper.GetString("name"))
+
+	assert.Error(t, config.LoadFile(filepath.Join(t.TempDir(), "missing.yaml"), &out))
+}
+
+func TestWatchFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tool.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("name: a\n"), 0644))
+
+	changed := make(chan struct{}, 10)
+	require.NoError(t, config.WatchFile(path, func() { changed <- struct{}{} }))
+
+	require.NoError(t, os.WriteFile(path, []byte("name: b\n"), 0644))
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change notification")
+	}
+}
@@ -0,0 +1,126 @@
+// Package glob implements redis-style glob matching (stringmatchlen).
+// It is shared by KEYS, SCAN MATCH and PSUBSCRIBE patterns.
+package glob
+
+// Match reports whether str matches pattern.
+//
+// Supported syntax: '*' matches any sequence of characters (including
+// none), '?' exactly one character, '[abc]' one of the listed characters,
+// '[^abc]' any character except the listed ones, '[a-z]' a character range
+// and '\x' the literal character x.
+func Match(pattern, str string) bool {
+	p, s := 0, 0
+
+	// Position of the last '*' seen and where it started matching in str.
+	// On a mismatch we let that star swallow one more character and retry,
+	// which avoids the exponential recursion of the naive approach.
+	starP, starS := -1, 0
+
+	for s < len(str) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				for p < len(pattern) && pattern[p] == '*' {
+					p++
+				}
+				if p == len(pattern) {
+					return true // trailing star matches the rest
+				}
+				starP, starS = p, s
+				continue
+
+			case '?':
+				p++
+				s++
+				continue
+
+			case '[':
+				if matched, next := matchClass(pattern, p, str[s]); matched {
+					p = next
+					s++
+					continue
+				}
+
+			case '\\':
+				if p+1 < len(pattern) {
+					if pattern[p+1] == str[s] {
+						p += 2
+						s++
+						continue
+					}
+				} else if str[s] == '\\' {
+					// Trailing backslash matches itself
+					p++
+					s++
+					continue
+				}
+
+			default:
+				if pattern[p] == str[s] {
+					p++
+					s++
+					continue
+				}
+			}
+		}
+
+		// Mismatch: backtrack to the last star if there is one
+		if starP == -1 {
+			return false
+		}
+		starS++
+		p, s = starP, starS
+	}
+
+	// str is consumed; only stars may remain in the pattern
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchClass matches c against the [...] class starting at pattern[start].
+// Returns whether it matched and the index just after the closing ']'.
+func matchClass(pattern string, start int, c byte) (bool, int) {
+	p := start + 1
+	negate := false
+	if p < len(pattern) && pattern[p] == '^' {
+		negate = true
+		p++
+	}
+
+	matched := false
+	for p < len(pattern) && pattern[p] != ']' {
+		switch {
+		case pattern[p] == '\\' && p+1 < len(pattern):
+			p++
+			if pattern[p] == c {
+				matched = true
+			}
+		case p+2 < len(pattern) && pattern[p+1] == '-' && pattern[p+2] != ']':
+			lo, hi := pattern[p], pattern[p+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			if c >= lo && c <= hi {
+				matched = true
+			}
+			p += 2
+		default:
+			if pattern[p] == c {
+				matched = true
+			}
+		}
+		p++
+	}
+
+	// An unterminated class runs to the end of the pattern, like redis
+	if p < len(pattern) {
+		p++ // skip ']'
+	}
+
+	if negate {
+		matched = !matched
+	}
+	return matched, p
+}
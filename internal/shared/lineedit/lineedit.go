@@ -0,0 +1,286 @@
+// Package lineedit reads lines from a terminal with emacs-style editing
+// and history recall, a tiny take on linenoise/readline.
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrInterrupted is returned by ReadLine when the user presses Ctrl-C
+var ErrInterrupted = errors.New("interrupted")
+
+const defaultMaxHistory = 1000
+
+// Editor reads lines from in, echoing and editing them on out. When in is
+// not a terminal it falls back to plain line reading without echo.
+type Editor struct {
+	in       *os.File
+	reader   *bufio.Reader
+	out      io.Writer
+	terminal bool
+
+	history    []string
+	MaxHistory int // oldest lines are dropped past this
+}
+
+func New(in *os.File, out io.Writer) *Editor {
+	return &Editor{
+		in:         in,
+		reader:     bufio.NewReader(in),
+		out:        out,
+		terminal:   IsTerminal(in.Fd()),
+		MaxHistory: defaultMaxHistory,
+	}
+}
+
+// ReadLine shows prompt and returns the line the user entered, without the
+// newline. It returns io.EOF on Ctrl-D at an empty line or at the end of the
+// input, and ErrInterrupted on Ctrl-C.
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	if !e.terminal {
+		fmt.Fprint(e.out, prompt)
+		line, err := e.reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	restore, err := makeRaw(e.in.Fd())
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+	return e.edit(prompt)
+}
+
+// History returns the remembered lines, oldest first
+func (e *Editor) History() []string {
+	return e.history
+}
+
+// AddHistory remembers a line for Up/Ctrl-P. Blank lines and repeats of the
+// previous line are skipped.
+func (e *Editor) AddHistory(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if n := len(e.history); n > 0 && e.history[n-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+	if e.MaxHistory > 0 && len(e.history) > e.MaxHistory {
+		e.history = e.history[len(e.history)-e.MaxHistory:]
+	}
+}
+
+// LoadHistory adds the lines of a history file; a missing file is not an error
+func (e *Editor) LoadHistory(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		e.AddHistory(line)
+	}
+	return nil
+}
+
+// SaveHistory writes the history, one line per entry
+func (e *Editor) SaveHistory(path string) error {
+	var out strings.Builder
+	for _, line := range e.history {
+		out.WriteString(line + "\n")
+	}
+	return os.WriteFile(path, []byte(out.String()), 0600)
+}
+
+// Control keys
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlH     = 8
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// lineState is the line being edited
+type lineState struct {
+	prompt string
+	buf    []rune
+	pos    int // cursor, index into buf
+
+	historyIndex int    // entry shown, len(history) is the line being typed
+	typed        string // the line being typed, kept while browsing history
+}
+
+// edit runs the editing loop on a terminal already in raw mode
+func (e *Editor) edit(prompt string) (string, error) {
+	st := &lineState{prompt: prompt, historyIndex: len(e.history)}
+	e.refresh(st)
+
+	for {
+		r, _, err := e.reader.ReadRune()
+		if err != nil {
+			if err == io.EOF && len(st.buf) > 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return string(st.buf), nil
+			}
+			return "", err
+		}
+
+		switch r {
+		case keyEnter, '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return string(st.buf), nil
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", ErrInterrupted
+		case keyCtrlD:
+			if len(st.buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			st.deleteAt(st.pos)
+		case keyBackspace, keyCtrlH:
+			if st.pos > 0 {
+				st.pos--
+				st.deleteAt(st.pos)
+			}
+		case keyCtrlA:
+			st.pos = 0
+		case keyCtrlE:
+			st.pos = len(st.buf)
+		case keyCtrlB:
+			st.pos = max(st.pos-1, 0)
+		case keyCtrlF:
+			st.pos = min(st.pos+1, len(st.buf))
+		case keyCtrlP:
+			e.browseHistory(st, -1)
+		case keyCtrlN:
+			e.browseHistory(st, 1)
+		case keyCtrlU:
+			st.buf = st.buf[st.pos:]
+			st.pos = 0
+		case keyCtrlK:
+			st.buf = st.buf[:st.pos]
+		case keyCtrlW:
+			start := st.pos
+			for start > 0 && st.buf[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && st.buf[start-1] != ' ' {
+				start--
+			}
+			st.buf = append(st.buf[:start], st.buf[st.pos:]...)
+			st.pos = start
+		case keyCtrlL:
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+		case keyEscape:
+			e.escapeSequence(st)
+		default:
+			if r >= ' ' {
+				st.buf = append(st.buf[:st.pos], append([]rune{r}, st.buf[st.pos:]...)...)
+				st.pos++
+			}
+		}
+		e.refresh(st)
+	}
+}
+
+// escapeSequence handles the arrow, Home/End and Delete keys
+// (ESC [ A, ESC O H, ESC [ 3 ~ ...)
+func (e *Editor) escapeSequence(st *lineState) {
+	first, _, err := e.reader.ReadRune()
+	if err != nil || (first != '[' && first != 'O') {
+		return
+	}
+	key, _, err := e.reader.ReadRune()
+	if err != nil {
+		return
+	}
+
+	if key >= '0' && key <= '9' {
+		// ESC [ n ~
+		if tilde, _, err := e.reader.ReadRune(); err != nil || tilde != '~' {
+			return
+		}
+		switch key {
+		case '1', '7':
+			st.pos = 0
+		case '4', '8':
+			st.pos = len(st.buf)
+		case '3':
+			st.deleteAt(st.pos)
+		}
+		return
+	}
+
+	switch key {
+	case 'A':
+		e.browseHistory(st, -1)
+	case 'B':
+		e.browseHistory(st, 1)
+	case 'C':
+		st.pos = min(st.pos+1, len(st.buf))
+	case 'D':
+		st.pos = max(st.pos-1, 0)
+	case 'H':
+		st.pos = 0
+	case 'F':
+		st.pos = len(st.buf)
+	}
+}
+
+// browseHistory moves through the history, -1 is older
+func (e *Editor) browseHistory(st *lineState, step int) {
+	next := st.historyIndex + step
+	if next < 0 || next > len(e.history) {
+		return
+	}
+	if st.historyIndex == len(e.history) {
+		st.typed = string(st.buf)
+	}
+
+	st.historyIndex = next
+	line := st.typed
+	if next < len(e.history) {
+		line = e.history[next]
+	}
+	st.buf = []rune(line)
+	st.pos = len(st.buf)
+}
+
+func (st *lineState) deleteAt(i int) {
+	if i < len(st.buf) {
+		st.buf = append(st.buf[:i], st.buf[i+1:]...)
+	}
+}
+
+// refresh redraws the prompt and line, then puts the cursor back
+func (e *Editor) refresh(st *lineState) {
+	column := len([]rune(st.prompt)) + st.pos
+	fmt.Fprintf(e.out, "\r%s%s\x1b[0K\r", st.prompt, string(st.buf))
+	if column > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dC", column)
+	}
+}
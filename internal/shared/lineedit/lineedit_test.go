@@ -0,0 +1,97 @@
+package lineedit
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// keys runs the editing loop on scripted key presses
+func keys(e *Editor, input string) (string, error) {
+	e.reader = bufio.NewReader(strings.NewReader(input))
+	e.out = io.Discard
+	return e.edit("> ")
+}
+
+func TestEdit(t *testing.T) {
+	e := &Editor{}
+
+	tests := []struct {
+		name, input, want string
+	}{
+		{"plain", "get foo\r", "get foo"},
+		{"backspace", "get fooo\x7f\r", "get foo"},
+		{"insert after moving left", "gt\x1b[De\r", "get"},
+		{"home and end", "et fo\x01g\x05o\r", "get foo"},
+		{"delete under cursor", "gxet\x01\x1b[C\x1b[3~\r", "get"},
+		{"kill to end", "get foo\x01\x06\x06\x06\x0b\r", "get"},
+		{"clear before cursor", "junk\x15ping\r", "ping"},
+		{"delete word", "set key value\x17val\r", "set key val"},
+		{"unicode", "set k ünï\x7f\r", "set k ün"},
+	}
+	for _, tt := range tests {
+		got, err := keys(e, tt.input)
+		require.NoError(t, err, tt.name)
+		assert.Equal(t, tt.want, got, tt.name)
+	}
+
+	_, err := keys(e, "abc\x03")
+	assert.ErrorIs(t, err, ErrInterrupted)
+	_, err = keys(e, "\x04")
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestHistory(t *testing.T) {
+	e := &Editor{MaxHistory: 3}
+	for _, line := range []string{"one", "two", "two", " ", "three", "four"} {
+		e.AddHistory(line)
+	}
+	assert.Equal(t, []string{"two", "three", "four"}, e.History())
+
+	// Up twice, down once
+	got, err := keys(e, "\x1b[A\x1b[A\x1b[B\r")
+	require.NoError(t, err)
+	assert.Equal(t, "four", got)
+
+	// Browsing away and back keeps what was typed
+	got, err = keys(e, "par\x10\x10\x0e\x0etial\r")
+	require.NoError(t, err)
+	assert.Equal(t, "partial", got)
+
+	// Can't go past the oldest entry
+	got, err = keys(e, "\x10\x10\x10\x10\r")
+	require.NoError(t, err)
+	assert.Equal(t, "two", got)
+
+	path := filepath.Join(t.TempDir(), "history")
+	require.NoError(t, e.SaveHistory(path))
+	loaded := &Editor{MaxHistory: 10}
+	require.NoError(t, loaded.LoadHistory(path))
+	assert.Equal(t, e.History(), loaded.History())
+	require.NoError(t, loaded.LoadHistory(filepath.Join(t.TempDir(), "missing")))
+}
+
+func TestReadLine_NotATerminal(t *testing.T) {
+	in, err := os.CreateTemp(t.TempDir(), "input")
+	require.NoError(t, err)
+	_, err = in.WriteString("ping\r\nget a")
+	require.NoError(t, err)
+	_, err = in.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+
+	e := New(in, io.Discard)
+	line, err := e.ReadLine("> ")
+	require.NoError(t, err)
+	assert.Equal(t, "ping", line)
+	line, err = e.ReadLine("> ")
+	require.NoError(t, err)
+	assert.Equal(t, "get a", line)
+	_, err = e.ReadLine("> ")
+	assert.ErrorIs(t, err, io.EOF)
+}
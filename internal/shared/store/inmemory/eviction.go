@@ -0,0 +1,412 @@
+package inmemory
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// EvictionPolicy decides which keys go when the store is over maxmemory
+type EvictionPolicy string
+
+const (
+	NoEviction     EvictionPolicy = "noeviction"      // refuse writes instead
+	AllKeysLRU     EvictionPolicy = "allkeys-lru"     // least recently used key
+	VolatileLRU    EvictionPolicy = "volatile-lru"    // least recently used key with a TTL
+	AllKeysLFU     EvictionPolicy = "allkeys-lfu"     // least frequently used key
+	VolatileLFU    EvictionPolicy = "volatile-lfu"    // least frequently used key with a TTL
+	AllKeysRandom  EvictionPolicy = "allkeys-random"  // any key
+	VolatileRandom EvictionPolicy = "volatile-random" // any key with a TTL
+	VolatileTTL    EvictionPolicy = "volatile-ttl"    // key with the nearest expiry
+)
+
+// DefaultEvictionSamples is how many keys are compared per eviction, like
+// redis' maxmemory-samples
+const DefaultEvictionSamples = 5
+
+var ErrOOM = errors.New("OOM command not allowed when used memory > 'maxmemory'.")
+
+// ParseEvictionPolicy validates a --maxmemory-policy value
+func ParseEvictionPolicy(value string) (EvictionPolicy, error) {
+	switch policy := EvictionPolicy(strings.ToLower(value)); policy {
+	case NoEviction, AllKeysLRU, VolatileLRU, AllKeysLFU, VolatileLFU,
+		AllKeysRandom, VolatileRandom, VolatileTTL:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid maxmemory policy %q", value)
+}
+
+// volatile policies only ever evict keys that have an expiry
+func (p EvictionPolicy) volatile() bool {
+	return strings.HasPrefix(string(p), "volatile-")
+}
+
+// LFU counter tuning, same defaults as redis (lfu-log-factor, lfu-decay-time)
+const (
+	lfuInitValue  = 5
+	lfuLogFactor  = 10
+	lfuDecayEvery = time.Minute
+)
+
+// keyMeta is the per-key bookkeeping eviction needs. It only exists while
+// a memory limit is set, so a store without one pays nothing for it.
+//
+// Reads update the access fields under the shard's read lock, several at
+// once, hence the atomics. A lost update between two concurrent reads only
+// makes the approximation a little rougher.
+type keyMeta struct {
+	size       int64         // estimated bytes, see sizeOf; written under the write lock
+	lastAccess atomic.Int64  // unix ms, for LRU
+	freq       atomic.Uint32 // logarithmic access counter (0-255), for LFU
+	decayedAt  atomic.Int64  // unix ms of the last LFU decay
+}
+
+// memoryLimit is the maxmemory state of a store. max, policy and samples
+// only change with every shard locked; used is updated by all shards at
+// once. The per-key keyMeta lives in each shard.
+type memoryLimit struct {
+	max     atomic.Int64 // bytes, 0 = no limit
+	policy  EvictionPolicy
+	samples int
+	used    atomic.Int64
+}
+
+// Rough per-entry costs of the Go structures behind each type. They don't
+// have to be exact, only proportional, so big values are evicted first
+// and the limit tracks the real heap closely enough.
+const (
+	keyOverhead      = 144 // map bucket slot, StoreValue header, keyMeta, SCAN order node
+	expiryOverhead   = 24  // *time.Time
+	listItemOverhead = 16  // string header
+	hashOverhead     = 48  // map slot + two string headers
+	setOverhead      = 24  // map slot + string header
+	zsetOverhead     = 96  // dict slot + skiplist node with its levels
+	streamOverhead   = 48  // StreamEntry: ID + slice header
+	pendingOverhead  = 96  // PEL map slot + PendingEntry
+)
+
+// What one item of each collection adds to its key's size. Writes to a
+// collection account for the items they add or remove with these, sizeOf
+// adds them all up.
+func listItemSize(item string) int64 {
+	return int64(listItemOverhead + len(item))
+}
+
+func listItemsSize(items []string) int64 {
+	var size int64
+	for _, item := range items {
+		size += listItemSize(item)
+	}
+	return size
+}
+
+func hashFieldSize(field, value string) int64 {
+	return int64(hashOverhead + len(field) + len(value))
+}
+
+func setMemberSize(member string) int64 {
+	return int64(setOverhead + len(member))
+}
+
+func zsetMemberSize(member string) int64 {
+	return int64(zsetOverhead + 2*len(member)) // dict key + skiplist copy
+}
+
+func streamEntrySize(entry StreamEntry) int64 {
+	size := int64(streamOverhead)
+	for _, field := range entry.Fields {
+		size += listItemSize(field)
+	}
+	return size
+}
+
+func streamEntriesSize(entries []StreamEntry) int64 {
+	var size int64
+	for _, entry := range entries {
+		size += streamEntrySize(entry)
+	}
+	return size
+}
+
+// expirySize is what a TTL adds to its key
+func expirySize(expiresAt *time.Time) int64 {
+	if expiresAt == nil {
+		return 0
+	}
+	return expiryOverhead
+}
+
+// sizeOf estimates how many bytes key and its value take. It walks the
+// whole value: only for values written whole, never per collection write.
+func sizeOf(key string, val StoreValue) int64 {
+	size := int64(keyOverhead + len(key))
+	switch val.Type {
+	case TypeString:
+		size += int64(len(val.Data))
+	case TypeList:
+		size += listItemsSize(val.List)
+	case TypeHash:
+		for field, value := range val.Hash {
+			size += hashFieldSize(field, value)
+		}
+	case TypeSet:
+		for member := range val.Set {
+			size += setMemberSize(member)
+		}
+	case TypeZSet:
+		if val.ZSet != nil {
+			for member := range val.ZSet.dict {
+				size += zsetMemberSize(member)
+			}
+		}
+	case TypeStream:
+		if val.Stream != nil {
+			size += streamEntriesSize(val.Stream.entries)
+			for _, group := range val.Stream.groups {
+				size += int64(pendingOverhead * len(group.pending))
+			}
+		}
+	}
+	return size + expirySize(val.ExpiresAt)
+}
+
+// SetMaxMemory sets the memory limit in bytes (0 removes it), the eviction
+// policy and how many keys are sampled per eviction
+func (s *InMemoryStore) SetMaxMemory(limit int64, policy EvictionPolicy, samples int) {
+	unlock := s.lockAll()
+	defer unlock()
+
+	if samples <= 0 {
+		samples = DefaultEvictionSamples
+	}
+	s.mem.policy, s.mem.samples = policy, samples
+	if limit <= 0 {
+		s.mem.max.Store(0)
+		s.mem.used.Store(0)
+		for _, sh := range s.shards {
+			sh.meta = nil
+		}
+		return
+	}
+
+	wasOff := s.mem.max.Load() == 0
+	s.mem.max.Store(limit)
+	if wasOff {
+		// Start accounting: every existing key counts as just accessed
+		s.mem.used.Store(0)
+		for _, sh := range s.shards {
+			sh.meta = make(map[string]*keyMeta, len(sh.data))
+			for key, val := range sh.data {
+				s.account(key, val)
+			}
+		}
+	}
+}
+
+// UsedMemory returns the estimated dataset size in bytes
+func (s *InMemoryStore) UsedMemory() int64 {
+	if s.mem.max.Load() > 0 {
+		return s.mem.used.Load()
+	}
+	var used int64
+	s.forEachShard(func(sh *shard) {
+		for key, val := range sh.data {
+			used += sizeOf(key, val)
+		}
+	})
+	return used
+}
+
+// FreeMemory evicts keys with the configured policy until the dataset fits
+// in limit bytes: maxmemory, or less when the databases share it. It
+// returns the evicted keys, so the caller can propagate them, and ErrOOM
+// when nothing more can be evicted. Without a memory limit (SetMaxMemory)
+// nothing is tracked and nothing is evicted.
+func (s *InMemoryStore) FreeMemory(limit int64) ([]string, error) {
+	// Checked without locks first: this runs before every write command
+	if s.mem.max.Load() == 0 || s.mem.used.Load() <= limit {
+		return nil, nil
+	}
+
+	unlock := s.lockAll()
+	defer unlock()
+
+	if s.mem.policy == NoEviction {
+		return nil, ErrOOM
+	}
+
+	var evicted []string
+	for s.mem.used.Load() > limit {
+		key, ok := s.evictionCandidate()
+		if !ok {
+			return evicted, ErrOOM
+		}
+		s.del(key)
+		s.counters.evicted.Add(1)
+		s.keyEvent("evicted", key)
+		evicted = append(evicted, key)
+	}
+	return evicted, nil
+}
+
+// Private helper - assumes every shard lock is held!
+// Like redis, compares a few keys picked at random instead of keeping
+// every key ordered: it starts at a random shard, and map iteration order
+// already is random.
+func (s *InMemoryStore) evictionCandidate() (string, bool) {
+	policy := s.mem.policy
+	now := time.Now()
+
+	best, found := "", false
+	var bestScore int64
+	sampled := 0
+	start := rand.Intn(len(s.shards))
+	for i := range s.shards {
+		sh := s.shards[(start+i)%len(s.shards)]
+		for key, val := range sh.data {
+			if policy.volatile() && val.ExpiresAt == nil {
+				continue
+			}
+			// Already expired keys are free to take
+			if val.ExpiresAt != nil && now.After(*val.ExpiresAt) {
+				return key, true
+			}
+
+			// Lower score = better candidate
+			var score int64
+			switch policy {
+			case AllKeysLRU, VolatileLRU:
+				score = sh.meta[key].lastAccess.Load()
+			case AllKeysLFU, VolatileLFU:
+				score = int64(lfuDecay(sh.meta[key], now))
+			case VolatileTTL:
+				score = val.ExpiresAt.UnixMilli()
+			case AllKeysRandom, VolatileRandom:
+				return key, true
+			}
+			if !found || score < bestScore {
+				best, bestScore, found = key, score, true
+			}
+
+			sampled++
+			if sampled >= s.mem.samples {
+				return best, found
+			}
+		}
+	}
+	return best, found
+}
+
+// Private helper - assumes the key's shard lock is held!
+// Records the new size of key after val was written whole.
+func (s *InMemoryStore) account(key string, val StoreValue) {
+	if s.shardFor(key).meta == nil {
+		return // no memory limit, don't measure
+	}
+	s.record(key, sizeOf(key, val))
+}
+
+// Private helper - assumes the key's shard lock is held!
+// Records size as the size of key, a new key counts as just accessed.
+func (s *InMemoryStore) record(key string, size int64) {
+	sh := s.shardFor(key)
+	if sh.meta == nil {
+		return // no memory limit
+	}
+	m := sh.meta[key]
+	if m == nil {
+		now := time.Now().UnixMilli()
+		m = &keyMeta{}
+		m.lastAccess.Store(now)
+		m.freq.Store(lfuInitValue)
+		m.decayedAt.Store(now)
+		sh.meta[key] = m
+	}
+	s.mem.used.Add(size - m.size)
+	m.size = size
+}
+
+// Private helper - assumes the key's shard lock is held!
+// The size recorded for key, 0 without a memory limit.
+func (s *InMemoryStore) recordedSize(key string) int64 {
+	if m := s.shardFor(key).meta[key]; m != nil {
+		return m.size
+	}
+	return 0
+}
+
+// Private helper - assumes the key's shard lock is held!
+// Records that key grew by delta bytes (shrank if negative) after a change
+// in place, without measuring it again. A key that wasn't accounted for
+// yet is new, and small: it's measured whole.
+func (s *InMemoryStore) grow(key string, val StoreValue, delta int64) {
+	sh := s.shardFor(key)
+	if sh.meta == nil {
+		return // no memory limit
+	}
+	m := sh.meta[key]
+	if m == nil {
+		s.account(key, val)
+		return
+	}
+	s.mem.used.Add(delta)
+	m.size += delta
+}
+
+// Private helper - assumes the key's shard lock is held!
+func (s *InMemoryStore) unaccount(key string) {
+	sh := s.shardFor(key)
+	if m := sh.meta[key]; m != nil {
+		s.mem.used.Add(-m.size)
+		delete(sh.meta, key)
+	}
+}
+
+// Private helper - assumes the key's shard lock is held, for reading at least!
+// Updates the LRU clock and the LFU counter of a key that was just read.
+func (s *InMemoryStore) touch(key string) {
+	m := s.shardFor(key).meta[key]
+	if m == nil {
+		return
+	}
+	now := time.Now()
+	m.lastAccess.Store(now.UnixMilli())
+	m.freq.Store(uint32(lfuIncr(lfuDecay(m, now))))
+}
+
+// lfuDecay takes one point off the counter per elapsed decay period, so
+// keys that were hot long ago cool down
+func lfuDecay(m *keyMeta, now time.Time) uint8 {
+	freq := uint8(m.freq.Load())
+	periods := (now.UnixMilli() - m.decayedAt.Load()) / lfuDecayEvery.Milliseconds()
+	if periods <= 0 {
+		return freq
+	}
+	m.decayedAt.Store(now.UnixMilli())
+	if periods >= int64(freq) {
+		freq = 0
+	} else {
+		freq -= uint8(periods)
+	}
+	m.freq.Store(uint32(freq))
+	return freq
+}
+
+// lfuIncr is redis' logarithmic counter: the higher the counter, the less
+// likely an access bumps it, so 255 covers millions of hits
+func lfuIncr(counter uint8) uint8 {
+	if counter == 255 {
+		return counter
+	}
+	base := float64(int(counter) - lfuInitValue)
+	if base < 0 {
+		base = 0
+	}
+	if rand.Float64() < 1.0/(base*lfuLogFactor+1) {
+		counter++
+	}
+	return counter
+}
@@ -0,0 +1,190 @@
+package inmemory_test
+
+import (
+	inmemory "cli-t/internal/shared/store/inmemory"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsedMemoryTracksWrites(t *testing.T) {
+	s := inmemory.New()
+	s.SetMaxMemory(1<<20, inmemory.AllKeysLRU, 0)
+	assert.Equal(t, int64(0), s.UsedMemory())
+
+	s.Set("small", str("x"))
+	small := s.UsedMemory()
+	s.Set("big", str(strings.Repeat("x", 1000)))
+	assert.Greater(t, s.UsedMemory(), small+1000)
+
+	s.Delete("big")
+	assert.Equal(t, small, s.UsedMemory())
+
+	// Lifting the limit still reports an estimate
+	s.SetMaxMemory(0, inmemory.NoEviction, 0)
+	assert.Equal(t, small, s.UsedMemory())
+}
+
+// remeasured is the used memory measured again from scratch, to compare
+// with what the writes accounted for one by one
+func remeasured(s inmemory.Store) int64 {
+	s.SetMaxMemory(0, inmemory.NoEviction, 0)
+	return s.UsedMemory()
+}
+
+func TestUsedMemoryTracksCollectionWrites(t *testing.T) {
+	s := inmemory.New()
+	s.SetMaxMemory(1<<30, inmemory.AllKeysLRU, 0)
+
+	s.RPush("list", "a", "bb", "ccc", "dddd", "a")
+	s.LPush("list", "z")
+	s.LPop("list", 1)
+	s.RPop("list", 1)
+	s.LSet("list", 0, "longer")
+	s.LInsert("list", true, "bb", "new")
+	s.LRem("list", 0, "ccc")
+	s.LPush("list", "x", "y", "z")
+	s.LTrim("list", 1, 4)
+	s.LMove("list", "other", true, false)
+
+	s.HSet("hash", map[string]string{"f1": "v1", "f2": "v2"})
+	s.HSet("hash", map[string]string{"f1": "a much longer value", "f3": "v3"})
+	s.HSetNX("hash", "f4", "v4")
+	s.HIncrBy("hash", "n", 99)
+	s.HIncrBy("hash", "n", 1)
+	s.HDel("hash", "f2", "nope")
+
+	s.SAdd("set", "a", "b", "c", "a")
+	s.SRem("set", "b")
+
+	s.ZAdd("zset", []inmemory.ZMember{{Member: "a", Score: 1}, {Member: "bb", Score: 2}}, inmemory.ZAddOptions{})
+	s.ZAdd("zset", []inmemory.ZMember{{Member: "a", Score: 3}}, inmemory.ZAddOptions{})
+	s.ZIncrBy("zset", 1, "new")
+	s.ZIncrBy("zset", 1, "a")
+	s.ZRem("zset", "bb")
+
+	for i := 0; i < 10; i++ {
+		s.XAdd("stream", "*", []string{"field", strings.Repeat("v", i)}, inmemory.XAddOptions{})
+	}
+	s.XAdd("stream", "*", []string{"f", "v"}, inmemory.XAddOptions{Trim: &inmemory.StreamTrim{MaxLen: 8}})
+	require.NoError(t, s.XGroupCreate("stream", "g", "0", false))
+	read, err := s.XReadGroup("stream", "g", "alice", inmemory.XReadGroupOptions{New: true, Count: 6})
+	require.NoError(t, err)
+	s.XAck("stream", "g", read[0].ID)
+	s.XClaim("stream", "g", "bob", 0, []inmemory.StreamID{read[1].ID, read[2].ID}, inmemory.XClaimOptions{})
+	s.XDel("stream", read[3].ID)
+	s.XClaim("stream", "g", "bob", 0, []inmemory.StreamID{read[3].ID}, inmemory.XClaimOptions{})
+	s.XTrim("stream", inmemory.StreamTrim{MaxLen: 5})
+	s.XGroupDelConsumer("stream", "g", "alice")
+	require.NoError(t, s.XGroupCreate("stream", "g2", "0", false))
+	s.XReadGroup("stream", "g2", "carol", inmemory.XReadGroupOptions{New: true})
+	s.XGroupDestroy("stream", "g")
+
+	s.SetExpiry("hash", 100)
+	s.SetExpiry("hash", 200)
+	s.SetExpiryAt("set", time.Now().Add(time.Hour))
+	s.Persist("set")
+	s.Rename("zset", "renamed-zset", false)
+	s.Copy("stream", "stream-copy", false)
+
+	used := s.UsedMemory()
+	assert.Equal(t, remeasured(s), used)
+}
+
+// BenchmarkRPushWithMaxMemory grows a list with a memory limit set: each
+// push costs the same however long the list already is
+func BenchmarkRPushWithMaxMemory(b *testing.B) {
+	s := inmemory.New()
+	s.SetMaxMemory(1<<40, inmemory.AllKeysLRU, 0)
+	for i := 0; i < b.N; i++ {
+		s.RPush("list", "item")
+	}
+}
+
+func TestFreeMemoryNoEviction(t *testing.T) {
+	s := inmemory.New()
+	s.SetMaxMemory(100, inmemory.NoEviction, 0)
+	s.Set("key", str(strings.Repeat("x", 200)))
+
+	evicted, err := s.FreeMemory(100)
+	assert.ErrorIs(t, err, inmemory.ErrOOM)
+	assert.Empty(t, evicted)
+	assert.Equal(t, 1, s.DBSize())
+}
+
+func TestFreeMemoryAllKeysLRU(t *testing.T) {
+	s := inmemory.New()
+	for i := 0; i < 10; i++ {
+		s.Set(fmt.Sprintf("key:%d", i), str(strings.Repeat("x", 100)))
+	}
+	// Enabling the limit afterwards accounts for the existing keys
+	limit := s.UsedMemory() / 2
+	s.SetMaxMemory(limit, inmemory.AllKeysLRU, 10)
+
+	// key:0 is the only one read since, so it's the most recently used
+	time.Sleep(2 * time.Millisecond)
+	s.Get("key:0")
+
+	evicted, err := s.FreeMemory(limit)
+	require.NoError(t, err)
+	assert.NotEmpty(t, evicted)
+	assert.NotContains(t, evicted, "key:0")
+	assert.LessOrEqual(t, s.UsedMemory(), limit)
+	assert.Equal(t, 1, s.Exists("key:0"))
+}
+
+func TestFreeMemoryBelowTheLimit(t *testing.T) {
+	s := inmemory.New()
+	s.SetMaxMemory(1<<20, inmemory.AllKeysRandom, 0)
+	for i := 0; i < 10; i++ {
+		s.Set(fmt.Sprintf("key:%d", i), str(strings.Repeat("x", 100)))
+	}
+
+	// Databases share maxmemory: each may have to go below it
+	target := s.UsedMemory() / 2
+	evicted, err := s.FreeMemory(target)
+	require.NoError(t, err)
+	assert.NotEmpty(t, evicted)
+	assert.LessOrEqual(t, s.UsedMemory(), target)
+
+	// The store's own limit didn't move
+	evicted, err = s.FreeMemory(1 << 20)
+	require.NoError(t, err)
+	assert.Empty(t, evicted)
+}
+
+func TestFreeMemoryVolatile(t *testing.T) {
+	s := inmemory.New()
+	s.Set("persistent", str(strings.Repeat("x", 500)))
+	s.Set("soon", str("a"))
+	s.Set("later", str("b"))
+	s.SetExpiry("soon", 10)
+	s.SetExpiry("later", 100)
+	limit := s.UsedMemory() - 1
+	s.SetMaxMemory(limit, inmemory.VolatileTTL, 10)
+
+	// The key closest to expiring goes first, keys without a TTL never do
+	evicted, err := s.FreeMemory(limit)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"soon"}, evicted)
+
+	s.SetMaxMemory(0, inmemory.VolatileTTL, 10)
+	s.SetMaxMemory(100, inmemory.VolatileLRU, 10)
+	evicted, err = s.FreeMemory(100)
+	assert.ErrorIs(t, err, inmemory.ErrOOM)
+	assert.Equal(t, []string{"later"}, evicted)
+	assert.Equal(t, 1, s.Exists("persistent"))
+}
+
+func TestParseEvictionPolicy(t *testing.T) {
+	policy, err := inmemory.ParseEvictionPolicy("ALLKEYS-LFU")
+	require.NoError(t, err)
+	assert.Equal(t, inmemory.AllKeysLFU, policy)
+
+	_, err = inmemory.ParseEvictionPolicy("lru")
+	assert.Error(t, err)
+}
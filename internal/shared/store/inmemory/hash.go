@@ -0,0 +1,243 @@
+package inmemory
+
+import (
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Private helper - assumes lock is already held!
+// Returns the hash stored at key, nil if the key doesn't exist.
+func (s *InMemoryStore) getHash(key string) (map[string]string, error) {
+	val, exists := s.getIfValid(key)
+	if !exists {
+		return nil, nil
+	}
+	if val.Type != TypeHash {
+		return nil, ErrWrongType
+	}
+	return val.Hash, nil
+}
+
+// HSet sets the given fields, creating the hash if needed.
+// Returns the number of fields that were newly added (not updated).
+func (s *InMemoryStore) HSet(key string, fields map[string]string) (int64, error) {
+	unlock := s.lock(key)
+	defer unlock()
+
+	val, exists := s.getIfValid(key)
+	if exists && val.Type != TypeHash {
+		return 0, ErrWrongType
+	}
+	if !exists {
+		val = StoreValue{Type: TypeHash, Hash: make(map[string]string, len(fields))}
+	}
+
+	var added, delta int64
+	for field, value := range fields {
+		if old, ok := val.Hash[field]; ok {
+			delta += int64(len(value) - len(old))
+		} else {
+			added++
+			delta += hashFieldSize(field, value)
+		}
+		val.Hash[field] = value
+	}
+
+	s.update(key, val, delta)
+	s.keyEvent("hset", key)
+	return added, nil
+}
+
+// HSetNX sets field only if it doesn't exist yet. Returns true if it was set.
+func (s *InMemoryStore) HSetNX(key, field, value string) (bool, error) {
+	unlock := s.lock(key)
+	defer unlock()
+
+	val, exists := s.getIfValid(key)
+	if exists && val.Type != TypeHash {
+		return false, ErrWrongType
+	}
+	if !exists {
+		val = StoreValue{Type: TypeHash, Hash: make(map[string]string, 1)}
+	}
+
+	if _, ok := val.Hash[field]; ok {
+		return false, nil
+	}
+
+	val.Hash[field] = value
+	s.update(key, val, hashFieldSize(field, value))
+	s.keyEvent("hset", key)
+	return true, nil
+}
+
+// HGet returns (value, true) if the field exists
+func (s *InMemoryStore) HGet(key, field string) (string, bool, error) {
+	unlock := s.rlock(key)
+	defer unlock()
+
+	hash, err := s.getHash(key)
+	if err != nil {
+		return "", false, err
+	}
+
+	value, ok := hash[field] // nil map lookup is fine
+	return value, ok, nil
+}
+
+// HGetAll returns a copy of the whole hash (empty map for missing keys)
+func (s *InMemoryStore) HGetAll(key string) (map[string]string, error) {
+	unlock := s.rlock(key)
+	defer unlock()
+
+	hash, err := s.getHash(key)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string, len(hash))
+	for field, value := range hash {
+		result[field] = value
+	}
+	return result, nil
+}
+
+// HDel removes fields and deletes the key once the hash is empty.
+// Returns the number of fields removed.
+func (s *InMemoryStore) HDel(key string, fields ...string) (int64, error) {
+	unlock := s.lock(key)
+	defer unlock()
+
+	val, exists := s.getIfValid(key)
+	if !exists {
+		return 0, nil
+	}
+	if val.Type != TypeHash {
+		return 0, ErrWrongType
+	}
+
+	var removed, delta int64
+	for _, field := range fields {
+		if value, ok := val.Hash[field]; ok {
+			delete(val.Hash, field)
+			removed++
+			delta -= hashFieldSize(field, value)
+		}
+	}
+
+	// Redis never keeps empty aggregates around
+	if removed == 0 {
+		return 0, nil
+	}
+	if len(val.Hash) == 0 {
+		s.del(key)
+		s.keyEvent("hdel", key)
+		s.keyEvent("del", key)
+	} else {
+		s.update(key, val, delta)
+		s.keyEvent("hdel", key)
+	}
+	return removed, nil
+}
+
+// HIncrBy adds delta to the integer stored in field (missing field = 0)
+func (s *InMemoryStore) HIncrBy(key, field string, delta int64) (int64, error) {
+	unlock := s.lock(key)
+	defer unlock()
+
+	val, exists := s.getIfValid(key)
+	if exists && val.Type != TypeHash {
+		return 0, ErrWrongType
+	}
+	if !exists {
+		val = StoreValue{Type: TypeHash, Hash: make(map[string]string, 1)}
+	}
+
+	var current int64
+	raw, found := val.Hash[field]
+	if found {
+		num, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return 0, ErrHashNotInt
+		}
+		current = num
+	}
+
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return 0, ErrIncrOverflow
+	}
+
+	newValue := current + delta
+	val.Hash[field] = strconv.FormatInt(newValue, 10)
+	grown := hashFieldSize(field, val.Hash[field])
+	if found {
+		grown -= hashFieldSize(field, raw)
+	}
+	s.update(key, val, grown)
+	s.keyEvent("hincrby", key)
+	return newValue, nil
+}
+
+// HKeys returns field names sorted, so HKEYS/HVALS/HGETALL line up
+func (s *InMemoryStore) HKeys(key string) ([]string, error) {
+	unlock := s.rlock(key)
+	defer unlock()
+
+	hash, err := s.getHash(key)
+	if err != nil {
+		return nil, err
+	}
+	return sortedFields(hash), nil
+}
+
+// HVals returns values in the same order as HKeys
+func (s *InMemoryStore) HVals(key string) ([]string, error) {
+	unlock := s.rlock(key)
+	defer unlock()
+
+	hash, err := s.getHash(key)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := sortedFields(hash)
+	values := make([]string, len(fields))
+	for i, field := range fields {
+		values[i] = hash[field]
+	}
+	return values, nil
+}
+
+func (s *InMemoryStore) HLen(key string) (int64, error) {
+	unlock := s.rlock(key)
+	defer unlock()
+
+	hash, err := s.getHash(key)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(hash)), nil
+}
+
+func (s *InMemoryStore) HExists(key, field string) (bool, error) {
+	unlock := s.rlock(key)
+	defer unlock()
+
+	hash, err := s.getHash(key)
+	if err != nil {
+		return false, err
+	}
+	_, ok := hash[field]
+	return ok, nil
+}
+
+// Go maps iterate randomly; sort so replies are stable between calls
+func sortedFields(hash map[string]string) []string {
+	fields := make([]string, 0, len(hash))
+	for field := range hash {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
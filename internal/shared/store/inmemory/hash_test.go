@@ -0,0 +1,99 @@
+package inmemory_test
+
+import (
+	inmemory "cli-t/internal/shared/store/inmemory"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHSetAndGet(t *testing.T) {
+	s := inmemory.New()
+
+	added, err := s.HSet("user:1", map[string]string{"name": "ada", "age": "36"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), added)
+
+	// Updating an existing field doesn't count as added
+	added, err = s.HSet("user:1", map[string]string{"age": "37", "city": "london"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), added)
+
+	value, found, err := s.HGet("user:1", "age")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "37", value)
+
+	_, found, err = s.HGet("user:1", "missing")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	all, err := s.HGetAll("user:1")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"name": "ada", "age": "37", "city": "london"}, all)
+
+	keys, err := s.HKeys("user:1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"age", "city", "name"}, keys)
+
+	vals, err := s.HVals("user:1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"37", "london", "ada"}, vals)
+
+	length, err := s.HLen("user:1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), length)
+}
+
+func TestHDelRemovesEmptyHash(t *testing.T) {
+	s := inmemory.New()
+	s.HSet("h", map[string]string{"a": "1", "b": "2"})
+
+	removed, err := s.HDel("h", "a", "nope")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), removed)
+	assert.Equal(t, 1, s.Exists("h"))
+
+	removed, err = s.HDel("h", "b")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), removed)
+	assert.Equal(t, 0, s.Exists("h"), "empty hash should be deleted")
+}
+
+func TestHIncrBy(t *testing.T) {
+	s := inmemory.New()
+
+	n, err := s.HIncrBy("counters", "hits", 5)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+
+	n, err = s.HIncrBy("counters", "hits", -7)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-2), n)
+
+	s.HSet("counters", map[string]string{"name": "abc"})
+	_, err = s.HIncrBy("counters", "name", 1)
+	assert.Equal(t, inmemory.ErrHashNotInt, err)
+
+	s.HSet("counters", map[string]string{"big": "9223372036854775807"})
+	_, err = s.HIncrBy("counters", "big", 1)
+	assert.Equal(t, inmemory.ErrIncrOverflow, err)
+}
+
+func TestHashWrongType(t *testing.T) {
+	s := inmemory.New()
+	s.Set("str", inmemory.StoreValue{Type: inmemory.TypeString, Data: "x"})
+
+	_, err := s.HSet("str", map[string]string{"f": "v"})
+	assert.Equal(t, inmemory.ErrWrongType, err)
+
+	_, _, err = s.HGet("str", "f")
+	assert.Equal(t, inmemory.ErrWrongType, err)
+
+	_, err = s.HLen("str")
+	assert.Equal(t, inmemory.ErrWrongType, err)
+
+	_, err = s.LPush("str", "a")
+	assert.Equal(t, inmemory.ErrWrongType, err)
+}
@@ -0,0 +1,248 @@
+package inmemory
+
+import (
+	"cli-t/internal/shared/glob"
+
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Calls fn for every key that hasn't expired (without deleting expired ones,
+// so it is safe to use while iterating the map). Takes the shard locks one
+// after the other, fn must not call back into the store.
+func (s *InMemoryStore) forEachLive(fn func(key string, val StoreValue)) {
+	now := time.Now()
+	s.forEachShard(func(sh *shard) {
+		for key, val := range sh.data {
+			if val.ExpiresAt != nil && now.After(*val.ExpiresAt) {
+				continue
+			}
+			fn(key, val)
+		}
+	})
+}
+
+// Keys returns every key matching the glob pattern, sorted
+func (s *InMemoryStore) Keys(pattern string) []string {
+	keys := []string{}
+	s.forEachLive(func(key string, _ StoreValue) {
+		if pattern == "*" || glob.Match(pattern, key) {
+			keys = append(keys, key)
+		}
+	})
+	sort.Strings(keys)
+	return keys
+}
+
+// ScanOptions are the SCAN filters. They are applied after the keys for a
+// step were picked, so a step may return fewer than Count keys (like redis).
+type ScanOptions struct {
+	Match string    // glob pattern, "" = everything
+	Count int       // keys examined per step
+	Type  ValueType // "" = any type
+}
+
+// Scan returns one step of a cursor iteration and the cursor for the next
+// step (0 once the iteration is complete).
+//
+// The cursor is a position in the order SCAN walks the keys in: shard by
+// shard, and within a shard by the hash that placed the key there (see
+// shard.order). The upper 32 bits are the shard, the lower 32 the hash. A
+// key's position never changes, so keys present during the whole iteration
+// are returned exactly once no matter how the keyspace is mutated in
+// between, which is the same guarantee redis gives. A step finds where it
+// starts in O(log n) and then only looks at the Count keys it returns.
+func (s *InMemoryStore) Scan(cursor uint64, opts ScanOptions) ([]string, uint64) {
+	count := opts.Count
+	if count <= 0 {
+		count = 10
+	}
+
+	now := time.Now()
+	keys := []string{}
+	examined := 0
+	for index, from := cursor>>32, uint32(cursor); index < uint64(len(s.shards)); index, from = index+1, 0 {
+		if examined >= count {
+			return keys, index << 32 // the previous shard ended with the step
+		}
+
+		sh := s.shards[index]
+		sh.mu.RLock()
+
+		// Keys sharing the last hash all come in this step: the next
+		// cursor starts after it
+		node := sh.order.firstInRange(ScoreBound{Value: float64(from)}, ScoreBound{Value: math.MaxUint32})
+		var last float64
+		for ; node != nil && (examined < count || node.score == last); node = node.level[0].forward {
+			examined++
+			last = node.score
+
+			key, val := node.member, sh.data[node.member]
+			if val.ExpiresAt != nil && now.After(*val.ExpiresAt) {
+				continue
+			}
+			if opts.Match != "" && !glob.Match(opts.Match, key) {
+				continue
+			}
+			if opts.Type != "" && val.Type != opts.Type {
+				continue
+			}
+			keys = append(keys, key)
+		}
+		sh.mu.RUnlock()
+
+		if node != nil {
+			return keys, nextScanCursor(index, uint32(last), len(s.shards))
+		}
+	}
+	return keys, 0
+}
+
+// nextScanCursor is where the step after one that stopped at hash last of
+// shard index starts. After the biggest hash comes the next shard: adding
+// one would carry into the shard bits.
+func nextScanCursor(index uint64, last uint32, shards int) uint64 {
+	if last < math.MaxUint32 {
+		return index<<32 | uint64(last+1)
+	}
+	if index+1 >= uint64(shards) {
+		return 0
+	}
+	return (index + 1) << 32
+}
+
+// Type returns the type of the value at key, false if it doesn't exist
+func (s *InMemoryStore) Type(key string) (ValueType, bool) {
+	unlock := s.rlock(key)
+	defer unlock()
+
+	val, exists := s.getIfValid(key)
+	return val.Type, exists
+}
+
+// Rename moves src to dst, overwriting dst unless nx is set.
+// Returns false when nx prevented the rename.
+func (s *InMemoryStore) Rename(src, dst string, nx bool) (bool, error) {
+	unlock := s.lockKeys(src, dst)
+	defer unlock()
+
+	val, exists := s.getIfValid(src)
+	if !exists {
+		return false, ErrNoSuchKey
+	}
+	if _, taken := s.getIfValid(dst); taken && nx {
+		return false, nil
+	}
+	if src == dst {
+		return !nx, nil
+	}
+
+	size := s.recordedSize(src) + int64(len(dst)-len(src)) // only the name changes
+	s.del(src)
+	s.setSized(dst, val, size)
+	s.keyEvent("rename_from", src)
+	s.keyEvent("rename_to", dst)
+	return true, nil
+}
+
+// Copy copies src (value and TTL) to dst.
+// Returns false if src is missing or dst exists and replace isn't set.
+func (s *InMemoryStore) Copy(src, dst string, replace bool) bool {
+	unlock := s.lockKeys(src, dst)
+	defer unlock()
+
+	val, exists := s.getIfValid(src)
+	if !exists {
+		return false
+	}
+	if _, taken := s.getIfValid(dst); taken && !replace {
+		return false
+	}
+
+	s.setSized(dst, val.Clone(), s.recordedSize(src)+int64(len(dst)-len(src)))
+	s.keyEvent("copy_to", dst)
+	return true
+}
+
+// Persist removes the expiry. Returns false if the key is missing or has none.
+func (s *InMemoryStore) Persist(key string) bool {
+	unlock := s.lock(key)
+	defer unlock()
+
+	val, exists := s.getIfValid(key)
+	if !exists || val.ExpiresAt == nil {
+		return false
+	}
+
+	val.ExpiresAt = nil
+	s.update(key, val, -expiryOverhead)
+	s.keyEvent("persist", key)
+	return true
+}
+
+// GetPTTL is GetTTL in milliseconds (-2 missing, -1 no expiry)
+func (s *InMemoryStore) GetPTTL(key string) int64 {
+	unlock := s.rlock(key)
+	defer unlock()
+
+	val, exists := s.getIfValid(key)
+	if !exists {
+		return -2
+	}
+	if val.ExpiresAt == nil {
+		return -1
+	}
+	return max(time.Until(*val.ExpiresAt).Milliseconds(), 0)
+}
+
+// RandomKey returns a random live key, false if the store is empty
+func (s *InMemoryStore) RandomKey() (string, bool) {
+	// Start at a random shard, then map iteration order is random too:
+	// take the first live key
+	start := rand.Intn(len(s.shards))
+	for i := range s.shards {
+		if key, found := s.randomKeyIn(s.shards[(start+i)%len(s.shards)]); found {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+func (s *InMemoryStore) randomKeyIn(sh *shard) (string, bool) {
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	now := time.Now()
+	for key, val := range sh.data {
+		if val.ExpiresAt == nil || !now.After(*val.ExpiresAt) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// DBSize returns the number of live keys
+func (s *InMemoryStore) DBSize() int {
+	size := 0
+	s.forEachLive(func(string, StoreValue) { size++ })
+	return size
+}
+
+// Flush deletes every key
+func (s *InMemoryStore) Flush() {
+	unlock := s.lockAll()
+	defer unlock()
+
+	s.clear()
+}
+
+// Private helper - assumes every shard lock is held!
+func (s *InMemoryStore) clear() {
+	for _, sh := range s.shards {
+		for key := range sh.data {
+			s.del(key)
+		}
+	}
+}
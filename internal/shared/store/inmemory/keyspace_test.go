@@ -0,0 +1,167 @@
+package inmemory_test
+
+import (
+	inmemory "cli-t/internal/shared/store/inmemory"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func str(value string) inmemory.StoreValue {
+	return inmemory.StoreValue{Type: inmemory.TypeString, Data: value}
+}
+
+func TestKeysAndTypes(t *testing.T) {
+	s := inmemory.New()
+	s.Set("user:1", str("a"))
+	s.Set("user:2", str("b"))
+	s.Set("other", str("c"))
+	s.SAdd("tags", "x")
+
+	assert.Equal(t, []string{"user:1", "user:2"}, s.Keys("user:*"))
+	assert.Len(t, s.Keys("*"), 4)
+	assert.Equal(t, 4, s.DBSize())
+
+	typ, exists := s.Type("tags")
+	assert.True(t, exists)
+	assert.Equal(t, inmemory.TypeSet, typ)
+	_, exists = s.Type("missing")
+	assert.False(t, exists)
+
+	key, found := s.RandomKey()
+	assert.True(t, found)
+	assert.Contains(t, []string{"user:1", "user:2", "other", "tags"}, key)
+
+	s.Flush()
+	assert.Equal(t, 0, s.DBSize())
+	_, found = s.RandomKey()
+	assert.False(t, found)
+}
+
+func TestScanVisitsEveryKeyOnceWhileMutating(t *testing.T) {
+	s := inmemory.New()
+	for i := 0; i < 500; i++ {
+		s.Set(fmt.Sprintf("key:%d", i), str("v"))
+	}
+
+	seen := map[string]int{}
+	var cursor uint64
+	step := 0
+	for {
+		keys, next := s.Scan(cursor, inmemory.ScanOptions{Count: 20})
+		for _, key := range keys {
+			seen[key]++
+		}
+
+		// Mutate between steps: add new keys, delete some never-returned ones
+		s.Set(fmt.Sprintf("new:%d", step), str("v"))
+		step++
+
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+
+	for i := 0; i < 500; i++ {
+		assert.Equal(t, 1, seen[fmt.Sprintf("key:%d", i)], "key:%d", i)
+	}
+}
+
+func TestScanStepsReturnCountKeys(t *testing.T) {
+	s := inmemory.New()
+	for i := 0; i < 1000; i++ {
+		s.Set(fmt.Sprintf("key:%d", i), str("v"))
+	}
+
+	// Each step carries on from the cursor, it doesn't start over
+	steps, total := 0, 0
+	var cursor uint64
+	for {
+		keys, next := s.Scan(cursor, inmemory.ScanOptions{Count: 10})
+		steps++
+		total += len(keys)
+		if next == 0 {
+			break
+		}
+		assert.GreaterOrEqual(t, len(keys), 10)
+		cursor = next
+	}
+	assert.Equal(t, 1000, total)
+	assert.LessOrEqual(t, steps, 101)
+}
+
+func TestScanFromTheEndOfAShard(t *testing.T) {
+	s := inmemory.New()
+	for i := 0; i < 1000; i++ {
+		s.Set(fmt.Sprintf("key:%d", i), str("v"))
+	}
+
+	// A cursor at the biggest hash of shard 1 goes on with the shards after it
+	cursor := uint64(1)<<32 | math.MaxUint32
+	seen := 0
+	for steps := 0; ; steps++ {
+		require.Less(t, steps, 1000, "the iteration must end")
+		keys, next := s.Scan(cursor, inmemory.ScanOptions{Count: 10})
+		seen += len(keys)
+		if next == 0 {
+			break
+		}
+		assert.Greater(t, next, cursor)
+		cursor = next
+	}
+	assert.Greater(t, seen, 900)
+	assert.Less(t, seen, 1000)
+}
+
+func TestScanFilters(t *testing.T) {
+	s := inmemory.New()
+	s.Set("a:1", str("v"))
+	s.Set("b:1", str("v"))
+	s.SAdd("a:set", "x")
+
+	keys, next := s.Scan(0, inmemory.ScanOptions{Count: 100, Match: "a:*"})
+	assert.Equal(t, uint64(0), next)
+	assert.ElementsMatch(t, []string{"a:1", "a:set"}, keys)
+
+	keys, _ = s.Scan(0, inmemory.ScanOptions{Count: 100, Type: inmemory.TypeSet})
+	assert.Equal(t, []string{"a:set"}, keys)
+}
+
+func TestRenameCopyPersist(t *testing.T) {
+	s := inmemory.New()
+	s.Set("src", str("v"))
+	s.SetExpiry("src", 100)
+
+	renamed, err := s.Rename("src", "dst", false)
+	require.NoError(t, err)
+	assert.True(t, renamed)
+	assert.Equal(t, 0, s.Exists("src"))
+	assert.Greater(t, s.GetTTL("dst"), int64(0), "rename keeps the TTL")
+
+	_, err = s.Rename("missing", "x", false)
+	assert.Equal(t, inmemory.ErrNoSuchKey, err)
+
+	s.Set("taken", str("t"))
+	renamed, _ = s.Rename("dst", "taken", true)
+	assert.False(t, renamed)
+
+	// Copies are independent
+	s.HSet("h", map[string]string{"f": "v"})
+	assert.True(t, s.Copy("h", "h2", false))
+	assert.False(t, s.Copy("h", "h2", false))
+	s.HSet("h2", map[string]string{"f": "changed"})
+	value, _, _ := s.HGet("h", "f")
+	assert.Equal(t, "v", value)
+
+	assert.True(t, s.Persist("dst"))
+	assert.False(t, s.Persist("dst"))
+	assert.Equal(t, int64(-1), s.GetPTTL("dst"))
+
+	s.SetExpiryAt("dst", time.Now().Add(time.Minute))
+	assert.InDelta(t, 60000, s.GetPTTL("dst"), 1000)
+}
@@ -0,0 +1,299 @@
+package inmemory
+
+import "errors"
+
+var (
+	ErrNoSuchKey       = errors.New("ERR no such key")
+	ErrIndexOutOfRange = errors.New("ERR index out of range")
+)
+
+// Private helper - assumes lock is already held!
+// Returns the list stored at key, nil if the key doesn't exist.
+func (s *InMemoryStore) getList(key string) ([]string, error) {
+	val, exists := s.getIfValid(key)
+	if !exists {
+		return nil, nil
+	}
+	if val.Type != TypeList {
+		return nil, ErrWrongType
+	}
+	return val.List, nil
+}
+
+// Private helper - assumes lock is already held!
+// Stores list under key keeping its TTL and reports event; an empty list
+// deletes the key, which is reported as "del" too. delta is how many bytes
+// the change added, see update.
+func (s *InMemoryStore) putList(key string, list []string, delta int64, event string) {
+	if len(list) == 0 {
+		s.del(key)
+		s.keyEvent(event, key)
+		s.keyEvent("del", key)
+		return
+	}
+
+	val, exists := s.getIfValid(key)
+	if !exists {
+		val = StoreValue{Type: TypeList}
+	}
+	val.List = list
+	s.update(key, val, delta)
+	s.keyEvent(event, key)
+}
+
+// normalizeIndex turns a possibly negative index into a slice index
+func normalizeIndex(index, length int) (int, bool) {
+	if index < 0 {
+		index += length
+	}
+	return index, index >= 0 && index < length
+}
+
+// LPop removes and returns up to count elements from the head
+func (s *InMemoryStore) LPop(key string, count int) ([]string, error) {
+	return s.pop(key, count, true)
+}
+
+// RPop removes and returns up to count elements from the tail
+func (s *InMemoryStore) RPop(key string, count int) ([]string, error) {
+	return s.pop(key, count, false)
+}
+
+// popEvent and pushEvent name the keyspace event of either end of a list
+func popEvent(left bool) string {
+	if left {
+		return "lpop"
+	}
+	return "rpop"
+}
+
+func pushEvent(left bool) string {
+	if left {
+		return "lpush"
+	}
+	return "rpush"
+}
+
+func (s *InMemoryStore) pop(key string, count int, left bool) ([]string, error) {
+	unlock := s.lock(key)
+	defer unlock()
+
+	list, err := s.getList(key)
+	if err != nil || list == nil {
+		return nil, err
+	}
+
+	count = min(count, len(list))
+	popped := make([]string, count)
+	if left {
+		copy(popped, list[:count])
+		list = list[count:]
+	} else {
+		for i := 0; i < count; i++ {
+			popped[i] = list[len(list)-1-i]
+		}
+		list = list[:len(list)-count]
+	}
+
+	if count > 0 {
+		s.putList(key, list, -listItemsSize(popped), popEvent(left))
+	}
+	return popped, nil
+}
+
+func (s *InMemoryStore) LLen(key string) (int64, error) {
+	unlock := s.rlock(key)
+	defer unlock()
+
+	list, err := s.getList(key)
+	return int64(len(list)), err
+}
+
+// LIndex returns (element, true) if index is inside the list
+func (s *InMemoryStore) LIndex(key string, index int) (string, bool, error) {
+	unlock := s.rlock(key)
+	defer unlock()
+
+	list, err := s.getList(key)
+	if err != nil {
+		return "", false, err
+	}
+
+	index, ok := normalizeIndex(index, len(list))
+	if !ok {
+		return "", false, nil
+	}
+	return list[index], true, nil
+}
+
+// LSet overwrites the element at index
+func (s *InMemoryStore) LSet(key string, index int, value string) error {
+	unlock := s.lock(key)
+	defer unlock()
+
+	list, err := s.getList(key)
+	if err != nil {
+		return err
+	}
+	if list == nil {
+		return ErrNoSuchKey
+	}
+
+	index, ok := normalizeIndex(index, len(list))
+	if !ok {
+		return ErrIndexOutOfRange
+	}
+
+	updated := append([]string(nil), list...)
+	updated[index] = value
+	s.putList(key, updated, listItemSize(value)-listItemSize(list[index]), "lset")
+	return nil
+}
+
+// LRem removes elements equal to value: the first count of them from the
+// head (count > 0), from the tail (count < 0) or all of them (count == 0)
+func (s *InMemoryStore) LRem(key string, count int, value string) (int64, error) {
+	unlock := s.lock(key)
+	defer unlock()
+
+	list, err := s.getList(key)
+	if err != nil || list == nil {
+		return 0, err
+	}
+
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+
+	remove := make([]bool, len(list))
+	removed := 0
+	for i := range list {
+		// Walk from the tail for negative counts
+		j := i
+		if count < 0 {
+			j = len(list) - 1 - i
+		}
+		if list[j] == value {
+			remove[j] = true
+			removed++
+			if limit > 0 && removed == limit {
+				break
+			}
+		}
+	}
+
+	if removed == 0 {
+		return 0, nil
+	}
+
+	kept := make([]string, 0, len(list)-removed)
+	for i, item := range list {
+		if !remove[i] {
+			kept = append(kept, item)
+		}
+	}
+	s.putList(key, kept, -int64(removed)*listItemSize(value), "lrem")
+	return int64(removed), nil
+}
+
+// LTrim keeps only the elements between start and stop (inclusive)
+func (s *InMemoryStore) LTrim(key string, start, stop int) error {
+	unlock := s.lock(key)
+	defer unlock()
+
+	list, err := s.getList(key)
+	if err != nil || list == nil {
+		return err
+	}
+
+	length := len(list)
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+
+	if start > stop {
+		s.putList(key, nil, 0, "ltrim")
+		return nil
+	}
+	if start == 0 && stop == length-1 {
+		return nil // nothing to trim
+	}
+
+	dropped := listItemsSize(list[:start]) + listItemsSize(list[stop+1:])
+	s.putList(key, append([]string(nil), list[start:stop+1]...), -dropped, "ltrim")
+	return nil
+}
+
+// LInsert inserts value before or after the first pivot.
+// Returns the new length, -1 if pivot wasn't found, 0 if the key is missing.
+func (s *InMemoryStore) LInsert(key string, before bool, pivot, value string) (int64, error) {
+	unlock := s.lock(key)
+	defer unlock()
+
+	list, err := s.getList(key)
+	if err != nil || list == nil {
+		return 0, err
+	}
+
+	for i, item := range list {
+		if item != pivot {
+			continue
+		}
+
+		at := i
+		if !before {
+			at = i + 1
+		}
+		updated := make([]string, 0, len(list)+1)
+		updated = append(updated, list[:at]...)
+		updated = append(updated, value)
+		updated = append(updated, list[at:]...)
+		s.putList(key, updated, listItemSize(value), "linsert")
+		return int64(len(updated)), nil
+	}
+	return -1, nil
+}
+
+// LMove atomically pops from one end of src and pushes to one end of dst.
+// Returns (element, true) when src had something to move.
+func (s *InMemoryStore) LMove(src, dst string, fromLeft, toLeft bool) (string, bool, error) {
+	unlock := s.lockKeys(src, dst)
+	defer unlock()
+
+	list, err := s.getList(src)
+	if err != nil || list == nil {
+		return "", false, err
+	}
+
+	// Check dst before touching src, so a WRONGTYPE dst moves nothing
+	if _, err := s.getList(dst); err != nil {
+		return "", false, err
+	}
+
+	var element string
+	if fromLeft {
+		element, list = list[0], list[1:]
+	} else {
+		element, list = list[len(list)-1], list[:len(list)-1]
+	}
+	s.putList(src, list, -listItemSize(element), popEvent(fromLeft))
+
+	target, _ := s.getList(dst) // re-read, src and dst may be the same key
+	if toLeft {
+		target = append([]string{element}, target...)
+	} else {
+		target = append(append([]string(nil), target...), element)
+	}
+	s.putList(dst, target, listItemSize(element), pushEvent(toLeft))
+	return element, true, nil
+}
@@ -0,0 +1,105 @@
+package inmemory_test
+
+import (
+	inmemory "cli-t/internal/shared/store/inmemory"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListPushOrder(t *testing.T) {
+	s := inmemory.New()
+
+	s.LPush("l", "a", "b", "c")
+	s.RPush("l", "d", "e")
+
+	list, _ := s.LRange("l", 0, -1)
+	assert.Equal(t, []string{"c", "b", "a", "d", "e"}, list)
+}
+
+func TestListPopIndexSet(t *testing.T) {
+	s := inmemory.New()
+	s.RPush("l", "a", "b", "c", "d")
+
+	popped, err := s.LPop("l", 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, popped)
+
+	popped, _ = s.RPop("l", 2)
+	assert.Equal(t, []string{"d", "c"}, popped)
+
+	length, _ := s.LLen("l")
+	assert.Equal(t, int64(1), length)
+
+	element, found, _ := s.LIndex("l", -1)
+	assert.True(t, found)
+	assert.Equal(t, "b", element)
+	_, found, _ = s.LIndex("l", 5)
+	assert.False(t, found)
+
+	assert.NoError(t, s.LSet("l", 0, "B"))
+	assert.Equal(t, inmemory.ErrIndexOutOfRange, s.LSet("l", 3, "x"))
+	assert.Equal(t, inmemory.ErrNoSuchKey, s.LSet("missing", 0, "x"))
+
+	// Popping the last element deletes the key
+	s.LPop("l", 10)
+	assert.Equal(t, 0, s.Exists("l"))
+
+	popped, _ = s.LPop("missing", 1)
+	assert.Nil(t, popped)
+}
+
+func TestListRemTrimInsert(t *testing.T) {
+	s := inmemory.New()
+	s.RPush("l", "x", "a", "x", "b", "x")
+
+	removed, _ := s.LRem("l", -2, "x")
+	assert.Equal(t, int64(2), removed)
+	list, _ := s.LRange("l", 0, -1)
+	assert.Equal(t, []string{"x", "a", "b"}, list)
+
+	removed, _ = s.LRem("l", 0, "x")
+	assert.Equal(t, int64(1), removed)
+
+	length, _ := s.LInsert("l", true, "b", "mid")
+	assert.Equal(t, int64(3), length)
+	length, _ = s.LInsert("l", false, "b", "end")
+	assert.Equal(t, int64(4), length)
+	length, _ = s.LInsert("l", false, "nope", "x")
+	assert.Equal(t, int64(-1), length)
+	list, _ = s.LRange("l", 0, -1)
+	assert.Equal(t, []string{"a", "mid", "b", "end"}, list)
+
+	require.NoError(t, s.LTrim("l", 1, -2))
+	list, _ = s.LRange("l", 0, -1)
+	assert.Equal(t, []string{"mid", "b"}, list)
+
+	require.NoError(t, s.LTrim("l", 5, 10))
+	assert.Equal(t, 0, s.Exists("l"))
+}
+
+func TestListMove(t *testing.T) {
+	s := inmemory.New()
+	s.RPush("src", "a", "b", "c")
+
+	element, moved, err := s.LMove("src", "dst", true, false)
+	require.NoError(t, err)
+	assert.True(t, moved)
+	assert.Equal(t, "a", element)
+
+	// Same key rotates
+	s.LMove("src", "src", false, true)
+	list, _ := s.LRange("src", 0, -1)
+	assert.Equal(t, []string{"c", "b"}, list)
+
+	// WRONGTYPE destination leaves the source untouched
+	s.Set("str", inmemory.StoreValue{Type: inmemory.TypeString, Data: "x"})
+	_, _, err = s.LMove("src", "str", true, true)
+	assert.Equal(t, inmemory.ErrWrongType, err)
+	length, _ := s.LLen("src")
+	assert.Equal(t, int64(2), length)
+
+	_, moved, _ = s.LMove("missing", "dst", true, true)
+	assert.False(t, moved)
+}
@@ -0,0 +1,18 @@
+package inmemory
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextScanCursor(t *testing.T) {
+	assert.Equal(t, uint64(3)<<32|8, nextScanCursor(3, 7, 32))
+
+	// The biggest hash of a shard: on to the next one, odd or even,
+	// never back to the start of the same shard
+	assert.Equal(t, uint64(4)<<32, nextScanCursor(3, math.MaxUint32, 32))
+	assert.Equal(t, uint64(5)<<32, nextScanCursor(4, math.MaxUint32, 32))
+	assert.Equal(t, uint64(0), nextScanCursor(31, math.MaxUint32, 32), "past the last shard")
+}
@@ -0,0 +1,218 @@
+package inmemory
+
+import "sort"
+
+// Private helper - assumes lock is already held!
+// Returns the set stored at key, nil if the key doesn't exist.
+func (s *InMemoryStore) getSet(key string) (map[string]struct{}, error) {
+	val, exists := s.getIfValid(key)
+	if !exists {
+		return nil, nil
+	}
+	if val.Type != TypeSet {
+		return nil, ErrWrongType
+	}
+	return val.Set, nil
+}
+
+// SAdd adds members, creating the set if needed.
+// Returns the number of members that weren't already present.
+func (s *InMemoryStore) SAdd(key string, members ...string) (int64, error) {
+	unlock := s.lock(key)
+	defer unlock()
+
+	val, exists := s.getIfValid(key)
+	if exists && val.Type != TypeSet {
+		return 0, ErrWrongType
+	}
+	if !exists {
+		val = StoreValue{Type: TypeSet, Set: make(map[string]struct{}, len(members))}
+	}
+
+	var added, delta int64
+	for _, member := range members {
+		if _, ok := val.Set[member]; !ok {
+			val.Set[member] = struct{}{}
+			added++
+			delta += setMemberSize(member)
+		}
+	}
+
+	if added > 0 {
+		s.update(key, val, delta)
+		s.keyEvent("sadd", key)
+	}
+	return added, nil
+}
+
+// SRem removes members and deletes the key once the set is empty
+func (s *InMemoryStore) SRem(key string, members ...string) (int64, error) {
+	unlock := s.lock(key)
+	defer unlock()
+
+	val, exists := s.getIfValid(key)
+	if !exists {
+		return 0, nil
+	}
+	if val.Type != TypeSet {
+		return 0, ErrWrongType
+	}
+
+	var removed, delta int64
+	for _, member := range members {
+		if _, ok := val.Set[member]; ok {
+			delete(val.Set, member)
+			removed++
+			delta -= setMemberSize(member)
+		}
+	}
+
+	if removed == 0 {
+		return 0, nil
+	}
+	if len(val.Set) == 0 {
+		s.del(key)
+		s.keyEvent("srem", key)
+		s.keyEvent("del", key)
+	} else {
+		s.update(key, val, delta)
+		s.keyEvent("srem", key)
+	}
+	return removed, nil
+}
+
+// SMembers returns all members, sorted for stable output
+func (s *InMemoryStore) SMembers(key string) ([]string, error) {
+	unlock := s.rlock(key)
+	defer unlock()
+
+	set, err := s.getSet(key)
+	if err != nil {
+		return nil, err
+	}
+	return sortedMembers(set), nil
+}
+
+func (s *InMemoryStore) SIsMember(key, member string) (bool, error) {
+	unlock := s.rlock(key)
+	defer unlock()
+
+	set, err := s.getSet(key)
+	if err != nil {
+		return false, err
+	}
+	_, ok := set[member]
+	return ok, nil
+}
+
+func (s *InMemoryStore) SCard(key string) (int64, error) {
+	unlock := s.rlock(key)
+	defer unlock()
+
+	set, err := s.getSet(key)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(set)), nil
+}
+
+// SInter returns members present in every set (a missing key is empty)
+func (s *InMemoryStore) SInter(keys ...string) ([]string, error) {
+	unlock := s.rlockKeys(keys...)
+	defer unlock()
+
+	sets, err := s.getSets(keys)
+	if err != nil || len(sets) == 0 {
+		return []string{}, err
+	}
+
+	// Iterate the smallest set, probe the others
+	sort.Slice(sets, func(i, j int) bool { return len(sets[i]) < len(sets[j]) })
+
+	result := []string{}
+	for member := range sets[0] {
+		inAll := true
+		for _, other := range sets[1:] {
+			if _, ok := other[member]; !ok {
+				inAll = false
+				break
+			}
+		}
+		if inAll {
+			result = append(result, member)
+		}
+	}
+
+	sort.Strings(result)
+	return result, nil
+}
+
+// SUnion returns members present in any of the sets
+func (s *InMemoryStore) SUnion(keys ...string) ([]string, error) {
+	unlock := s.rlockKeys(keys...)
+	defer unlock()
+
+	sets, err := s.getSets(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	union := make(map[string]struct{})
+	for _, set := range sets {
+		for member := range set {
+			union[member] = struct{}{}
+		}
+	}
+	return sortedMembers(union), nil
+}
+
+// SDiff returns members of the first set that aren't in any of the others
+func (s *InMemoryStore) SDiff(keys ...string) ([]string, error) {
+	unlock := s.rlockKeys(keys...)
+	defer unlock()
+
+	sets, err := s.getSets(keys)
+	if err != nil || len(sets) == 0 {
+		return []string{}, err
+	}
+
+	result := []string{}
+	for member := range sets[0] {
+		found := false
+		for _, other := range sets[1:] {
+			if _, ok := other[member]; ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, member)
+		}
+	}
+
+	sort.Strings(result)
+	return result, nil
+}
+
+// Private helper - assumes lock is already held!
+// Any key holding a non-set makes the whole operation fail, like redis.
+func (s *InMemoryStore) getSets(keys []string) ([]map[string]struct{}, error) {
+	sets := make([]map[string]struct{}, len(keys))
+	for i, key := range keys {
+		set, err := s.getSet(key)
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = set
+	}
+	return sets, nil
+}
+
+func sortedMembers(set map[string]struct{}) []string {
+	members := make([]string, 0, len(set))
+	for member := range set {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
@@ -0,0 +1,45 @@
+package inmemory_test
+
+import (
+	inmemory "cli-t/internal/shared/store/inmemory"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetOperations(t *testing.T) {
+	s := inmemory.New()
+
+	added, err := s.SAdd("a", "1", "2", "3", "2")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), added)
+	s.SAdd("b", "2", "3", "4")
+
+	members, _ := s.SMembers("a")
+	assert.Equal(t, []string{"1", "2", "3"}, members)
+
+	isMember, _ := s.SIsMember("a", "2")
+	assert.True(t, isMember)
+
+	inter, _ := s.SInter("a", "b")
+	assert.Equal(t, []string{"2", "3"}, inter)
+
+	union, _ := s.SUnion("a", "b")
+	assert.Equal(t, []string{"1", "2", "3", "4"}, union)
+
+	diff, _ := s.SDiff("a", "b")
+	assert.Equal(t, []string{"1"}, diff)
+
+	// Missing key behaves like an empty set
+	inter, _ = s.SInter("a", "missing")
+	assert.Empty(t, inter)
+
+	removed, _ := s.SRem("b", "2", "3", "4")
+	assert.Equal(t, int64(3), removed)
+	assert.Equal(t, 0, s.Exists("b"), "empty set should be deleted")
+
+	s.HSet("h", map[string]string{"f": "v"})
+	_, err = s.SUnion("a", "h")
+	assert.Equal(t, inmemory.ErrWrongType, err)
+}
@@ -0,0 +1,189 @@
+package inmemory
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultShards is how many partitions New splits the keyspace into
+const DefaultShards = 32
+
+// shard is one hash partition of the keyspace. Commands on keys in
+// different shards don't wait for each other, and reads of the same shard
+// don't wait for each other either.
+type shard struct {
+	mu      sync.RWMutex // reads share it; writes and lazy expiry take it exclusively
+	data    map[string]StoreValue
+	expires map[string]struct{} // keys that have a TTL, what active expiry samples
+	meta    map[string]*keyMeta // eviction bookkeeping, nil without a memory limit
+	order   *skipList           // every key, scored by keyHash: the order SCAN walks
+	cows    []*cow              // snapshots in progress that haven't copied this shard yet
+
+	_ [64]byte // shards are allocated side by side: keep their locks on separate cache lines
+}
+
+func newShard() *shard {
+	return &shard{
+		data:    make(map[string]StoreValue),
+		expires: make(map[string]struct{}),
+		order:   newSkipList(),
+	}
+}
+
+// keyHash hashes key with FNV-1a, inline so nothing is allocated
+func keyHash(key string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return h
+}
+
+func (s *InMemoryStore) shardIndex(key string) uint32 {
+	return keyHash(key) & s.mask
+}
+
+func (s *InMemoryStore) shardFor(key string) *shard {
+	return s.shards[s.shardIndex(key)]
+}
+
+// lock takes the shard lock of key for writing and returns the matching
+// unlock. The key is deleted first if its TTL passed: keys expire lazily
+// when a command gets to them, like in redis.
+func (s *InMemoryStore) lock(key string) func() {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	s.preserve(sh, key)
+	s.expireIfDue(sh, key)
+	return sh.mu.Unlock
+}
+
+// lockKeys takes the shard locks of every key for writes that touch
+// several keys (DEL, MSET, RENAME, ...). Shards are always locked in index
+// order, so two such commands can't deadlock on each other.
+func (s *InMemoryStore) lockKeys(keys ...string) func() {
+	if len(keys) == 1 {
+		return s.lock(keys[0])
+	}
+
+	locked := s.shardsOf(keys)
+	for _, index := range locked {
+		s.shards[index].mu.Lock()
+	}
+	for _, key := range keys {
+		sh := s.shardFor(key)
+		s.preserve(sh, key)
+		s.expireIfDue(sh, key)
+	}
+	return func() {
+		for _, index := range locked {
+			s.shards[index].mu.Unlock()
+		}
+	}
+}
+
+// rlock takes the shard lock of key for reading. A read can't delete the
+// key, so if it is due to expire, it is expired under the write lock first.
+func (s *InMemoryStore) rlock(key string) func() {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	if s.due(sh, key) {
+		sh.mu.RUnlock()
+		s.lock(key)()
+		sh.mu.RLock()
+	}
+	return sh.mu.RUnlock
+}
+
+// rlockKeys is lockKeys for reads of several keys (EXISTS, MGET, SINTER, ...)
+func (s *InMemoryStore) rlockKeys(keys ...string) func() {
+	if len(keys) == 1 {
+		return s.rlock(keys[0])
+	}
+
+	locked := s.shardsOf(keys)
+	rlock := func() {
+		for _, index := range locked {
+			s.shards[index].mu.RLock()
+		}
+	}
+	runlock := func() {
+		for _, index := range locked {
+			s.shards[index].mu.RUnlock()
+		}
+	}
+
+	rlock()
+	for _, key := range keys {
+		if s.due(s.shardFor(key), key) {
+			runlock()
+			s.lockKeys(keys...)()
+			rlock()
+			break
+		}
+	}
+	return runlock
+}
+
+// shardsOf returns the distinct shard indexes of keys in locking order
+func (s *InMemoryStore) shardsOf(keys []string) []uint32 {
+	indexes := make([]uint32, 0, len(keys))
+	for _, key := range keys {
+		indexes = append(indexes, s.shardIndex(key))
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+
+	distinct := indexes[:0]
+	for i, index := range indexes {
+		if i == 0 || index != indexes[i-1] { // several keys in the same shard
+			distinct = append(distinct, index)
+		}
+	}
+	return distinct
+}
+
+// Private helper - assumes the shard lock is held, for reading at least!
+// Reports whether key exists with a TTL that passed.
+func (s *InMemoryStore) due(sh *shard, key string) bool {
+	if len(sh.expires) == 0 {
+		return false
+	}
+	if _, volatile := sh.expires[key]; !volatile {
+		return false // the common case, without reading the clock
+	}
+	return time.Now().After(*sh.data[key].ExpiresAt)
+}
+
+// Private helper - assumes the shard lock is held for writing!
+func (s *InMemoryStore) expireIfDue(sh *shard, key string) {
+	if s.due(sh, key) {
+		s.expire(key)
+	}
+}
+
+// lockAll stops the whole keyspace, for what must see or change all of it
+// at once: snapshots, FLUSHALL, changing the memory limit
+func (s *InMemoryStore) lockAll() func() {
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+	}
+	return func() {
+		for _, sh := range s.shards {
+			sh.mu.Unlock()
+		}
+	}
+}
+
+// forEachShard visits the shards one at a time, each under its read lock.
+// Whole-keyspace reads (KEYS, DBSIZE, INFO) use it, so they only ever hold
+// up writes to one shard; like redis' SCAN they don't see a single point in
+// time. fn must not modify the shard.
+func (s *InMemoryStore) forEachShard(fn func(sh *shard)) {
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		fn(sh)
+		sh.mu.RUnlock()
+	}
+}
@@ -0,0 +1,188 @@
+package inmemory_test
+
+import (
+	inmemory "cli-t/internal/shared/store/inmemory"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiKeyAcrossShards(t *testing.T) {
+	for _, shards := range []int{1, inmemory.DefaultShards} {
+		s := inmemory.NewSharded(shards)
+
+		values := map[string]inmemory.StoreValue{}
+		keys := []string{}
+		for i := 0; i < 100; i++ {
+			key := "k" + strconv.Itoa(i)
+			values[key] = str(strconv.Itoa(i))
+			keys = append(keys, key)
+		}
+		s.MSet(values)
+
+		got := s.MGet(append(keys, "missing")...)
+		require.Len(t, got, 101)
+		for i := 0; i < 100; i++ {
+			require.NotNil(t, got[i])
+			assert.Equal(t, strconv.Itoa(i), got[i].Data)
+		}
+		assert.Nil(t, got[100])
+
+		// The same key twice must not lock its shard twice
+		assert.Equal(t, 101, s.Exists(append(keys, "k0", "missing")...))
+		assert.Equal(t, 100, s.Delete(append(keys, "k0")...))
+		assert.Equal(t, 0, s.DBSize())
+	}
+}
+
+func TestMSetIsAtomic(t *testing.T) {
+	s := inmemory.New()
+	s.MSet(map[string]inmemory.StoreValue{"x": str("0"), "y": str("0")})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= 1000; i++ {
+			n := strconv.Itoa(i)
+			s.MSet(map[string]inmemory.StoreValue{"x": str(n), "y": str(n)})
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		got := s.MGet("x", "y")
+		require.Equal(t, got[0].Data, got[1].Data, "MGET saw half of an MSET")
+	}
+}
+
+func TestCrossShardMovesDontDeadlock(t *testing.T) {
+	s := inmemory.New()
+	s.Set("a", str("1"))
+	s.RPush("left", "x", "y")
+
+	// Opposite directions lock the same two shards; both must get through
+	var wg sync.WaitGroup
+	for _, pair := range [][2]string{{"a", "b"}, {"b", "a"}, {"left", "right"}, {"right", "left"}} {
+		wg.Add(1)
+		go func(src, dst string) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				s.Rename(src, dst, false)
+				s.LMove(src, dst, true, false)
+				s.Copy(src, dst, true)
+			}
+		}(pair[0], pair[1])
+	}
+	wg.Wait()
+}
+
+func TestCleanExpiredKeysWalksEveryShard(t *testing.T) {
+	s := inmemory.New()
+	past := time.Now().Add(10 * time.Millisecond)
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		s.Set("persistent:"+key, str(key))
+		s.Set("volatile:"+key, inmemory.StoreValue{Type: inmemory.TypeString, Data: key, ExpiresAt: &past})
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	// Every shard is sampled and mostly-expired shards are sampled again,
+	// so a few cycles clear everything
+	deleted := 0
+	for cycle := 0; cycle < 10; cycle++ {
+		deleted += s.CleanExpiredKeys()
+	}
+	assert.Equal(t, 1000, deleted)
+	assert.Equal(t, inmemory.Stats{Keys: 1000, ExpiredKeys: 1000}, s.Stats())
+}
+
+// The benchmarks compare one global lock (1 shard) with the default
+// sharding, e.g. go test -bench Parallel -cpu 1,8 ./internal/shared/store/inmemory
+
+func benchmarkParallel(b *testing.B, shards int, writeEvery int) {
+	s := inmemory.NewSharded(shards)
+	const keys = 10000
+	for i := 0; i < keys; i++ {
+		s.Set("key:"+strconv.Itoa(i), str("value"))
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := "key:" + strconv.Itoa(i%keys)
+			if i%writeEvery == 0 {
+				s.Set(key, str("value"))
+			} else {
+				s.Get(key)
+			}
+			i += 7
+		}
+	})
+}
+
+func BenchmarkParallelReads(b *testing.B) {
+	for _, shards := range []int{1, inmemory.DefaultShards} {
+		b.Run("shards="+strconv.Itoa(shards), func(b *testing.B) {
+			benchmarkParallel(b, shards, 1000000)
+		})
+	}
+}
+
+func BenchmarkParallelReadWrite(b *testing.B) {
+	for _, shards := range []int{1, inmemory.DefaultShards} {
+		b.Run("shards="+strconv.Itoa(shards), func(b *testing.B) {
+			benchmarkParallel(b, shards, 10) // 10% writes
+		})
+	}
+}
+
+// BenchmarkCleanExpiredKeys is one active expiry cycle over 100k keys, 1%
+// of them with a TTL that hasn't passed: the common case, nothing to delete
+func BenchmarkCleanExpiredKeys(b *testing.B) {
+	for _, shards := range []int{1, inmemory.DefaultShards} {
+		b.Run("shards="+strconv.Itoa(shards), func(b *testing.B) {
+			s := inmemory.NewSharded(shards)
+			later := time.Now().Add(time.Hour)
+			for i := 0; i < 100000; i++ {
+				val := str("v")
+				if i%100 == 0 {
+					val.ExpiresAt = &later
+				}
+				s.Set("key:"+strconv.Itoa(i), val)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s.CleanExpiredKeys()
+			}
+		})
+	}
+}
+
+// BenchmarkScanStep is one SCAN step of 10 keys: a lookup in one shard and
+// 10 keys from there, not a walk over the whole keyspace
+func BenchmarkScanStep(b *testing.B) {
+	for _, keys := range []int{1000, 100000} {
+		b.Run("keys="+strconv.Itoa(keys), func(b *testing.B) {
+			s := inmemory.New()
+			for i := 0; i < keys; i++ {
+				s.Set("key:"+strconv.Itoa(i), str("v"))
+			}
+
+			b.ResetTimer()
+			var cursor uint64
+			for i := 0; i < b.N; i++ {
+				_, cursor = s.Scan(cursor, inmemory.ScanOptions{Count: 10})
+			}
+		})
+	}
+}
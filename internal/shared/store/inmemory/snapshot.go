@@ -0,0 +1,115 @@
+package inmemory
+
+import "time"
+
+// cow is what a snapshot in progress keeps of a shard it hasn't copied yet:
+// the values writes replaced since it started, nil for keys that didn't
+// exist then
+type cow struct {
+	old map[string]*StoreValue
+}
+
+// Snapshot returns a deep copy of every live key
+func (s *InMemoryStore) Snapshot() map[string]StoreValue {
+	return s.BeginSnapshot()()
+}
+
+// BeginSnapshot fixes the point in time of a snapshot and returns the
+// function that copies it. The caller must call it exactly once, typically
+// from the goroutine that saves the copy.
+//
+// Go can't fork like redis does for BGSAVE, so the copy-on-write is done
+// here: starting only marks every shard, which is quick whatever the size
+// of the dataset. Until the copy gets to a shard, a write to one of its keys
+// first keeps a clone of the value it is about to change (preserve). The
+// copy then clones each shard in turn, under its read lock, taking the kept
+// values instead of the current ones.
+func (s *InMemoryStore) BeginSnapshot() func() map[string]StoreValue {
+	unlock := s.lockAll() // one point in time across every shard
+	at := time.Now()
+	cows := make([]*cow, len(s.shards))
+	for i, sh := range s.shards {
+		cows[i] = &cow{old: make(map[string]*StoreValue)}
+		sh.cows = append(sh.cows, cows[i])
+	}
+	unlock()
+
+	return func() map[string]StoreValue {
+		snapshot := make(map[string]StoreValue)
+		for i, sh := range s.shards {
+			sh.mu.RLock()
+			copyShard(sh, cows[i], at, snapshot)
+			sh.mu.RUnlock()
+
+			// Writes made in between kept values for nothing, that's all
+			sh.mu.Lock()
+			sh.dropCow(cows[i])
+			sh.mu.Unlock()
+		}
+		return snapshot
+	}
+}
+
+// Private helper - assumes the shard lock is held, for reading at least!
+// Adds the keys of sh live at the time at to snapshot, as they were then.
+func copyShard(sh *shard, c *cow, at time.Time, snapshot map[string]StoreValue) {
+	live := func(val StoreValue) bool {
+		return val.ExpiresAt == nil || !at.After(*val.ExpiresAt)
+	}
+
+	for key, val := range sh.data {
+		if _, kept := c.old[key]; !kept && live(val) {
+			snapshot[key] = val.Clone()
+		}
+	}
+	for key, val := range c.old {
+		if val != nil && live(*val) {
+			snapshot[key] = *val // already a clone
+		}
+	}
+}
+
+// Private helper - assumes the shard lock is held for writing!
+// Keeps key's current value for the snapshots that haven't copied its
+// shard yet, before a write changes it. Commands modify values in place, so
+// this runs when the key is locked, not when it is set.
+func (s *InMemoryStore) preserve(sh *shard, key string) {
+	for _, c := range sh.cows {
+		if _, kept := c.old[key]; kept {
+			continue // changed since the snapshot already
+		}
+		if val, exists := sh.data[key]; exists {
+			clone := val.Clone()
+			c.old[key] = &clone
+		} else {
+			c.old[key] = nil
+		}
+	}
+}
+
+// Private helper - assumes the shard lock is held for writing!
+func (sh *shard) dropCow(c *cow) {
+	for i, other := range sh.cows {
+		if other == c {
+			sh.cows = append(sh.cows[:i], sh.cows[i+1:]...)
+			return
+		}
+	}
+}
+
+// Load replaces the whole dataset, e.g. with a snapshot read from disk.
+// Keys that expired while the snapshot sat on disk are dropped.
+func (s *InMemoryStore) Load(data map[string]StoreValue) {
+	unlock := s.lockAll()
+	defer unlock()
+
+	s.clear()
+
+	now := time.Now()
+	for key, val := range data {
+		if val.ExpiresAt != nil && now.After(*val.ExpiresAt) {
+			continue
+		}
+		s.set(key, val)
+	}
+}
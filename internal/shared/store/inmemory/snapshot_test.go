@@ -0,0 +1,68 @@
+package inmemory_test
+
+import (
+	inmemory "cli-t/internal/shared/store/inmemory"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotIsIndependent(t *testing.T) {
+	s := inmemory.New()
+	s.HSet("h", map[string]string{"f": "v"})
+	s.ZAdd("z", []inmemory.ZMember{{Member: "a", Score: 1}}, inmemory.ZAddOptions{})
+
+	snapshot := s.Snapshot()
+
+	// Writes after the snapshot don't leak into it
+	s.HSet("h", map[string]string{"f": "changed"})
+	s.ZAdd("z", []inmemory.ZMember{{Member: "b", Score: 2}}, inmemory.ZAddOptions{})
+
+	assert.Equal(t, "v", snapshot["h"].Hash["f"])
+	assert.Equal(t, 1, snapshot["z"].ZSet.Len())
+}
+
+func TestBeginSnapshotCopiesOnWrite(t *testing.T) {
+	s := inmemory.New()
+	s.HSet("h", map[string]string{"f": "v"})
+	s.RPush("l", "a")
+	s.Set("gone", inmemory.StoreValue{Type: inmemory.TypeString, Data: "x"})
+
+	copyData := s.BeginSnapshot()
+
+	// Between the start and the copy: in-place changes, deletes, new keys,
+	// and finally everything flushed
+	s.HSet("h", map[string]string{"f": "changed"})
+	s.RPush("l", "b")
+	s.Delete("gone")
+	s.Set("new", inmemory.StoreValue{Type: inmemory.TypeString, Data: "y"})
+	s.Flush()
+
+	snapshot := copyData()
+	assert.Len(t, snapshot, 3)
+	assert.Equal(t, "v", snapshot["h"].Hash["f"])
+	assert.Equal(t, []string{"a"}, snapshot["l"].List)
+	assert.Equal(t, "x", snapshot["gone"].Data)
+
+	// Once copied, writes stop keeping old values for it
+	s.Set("after", inmemory.StoreValue{Type: inmemory.TypeString, Data: "z"})
+	assert.Equal(t, map[string]inmemory.StoreValue{
+		"after": {Type: inmemory.TypeString, Data: "z"},
+	}, s.Snapshot())
+}
+
+func TestLoadReplacesDataAndDropsExpired(t *testing.T) {
+	s := inmemory.New()
+	s.Set("old", inmemory.StoreValue{Type: inmemory.TypeString, Data: "x"})
+
+	past := time.Now().Add(-time.Second)
+	s.Load(map[string]inmemory.StoreValue{
+		"new":     {Type: inmemory.TypeString, Data: "y"},
+		"expired": {Type: inmemory.TypeString, Data: "z", ExpiresAt: &past},
+	})
+
+	assert.Equal(t, 0, s.Exists("old"))
+	assert.Equal(t, 0, s.Exists("expired"))
+	assert.Equal(t, 1, s.Exists("new"))
+}
@@ -0,0 +1,51 @@
+package inmemory
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats are the store counters INFO reports
+type Stats struct {
+	Keys        int   // live keys
+	Expires     int   // live keys with a TTL
+	ExpiredKeys int64 // keys removed because their TTL passed
+	EvictedKeys int64 // keys removed to stay under maxmemory
+}
+
+// counters are the cumulative part of Stats. Shards update them
+// concurrently, hence the atomics.
+type counters struct {
+	expired atomic.Int64
+	evicted atomic.Int64
+}
+
+// Stats counts the keyspace and returns the counters
+func (s *InMemoryStore) Stats() Stats {
+	stats := Stats{ExpiredKeys: s.counters.expired.Load(), EvictedKeys: s.counters.evicted.Load()}
+	now := time.Now()
+	s.forEachShard(func(sh *shard) {
+		stats.Keys += len(sh.data) - len(sh.expires)
+		for key := range sh.expires {
+			if now.Before(*sh.data[key].ExpiresAt) {
+				stats.Keys++
+				stats.Expires++
+			}
+		}
+	})
+	return stats
+}
+
+// ResetStats zeroes the cumulative counters (CONFIG RESETSTAT)
+func (s *InMemoryStore) ResetStats() {
+	s.counters.expired.Store(0)
+	s.counters.evicted.Store(0)
+}
+
+// Private helper - assumes the key's shard lock is held!
+// Removes a key whose TTL passed.
+func (s *InMemoryStore) expire(key string) {
+	s.del(key)
+	s.counters.expired.Add(1)
+	s.keyEvent("expired", key)
+}
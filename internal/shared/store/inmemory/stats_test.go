@@ -0,0 +1,73 @@
+package inmemory_test
+
+import (
+	inmemory "cli-t/internal/shared/store/inmemory"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	s := inmemory.New()
+	s.Set("a", str("1"))
+	s.Set("b", str("2"))
+	s.Set("c", str("3"))
+	s.SetExpiry("b", 100)
+	s.SetExpiryAt("c", time.Now().Add(10*time.Millisecond))
+
+	assert.Equal(t, inmemory.Stats{Keys: 3, Expires: 2}, s.Stats())
+
+	// Both lazy and active expiry count
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 1, s.CleanExpiredKeys())
+	assert.Equal(t, inmemory.Stats{Keys: 2, Expires: 1, ExpiredKeys: 1}, s.Stats())
+
+	s.SetMaxMemory(1, inmemory.AllKeysRandom, 0)
+	s.Set("big", str(strings.Repeat("x", 100)))
+	// Every key is bigger than the limit, so all of them go
+	evicted, err := s.FreeMemory(1)
+	assert.NoError(t, err)
+	assert.Len(t, evicted, 3)
+	assert.Equal(t, int64(3), s.Stats().EvictedKeys)
+
+	s.ResetStats()
+	assert.Equal(t, inmemory.Stats{}, s.Stats())
+}
+
+func TestKeyEvents(t *testing.T) {
+	s := inmemory.New()
+	var events []string
+	s.OnKeyEvent(func(event, key string) {
+		events = append(events, event+" "+key)
+	})
+
+	s.Set("a", str("1"))
+	s.Incr("a")
+	s.Rename("a", "b", false)
+	s.RPush("list", "x", "y")
+	s.LPop("list", 2)
+	s.HSet("hash", map[string]string{"f": "v"})
+	s.HDel("hash", "missing") // nothing removed, nothing to report
+	s.Delete("b", "missing")
+	s.Set("temp", str("1"))
+	s.SetExpiryAt("temp", time.Now().Add(time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+	s.CleanExpiredKeys()
+
+	assert.Equal(t, []string{
+		"set a",
+		"incrby a",
+		"rename_from a",
+		"rename_to b",
+		"rpush list",
+		"lpop list",
+		"del list", // the pop emptied it
+		"hset hash",
+		"del b",
+		"set temp",
+		"expire temp",
+		"expired temp",
+	}, events)
+}
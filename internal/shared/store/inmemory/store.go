@@ -3,7 +3,6 @@ package inmemory
 import (
 	"cli-t/internal/shared/logger"
 	"context"
-	"fmt"
 	"strconv"
 	"time"
 )
@@ -16,74 +15,234 @@ func New() Store {
 	// - Start background cleanup goroutines
 	// - Initialize metrics
 	// fayada of hacing interface pattern
-	return &InMemoryStore{
-		data: make(map[string]StoreValue),
+	return NewSharded(DefaultShards)
+}
+
+// NewSharded creates a store whose keyspace is split into n shards (rounded
+// up to a power of two), each behind its own lock. NewSharded(1) behaves
+// like a single global lock, which is what the benchmarks compare against.
+func NewSharded(n int) Store {
+	size := 1
+	for size < n {
+		size <<= 1
+	}
+
+	s := &InMemoryStore{shards: make([]*shard, size), mask: uint32(size - 1)}
+	for i := range s.shards {
+		s.shards[i] = newShard()
 	}
+	return s
 }
 
-// Private helper - assumes lock is already held!
+// Private helper - assumes the key's shard lock is held, for reading at least!
+// A key whose TTL passed reads as missing. It isn't deleted here: the lock
+// helpers already expired it if it was due when the lock was taken.
 func (s *InMemoryStore) getIfValid(key string) (StoreValue, bool) {
-	val, exists := s.data[key]
+	val, exists := s.shardFor(key).data[key]
 	if !exists {
 		return StoreValue{}, false
 	}
 
 	if val.ExpiresAt != nil && time.Now().After(*val.ExpiresAt) {
-		delete(s.data, key)
 		return StoreValue{}, false
 	}
 
+	s.touch(key)
 	return val, true
 }
 
-// Private helper - assumes lock is already held!
+// Private helper - assumes the key's shard lock is held!
+// Every write goes through here or update so the change hook sees it.
+// value is measured whole for maxmemory: use it for values written whole.
 func (s *InMemoryStore) set(key string, value StoreValue) {
-	s.data[key] = value
+	s.store(key, value)
+	s.account(key, value)
+	s.keyChanged(key)
+}
+
+// Private helper - assumes the key's shard lock is held!
+// Like set, for a value changed in place that grew by delta bytes (see
+// sizeOf, negative when it shrank): a collection isn't measured again on
+// every write to it.
+func (s *InMemoryStore) update(key string, value StoreValue, delta int64) {
+	s.store(key, value)
+	s.grow(key, value, delta)
+	s.keyChanged(key)
+}
+
+// Private helper - assumes the key's shard lock is held!
+// Like set, for a value whose size is already known: a moved or copied key.
+func (s *InMemoryStore) setSized(key string, value StoreValue, size int64) {
+	s.store(key, value)
+	s.record(key, size)
+	s.keyChanged(key)
+}
+
+// Private helper - assumes the key's shard lock is held!
+func (s *InMemoryStore) store(key string, value StoreValue) {
+	sh := s.shardFor(key)
+	s.preserve(sh, key) // Load locks every shard rather than the key
+	if _, exists := sh.data[key]; !exists {
+		sh.order.insert(float64(keyHash(key)), key)
+	}
+	sh.data[key] = value
+	if value.ExpiresAt != nil {
+		sh.expires[key] = struct{}{}
+	} else {
+		delete(sh.expires, key)
+	}
+}
+
+// Private helper - assumes the key's shard lock is held!
+func (s *InMemoryStore) del(key string) {
+	sh := s.shardFor(key)
+	s.preserve(sh, key) // expiry, eviction and FLUSHALL don't go through lock
+	if _, exists := sh.data[key]; exists {
+		sh.order.delete(float64(keyHash(key)), key)
+	}
+	delete(sh.data, key)
+	delete(sh.expires, key)
+	s.unaccount(key)
+	s.keyChanged(key)
+}
+
+// Private helper - assumes the key's shard lock is held!
+func (s *InMemoryStore) keyChanged(key string) {
+	if s.onKeyChange != nil {
+		s.onKeyChange(key)
+	}
+}
+
+// OnKeyChange registers fn to be told about every modified key
+func (s *InMemoryStore) OnKeyChange(fn KeyChangeFunc) {
+	unlock := s.lockAll()
+	defer unlock()
+	s.onKeyChange = fn
+}
+
+// Private helper - assumes the key's shard lock is held!
+// Called by the public methods once a write succeeded.
+func (s *InMemoryStore) keyEvent(event, key string) {
+	if s.onKeyEvent != nil {
+		s.onKeyEvent(event, key)
+	}
+}
+
+// OnKeyEvent registers fn to be told what happened to each modified key
+func (s *InMemoryStore) OnKeyEvent(fn KeyEventFunc) {
+	unlock := s.lockAll()
+	defer unlock()
+	s.onKeyEvent = fn
 }
 
 // Get retrieves a value by key
 // Returns (value, true) if found, ("", false) if not found
 func (s *InMemoryStore) Get(key string) (StoreValue, bool) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock := s.rlock(key)
+	defer unlock()
 	return s.getIfValid(key)
 }
 
+// MGet returns the values of several keys at once, from one consistent
+// view: all their shards are held together
+func (s *InMemoryStore) MGet(keys ...string) []*StoreValue {
+	unlock := s.rlockKeys(keys...)
+	defer unlock()
+
+	values := make([]*StoreValue, len(keys))
+	for i, key := range keys {
+		if val, exists := s.getIfValid(key); exists {
+			values[i] = &val
+		}
+	}
+	return values
+}
+
 // Set stores a key-value pair
 func (s *InMemoryStore) Set(key string, value StoreValue) {
-	s.mu.Lock() // Exclusive lock - blocks all readers and writers
-	defer s.mu.Unlock()
+	unlock := s.lock(key) // blocks only the keys sharing this shard
+	defer unlock()
 
 	s.set(key, value)
+	s.keyEvent("set", key)
 }
 
-// Add this method to InMemoryStore
-func (s *InMemoryStore) CleanExpiredKeys() int {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// MSet stores several key-value pairs atomically: no reader sees some of
+// them written and others not
+func (s *InMemoryStore) MSet(values map[string]StoreValue) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	unlock := s.lockKeys(keys...)
+	defer unlock()
 
-	now := time.Now()
-	deleted := 0
+	for key, val := range values {
+		s.set(key, val)
+		s.keyEvent("set", key)
+	}
+}
 
-	// Sample random keys (map iteration is random in Go!)
-	for key, val := range s.data {
-		// Check if expired
-		if val.ExpiresAt != nil && now.After(*val.ExpiresAt) {
-			delete(s.data, key)
-			deleted++
+// Active expiry tuning, the same idea as redis' activeExpireCycle
+const (
+	expireSamples     = 20                    // keys with a TTL looked at per shard and round
+	expireRepeatRatio = 4                     // go again while more than 1/4 of the sample had expired
+	expireCycleBudget = 25 * time.Millisecond // a cycle stops here and the next one resumes
+)
 
-			// Sample only ~25 keys per iteration (like Redis)
-			if deleted >= 25 {
+// CleanExpiredKeys runs one active expiry cycle and returns how many keys
+// it deleted.
+//
+// It walks the shards from where the previous cycle stopped, holding one
+// shard lock at a time and only for one round of sampling, so it never
+// stops the whole keyspace the way a full scan would. A round samples keys
+// that have a TTL; when many of them were expired the shard likely has more,
+// so it is sampled again.
+//
+// Sharding must not multiply the work: like with a single map, a cycle
+// that finds the keyspace mostly clean stops after one sample, whichever
+// shard it came from. It moves on to the next shards only while it keeps
+// finding expired keys, for at most one pass or its time budget.
+func (s *InMemoryStore) CleanExpiredKeys() int {
+	start := time.Now()
+	deleted, sampled := 0, 0
+	for range s.shards {
+		sh := s.shards[s.expireCursor.Add(1)&s.mask]
+		for {
+			expired, n := s.expireRound(sh)
+			deleted += expired
+			sampled += n
+			if expired*expireRepeatRatio <= n || time.Since(start) > expireCycleBudget {
 				break
 			}
 		}
-
-		// Can Also limit total keys checked (in case map is huge)
+		if sampled >= expireSamples && deleted*expireRepeatRatio <= sampled || time.Since(start) > expireCycleBudget {
+			break
+		}
 	}
-
 	return deleted
 }
 
+// expireRound samples up to expireSamples keys with a TTL in one shard
+// (map iteration order is random) and deletes the expired ones
+func (s *InMemoryStore) expireRound(sh *shard) (expired, sampled int) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	now := time.Now()
+	for key := range sh.expires {
+		if val := sh.data[key]; now.After(*val.ExpiresAt) {
+			s.expire(key)
+			expired++
+		}
+		sampled++
+		if sampled >= expireSamples {
+			break
+		}
+	}
+	return expired, sampled
+}
+
 // StartExpiryWorker runs background expiry cleanup
 // Call this from Server.Start()
 func (s *InMemoryStore) StartExpiryWorker(ctx context.Context) {
@@ -115,13 +274,13 @@ func (s *InMemoryStore) StartExpiryWorker(ctx context.Context) {
 //	>0 seconds until expiry
 func (s *InMemoryStore) GetTTL(key string) int64 {
 	// Hints:
-	// - What lock do you need? (reading only)
+	// - What lock do you need? (reading only: rlock)
 	// - How to check if key exists?
 	// - How to check if it has expiry?
 	// - How to calculate time remaining? (time.Until)
 	// - What if time.Until is negative? (already expired)
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock := s.rlock(key)
+	defer unlock()
 
 	val, exists := s.getIfValid(key)
 	if !exists {
@@ -134,7 +293,6 @@ func (s *InMemoryStore) GetTTL(key string) int64 {
 
 	ttl := time.Until(*val.ExpiresAt)
 	if ttl < 0 {
-		delete(s.data, key)
 		return -2
 	}
 
@@ -153,8 +311,8 @@ func (s *InMemoryStore) SetExpiry(key string, seconds int) bool {
 	// - Update the ExpiresAt field
 	// - Return true/false based on success
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock := s.lock(key)
+	defer unlock()
 
 	val, exists := s.getIfValid(key)
 	if !exists {
@@ -162,14 +320,40 @@ func (s *InMemoryStore) SetExpiry(key string, seconds int) bool {
 	}
 
 	expiresAt := time.Now().Add(time.Duration(seconds) * time.Second)
+	delta := expiryOverhead - expirySize(val.ExpiresAt)
 	val.ExpiresAt = &expiresAt
-	s.set(key, val)
+	s.update(key, val, delta)
+	s.keyEvent("expire", key)
+	return true
+}
+
+// SetExpiryAt sets an absolute expiration time on an existing key.
+// A time in the past deletes the key right away, like redis.
+func (s *InMemoryStore) SetExpiryAt(key string, at time.Time) bool {
+	unlock := s.lock(key)
+	defer unlock()
+
+	val, exists := s.getIfValid(key)
+	if !exists {
+		return false
+	}
+
+	if !at.After(time.Now()) {
+		s.del(key)
+		s.keyEvent("del", key)
+		return true
+	}
+
+	delta := expiryOverhead - expirySize(val.ExpiresAt)
+	val.ExpiresAt = &at
+	s.update(key, val, delta)
+	s.keyEvent("expire", key)
 	return true
 }
 
 func (s *InMemoryStore) Exists(keys ...string) int {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock := s.rlockKeys(keys...)
+	defer unlock()
 
 	count := 0
 	for _, key := range keys {
@@ -182,14 +366,15 @@ func (s *InMemoryStore) Exists(keys ...string) int {
 }
 
 func (s *InMemoryStore) Delete(keys ...string) int {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock := s.lockKeys(keys...)
+	defer unlock()
 
 	count := 0
 	for _, key := range keys {
 		_, exists := s.getIfValid(key)
 		if exists {
-			delete(s.data, key)
+			s.del(key)
+			s.keyEvent("del", key)
 			count++
 		}
 	}
@@ -197,8 +382,8 @@ func (s *InMemoryStore) Delete(keys ...string) int {
 }
 
 func (s *InMemoryStore) Incr(key string) (int64, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock := s.lock(key)
+	defer unlock()
 
 	// Get current value
 	val, exists := s.getIfValid(key)
@@ -208,14 +393,14 @@ func (s *InMemoryStore) Incr(key string) (int64, error) {
 
 		// Check if it's a string
 		if val.Type != TypeString {
-			return 0, fmt.Errorf("WRONGTYPE Operation against a key holding the wrong kind of value")
+			return 0, ErrWrongType
 		}
 
 		// Parse as integer
 		// If parse fails, return error
 		num, err := strconv.ParseInt(val.Data, 10, 64)
 		if err != nil {
-			return 0, fmt.Errorf("ERR value is not an integer or out of range")
+			return 0, ErrNotInteger
 		}
 
 		currentNum = num
@@ -232,12 +417,13 @@ func (s *InMemoryStore) Incr(key string) (int64, error) {
 	val.Data = strconv.FormatInt(newValue, 10)
 	val.Type = TypeString
 	s.set(key, val)
+	s.keyEvent("incrby", key)
 	return newValue, nil
 }
 
 func (s *InMemoryStore) Decr(key string) (int64, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock := s.lock(key)
+	defer unlock()
 
 	// Get current value
 	val, exists := s.getIfValid(key)
@@ -247,14 +433,14 @@ func (s *InMemoryStore) Decr(key string) (int64, error) {
 
 		// Check if it's a string
 		if val.Type != TypeString {
-			return 0, fmt.Errorf("WRONGTYPE Operation against a key holding the wrong kind of value")
+			return 0, ErrWrongType
 		}
 
 		// Parse as integer
 		// If parse fails, return error
 		num, err := strconv.ParseInt(val.Data, 10, 64)
 		if err != nil {
-			return 0, fmt.Errorf("ERR value is not an integer or out of range")
+			return 0, ErrNotInteger
 		}
 
 		currentNum = num
@@ -271,12 +457,13 @@ func (s *InMemoryStore) Decr(key string) (int64, error) {
 	val.Data = strconv.FormatInt(newValue, 10)
 	val.Type = TypeString
 	s.set(key, val)
+	s.keyEvent("decrby", key)
 	return newValue, nil
 }
 
 func (s *InMemoryStore) LPush(key string, values ...string) (int64, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock := s.lock(key)
+	defer unlock()
 
 	val, exists := s.getIfValid(key)
 
@@ -284,7 +471,7 @@ func (s *InMemoryStore) LPush(key string, values ...string) (int64, error) {
 	if exists {
 		// Key exists - check type
 		if val.Type != TypeList {
-			return 0, fmt.Errorf("WRONGTYPE Operation against a key holding the wrong kind of value")
+			return 0, ErrWrongType
 		}
 		list = val.List
 	} else {
@@ -292,22 +479,28 @@ func (s *InMemoryStore) LPush(key string, values ...string) (int64, error) {
 		list = []string{}
 	}
 
-	// Push to LEFT means PREPEND
-	newList := append(values, list...)
+	// Push to LEFT means PREPEND, one value at a time like redis:
+	// LPUSH k a b c leaves [c b a ...]
+	newList := make([]string, 0, len(values)+len(list))
+	for i := len(values) - 1; i >= 0; i-- {
+		newList = append(newList, values[i])
+	}
+	newList = append(newList, list...)
 
 	// Store back
-	s.set(key, StoreValue{
+	s.update(key, StoreValue{
 		Type:      TypeList,
 		List:      newList,
 		ExpiresAt: val.ExpiresAt,
-	})
+	}, listItemsSize(values))
+	s.keyEvent("lpush", key)
 
 	return int64(len(newList)), nil
 }
 
 func (s *InMemoryStore) RPush(key string, values ...string) (int64, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock := s.lock(key)
+	defer unlock()
 
 	val, exists := s.getIfValid(key)
 
@@ -315,7 +508,7 @@ func (s *InMemoryStore) RPush(key string, values ...string) (int64, error) {
 	if exists {
 		// Key exists - check type
 		if val.Type != TypeList {
-			return 0, fmt.Errorf("WRONGTYPE Operation against a key holding the wrong kind of value")
+			return 0, ErrWrongType
 		}
 		list = val.List
 	} else {
@@ -323,22 +516,23 @@ func (s *InMemoryStore) RPush(key string, values ...string) (int64, error) {
 		list = []string{}
 	}
 
-	// Push to LEFT means PREPEND
+	// Push to RIGHT means APPEND
 	newList := append(list, values...)
 
 	// Store back
-	s.set(key, StoreValue{
+	s.update(key, StoreValue{
 		Type:      TypeList,
 		List:      newList,
 		ExpiresAt: val.ExpiresAt,
-	})
+	}, listItemsSize(values))
+	s.keyEvent("rpush", key)
 
 	return int64(len(newList)), nil
 }
 
 func (s *InMemoryStore) LRange(key string, start, stop int) ([]string, error) {
-	s.mu.RLock() // Read-only!
-	defer s.mu.RUnlock()
+	unlock := s.rlock(key)
+	defer unlock()
 
 	val, exists := s.getIfValid(key)
 	if !exists {
@@ -346,7 +540,7 @@ func (s *InMemoryStore) LRange(key string, start, stop int) ([]string, error) {
 	}
 
 	if val.Type != TypeList {
-		return nil, fmt.Errorf("WRONGTYPE Operation against a key holding the wrong kind of value")
+		return nil, ErrWrongType
 	}
 
 	list := val.List
@@ -374,5 +568,6 @@ func (s *InMemoryStore) LRange(key string, start, stop int) ([]string, error) {
 
 	// Slice syntax: [start:stop+1]
 	// (stop is inclusive in Redis!)
-	return list[start : stop+1], nil
+	// Copy, the caller reads it after the lock is released
+	return append([]string(nil), list[start:stop+1]...), nil
 }
@@ -0,0 +1,443 @@
+package inmemory
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrStreamID         = errors.New("ERR Invalid stream ID specified as stream command argument")
+	ErrStreamIDTooSmall = errors.New("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	ErrStreamIDZero     = errors.New("ERR The ID specified in XADD must be greater than 0-0")
+	ErrStreamExhausted  = errors.New("ERR The stream has exhausted the last possible ID, unable to add more items")
+	ErrXSetIDTooSmall   = errors.New("ERR The ID specified in XSETID is smaller than the target stream top item")
+)
+
+// StreamID is an entry ID: a millisecond timestamp and a sequence number
+// for entries added in the same millisecond
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+// MaxStreamID is "+", the highest possible ID
+var MaxStreamID = StreamID{math.MaxUint64, math.MaxUint64}
+
+func (id StreamID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+func (id StreamID) Less(other StreamID) bool {
+	return id.Ms < other.Ms || (id.Ms == other.Ms && id.Seq < other.Seq)
+}
+
+// Next is the smallest ID after id, false when id is the maximum
+func (id StreamID) Next() (StreamID, bool) {
+	switch {
+	case id.Seq < math.MaxUint64:
+		return StreamID{id.Ms, id.Seq + 1}, true
+	case id.Ms < math.MaxUint64:
+		return StreamID{id.Ms + 1, 0}, true
+	}
+	return id, false
+}
+
+// Prev is the largest ID before id, false when id is 0-0
+func (id StreamID) Prev() (StreamID, bool) {
+	switch {
+	case id.Seq > 0:
+		return StreamID{id.Ms, id.Seq - 1}, true
+	case id.Ms > 0:
+		return StreamID{id.Ms - 1, math.MaxUint64}, true
+	}
+	return id, false
+}
+
+// ParseStreamID parses "ms-seq", "-" and "+". A bare "ms" gets missingSeq
+// as sequence: 0 for the start of a range, the maximum for its end.
+func ParseStreamID(s string, missingSeq uint64) (StreamID, error) {
+	switch s {
+	case "-":
+		return StreamID{}, nil
+	case "+":
+		return MaxStreamID, nil
+	}
+
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return StreamID{}, ErrStreamID
+	}
+	if !hasSeq {
+		return StreamID{ms, missingSeq}, nil
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return StreamID{}, ErrStreamID
+	}
+	return StreamID{ms, seq}, nil
+}
+
+// StreamEntry is one stream item. Fields are field, value pairs in the
+// order they were added; nil means the entry was deleted (what XREADGROUP
+// and XCLAIM report for pending entries that no longer exist).
+type StreamEntry struct {
+	ID     StreamID
+	Fields []string
+}
+
+// Stream is an append-only log of entries ordered by ID, plus its
+// consumer groups. Entries sit in a slice: XADD appends, ranges are found
+// by binary search, only XDEL in the middle costs O(n).
+type Stream struct {
+	entries []StreamEntry
+	lastID  StreamID // highest ID ever added, deleted entries included
+	groups  map[string]*consumerGroup
+}
+
+func NewStream() *Stream {
+	return &Stream{groups: make(map[string]*consumerGroup)}
+}
+
+func (st *Stream) Len() int {
+	return len(st.entries)
+}
+
+// LastID is the ID of the last entry ever added
+func (st *Stream) LastID() StreamID {
+	return st.lastID
+}
+
+// SetLastID moves the last ID (XSETID and loading from disk)
+func (st *Stream) SetLastID(id StreamID) {
+	st.lastID = id
+}
+
+// Entries returns the entries in ID order; callers must not modify them
+func (st *Stream) Entries() []StreamEntry {
+	return st.entries
+}
+
+// Append adds an entry at the end, it must have the highest ID so far
+func (st *Stream) Append(entry StreamEntry) {
+	st.entries = append(st.entries, entry)
+	if st.lastID.Less(entry.ID) {
+		st.lastID = entry.ID
+	}
+}
+
+// search returns the index of the first entry with an ID >= id
+func (st *Stream) search(id StreamID) int {
+	return sort.Search(len(st.entries), func(i int) bool {
+		return !st.entries[i].ID.Less(id)
+	})
+}
+
+// lookup returns the entry with exactly this ID
+func (st *Stream) lookup(id StreamID) (StreamEntry, bool) {
+	i := st.search(id)
+	if i < len(st.entries) && st.entries[i].ID == id {
+		return st.entries[i], true
+	}
+	return StreamEntry{}, false
+}
+
+// Range returns the entries with start <= ID <= end, at most count of them
+// (count <= 0 is no limit), from the end when reverse is set
+func (st *Stream) Range(start, end StreamID, count int, reverse bool) []StreamEntry {
+	if end.Less(start) {
+		return []StreamEntry{}
+	}
+	from, to := st.search(start), st.search(end)
+	if to < len(st.entries) && st.entries[to].ID == end {
+		to++
+	}
+
+	n := to - from
+	if count > 0 && count < n {
+		n = count
+	}
+	result := make([]StreamEntry, 0, n)
+	for i := 0; i < n; i++ {
+		if reverse {
+			result = append(result, st.entries[to-1-i])
+		} else {
+			result = append(result, st.entries[from+i])
+		}
+	}
+	return result
+}
+
+// trim drops entries from the head, returns how many
+func (st *Stream) trim(trim StreamTrim) int {
+	drop := 0
+	if trim.ByID {
+		drop = st.search(trim.MinID)
+	} else if len(st.entries) > trim.MaxLen {
+		drop = len(st.entries) - max(trim.MaxLen, 0)
+	}
+	if drop > 0 {
+		st.entries = append([]StreamEntry(nil), st.entries[drop:]...)
+	}
+	return drop
+}
+
+// Clone deep copies the stream and its groups
+func (st *Stream) Clone() *Stream {
+	clone := &Stream{
+		entries: make([]StreamEntry, len(st.entries)),
+		lastID:  st.lastID,
+		groups:  make(map[string]*consumerGroup, len(st.groups)),
+	}
+	for i, entry := range st.entries {
+		clone.entries[i] = StreamEntry{ID: entry.ID, Fields: append([]string(nil), entry.Fields...)}
+	}
+	for name, group := range st.groups {
+		clone.groups[name] = group.clone()
+	}
+	return clone
+}
+
+// StreamTrim is the MAXLEN or MINID clause of XADD and XTRIM.
+// "~" is accepted and trims exactly: there are no macro nodes to keep whole.
+type StreamTrim struct {
+	ByID   bool     // MINID instead of MAXLEN
+	MaxLen int      // MAXLEN: how many entries to keep
+	MinID  StreamID // MINID: entries below it go
+}
+
+// XAddOptions are the XADD flags
+type XAddOptions struct {
+	NoMkStream bool        // don't create a missing stream
+	Trim       *StreamTrim // trim after adding, nil = don't
+}
+
+// Private helper - assumes lock is already held!
+// Returns the stream stored at key, nil if the key doesn't exist.
+func (s *InMemoryStore) getStream(key string) (*Stream, error) {
+	val, exists := s.getIfValid(key)
+	if !exists {
+		return nil, nil
+	}
+	if val.Type != TypeStream {
+		return nil, ErrWrongType
+	}
+	return val.Stream, nil
+}
+
+// Private helper - assumes lock is already held!
+// Stores a modified stream keeping its TTL, so the change hook fires.
+// delta is how many bytes the change added, see update.
+func (s *InMemoryStore) putStream(key string, st *Stream, delta int64) {
+	val, exists := s.getIfValid(key)
+	if !exists {
+		val = StoreValue{Type: TypeStream}
+	}
+	val.Stream = st
+	s.update(key, val, delta)
+}
+
+// nextStreamID turns XADD's ID argument ("*", "ms-*" or "ms-seq") into
+// the ID of the new entry, which must be above every ID used before
+func nextStreamID(arg string, last StreamID) (StreamID, error) {
+	if arg == "*" {
+		now := uint64(time.Now().UnixMilli())
+		if now > last.Ms {
+			return StreamID{now, 0}, nil
+		}
+		next, ok := last.Next()
+		if !ok {
+			return StreamID{}, ErrStreamExhausted
+		}
+		return next, nil
+	}
+
+	msPart, seqPart, _ := strings.Cut(arg, "-")
+	if seqPart == "*" {
+		ms, err := strconv.ParseUint(msPart, 10, 64)
+		if err != nil {
+			return StreamID{}, ErrStreamID
+		}
+		switch {
+		case ms < last.Ms:
+			return StreamID{}, ErrStreamIDTooSmall
+		case ms == last.Ms:
+			if last.Seq == math.MaxUint64 {
+				return StreamID{}, ErrStreamIDTooSmall
+			}
+			return StreamID{ms, last.Seq + 1}, nil
+		case ms == 0:
+			return StreamID{0, 1}, nil // 0-0 isn't a valid entry ID
+		}
+		return StreamID{ms, 0}, nil
+	}
+
+	id, err := ParseStreamID(arg, 0)
+	if err != nil || arg == "-" || arg == "+" {
+		return StreamID{}, ErrStreamID
+	}
+	if id == (StreamID{}) {
+		return StreamID{}, ErrStreamIDZero
+	}
+	if !last.Less(id) {
+		return StreamID{}, ErrStreamIDTooSmall
+	}
+	return id, nil
+}
+
+// XAdd appends an entry. Returns its ID, false when NOMKSTREAM found no
+// stream.
+func (s *InMemoryStore) XAdd(key, id string, fields []string, opts XAddOptions) (StreamID, bool, error) {
+	unlock := s.lock(key)
+	defer unlock()
+
+	st, err := s.getStream(key)
+	if err != nil {
+		return StreamID{}, false, err
+	}
+	if st == nil {
+		if opts.NoMkStream {
+			return StreamID{}, false, nil
+		}
+		st = NewStream()
+	}
+
+	entryID, err := nextStreamID(id, st.lastID)
+	if err != nil {
+		return StreamID{}, false, err
+	}
+	entry := StreamEntry{ID: entryID, Fields: append([]string(nil), fields...)}
+	st.Append(entry)
+	delta := streamEntrySize(entry)
+	trimmed := 0
+	if opts.Trim != nil {
+		entries := st.entries
+		trimmed = st.trim(*opts.Trim)
+		delta -= streamEntriesSize(entries[:trimmed])
+	}
+	s.putStream(key, st, delta)
+	s.keyEvent("xadd", key)
+	if trimmed > 0 {
+		s.keyEvent("xtrim", key)
+	}
+	return entryID, true, nil
+}
+
+// XLen returns the number of entries
+func (s *InMemoryStore) XLen(key string) (int64, error) {
+	unlock := s.rlock(key)
+	defer unlock()
+
+	st, err := s.getStream(key)
+	if err != nil || st == nil {
+		return 0, err
+	}
+	return int64(st.Len()), nil
+}
+
+// XRange returns the entries between start and end (both inclusive), see
+// Stream.Range. The entries are copies.
+func (s *InMemoryStore) XRange(key string, start, end StreamID, count int, reverse bool) ([]StreamEntry, error) {
+	unlock := s.rlock(key)
+	defer unlock()
+
+	st, err := s.getStream(key)
+	if err != nil || st == nil {
+		return []StreamEntry{}, err
+	}
+	return copyEntries(st.Range(start, end, count, reverse)), nil
+}
+
+// copyEntries detaches entries from the stream, the caller reads them
+// after the lock is released
+func copyEntries(entries []StreamEntry) []StreamEntry {
+	copied := make([]StreamEntry, len(entries))
+	for i, entry := range entries {
+		copied[i] = StreamEntry{ID: entry.ID, Fields: append([]string(nil), entry.Fields...)}
+	}
+	return copied
+}
+
+// XLastID returns the stream's last ID ("$" in XREAD), false if the key
+// doesn't exist
+func (s *InMemoryStore) XLastID(key string) (StreamID, bool, error) {
+	unlock := s.rlock(key)
+	defer unlock()
+
+	st, err := s.getStream(key)
+	if err != nil || st == nil {
+		return StreamID{}, false, err
+	}
+	return st.lastID, true, nil
+}
+
+// XDel deletes entries by ID, returns how many existed
+func (s *InMemoryStore) XDel(key string, ids ...StreamID) (int64, error) {
+	unlock := s.lock(key)
+	defer unlock()
+
+	st, err := s.getStream(key)
+	if err != nil || st == nil {
+		return 0, err
+	}
+
+	var deleted, delta int64
+	for _, id := range ids {
+		i := st.search(id)
+		if i < len(st.entries) && st.entries[i].ID == id {
+			delta -= streamEntrySize(st.entries[i])
+			st.entries = append(st.entries[:i], st.entries[i+1:]...)
+			deleted++
+		}
+	}
+	if deleted > 0 {
+		s.putStream(key, st, delta)
+		s.keyEvent("xdel", key)
+	}
+	return deleted, nil
+}
+
+// XTrim drops old entries, returns how many
+func (s *InMemoryStore) XTrim(key string, trim StreamTrim) (int64, error) {
+	unlock := s.lock(key)
+	defer unlock()
+
+	st, err := s.getStream(key)
+	if err != nil || st == nil {
+		return 0, err
+	}
+
+	entries := st.entries
+	trimmed := st.trim(trim)
+	if trimmed > 0 {
+		s.putStream(key, st, -streamEntriesSize(entries[:trimmed]))
+		s.keyEvent("xtrim", key)
+	}
+	return int64(trimmed), nil
+}
+
+// XSetID sets the last ID, which can't go below the newest entry
+func (s *InMemoryStore) XSetID(key string, id StreamID) error {
+	unlock := s.lock(key)
+	defer unlock()
+
+	st, err := s.getStream(key)
+	if err != nil {
+		return err
+	}
+	if st == nil {
+		return ErrNoSuchKey
+	}
+	if n := len(st.entries); n > 0 && id.Less(st.entries[n-1].ID) {
+		return ErrXSetIDTooSmall
+	}
+
+	st.lastID = id
+	s.putStream(key, st, 0)
+	s.keyEvent("xsetid", key)
+	return nil
+}
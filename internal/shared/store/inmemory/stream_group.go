@@ -0,0 +1,492 @@
+package inmemory
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var (
+	ErrBusyGroup   = errors.New("BUSYGROUP Consumer Group name already exists")
+	ErrNoStreamKey = errors.New("ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+)
+
+// NoGroupError is returned when the stream or its consumer group is missing
+type NoGroupError struct {
+	Key, Group string
+}
+
+func (e *NoGroupError) Error() string {
+	return fmt.Sprintf("NOGROUP No such key '%s' or consumer group '%s'", e.Key, e.Group)
+}
+
+// PendingEntry is an entry delivered to a consumer of a group and not
+// acknowledged yet: one item of the group's pending entries list (PEL)
+type PendingEntry struct {
+	ID          StreamID
+	Consumer    string
+	DeliveredAt time.Time
+	Deliveries  int64
+}
+
+// StreamConsumer is a consumer of a group, created on its first read
+type StreamConsumer struct {
+	Name   string
+	SeenAt time.Time
+}
+
+// StreamGroup is a consumer group as persistence sees it
+type StreamGroup struct {
+	Name      string
+	LastID    StreamID
+	Pending   []PendingEntry // by ID
+	Consumers []StreamConsumer
+}
+
+type consumerGroup struct {
+	lastID    StreamID // last entry delivered with ">"
+	pending   map[StreamID]*PendingEntry
+	consumers map[string]*StreamConsumer
+}
+
+func newConsumerGroup(lastID StreamID) *consumerGroup {
+	return &consumerGroup{
+		lastID:    lastID,
+		pending:   make(map[StreamID]*PendingEntry),
+		consumers: make(map[string]*StreamConsumer),
+	}
+}
+
+func (g *consumerGroup) clone() *consumerGroup {
+	clone := newConsumerGroup(g.lastID)
+	for id, pe := range g.pending {
+		copied := *pe
+		clone.pending[id] = &copied
+	}
+	for name, consumer := range g.consumers {
+		copied := *consumer
+		clone.consumers[name] = &copied
+	}
+	return clone
+}
+
+// consumer returns the named consumer, creating it, and marks it seen
+func (g *consumerGroup) consumer(name string, now time.Time) *StreamConsumer {
+	consumer, ok := g.consumers[name]
+	if !ok {
+		consumer = &StreamConsumer{Name: name}
+		g.consumers[name] = consumer
+	}
+	consumer.SeenAt = now
+	return consumer
+}
+
+// pendingIDs returns the PEL IDs in order, only those of consumer if set
+func (g *consumerGroup) pendingIDs(consumer string) []StreamID {
+	ids := make([]StreamID, 0, len(g.pending))
+	for id, pe := range g.pending {
+		if consumer == "" || pe.Consumer == consumer {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Less(ids[j]) })
+	return ids
+}
+
+// Groups returns the consumer groups sorted by name
+func (st *Stream) Groups() []StreamGroup {
+	groups := make([]StreamGroup, 0, len(st.groups))
+	for name, g := range st.groups {
+		group := StreamGroup{Name: name, LastID: g.lastID}
+		for _, id := range g.pendingIDs("") {
+			group.Pending = append(group.Pending, *g.pending[id])
+		}
+		for _, consumer := range g.consumers {
+			group.Consumers = append(group.Consumers, *consumer)
+		}
+		sort.Slice(group.Consumers, func(i, j int) bool { return group.Consumers[i].Name < group.Consumers[j].Name })
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups
+}
+
+// AddGroup restores a consumer group (loading from disk)
+func (st *Stream) AddGroup(group StreamGroup) {
+	g := newConsumerGroup(group.LastID)
+	for _, pe := range group.Pending {
+		copied := pe
+		g.pending[pe.ID] = &copied
+	}
+	for _, consumer := range group.Consumers {
+		copied := consumer
+		g.consumers[consumer.Name] = &copied
+	}
+	st.groups[group.Name] = g
+}
+
+// Private helper - assumes lock is already held!
+// Returns the stream and its group, NOGROUP if either is missing.
+func (s *InMemoryStore) getGroup(key, group string) (*Stream, *consumerGroup, error) {
+	st, err := s.getStream(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if st == nil || st.groups[group] == nil {
+		return nil, nil, &NoGroupError{Key: key, Group: group}
+	}
+	return st, st.groups[group], nil
+}
+
+// resolveGroupID turns XGROUP's ID argument into an ID, "$" being the last
+// one of the stream
+func resolveGroupID(st *Stream, id string) (StreamID, error) {
+	if id == "$" {
+		return st.lastID, nil
+	}
+	return ParseStreamID(id, 0)
+}
+
+// XGroupCreate creates a consumer group that will deliver the entries
+// after id ("$" for only new ones). With mkStream a missing stream is
+// created empty.
+func (s *InMemoryStore) XGroupCreate(key, group, id string, mkStream bool) error {
+	unlock := s.lock(key)
+	defer unlock()
+
+	st, err := s.getStream(key)
+	if err != nil {
+		return err
+	}
+	if st == nil {
+		if !mkStream {
+			return ErrNoStreamKey
+		}
+		st = NewStream()
+	}
+	if st.groups[group] != nil {
+		return ErrBusyGroup
+	}
+	lastID, err := resolveGroupID(st, id)
+	if err != nil {
+		return err
+	}
+
+	st.groups[group] = newConsumerGroup(lastID)
+	s.putStream(key, st, 0)
+	s.keyEvent("xgroup-create", key)
+	return nil
+}
+
+// XGroupSetID moves the group's last delivered ID
+func (s *InMemoryStore) XGroupSetID(key, group, id string) error {
+	unlock := s.lock(key)
+	defer unlock()
+
+	st, g, err := s.getGroup(key, group)
+	if err != nil {
+		return err
+	}
+	lastID, err := resolveGroupID(st, id)
+	if err != nil {
+		return err
+	}
+
+	g.lastID = lastID
+	s.putStream(key, st, 0)
+	s.keyEvent("xgroup-setid", key)
+	return nil
+}
+
+// XGroupDestroy deletes a group and its PEL, false if it didn't exist
+func (s *InMemoryStore) XGroupDestroy(key, group string) (bool, error) {
+	unlock := s.lock(key)
+	defer unlock()
+
+	st, err := s.getStream(key)
+	if err != nil {
+		return false, err
+	}
+	if st == nil {
+		return false, ErrNoStreamKey
+	}
+	if st.groups[group] == nil {
+		return false, nil
+	}
+
+	pending := len(st.groups[group].pending)
+	delete(st.groups, group)
+	s.putStream(key, st, -int64(pendingOverhead*pending))
+	s.keyEvent("xgroup-destroy", key)
+	return true, nil
+}
+
+// XGroupCreateConsumer adds a consumer, false if it already existed
+func (s *InMemoryStore) XGroupCreateConsumer(key, group, consumer string) (bool, error) {
+	unlock := s.lock(key)
+	defer unlock()
+
+	st, g, err := s.getGroup(key, group)
+	if err != nil {
+		return false, err
+	}
+	if g.consumers[consumer] != nil {
+		return false, nil
+	}
+
+	g.consumer(consumer, time.Now())
+	s.putStream(key, st, 0)
+	s.keyEvent("xgroup-createconsumer", key)
+	return true, nil
+}
+
+// XGroupDelConsumer deletes a consumer, returns how many entries it still
+// had pending; those are dropped from the PEL
+func (s *InMemoryStore) XGroupDelConsumer(key, group, consumer string) (int64, error) {
+	unlock := s.lock(key)
+	defer unlock()
+
+	st, g, err := s.getGroup(key, group)
+	if err != nil {
+		return 0, err
+	}
+	if g.consumers[consumer] == nil {
+		return 0, nil
+	}
+
+	ids := g.pendingIDs(consumer)
+	for _, id := range ids {
+		delete(g.pending, id)
+	}
+	delete(g.consumers, consumer)
+	s.putStream(key, st, -int64(pendingOverhead*len(ids)))
+	s.keyEvent("xgroup-delconsumer", key)
+	return int64(len(ids)), nil
+}
+
+// XReadGroupOptions selects what XREADGROUP delivers
+type XReadGroupOptions struct {
+	New   bool     // ">": entries never delivered to the group
+	After StreamID // otherwise: the consumer's pending entries after this ID
+	Count int      // at most this many, <= 0 is no limit
+	NoAck bool     // new entries don't go into the PEL
+}
+
+// XReadGroup delivers entries to a consumer of a group.
+//
+// New entries move the group's last ID forward and go into the PEL as
+// pending for this consumer. Reading the history (any ID but ">") returns
+// the consumer's pending entries again, nil Fields for those deleted since.
+// Both count as a delivery.
+func (s *InMemoryStore) XReadGroup(key, group, consumer string, opts XReadGroupOptions) ([]StreamEntry, error) {
+	unlock := s.lock(key)
+	defer unlock()
+
+	st, g, err := s.getGroup(key, group)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	g.consumer(consumer, now)
+	pending := len(g.pending)
+
+	var entries []StreamEntry
+	if opts.New {
+		start, ok := g.lastID.Next()
+		if ok {
+			entries = st.Range(start, MaxStreamID, opts.Count, false)
+		}
+		for _, entry := range entries {
+			g.lastID = entry.ID
+			if opts.NoAck {
+				continue
+			}
+			// An entry may already be pending after XGROUP SETID moved back;
+			// this consumer takes it over
+			g.pending[entry.ID] = &PendingEntry{ID: entry.ID, Consumer: consumer, DeliveredAt: now, Deliveries: 1}
+		}
+	} else {
+		for _, id := range g.pendingIDs(consumer) {
+			if !opts.After.Less(id) {
+				continue
+			}
+			if opts.Count > 0 && len(entries) == opts.Count {
+				break
+			}
+			pe := g.pending[id]
+			pe.DeliveredAt = now
+			pe.Deliveries++
+			entry, _ := st.lookup(id)
+			entries = append(entries, StreamEntry{ID: id, Fields: entry.Fields})
+		}
+	}
+
+	s.putStream(key, st, int64(pendingOverhead*(len(g.pending)-pending)))
+	return copyEntries(entries), nil
+}
+
+// XAck removes entries from the group's PEL, returns how many were pending
+func (s *InMemoryStore) XAck(key, group string, ids ...StreamID) (int64, error) {
+	unlock := s.lock(key)
+	defer unlock()
+
+	st, g, err := s.getGroup(key, group)
+	if noGroup := (*NoGroupError)(nil); errors.As(err, &noGroup) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var acked int64
+	for _, id := range ids {
+		if g.pending[id] != nil {
+			delete(g.pending, id)
+			acked++
+		}
+	}
+	if acked > 0 {
+		s.putStream(key, st, -acked*pendingOverhead)
+	}
+	return acked, nil
+}
+
+// PendingSummary is the short form of XPENDING
+type PendingSummary struct {
+	Count     int64
+	Min, Max  StreamID
+	Consumers []ConsumerPending // by name, only consumers with pending entries
+}
+
+type ConsumerPending struct {
+	Name  string
+	Count int64
+}
+
+// XPendingSummary counts a group's pending entries, per consumer
+func (s *InMemoryStore) XPendingSummary(key, group string) (PendingSummary, error) {
+	unlock := s.rlock(key)
+	defer unlock()
+
+	_, g, err := s.getGroup(key, group)
+	if err != nil {
+		return PendingSummary{}, err
+	}
+
+	ids := g.pendingIDs("")
+	summary := PendingSummary{Count: int64(len(ids))}
+	if len(ids) == 0 {
+		return summary, nil
+	}
+	summary.Min, summary.Max = ids[0], ids[len(ids)-1]
+
+	counts := map[string]int64{}
+	for _, pe := range g.pending {
+		counts[pe.Consumer]++
+	}
+	for name, count := range counts {
+		summary.Consumers = append(summary.Consumers, ConsumerPending{Name: name, Count: count})
+	}
+	sort.Slice(summary.Consumers, func(i, j int) bool { return summary.Consumers[i].Name < summary.Consumers[j].Name })
+	return summary, nil
+}
+
+// XPendingOptions is the extended form of XPENDING
+type XPendingOptions struct {
+	Start, End StreamID
+	Count      int
+	Consumer   string        // only this consumer's entries if set
+	MinIdle    time.Duration // only entries not delivered for this long
+}
+
+// XPending lists pending entries between Start and End in ID order
+func (s *InMemoryStore) XPending(key, group string, opts XPendingOptions) ([]PendingEntry, error) {
+	unlock := s.rlock(key)
+	defer unlock()
+
+	_, g, err := s.getGroup(key, group)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	result := []PendingEntry{}
+	for _, id := range g.pendingIDs(opts.Consumer) {
+		if len(result) == opts.Count {
+			break
+		}
+		pe := g.pending[id]
+		if id.Less(opts.Start) || opts.End.Less(id) || now.Sub(pe.DeliveredAt) < opts.MinIdle {
+			continue
+		}
+		result = append(result, *pe)
+	}
+	return result, nil
+}
+
+// XClaimOptions are the XCLAIM flags
+type XClaimOptions struct {
+	DeliveredAt time.Time // IDLE/TIME: the new delivery time, zero = now
+	RetryCount  *int64    // RETRYCOUNT: the new delivery count
+	Force       bool      // claim entries that aren't in the PEL
+	JustID      bool      // don't count a delivery, the caller only wants IDs
+}
+
+// XClaim gives pending entries idle for at least minIdle to consumer and
+// returns them. Entries deleted from the stream leave the PEL instead.
+func (s *InMemoryStore) XClaim(key, group, consumer string, minIdle time.Duration, ids []StreamID, opts XClaimOptions) ([]StreamEntry, error) {
+	unlock := s.lock(key)
+	defer unlock()
+
+	st, g, err := s.getGroup(key, group)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	deliveredAt := opts.DeliveredAt
+	if deliveredAt.IsZero() {
+		deliveredAt = now
+	}
+
+	claimed := []StreamEntry{}
+	changed := false
+	pending := len(g.pending)
+	for _, id := range ids {
+		entry, exists := st.lookup(id)
+		pe := g.pending[id]
+		if pe == nil {
+			if !opts.Force || !exists {
+				continue
+			}
+			pe = &PendingEntry{ID: id}
+			g.pending[id] = pe
+		}
+		if !exists {
+			delete(g.pending, id)
+			changed = true
+			continue
+		}
+		if minIdle > 0 && now.Sub(pe.DeliveredAt) < minIdle {
+			continue
+		}
+
+		pe.Consumer = consumer
+		pe.DeliveredAt = deliveredAt
+		if !opts.JustID {
+			pe.Deliveries++
+		}
+		if opts.RetryCount != nil {
+			pe.Deliveries = *opts.RetryCount
+		}
+		claimed = append(claimed, entry)
+		changed = true
+	}
+
+	if changed {
+		g.consumer(consumer, now)
+		s.putStream(key, st, int64(pendingOverhead*(len(g.pending)-pending)))
+	}
+	return copyEntries(claimed), nil
+}
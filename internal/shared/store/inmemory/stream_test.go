@@ -0,0 +1,271 @@
+package inmemory_test
+
+import (
+	inmemory "cli-t/internal/shared/store/inmemory"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func id(ms, seq uint64) inmemory.StreamID {
+	return inmemory.StreamID{Ms: ms, Seq: seq}
+}
+
+func TestParseStreamID(t *testing.T) {
+	for input, want := range map[string]inmemory.StreamID{
+		"-":   {},
+		"+":   inmemory.MaxStreamID,
+		"5":   id(5, 7),
+		"5-3": id(5, 3),
+	} {
+		got, err := inmemory.ParseStreamID(input, 7)
+		require.NoError(t, err, input)
+		assert.Equal(t, want, got, input)
+	}
+	for _, input := range []string{"", "x", "1-x", "-1", "1-2-3"} {
+		_, err := inmemory.ParseStreamID(input, 0)
+		assert.Equal(t, inmemory.ErrStreamID, err, input)
+	}
+}
+
+func TestXAddIDs(t *testing.T) {
+	s := inmemory.New()
+
+	got, ok, err := s.XAdd("s", "5-1", []string{"a", "1"}, inmemory.XAddOptions{})
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, id(5, 1), got)
+
+	got, _, err = s.XAdd("s", "5-*", []string{"a", "2"}, inmemory.XAddOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, id(5, 2), got)
+
+	_, _, err = s.XAdd("s", "5-2", []string{"a", "3"}, inmemory.XAddOptions{})
+	assert.Equal(t, inmemory.ErrStreamIDTooSmall, err)
+	_, _, err = s.XAdd("s", "4-*", []string{"a", "3"}, inmemory.XAddOptions{})
+	assert.Equal(t, inmemory.ErrStreamIDTooSmall, err)
+	_, _, err = s.XAdd("new", "0-0", []string{"a", "3"}, inmemory.XAddOptions{})
+	assert.Equal(t, inmemory.ErrStreamIDZero, err)
+
+	// "*" uses the clock, and never goes backwards
+	before := uint64(time.Now().UnixMilli())
+	got, _, err = s.XAdd("s", "*", []string{"a", "3"}, inmemory.XAddOptions{})
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, got.Ms, before)
+	_, _, err = s.XAdd("s", "99999999999999-0", []string{"a", "4"}, inmemory.XAddOptions{})
+	require.NoError(t, err)
+	got, _, err = s.XAdd("s", "*", []string{"a", "5"}, inmemory.XAddOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, id(99999999999999, 1), got)
+
+	// NOMKSTREAM doesn't create the key
+	_, ok, err = s.XAdd("none", "*", []string{"a", "1"}, inmemory.XAddOptions{NoMkStream: true})
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 0, s.Exists("none"))
+
+	s.Set("str", str("x"))
+	_, _, err = s.XAdd("str", "*", []string{"a", "1"}, inmemory.XAddOptions{})
+	assert.Equal(t, inmemory.ErrWrongType, err)
+
+	typ, _ := s.Type("s")
+	assert.Equal(t, inmemory.TypeStream, typ)
+}
+
+func TestXRangeDelTrim(t *testing.T) {
+	s := inmemory.New()
+	for i := uint64(1); i <= 10; i++ {
+		_, _, err := s.XAdd("s", id(i, 0).String(), []string{"n", id(i, 0).String()}, inmemory.XAddOptions{})
+		require.NoError(t, err)
+	}
+
+	all, err := s.XRange("s", id(0, 0), inmemory.MaxStreamID, 0, false)
+	require.NoError(t, err)
+	assert.Len(t, all, 10)
+
+	some, err := s.XRange("s", id(3, 0), id(6, 0), 2, false)
+	require.NoError(t, err)
+	assert.Equal(t, []inmemory.StreamEntry{
+		{ID: id(3, 0), Fields: []string{"n", "3-0"}},
+		{ID: id(4, 0), Fields: []string{"n", "4-0"}},
+	}, some)
+
+	rev, err := s.XRange("s", id(3, 0), id(6, 0), 0, true)
+	require.NoError(t, err)
+	require.Len(t, rev, 4)
+	assert.Equal(t, id(6, 0), rev[0].ID)
+
+	empty, err := s.XRange("s", id(6, 0), id(3, 0), 0, false)
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+
+	deleted, err := s.XDel("s", id(10, 0), id(5, 0), id(42, 0))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+
+	// The last ID stays, the next auto ID can't reuse a deleted one
+	last, _, err := s.XLastID("s")
+	require.NoError(t, err)
+	assert.Equal(t, id(10, 0), last)
+
+	trimmed, err := s.XTrim("s", inmemory.StreamTrim{MaxLen: 5})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), trimmed)
+	trimmed, err = s.XTrim("s", inmemory.StreamTrim{ByID: true, MinID: id(7, 0)})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), trimmed)
+	n, _ := s.XLen("s")
+	assert.Equal(t, int64(3), n)
+
+	assert.Equal(t, inmemory.ErrXSetIDTooSmall, s.XSetID("s", id(8, 0)))
+	require.NoError(t, s.XSetID("s", id(20, 0)))
+	_, _, err = s.XAdd("s", "15-0", []string{"a", "b"}, inmemory.XAddOptions{})
+	assert.Equal(t, inmemory.ErrStreamIDTooSmall, err)
+	assert.Equal(t, inmemory.ErrNoSuchKey, s.XSetID("missing", id(1, 0)))
+
+	// Trimming to nothing keeps an empty stream, like redis
+	_, err = s.XTrim("s", inmemory.StreamTrim{MaxLen: 0})
+	require.NoError(t, err)
+	assert.Equal(t, 1, s.Exists("s"))
+}
+
+func TestConsumerGroups(t *testing.T) {
+	s := inmemory.New()
+	assert.Equal(t, inmemory.ErrNoStreamKey, s.XGroupCreate("s", "g", "$", false))
+	require.NoError(t, s.XGroupCreate("s", "g", "$", true))
+	assert.Equal(t, inmemory.ErrBusyGroup, s.XGroupCreate("s", "g", "0", false))
+
+	for i := uint64(1); i <= 3; i++ {
+		_, _, err := s.XAdd("s", id(i, 0).String(), []string{"n", "v"}, inmemory.XAddOptions{})
+		require.NoError(t, err)
+	}
+
+	// New entries are split between consumers and become pending
+	first, err := s.XReadGroup("s", "g", "alice", inmemory.XReadGroupOptions{New: true, Count: 2})
+	require.NoError(t, err)
+	require.Len(t, first, 2)
+	second, err := s.XReadGroup("s", "g", "bob", inmemory.XReadGroupOptions{New: true})
+	require.NoError(t, err)
+	require.Len(t, second, 1)
+	assert.Equal(t, id(3, 0), second[0].ID)
+	none, err := s.XReadGroup("s", "g", "bob", inmemory.XReadGroupOptions{New: true})
+	require.NoError(t, err)
+	assert.Empty(t, none)
+
+	summary, err := s.XPendingSummary("s", "g")
+	require.NoError(t, err)
+	assert.Equal(t, inmemory.PendingSummary{
+		Count: 3, Min: id(1, 0), Max: id(3, 0),
+		Consumers: []inmemory.ConsumerPending{{Name: "alice", Count: 2}, {Name: "bob", Count: 1}},
+	}, summary)
+
+	// History: alice's pending entries again, one more delivery each
+	history, err := s.XReadGroup("s", "g", "alice", inmemory.XReadGroupOptions{After: id(1, 0)})
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, id(2, 0), history[0].ID)
+	pending, err := s.XPending("s", "g", inmemory.XPendingOptions{Start: id(0, 0), End: inmemory.MaxStreamID, Count: 10, Consumer: "alice"})
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	assert.Equal(t, int64(1), pending[0].Deliveries)
+	assert.Equal(t, int64(2), pending[1].Deliveries)
+
+	acked, err := s.XAck("s", "g", id(1, 0), id(1, 0), id(9, 0))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), acked)
+	acked, err = s.XAck("s", "nogroup", id(2, 0))
+	require.NoError(t, err)
+	assert.Zero(t, acked)
+
+	// A deleted pending entry comes back without fields
+	_, err = s.XDel("s", id(2, 0))
+	require.NoError(t, err)
+	history, err = s.XReadGroup("s", "g", "alice", inmemory.XReadGroupOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []inmemory.StreamEntry{{ID: id(2, 0)}}, history)
+
+	_, err = s.XReadGroup("s", "missing", "alice", inmemory.XReadGroupOptions{New: true})
+	var noGroup *inmemory.NoGroupError
+	require.ErrorAs(t, err, &noGroup)
+	assert.Equal(t, "NOGROUP No such key 's' or consumer group 'missing'", err.Error())
+}
+
+func TestXClaim(t *testing.T) {
+	s := inmemory.New()
+	require.NoError(t, s.XGroupCreate("s", "g", "0", true))
+	for i := uint64(1); i <= 3; i++ {
+		_, _, err := s.XAdd("s", id(i, 0).String(), []string{"n", "v"}, inmemory.XAddOptions{})
+		require.NoError(t, err)
+	}
+	_, err := s.XReadGroup("s", "g", "alice", inmemory.XReadGroupOptions{New: true})
+	require.NoError(t, err)
+
+	// Not idle long enough: nothing moves
+	claimed, err := s.XClaim("s", "g", "bob", time.Hour, []inmemory.StreamID{id(1, 0)}, inmemory.XClaimOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, claimed)
+
+	claimed, err = s.XClaim("s", "g", "bob", 0, []inmemory.StreamID{id(1, 0), id(2, 0)}, inmemory.XClaimOptions{})
+	require.NoError(t, err)
+	assert.Len(t, claimed, 2)
+
+	retries := int64(7)
+	past := time.Now().Add(-time.Minute)
+	_, err = s.XClaim("s", "g", "bob", 0, []inmemory.StreamID{id(3, 0)}, inmemory.XClaimOptions{DeliveredAt: past, RetryCount: &retries, JustID: true})
+	require.NoError(t, err)
+
+	pending, err := s.XPending("s", "g", inmemory.XPendingOptions{Start: id(0, 0), End: inmemory.MaxStreamID, Count: 10, MinIdle: 30 * time.Second})
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, inmemory.PendingEntry{ID: id(3, 0), Consumer: "bob", DeliveredAt: past, Deliveries: 7}, pending[0])
+
+	// Deleted entries leave the PEL when claimed
+	_, err = s.XDel("s", id(1, 0))
+	require.NoError(t, err)
+	claimed, err = s.XClaim("s", "g", "alice", 0, []inmemory.StreamID{id(1, 0)}, inmemory.XClaimOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, claimed)
+	summary, _ := s.XPendingSummary("s", "g")
+	assert.Equal(t, int64(2), summary.Count)
+
+	// FORCE adds an entry that was never delivered
+	require.NoError(t, s.XGroupCreate("s", "other", "$", false))
+	claimed, err = s.XClaim("s", "other", "carol", 0, []inmemory.StreamID{id(2, 0)}, inmemory.XClaimOptions{Force: true})
+	require.NoError(t, err)
+	assert.Len(t, claimed, 1)
+
+	dropped, err := s.XGroupDelConsumer("s", "g", "bob")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), dropped)
+	destroyed, err := s.XGroupDestroy("s", "g")
+	require.NoError(t, err)
+	assert.True(t, destroyed)
+}
+
+func TestStreamSnapshotIsACopy(t *testing.T) {
+	s := inmemory.New()
+	require.NoError(t, s.XGroupCreate("s", "g", "0", true))
+	_, _, err := s.XAdd("s", "1-0", []string{"a", "1"}, inmemory.XAddOptions{})
+	require.NoError(t, err)
+	_, err = s.XReadGroup("s", "g", "alice", inmemory.XReadGroupOptions{New: true})
+	require.NoError(t, err)
+
+	snapshot := s.Snapshot()
+	_, _, err = s.XAdd("s", "2-0", []string{"a", "2"}, inmemory.XAddOptions{})
+	require.NoError(t, err)
+	_, err = s.XAck("s", "g", id(1, 0))
+	require.NoError(t, err)
+
+	st := snapshot["s"].Stream
+	assert.Equal(t, 1, st.Len())
+	groups := st.Groups()
+	require.Len(t, groups, 1)
+	assert.Len(t, groups[0].Pending, 1)
+
+	restored := inmemory.New()
+	restored.Load(snapshot)
+	n, _ := restored.XLen("s")
+	assert.Equal(t, int64(1), n)
+}
@@ -2,7 +2,8 @@ package inmemory
 
 import (
 	"context"
-	"sync"
+	"errors"
+	"sync/atomic"
 	"time"
 )
 
@@ -11,23 +12,85 @@ type ValueType string
 const (
 	TypeString ValueType = "string"
 	TypeList   ValueType = "list"
+	TypeHash   ValueType = "hash"
+	TypeSet    ValueType = "set"
+	TypeZSet   ValueType = "zset"
+	TypeStream ValueType = "stream"
+)
+
+// Errors shared by all typed operations (messages are the exact redis replies)
+var (
+	ErrWrongType    = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	ErrNotInteger   = errors.New("ERR value is not an integer or out of range")
+	ErrHashNotInt   = errors.New("ERR hash value is not an integer")
+	ErrIncrOverflow = errors.New("ERR increment or decrement would overflow")
 )
 
 type StoreValue struct {
 	Type      ValueType
-	Data      string     // For strings
-	List      []string   // For lists
-	ExpiresAt *time.Time // nil = no expiry
+	Data      string              // For strings
+	List      []string            // For lists
+	Hash      map[string]string   // For hashes
+	Set       map[string]struct{} // For sets
+	ZSet      *SortedSet          // For sorted sets
+	Stream    *Stream             // For streams
+	ExpiresAt *time.Time          // nil = no expiry
+}
+
+// Clone returns a deep copy, so the copy can be read without holding the
+// store lock while the original keeps being modified
+func (v StoreValue) Clone() StoreValue {
+	clone := v
+	if v.List != nil {
+		clone.List = append([]string(nil), v.List...)
+	}
+	if v.Hash != nil {
+		clone.Hash = make(map[string]string, len(v.Hash))
+		for field, value := range v.Hash {
+			clone.Hash[field] = value
+		}
+	}
+	if v.Set != nil {
+		clone.Set = make(map[string]struct{}, len(v.Set))
+		for member := range v.Set {
+			clone.Set[member] = struct{}{}
+		}
+	}
+	if v.ZSet != nil {
+		clone.ZSet = v.ZSet.Clone()
+	}
+	if v.Stream != nil {
+		clone.Stream = v.Stream.Clone()
+	}
+	if v.ExpiresAt != nil {
+		expiresAt := *v.ExpiresAt
+		clone.ExpiresAt = &expiresAt
+	}
+	return clone
 }
 
+// KeyChangeFunc is called with the key's shard lock held every time a key
+// is written, deleted or expires. It must not call back into the store, and
+// may be called from several goroutines at once for keys in other shards.
+type KeyChangeFunc func(key string)
+
+// KeyEventFunc is told what happened to a key, named like redis' keyspace
+// events: "set", "lpush", "del", "expired", "evicted", ... Like
+// KeyChangeFunc it runs with the key's shard lock held and must not call
+// back into the store.
+type KeyEventFunc func(event, key string)
+
 // Store defines the key-value storage interface
 type Store interface {
 	Get(key string) (StoreValue, bool)
+	MGet(keys ...string) []*StoreValue
 	Set(key string, value StoreValue)
+	MSet(values map[string]StoreValue)
 	CleanExpiredKeys() int
 	StartExpiryWorker(ctx context.Context)
 	GetTTL(key string) int64
 	SetExpiry(key string, seconds int) bool
+	SetExpiryAt(key string, at time.Time) bool
 	Exists(keys ...string) int
 	Delete(keys ...string) int
 	Incr(key string) (int64, error)
@@ -35,11 +98,110 @@ type Store interface {
 	LPush(key string, values ...string) (int64, error)
 	RPush(key string, values ...string) (int64, error)
 	LRange(key string, start, stop int) ([]string, error)
+	LPop(key string, count int) ([]string, error)
+	RPop(key string, count int) ([]string, error)
+	LLen(key string) (int64, error)
+	LIndex(key string, index int) (string, bool, error)
+	LSet(key string, index int, value string) error
+	LRem(key string, count int, value string) (int64, error)
+	LTrim(key string, start, stop int) error
+	LInsert(key string, before bool, pivot, value string) (int64, error)
+	LMove(src, dst string, fromLeft, toLeft bool) (string, bool, error)
+
+	// Hashes
+	HSet(key string, fields map[string]string) (int64, error)
+	HSetNX(key, field, value string) (bool, error)
+	HGet(key, field string) (string, bool, error)
+	HGetAll(key string) (map[string]string, error)
+	HDel(key string, fields ...string) (int64, error)
+	HIncrBy(key, field string, delta int64) (int64, error)
+	HKeys(key string) ([]string, error)
+	HVals(key string) ([]string, error)
+	HLen(key string) (int64, error)
+	HExists(key, field string) (bool, error)
+
+	// Sets
+	SAdd(key string, members ...string) (int64, error)
+	SRem(key string, members ...string) (int64, error)
+	SMembers(key string) ([]string, error)
+	SIsMember(key, member string) (bool, error)
+	SCard(key string) (int64, error)
+	SInter(keys ...string) ([]string, error)
+	SUnion(keys ...string) ([]string, error)
+	SDiff(keys ...string) ([]string, error)
+
+	// Sorted sets
+	ZAdd(key string, members []ZMember, opts ZAddOptions) (int64, error)
+	ZIncrBy(key string, delta float64, member string) (float64, error)
+	ZRange(key string, start, stop int, reverse bool) ([]ZMember, error)
+	ZRangeByScore(key string, min, max ScoreBound, offset, count int, reverse bool) ([]ZMember, error)
+	ZRank(key, member string, reverse bool) (int64, bool, error)
+	ZScore(key, member string) (float64, bool, error)
+	ZRem(key string, members ...string) (int64, error)
+	ZCard(key string) (int64, error)
+
+	// Streams
+	XAdd(key, id string, fields []string, opts XAddOptions) (StreamID, bool, error)
+	XLen(key string) (int64, error)
+	XRange(key string, start, end StreamID, count int, reverse bool) ([]StreamEntry, error)
+	XLastID(key string) (StreamID, bool, error)
+	XDel(key string, ids ...StreamID) (int64, error)
+	XTrim(key string, trim StreamTrim) (int64, error)
+	XSetID(key string, id StreamID) error
+	XGroupCreate(key, group, id string, mkStream bool) error
+	XGroupSetID(key, group, id string) error
+	XGroupDestroy(key, group string) (bool, error)
+	XGroupCreateConsumer(key, group, consumer string) (bool, error)
+	XGroupDelConsumer(key, group, consumer string) (int64, error)
+	XReadGroup(key, group, consumer string, opts XReadGroupOptions) ([]StreamEntry, error)
+	XAck(key, group string, ids ...StreamID) (int64, error)
+	XPendingSummary(key, group string) (PendingSummary, error)
+	XPending(key, group string, opts XPendingOptions) ([]PendingEntry, error)
+	XClaim(key, group, consumer string, minIdle time.Duration, ids []StreamID, opts XClaimOptions) ([]StreamEntry, error)
 	// We'll add more methods later (Delete, Exists, etc.)
+
+	// Keyspace
+	Keys(pattern string) []string
+	Scan(cursor uint64, opts ScanOptions) ([]string, uint64)
+	Type(key string) (ValueType, bool)
+	Rename(src, dst string, nx bool) (bool, error)
+	Copy(src, dst string, replace bool) bool
+	Persist(key string) bool
+	GetPTTL(key string) int64
+	RandomKey() (string, bool)
+	DBSize() int
+	Flush()
+
+	// Persistence
+	Snapshot() map[string]StoreValue
+	BeginSnapshot() func() map[string]StoreValue
+	Load(data map[string]StoreValue)
+
+	// Memory limit
+	SetMaxMemory(limit int64, policy EvictionPolicy, samples int)
+	UsedMemory() int64
+	FreeMemory(limit int64) ([]string, error)
+
+	// Stats
+	Stats() Stats
+	ResetStats()
+
+	// OnKeyChange registers the change-tracking hook (WATCH, blocking ops, ...)
+	OnKeyChange(fn KeyChangeFunc)
+	// OnKeyEvent registers the keyspace notification hook
+	OnKeyEvent(fn KeyEventFunc)
 }
 
-// InMemoryStore is a thread-safe inmemory key-value store
+// InMemoryStore is a thread-safe inmemory key-value store. The keyspace is
+// split into shards (see shard.go), each with its own lock, so clients
+// working on different keys don't wait for each other.
 type InMemoryStore struct {
-	data map[string]StoreValue
-	mu   sync.RWMutex // ← Use RWMutex, not Mutex!
+	shards []*shard
+	mask   uint32 // len(shards)-1, shards is a power of two
+
+	onKeyChange  KeyChangeFunc // set with every shard locked, read under any
+	onKeyEvent   KeyEventFunc  // same
+	mem          memoryLimit   // maxmemory accounting and eviction
+	counters     counters      // expired/evicted totals
+	expireCursor atomic.Uint32 // shard the next active expiry cycle starts at
 }
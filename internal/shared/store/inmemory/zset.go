@@ -0,0 +1,406 @@
+package inmemory
+
+import (
+	"errors"
+	"math"
+)
+
+var (
+	ErrNotFloat    = errors.New("ERR value is not a valid float")
+	ErrScoreIsNaN  = errors.New("ERR resulting score is not a number (NaN)")
+	ErrZAddOptions = errors.New("ERR XX and NX options at the same time are not compatible")
+	ErrZAddGTLTNX  = errors.New("ERR GT, LT, and/or NX options at the same time are not compatible")
+)
+
+// ZMember is one (member, score) pair of a sorted set
+type ZMember struct {
+	Member string
+	Score  float64
+}
+
+// ScoreBound is one end of a score range, "(1.5" is {1.5, true}
+type ScoreBound struct {
+	Value     float64
+	Exclusive bool
+}
+
+func (b ScoreBound) lessOrEqual(score float64) bool {
+	if b.Exclusive {
+		return b.Value < score
+	}
+	return b.Value <= score
+}
+
+func (b ScoreBound) greaterOrEqual(score float64) bool {
+	if b.Exclusive {
+		return b.Value > score
+	}
+	return b.Value >= score
+}
+
+// ZAddOptions are the ZADD flags
+type ZAddOptions struct {
+	NX bool // only add new members
+	XX bool // only update existing members
+	GT bool // only update when the new score is greater
+	LT bool // only update when the new score is less
+	CH bool // count changed members, not only added ones
+}
+
+// SortedSet pairs a member→score map (O(1) ZSCORE) with a skip list
+// (ordered ranges and ranks in O(log n)), like redis' zset encoding.
+type SortedSet struct {
+	dict map[string]float64
+	zsl  *skipList
+}
+
+func NewSortedSet() *SortedSet {
+	return &SortedSet{
+		dict: make(map[string]float64),
+		zsl:  newSkipList(),
+	}
+}
+
+func (z *SortedSet) Len() int {
+	return len(z.dict)
+}
+
+func (z *SortedSet) Score(member string) (float64, bool) {
+	score, ok := z.dict[member]
+	return score, ok
+}
+
+// Add inserts or updates member. Returns true if it was newly added.
+func (z *SortedSet) Add(member string, score float64) bool {
+	if current, ok := z.dict[member]; ok {
+		if current != score {
+			z.zsl.delete(current, member)
+			z.zsl.insert(score, member)
+			z.dict[member] = score
+		}
+		return false
+	}
+
+	z.zsl.insert(score, member)
+	z.dict[member] = score
+	return true
+}
+
+// Remove deletes member. Returns false if it wasn't present.
+func (z *SortedSet) Remove(member string) bool {
+	score, ok := z.dict[member]
+	if !ok {
+		return false
+	}
+	z.zsl.delete(score, member)
+	delete(z.dict, member)
+	return true
+}
+
+// Rank returns the 0-based position of member in ascending order
+func (z *SortedSet) Rank(member string) (int, bool) {
+	score, ok := z.dict[member]
+	if !ok {
+		return 0, false
+	}
+	return z.zsl.rank(score, member) - 1, true
+}
+
+// RangeByRank returns members between 0-based ranks start and stop
+// (inclusive, already normalised). reverse walks from the highest score.
+func (z *SortedSet) RangeByRank(start, stop int, reverse bool) []ZMember {
+	if start > stop || start >= z.Len() {
+		return []ZMember{}
+	}
+
+	result := make([]ZMember, 0, stop-start+1)
+	var node *skipListNode
+	if reverse {
+		node = z.zsl.byRank(z.Len() - start)
+	} else {
+		node = z.zsl.byRank(start + 1)
+	}
+
+	for i := start; i <= stop && node != nil; i++ {
+		result = append(result, ZMember{Member: node.member, Score: node.score})
+		if reverse {
+			node = node.backward
+		} else {
+			node = node.level[0].forward
+		}
+	}
+	return result
+}
+
+// RangeByScore returns members with min <= score <= max, skipping offset
+// matches and returning at most count (count < 0 means no limit).
+func (z *SortedSet) RangeByScore(min, max ScoreBound, offset, count int, reverse bool) []ZMember {
+	result := []ZMember{}
+
+	var node *skipListNode
+	if reverse {
+		node = z.zsl.lastInRange(min, max)
+	} else {
+		node = z.zsl.firstInRange(min, max)
+	}
+
+	for node != nil && count != 0 {
+		if reverse && !min.lessOrEqual(node.score) {
+			break
+		}
+		if !reverse && !max.greaterOrEqual(node.score) {
+			break
+		}
+
+		if offset > 0 {
+			offset--
+		} else {
+			result = append(result, ZMember{Member: node.member, Score: node.score})
+			count--
+		}
+
+		if reverse {
+			node = node.backward
+		} else {
+			node = node.level[0].forward
+		}
+	}
+	return result
+}
+
+// Members returns every member in ascending score order
+func (z *SortedSet) Members() []ZMember {
+	return z.RangeByRank(0, z.Len()-1, false)
+}
+
+// Clone returns an independent copy of the sorted set
+func (z *SortedSet) Clone() *SortedSet {
+	clone := NewSortedSet()
+	for _, m := range z.Members() {
+		clone.Add(m.Member, m.Score)
+	}
+	return clone
+}
+
+// Private helper - assumes lock is already held!
+// Returns the sorted set stored at key, nil if the key doesn't exist.
+func (s *InMemoryStore) getZSet(key string) (*SortedSet, error) {
+	val, exists := s.getIfValid(key)
+	if !exists {
+		return nil, nil
+	}
+	if val.Type != TypeZSet {
+		return nil, ErrWrongType
+	}
+	return val.ZSet, nil
+}
+
+// ZAdd adds or updates members honouring the NX/XX/GT/LT/CH flags.
+// Returns the number of added members (or changed members with CH).
+func (s *InMemoryStore) ZAdd(key string, members []ZMember, opts ZAddOptions) (int64, error) {
+	if opts.NX && opts.XX {
+		return 0, ErrZAddOptions
+	}
+	if (opts.GT && opts.LT) || (opts.NX && (opts.GT || opts.LT)) {
+		return 0, ErrZAddGTLTNX
+	}
+	for _, m := range members {
+		if math.IsNaN(m.Score) {
+			return 0, ErrNotFloat
+		}
+	}
+
+	unlock := s.lock(key)
+	defer unlock()
+
+	val, exists := s.getIfValid(key)
+	if exists && val.Type != TypeZSet {
+		return 0, ErrWrongType
+	}
+	if !exists {
+		if opts.XX {
+			return 0, nil // XX never creates the key
+		}
+		val = StoreValue{Type: TypeZSet, ZSet: NewSortedSet()}
+	}
+
+	var added, changed, delta int64
+	for _, m := range members {
+		current, found := val.ZSet.Score(m.Member)
+		switch {
+		case found && opts.NX, !found && opts.XX:
+			continue
+		case found && opts.GT && m.Score <= current, found && opts.LT && m.Score >= current:
+			continue
+		}
+
+		if val.ZSet.Add(m.Member, m.Score) {
+			added++
+			changed++
+			delta += zsetMemberSize(m.Member)
+		} else if current != m.Score {
+			changed++
+		}
+	}
+
+	// Only a real change counts as a write (matters for WATCH)
+	if changed > 0 {
+		s.update(key, val, delta)
+		s.keyEvent("zadd", key)
+	}
+
+	if opts.CH {
+		return changed, nil
+	}
+	return added, nil
+}
+
+// ZIncrBy adds delta to member's score (missing member starts at 0)
+func (s *InMemoryStore) ZIncrBy(key string, delta float64, member string) (float64, error) {
+	unlock := s.lock(key)
+	defer unlock()
+
+	val, exists := s.getIfValid(key)
+	if exists && val.Type != TypeZSet {
+		return 0, ErrWrongType
+	}
+	if !exists {
+		val = StoreValue{Type: TypeZSet, ZSet: NewSortedSet()}
+	}
+
+	current, _ := val.ZSet.Score(member)
+	newScore := current + delta
+	if math.IsNaN(newScore) {
+		return 0, ErrScoreIsNaN
+	}
+
+	var grown int64
+	if val.ZSet.Add(member, newScore) {
+		grown = zsetMemberSize(member)
+	}
+	s.update(key, val, grown)
+	s.keyEvent("zincr", key)
+	return newScore, nil
+}
+
+// ZRange returns members by rank; negative indices count from the end
+func (s *InMemoryStore) ZRange(key string, start, stop int, reverse bool) ([]ZMember, error) {
+	unlock := s.rlock(key)
+	defer unlock()
+
+	zset, err := s.getZSet(key)
+	if err != nil || zset == nil {
+		return []ZMember{}, err
+	}
+
+	length := zset.Len()
+	if start < 0 {
+		start = length + start
+	}
+	if stop < 0 {
+		stop = length + stop
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+
+	return zset.RangeByRank(start, stop, reverse), nil
+}
+
+// ZRangeByScore returns members with scores inside [min, max]
+func (s *InMemoryStore) ZRangeByScore(key string, min, max ScoreBound, offset, count int, reverse bool) ([]ZMember, error) {
+	unlock := s.rlock(key)
+	defer unlock()
+
+	zset, err := s.getZSet(key)
+	if err != nil || zset == nil {
+		return []ZMember{}, err
+	}
+	if offset < 0 {
+		return []ZMember{}, nil
+	}
+
+	return zset.RangeByScore(min, max, offset, count, reverse), nil
+}
+
+// ZRank returns the 0-based rank of member (reverse = ZREVRANK)
+func (s *InMemoryStore) ZRank(key, member string, reverse bool) (int64, bool, error) {
+	unlock := s.rlock(key)
+	defer unlock()
+
+	zset, err := s.getZSet(key)
+	if err != nil || zset == nil {
+		return 0, false, err
+	}
+
+	rank, found := zset.Rank(member)
+	if !found {
+		return 0, false, nil
+	}
+	if reverse {
+		rank = zset.Len() - 1 - rank
+	}
+	return int64(rank), true, nil
+}
+
+func (s *InMemoryStore) ZScore(key, member string) (float64, bool, error) {
+	unlock := s.rlock(key)
+	defer unlock()
+
+	zset, err := s.getZSet(key)
+	if err != nil || zset == nil {
+		return 0, false, err
+	}
+
+	score, found := zset.Score(member)
+	return score, found, nil
+}
+
+// ZRem removes members and deletes the key once the set is empty
+func (s *InMemoryStore) ZRem(key string, members ...string) (int64, error) {
+	unlock := s.lock(key)
+	defer unlock()
+
+	val, exists := s.getIfValid(key)
+	if !exists {
+		return 0, nil
+	}
+	if val.Type != TypeZSet {
+		return 0, ErrWrongType
+	}
+
+	var removed, delta int64
+	for _, member := range members {
+		if val.ZSet.Remove(member) {
+			removed++
+			delta -= zsetMemberSize(member)
+		}
+	}
+
+	if removed == 0 {
+		return 0, nil
+	}
+	if val.ZSet.Len() == 0 {
+		s.del(key)
+		s.keyEvent("zrem", key)
+		s.keyEvent("del", key)
+	} else {
+		s.update(key, val, delta)
+		s.keyEvent("zrem", key)
+	}
+	return removed, nil
+}
+
+func (s *InMemoryStore) ZCard(key string) (int64, error) {
+	unlock := s.rlock(key)
+	defer unlock()
+
+	zset, err := s.getZSet(key)
+	if err != nil || zset == nil {
+		return 0, err
+	}
+	return int64(zset.Len()), nil
+}
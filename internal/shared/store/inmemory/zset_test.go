@@ -0,0 +1,130 @@
+package inmemory_test
+
+import (
+	inmemory "cli-t/internal/shared/store/inmemory"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func members(zs []inmemory.ZMember) []string {
+	names := make([]string, len(zs))
+	for i, z := range zs {
+		names[i] = z.Member
+	}
+	return names
+}
+
+func TestZAddAndRange(t *testing.T) {
+	s := inmemory.New()
+
+	added, err := s.ZAdd("board", []inmemory.ZMember{
+		{Member: "carol", Score: 30},
+		{Member: "alice", Score: 10},
+		{Member: "bob", Score: 20},
+		{Member: "dave", Score: 20},
+	}, inmemory.ZAddOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), added)
+
+	all, _ := s.ZRange("board", 0, -1, false)
+	assert.Equal(t, []string{"alice", "bob", "dave", "carol"}, members(all))
+
+	top, _ := s.ZRange("board", 0, 1, true)
+	assert.Equal(t, []string{"carol", "dave"}, members(top))
+
+	ranged, _ := s.ZRangeByScore("board",
+		inmemory.ScoreBound{Value: 10, Exclusive: true},
+		inmemory.ScoreBound{Value: math.Inf(1)}, 0, -1, false)
+	assert.Equal(t, []string{"bob", "dave", "carol"}, members(ranged))
+
+	limited, _ := s.ZRangeByScore("board",
+		inmemory.ScoreBound{Value: math.Inf(-1)},
+		inmemory.ScoreBound{Value: 20}, 1, 1, false)
+	assert.Equal(t, []string{"bob"}, members(limited))
+
+	rank, found, _ := s.ZRank("board", "dave", false)
+	assert.True(t, found)
+	assert.Equal(t, int64(2), rank)
+
+	rank, _, _ = s.ZRank("board", "dave", true)
+	assert.Equal(t, int64(1), rank)
+
+	score, _ := s.ZIncrBy("board", 25, "alice")
+	assert.Equal(t, float64(35), score)
+	all, _ = s.ZRange("board", -1, -1, false)
+	assert.Equal(t, []string{"alice"}, members(all))
+}
+
+func TestZAddOptions(t *testing.T) {
+	s := inmemory.New()
+	s.ZAdd("z", []inmemory.ZMember{{Member: "a", Score: 5}}, inmemory.ZAddOptions{})
+
+	// NX: don't touch existing members
+	n, _ := s.ZAdd("z", []inmemory.ZMember{{Member: "a", Score: 1}, {Member: "b", Score: 2}}, inmemory.ZAddOptions{NX: true})
+	assert.Equal(t, int64(1), n)
+	score, _, _ := s.ZScore("z", "a")
+	assert.Equal(t, float64(5), score)
+
+	// XX + CH: only update existing, count changes
+	n, _ = s.ZAdd("z", []inmemory.ZMember{{Member: "a", Score: 7}, {Member: "c", Score: 1}}, inmemory.ZAddOptions{XX: true, CH: true})
+	assert.Equal(t, int64(1), n)
+	_, found, _ := s.ZScore("z", "c")
+	assert.False(t, found)
+
+	// GT: only raise scores
+	s.ZAdd("z", []inmemory.ZMember{{Member: "a", Score: 3}}, inmemory.ZAddOptions{GT: true})
+	score, _, _ = s.ZScore("z", "a")
+	assert.Equal(t, float64(7), score)
+
+	_, err := s.ZAdd("z", []inmemory.ZMember{{Member: "a", Score: 1}}, inmemory.ZAddOptions{NX: true, XX: true})
+	assert.Equal(t, inmemory.ErrZAddOptions, err)
+
+	removed, _ := s.ZRem("z", "a", "b")
+	assert.Equal(t, int64(2), removed)
+	assert.Equal(t, 0, s.Exists("z"))
+}
+
+// Compare the skip list against a plain sorted slice under random churn
+func TestSortedSetMatchesReference(t *testing.T) {
+	z := inmemory.NewSortedSet()
+	ref := map[string]float64{}
+	rng := rand.New(rand.NewSource(42))
+
+	for i := 0; i < 5000; i++ {
+		member := fmt.Sprintf("m%d", rng.Intn(300))
+		if rng.Intn(4) == 0 {
+			z.Remove(member)
+			delete(ref, member)
+		} else {
+			score := float64(rng.Intn(50))
+			z.Add(member, score)
+			ref[member] = score
+		}
+	}
+
+	want := make([]inmemory.ZMember, 0, len(ref))
+	for m, sc := range ref {
+		want = append(want, inmemory.ZMember{Member: m, Score: sc})
+	}
+	sort.Slice(want, func(i, j int) bool {
+		if want[i].Score != want[j].Score {
+			return want[i].Score < want[j].Score
+		}
+		return want[i].Member < want[j].Member
+	})
+
+	require.Equal(t, len(want), z.Len())
+	assert.Equal(t, want, z.Members())
+
+	for i, m := range want {
+		rank, ok := z.Rank(m.Member)
+		require.True(t, ok)
+		require.Equal(t, i, rank, "rank of %s", m.Member)
+	}
+}
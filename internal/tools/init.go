@@ -43,6 +43,8 @@ func init() {
 		sort.New(),
 		calc.New(),
 		redis.New(),
+		redis.NewCLI(),
+		redis.NewBenchmark(),
 		grep.New(),
 		uniq.New(),
 		webserver.New(),
@@ -81,6 +83,8 @@ func RegisterAll() error {
 		sort.New(),
 		calc.New(),
 		redis.New(),
+		redis.NewCLI(),
+		redis.NewBenchmark(),
 		grep.New(),
 		uniq.New(),
 		webserver.New(),
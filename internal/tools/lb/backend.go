@@ -1,18 +1,28 @@
 package lb
 
 import (
+	"cli-t/internal/shared/logger"
 	"fmt"
+	"net"
+	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Backend represents a backend server
 type Backend struct {
-	URL   string
-	Alive bool
-	Proxy *httputil.ReverseProxy
-	mu    *sync.RWMutex //  reads >> writes
+	URL    string
+	Alive  bool
+	Weight int // share of the traffic relative to the others, at least 1
+	Proxy  *httputil.ReverseProxy
+	mu     *sync.RWMutex //  reads >> writes
+
+	transport *http.Transport // the backend's own, so closing it doesn't touch the others
+	active    atomic.Int64    // requests being proxied right now
+	breaker   *Breaker        // passive health from the proxied responses, nil to not track
 }
 
 // NewBackend creates a new backend server
@@ -35,13 +45,20 @@ func NewBackend(backendURL string) (*Backend, error) {
 
 	// Create proxy
 	proxy := httputil.NewSingleHostReverseProxy(targetURL)
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	proxy.Transport = transport
 
-	return &Backend{
-		URL:   backendURL,
-		Proxy: proxy,
-		Alive: true, //assume all backends are healthy until proven otherwise.
-		mu:    &sync.RWMutex{},
-	}, nil
+	b := &Backend{
+		URL:       backendURL,
+		Proxy:     proxy,
+		Alive:     true, //assume all backends are healthy until proven otherwise.
+		Weight:    1,
+		mu:        &sync.RWMutex{},
+		transport: transport,
+	}
+	proxy.ModifyResponse = b.onResponse
+	proxy.ErrorHandler = b.onError
+	return b, nil
 }
 
 func (b *Backend) SetAlive(alive bool) {
@@ -50,8 +67,90 @@ func (b *Backend) SetAlive(alive bool) {
 	b.Alive = alive
 }
 
+// IsAlive reports whether the backend passes its health checks
 func (b *Backend) IsAlive() bool {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 	return b.Alive
 }
+
+// inherit takes over what old, the same URL before a reload, knew: its last
+// health check and its circuit breaker. The breaker is shared, so requests
+// still running on old count too; it takes the new breaker settings.
+func (b *Backend) inherit(old *Backend) {
+	b.SetAlive(old.IsAlive())
+	if b.breaker != nil && old.breaker != nil {
+		old.breaker.reconfigure(b.breaker.config)
+		b.breaker = old.breaker
+	}
+}
+
+// setTimeouts limits dialing the backend and waiting for its response
+// headers, zero keeps the default
+func (b *Backend) setTimeouts(connect, responseHeader time.Duration) {
+	if connect > 0 {
+		b.transport.DialContext = (&net.Dialer{Timeout: connect, KeepAlive: 30 * time.Second}).DialContext
+	}
+	if responseHeader > 0 {
+		b.transport.ResponseHeaderTimeout = responseHeader
+	}
+}
+
+// ActiveRequests returns how many requests the backend is serving
+func (b *Backend) ActiveRequests() int64 {
+	return b.active.Load()
+}
+
+// begin counts a request the backend starts serving, call the returned
+// func once it is done
+func (b *Backend) begin() func() {
+	b.active.Add(1)
+	return func() { b.active.Add(-1) }
+}
+
+// Available reports whether the backend may get requests: alive and not
+// ejected by its circuit breaker
+func (b *Backend) Available() bool {
+	return b.IsAlive() && (b.breaker == nil || b.breaker.Allow())
+}
+
+// admit tells the breaker a request is on its way, false when it refuses:
+// a half-open breaker lets only its trial request through
+func (b *Backend) admit() bool {
+	return b.breaker == nil || b.breaker.Admit()
+}
+
+// BreakerState returns the state of the backend's circuit breaker
+func (b *Backend) BreakerState() BreakerState {
+	if b.breaker == nil {
+		return BreakerClosed
+	}
+	return b.breaker.State()
+}
+
+// onResponse is the proxy's ModifyResponse: a 5xx counts as a failure
+func (b *Backend) onResponse(resp *http.Response) error {
+	if b.breaker != nil {
+		if resp.StatusCode >= 500 {
+			b.breaker.Failure()
+		} else {
+			b.breaker.Success()
+		}
+	}
+	return nil
+}
+
+// onError is the proxy's ErrorHandler, called when the backend couldn't be
+// reached or its response couldn't be read
+func (b *Backend) onError(w http.ResponseWriter, r *http.Request, err error) {
+	// The client went away, the backend did nothing wrong
+	if r.Context().Err() == nil && b.breaker != nil {
+		b.breaker.Failure()
+	}
+	// Nothing was written yet, the handler tries another backend
+	if retry(r, err) {
+		return
+	}
+	logger.Warn("Proxy error", "url", b.URL, "path", r.URL.Path, "error", err)
+	w.WriteHeader(http.StatusBadGateway)
+}
@@ -0,0 +1,229 @@
+package lb
+
+import (
+	"cli-t/internal/shared/logger"
+	"sync"
+	"time"
+)
+
+// BreakerState is where a backend's circuit breaker stands
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // traffic flows
+	BreakerOpen                         // ejected until the cooldown is over
+	BreakerHalfOpen                     // on trial: one request goes through, its result closes or reopens it
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// BreakerConfig sets when a backend is ejected. A zero limit disables
+// that check, a zero config never ejects.
+type BreakerConfig struct {
+	MaxFailures     int           `mapstructure:"max_failures"`      // consecutive failures
+	MaxErrorPercent int           `mapstructure:"max_error_percent"` // failed share of the last ErrorWindow requests
+	ErrorWindow     int           `mapstructure:"error_window"`      // requests the error rate is computed over
+	Cooldown        time.Duration `mapstructure:"cooldown"`          // how long an ejected backend gets no traffic
+}
+
+// Breaker tracks the results of the requests proxied to one backend,
+// connection errors and 5xx count as failures
+type Breaker struct {
+	url    string
+	config BreakerConfig
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int       // consecutive
+	window   []bool    // last results, true for a failure
+	next     int       // slot of window written next
+	openedAt time.Time // when it last opened
+	trialAt  time.Time // half-open: when the trial request was admitted, zero before
+
+	now func() time.Time // time.Now, replaced by tests
+}
+
+// NewBreaker creates a closed breaker for the backend at url
+func NewBreaker(url string, config BreakerConfig) *Breaker {
+	return &Breaker{
+		url:    url,
+		config: config,
+		window: make([]bool, 0, config.ErrorWindow),
+		now:    time.Now,
+	}
+}
+
+// reconfigure applies new settings to a breaker kept by a reload, without
+// touching its state. The results counted for the error rate are dropped
+// when the window size changed.
+func (b *Breaker) reconfigure(config BreakerConfig) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if config.ErrorWindow != b.config.ErrorWindow {
+		b.window = make([]bool, 0, config.ErrorWindow)
+		b.next = 0
+	}
+	b.config = config
+}
+
+// State returns the breaker state, moving an open breaker whose cooldown
+// is over to half-open
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.refresh()
+}
+
+// Allow reports whether the backend may get a request: closed, or
+// half-open with its trial request not admitted yet. It only looks, Admit
+// takes the trial.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.refresh() {
+	case BreakerClosed:
+		return true
+	case BreakerHalfOpen:
+		return b.trialFree()
+	}
+	return false
+}
+
+// Admit is Allow for the request about to be sent: while half-open, the
+// first one admitted is the trial and the others are refused until its
+// result closes or reopens the breaker
+func (b *Breaker) Admit() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.refresh() {
+	case BreakerClosed:
+		return true
+	case BreakerHalfOpen:
+		if b.trialFree() {
+			b.trialAt = b.now()
+			return true
+		}
+	}
+	return false
+}
+
+// Success records a request the backend answered
+func (b *Breaker) Success() {
+	b.record(false)
+}
+
+// Failure records a request the backend failed
+func (b *Breaker) Failure() {
+	b.record(true)
+}
+
+func (b *Breaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		// A request picked before it opened, it says nothing new
+		return
+	case BreakerHalfOpen:
+		if failed {
+			b.open("trial request failed")
+		} else {
+			b.reset()
+			b.setState(BreakerClosed, "trial request succeeded")
+		}
+		return
+	}
+
+	if failed {
+		b.failures++
+	} else {
+		b.failures = 0
+	}
+	b.push(failed)
+
+	switch {
+	case b.config.MaxFailures > 0 && b.failures >= b.config.MaxFailures:
+		b.open("consecutive failures", "failures", b.failures)
+	case b.config.MaxErrorPercent > 0 && len(b.window) == b.config.ErrorWindow:
+		if rate := b.errorPercent(); rate >= b.config.MaxErrorPercent {
+			b.open("error rate", "errorPercent", rate, "window", len(b.window))
+		}
+	}
+}
+
+// Private helpers - assume b.mu is held!
+
+func (b *Breaker) refresh() BreakerState {
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.config.Cooldown {
+		b.trialAt = time.Time{}
+		b.setState(BreakerHalfOpen, "cooldown over")
+	}
+	return b.state
+}
+
+// trialFree reports whether a half-open breaker can admit a trial. A trial
+// that never reported back (its client hung up) is given up after a
+// cooldown, or the backend would stay out for good.
+func (b *Breaker) trialFree() bool {
+	return b.trialAt.IsZero() || b.now().Sub(b.trialAt) >= b.config.Cooldown
+}
+
+func (b *Breaker) push(failed bool) {
+	if b.config.ErrorWindow <= 0 {
+		return
+	}
+	if len(b.window) < b.config.ErrorWindow {
+		b.window = append(b.window, failed)
+	} else {
+		b.window[b.next] = failed
+	}
+	b.next = (b.next + 1) % b.config.ErrorWindow
+}
+
+func (b *Breaker) errorPercent() int {
+	failed := 0
+	for _, f := range b.window {
+		if f {
+			failed++
+		}
+	}
+	return failed * 100 / len(b.window)
+}
+
+func (b *Breaker) open(reason string, keyvals ...interface{}) {
+	b.openedAt = b.now()
+	b.reset()
+	b.setState(BreakerOpen, reason, keyvals...)
+}
+
+// reset forgets the results, a closed breaker starts from a clean slate
+func (b *Breaker) reset() {
+	b.failures = 0
+	b.window = b.window[:0]
+	b.next = 0
+}
+
+func (b *Breaker) setState(state BreakerState, reason string, keyvals ...interface{}) {
+	if state == b.state {
+		return
+	}
+	keyvals = append([]interface{}{"url", b.url, "from", b.state.String(), "to", state.String(), "reason", reason}, keyvals...)
+	if state == BreakerOpen {
+		logger.Warn("Circuit breaker", append(keyvals, "cooldown", b.config.Cooldown)...)
+	} else {
+		logger.Info("Circuit breaker", keyvals...)
+	}
+	b.state = state
+}
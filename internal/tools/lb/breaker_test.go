@@ -0,0 +1,140 @@
+package lb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testBreaker(config BreakerConfig) (*Breaker, *time.Time) {
+	b := NewBreaker("http://backend:8080", config)
+	now := time.Now()
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+func TestBreaker_ConsecutiveFailures(t *testing.T) {
+	b, now := testBreaker(BreakerConfig{MaxFailures: 3, Cooldown: 10 * time.Second})
+
+	b.Failure()
+	b.Failure()
+	b.Success() // starts over
+	b.Failure()
+	b.Failure()
+	assert.Equal(t, BreakerClosed, b.State())
+	b.Failure()
+	assert.Equal(t, BreakerOpen, b.State())
+	assert.False(t, b.Allow())
+
+	*now = now.Add(10 * time.Second)
+	assert.Equal(t, BreakerHalfOpen, b.State())
+	assert.True(t, b.Allow())
+
+	// The trial fails: open for another cooldown
+	b.Failure()
+	assert.Equal(t, BreakerOpen, b.State())
+	*now = now.Add(9 * time.Second)
+	assert.Equal(t, BreakerOpen, b.State())
+	*now = now.Add(time.Second)
+	assert.Equal(t, BreakerHalfOpen, b.State())
+
+	// The trial succeeds, the old failures are forgotten
+	b.Success()
+	assert.Equal(t, BreakerClosed, b.State())
+	b.Failure()
+	b.Failure()
+	assert.Equal(t, BreakerClosed, b.State())
+}
+
+func TestBreaker_HalfOpenAdmitsOneTrial(t *testing.T) {
+	b, now := testBreaker(BreakerConfig{MaxFailures: 1, Cooldown: 10 * time.Second})
+
+	b.Failure()
+	*now = now.Add(10 * time.Second)
+	assert.True(t, b.Allow())
+	assert.True(t, b.Admit())
+
+	// The trial is running: nobody else gets through
+	assert.False(t, b.Allow())
+	assert.False(t, b.Admit())
+	b.Success()
+	assert.True(t, b.Admit())
+	assert.True(t, b.Admit(), "closed again")
+
+	// A trial that never reports back is given up after a cooldown
+	b.Failure()
+	*now = now.Add(10 * time.Second)
+	assert.True(t, b.Admit())
+	*now = now.Add(9 * time.Second)
+	assert.False(t, b.Admit())
+	*now = now.Add(time.Second)
+	assert.True(t, b.Admit())
+	assert.Equal(t, BreakerHalfOpen, b.State())
+}
+
+func TestBreaker_ErrorRate(t *testing.T) {
+	b, _ := testBreaker(BreakerConfig{MaxErrorPercent: 50, ErrorWindow: 10, Cooldown: time.Second})
+
+	// Never two in a row, but the window isn't full yet
+	for range 4 {
+		b.Failure()
+		b.Success()
+	}
+	assert.Equal(t, BreakerClosed, b.State())
+
+	b.Success()
+	b.Success()
+	assert.Equal(t, BreakerClosed, b.State(), "4 failures in 10 requests")
+
+	// The window slides: the oldest failure goes, then two more come
+	b.Failure()
+	b.Failure()
+	assert.Equal(t, BreakerOpen, b.State(), "5 failures in 10 requests")
+}
+
+func TestBreaker_Disabled(t *testing.T) {
+	b, _ := testBreaker(BreakerConfig{})
+	for range 100 {
+		b.Failure()
+	}
+	assert.Equal(t, BreakerClosed, b.State())
+}
+
+func TestHandler_EjectsFailingBackend(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer healthy.Close()
+
+	h := testHandler(t, BreakerConfig{MaxFailures: 2, Cooldown: time.Hour}, RetryConfig{}, failing.URL, healthy.URL)
+
+	statuses := make([]int, 8)
+	for i := range statuses {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		statuses[i] = rec.Code
+	}
+
+	// Two 500s eject the failing backend, then everything goes to the other
+	assert.Equal(t, []int{500, 200, 500, 200, 200, 200, 200, 200}, statuses)
+	assert.Equal(t, BreakerOpen, h.backends[0].BreakerState())
+}
+
+func TestHandler_ConnectionErrors(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	h := testHandler(t, BreakerConfig{MaxFailures: 1, Cooldown: time.Hour}, RetryConfig{}, down.URL)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.Equal(t, BreakerOpen, h.backends[0].BreakerState())
+}
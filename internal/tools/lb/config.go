@@ -0,0 +1,205 @@
+package lb
+
+import (
+	"cli-t/internal/config"
+	"fmt"
+	"time"
+)
+
+// Config is the load balancer configuration, read from lb.yaml with
+// --config or built from the flags
+type Config struct {
+	Listeners   []string          `mapstructure:"listeners"` // addresses to listen on, like ":8080"
+	Timeouts    TimeoutsConfig    `mapstructure:"timeouts"`
+	HealthCheck HealthCheckConfig `mapstructure:"health_check"`
+	Breaker     BreakerConfig     `mapstructure:"breaker"`
+	Retry       RetryConfig       `mapstructure:"retry"`
+	Pools       []PoolConfig      `mapstructure:"pools"`
+	Routes      []RouteConfig     `mapstructure:"routes"`
+	DefaultPool string            `mapstructure:"default_pool"` // where requests no route matches go, optional with one pool
+}
+
+// TimeoutsConfig bounds the client and backend connections, zero means no
+// limit (connect and response_header keep net/http's defaults)
+type TimeoutsConfig struct {
+	Read           time.Duration `mapstructure:"read"`            // whole client request
+	ReadHeader     time.Duration `mapstructure:"read_header"`     // client request headers
+	Write          time.Duration `mapstructure:"write"`           // writing the response to the client
+	Idle           time.Duration `mapstructure:"idle"`            // keep-alive between client requests
+	Connect        time.Duration `mapstructure:"connect"`         // dialing a backend
+	ResponseHeader time.Duration `mapstructure:"response_header"` // waiting for a backend's headers
+	Shutdown       time.Duration `mapstructure:"shutdown"`        // draining requests on exit
+}
+
+// HealthCheckConfig sets the active health checks
+type HealthCheckConfig struct {
+	Interval time.Duration `mapstructure:"interval"`
+	Path     string        `mapstructure:"path"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+}
+
+// PoolConfig is a named set of backends and how requests are spread on them
+type PoolConfig struct {
+	Name        string             `mapstructure:"name"`
+	Strategy    string             `mapstructure:"strategy"`
+	HashKey     string             `mapstructure:"hash_key"`
+	Backends    []BackendConfig    `mapstructure:"backends"`
+	HealthCheck *HealthCheckConfig `mapstructure:"health_check"` // unset fields come from the global one
+}
+
+// BackendConfig is one backend of a pool
+type BackendConfig struct {
+	URL    string `mapstructure:"url"`
+	Weight int    `mapstructure:"weight"` // 1 when not set
+}
+
+// DefaultConfig returns the settings of every field neither the file nor
+// the flags set
+func DefaultConfig() *Config {
+	return &Config{
+		Listeners: []string{":8080"},
+		Timeouts: TimeoutsConfig{
+			ReadHeader: 10 * time.Second,
+			Idle:       2 * time.Minute,
+			Shutdown:   5 * time.Second,
+		},
+		HealthCheck: HealthCheckConfig{
+			Interval: 10 * time.Second,
+			Path:     "/",
+			Timeout:  5 * time.Second,
+		},
+		Breaker: BreakerConfig{
+			MaxFailures:     5,
+			MaxErrorPercent: 50,
+			ErrorWindow:     20,
+			Cooldown:        30 * time.Second,
+		},
+		Retry: RetryConfig{
+			Retries:      1,
+			MaxBodyBytes: 1 << 20,
+		},
+	}
+}
+
+// LoadConfig reads the YAML file at path over the defaults
+func LoadConfig(path string) (*Config, error) {
+	cfg := DefaultConfig()
+	if err := config.LoadFile(path, cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Validate checks what the handler can't start without
+func (c *Config) Validate() error {
+	if len(c.Listeners) == 0 {
+		return fmt.Errorf("no listeners")
+	}
+	if c.HealthCheck.Interval <= 0 {
+		return fmt.Errorf("health_check.interval must be positive")
+	}
+	if c.Breaker.MaxErrorPercent > 0 && c.Breaker.ErrorWindow <= 0 {
+		return fmt.Errorf("breaker.error_window must be positive with breaker.max_error_percent")
+	}
+	if len(c.Pools) == 0 {
+		return fmt.Errorf("no pools")
+	}
+
+	names := make(map[string]bool)
+	for i := range c.Pools {
+		pool := &c.Pools[i]
+		if pool.Name == "" {
+			return fmt.Errorf("pool %d has no name", i)
+		}
+		if names[pool.Name] {
+			return fmt.Errorf("pool %q defined twice", pool.Name)
+		}
+		names[pool.Name] = true
+
+		if len(pool.Backends) == 0 {
+			return fmt.Errorf("pool %q has no backends", pool.Name)
+		}
+		if pool.Strategy == "" {
+			pool.Strategy = StrategyRoundRobin
+		}
+		pool.HealthCheck = mergeHealthCheck(pool.HealthCheck, c.HealthCheck)
+		for j := range pool.Backends {
+			if pool.Backends[j].Weight == 0 {
+				pool.Backends[j].Weight = 1
+			}
+		}
+		if _, err := NewStrategy(pool.Strategy, pool.HashKey); err != nil {
+			return fmt.Errorf("pool %q: %w", pool.Name, err)
+		}
+	}
+
+	for i, route := range c.Routes {
+		name := route.Name
+		if name == "" {
+			name = fmt.Sprint(i)
+		}
+		if !names[route.Pool] {
+			return fmt.Errorf("route %s: pool %q is not a pool", name, route.Pool)
+		}
+		if route.StripPrefix && route.Match.PathPrefix == "" {
+			return fmt.Errorf("route %s: strip_prefix needs match.path_prefix", name)
+		}
+		if route.Rewrite != "" && route.Match.PathRegex == "" {
+			return fmt.Errorf("route %s: rewrite needs match.path_regex", name)
+		}
+		if _, err := newRoute(route, nil); err != nil {
+			return err
+		}
+	}
+
+	// With routes, requests no route matches may as well get a 404
+	if c.DefaultPool == "" && len(c.Pools) > 1 && len(c.Routes) == 0 {
+		return fmt.Errorf("default_pool is required with more than one pool and no routes")
+	}
+	if c.DefaultPool != "" && !names[c.DefaultPool] {
+		return fmt.Errorf("default_pool %q is not a pool", c.DefaultPool)
+	}
+	return nil
+}
+
+// mergeHealthCheck fills the fields pool doesn't set from global
+func mergeHealthCheck(pool *HealthCheckConfig, global HealthCheckConfig) *HealthCheckConfig {
+	merged := global
+	if pool != nil {
+		if pool.Interval > 0 {
+			merged.Interval = pool.Interval
+		}
+		if pool.Path != "" {
+			merged.Path = pool.Path
+		}
+		if pool.Timeout > 0 {
+			merged.Timeout = pool.Timeout
+		}
+	}
+	return &merged
+}
+
+// pool returns the pool called name
+func (c *Config) pool(name string) *PoolConfig {
+	for i := range c.Pools {
+		if c.Pools[i].Name == name {
+			return &c.Pools[i]
+		}
+	}
+	return nil
+}
+
+// defaultPool returns the pool requests no route matches go to, nil when
+// they have none
+func (c *Config) defaultPool() *PoolConfig {
+	if c.DefaultPool == "" {
+		if len(c.Pools) == 1 {
+			return &c.Pools[0]
+		}
+		return nil
+	}
+	return c.pool(c.DefaultPool)
+}
@@ -0,0 +1,177 @@
+package lb
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lb.yaml")
+	writeConfig(t, path, `
+listeners: [":8080", ":8081"]
+timeouts:
+  read: 30s
+  response_header: 2s
+health_check:
+  path: /healthz
+breaker:
+  max_failures: 3
+  cooldown: 1m
+retry:
+  retries: 2
+pools:
+  - name: web
+    strategy: weighted-round-robin
+    backends:
+      - url: http://big:9000
+        weight: 5
+      - url: http://small:9000
+  - name: api
+    strategy: consistent-hash
+    hash_key: header:X-User
+    backends:
+      - url: http://api:9000
+default_pool: web
+`)
+
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{":8080", ":8081"}, cfg.Listeners)
+	assert.Equal(t, 30*time.Second, cfg.Timeouts.Read)
+	assert.Equal(t, 2*time.Second, cfg.Timeouts.ResponseHeader)
+	assert.Equal(t, 5*time.Second, cfg.Timeouts.Shutdown, "default")
+	assert.Equal(t, "/healthz", cfg.HealthCheck.Path)
+	assert.Equal(t, 10*time.Second, cfg.HealthCheck.Interval, "default")
+	assert.Equal(t, BreakerConfig{MaxFailures: 3, MaxErrorPercent: 50, ErrorWindow: 20, Cooldown: time.Minute}, cfg.Breaker)
+	assert.Equal(t, RetryConfig{Retries: 2, MaxBodyBytes: 1 << 20}, cfg.Retry)
+
+	require.Len(t, cfg.Pools, 2)
+	assert.Equal(t, []BackendConfig{{URL: "http://big:9000", Weight: 5}, {URL: "http://small:9000", Weight: 1}}, cfg.Pools[0].Backends)
+	assert.Equal(t, "header:X-User", cfg.Pools[1].HashKey)
+	assert.Equal(t, "web", cfg.defaultPool().Name)
+}
+
+func TestLoadConfig_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lb.yaml")
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"no pools", `listeners: [":8080"]`},
+		{"no backends", "pools:\n  - name: web\n"},
+		{"unnamed pool", "pools:\n  - backends: [{url: 'http://a:1'}]\n"},
+		{"duplicate pool", "pools:\n  - {name: web, backends: [{url: 'http://a:1'}]}\n  - {name: web, backends: [{url: 'http://b:1'}]}\n"},
+		{"unknown strategy", "pools:\n  - {name: web, strategy: fastest, backends: [{url: 'http://a:1'}]}\n"},
+		{"no default pool nor routes", "pools:\n  - {name: a, backends: [{url: 'http://a:1'}]}\n  - {name: b, backends: [{url: 'http://b:1'}]}\n"},
+		{"unknown default pool", "default_pool: c\npools:\n  - {name: a, backends: [{url: 'http://a:1'}]}\n"},
+		{"bad duration", "health_check: {interval: soon}\npools:\n  - {name: a, backends: [{url: 'http://a:1'}]}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeConfig(t, path, tt.content)
+			_, err := LoadConfig(path)
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := LoadConfig(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestBalancer_Reload(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte("old"))
+	}))
+	defer slow.Close()
+	replacement := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("new"))
+	}))
+	defer replacement.Close()
+
+	path := filepath.Join(t.TempDir(), "lb.yaml")
+	writeConfig(t, path, "pools:\n  - {name: web, backends: [{url: '"+slow.URL+"'}]}\n")
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+	b, err := newBalancer(cfg)
+	require.NoError(t, err)
+	defer b.Close()
+
+	lb := httptest.NewServer(b)
+	defer lb.Close()
+
+	// A request in flight on the old backend set
+	inFlight := make(chan string)
+	go func() {
+		resp, err := http.Get(lb.URL)
+		if err != nil {
+			inFlight <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		inFlight <- string(body)
+	}()
+	require.Eventually(t, func() bool { return b.current.Load().pools["web"].backends[0].ActiveRequests() == 1 }, time.Second, 5*time.Millisecond)
+
+	writeConfig(t, path, "listeners: [':9999']\npools:\n  - {name: web, backends: [{url: '"+replacement.URL+"'}]}\n")
+	cfg = b.reload(path, cfg)
+	assert.Equal(t, []string{":8080"}, cfg.Listeners, "listeners only change on restart")
+
+	resp, err := http.Get(lb.URL)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "new", string(body))
+
+	close(release)
+	assert.Equal(t, "old", <-inFlight)
+
+	// An invalid file keeps the running config
+	writeConfig(t, path, "pools: []\n")
+	assert.Same(t, cfg, b.reload(path, cfg))
+}
+
+func TestBalancer_ReloadKeepsBackendState(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer up.Close()
+
+	path := filepath.Join(t.TempDir(), "lb.yaml")
+	pool := "pools:\n  - {name: web, backends: [{url: 'http://dead.invalid'}, {url: 'http://ejected.invalid'}, {url: '" + up.URL + "'}]}\n"
+	writeConfig(t, path, "breaker: {max_failures: 1, cooldown: 1m}\n"+pool)
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+	b, err := newBalancer(cfg)
+	require.NoError(t, err)
+	defer b.Close()
+
+	backends := b.current.Load().pools["web"].backends
+	backends[0].SetAlive(false)
+	backends[1].breaker.Failure()
+	require.Equal(t, BreakerOpen, backends[1].BreakerState())
+
+	// Same backends, other settings: what the health checks and the
+	// breakers found out still holds, the next check is 10s away
+	writeConfig(t, path, "breaker: {max_failures: 3, cooldown: 1m}\n"+pool)
+	b.reload(path, cfg)
+	backends = b.current.Load().pools["web"].backends
+	assert.False(t, backends[0].IsAlive())
+	assert.Equal(t, BreakerOpen, backends[1].BreakerState())
+	assert.True(t, backends[2].Available())
+	assert.Equal(t, 3, backends[1].breaker.config.MaxFailures)
+}
@@ -3,96 +3,167 @@ package lb
 
 import (
 	"cli-t/internal/shared/logger"
-	"time"
 
 	"fmt"
 	"net/http"
-	"sync"
+	"strconv"
 )
 
-// Handler handles incoming HTTP requests and forwards them to backend servers
+// Handler handles incoming HTTP requests and forwards them to the backends
+// of one pool
 type Handler struct {
-	// Future: backend pool, algorithm, health checker
-	backends     []*Backend
-	currentIndex int
-	mu           sync.Mutex
-	healthCheck  *Checker
+	pool        string
+	backends    []*Backend
+	strategy    Strategy
+	retry       RetryConfig
+	healthCheck *Checker
 }
 
-// NewHandler creates a new load balancer handler
-func NewHandler(backendURLs []string, healthCheckInterval, healthCheckPath, healthCheckTimeout string) (*Handler, error) {
-	backends := make([]*Backend, 0, len(backendURLs))
+// NewHandler creates a load balancer handler for pool, with the breaker,
+// retry and backend timeout settings of cfg. The pool's health check
+// defaults to the one of cfg.
+func NewHandler(pool PoolConfig, cfg *Config) (*Handler, error) {
+	strategy, err := NewStrategy(pool.Strategy, pool.HashKey)
+	if err != nil {
+		return nil, err
+	}
 
-	logger.Info("backend", "urls", backendURLs)
+	logger.Info("backend", "pool", pool.Name, "backends", pool.Backends, "strategy", pool.Strategy)
 
-	for _, url := range backendURLs {
-		backend, err := NewBackend(url)
+	backends := make([]*Backend, 0, len(pool.Backends))
+	for _, bc := range pool.Backends {
+		backend, err := NewBackend(bc.URL)
 		if err != nil {
-			return nil, fmt.Errorf("invalid backend %s: %w", url, err)
+			return nil, fmt.Errorf("invalid backend %s: %w", bc.URL, err)
+		}
+		if bc.Weight < 1 {
+			return nil, fmt.Errorf("invalid weight %d for backend %s: must be at least 1", bc.Weight, bc.URL)
 		}
+		backend.Weight = bc.Weight
+		backend.breaker = NewBreaker(bc.URL, cfg.Breaker)
+		backend.setTimeouts(cfg.Timeouts.Connect, cfg.Timeouts.ResponseHeader)
 		backends = append(backends, backend)
 	}
 
-	// Parse duration strings
-	interval, err := time.ParseDuration(healthCheckInterval)
-	if err != nil {
-		return nil, fmt.Errorf("invalid health check interval: %w", err)
-	}
-
-	timeout, err := time.ParseDuration(healthCheckTimeout)
-	if err != nil {
-		return nil, fmt.Errorf("invalid health check timeout: %w", err)
-	}
-
-	checker := NewChecker(backends, interval, healthCheckPath, timeout, nil)
+	health := mergeHealthCheck(pool.HealthCheck, cfg.HealthCheck)
+	checker := NewChecker(backends, health.Interval, health.Path, health.Timeout, nil)
 	checker.Start()
 
 	return &Handler{
-		backends:     backends,
-		currentIndex: 0,
-		healthCheck:  checker,
+		pool:        pool.Name,
+		backends:    backends,
+		strategy:    strategy,
+		retry:       cfg.Retry,
+		healthCheck: checker,
 	}, nil
 }
 
 // ServeHTTP implements http.Handler interface
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Get next backend using round robin
-	backend := h.nextBackend()
+	body, retryable, err := retryBody(r, h.retry.MaxBodyBytes)
+	if err != nil {
+		logger.Warn("Reading request body failed", "from", r.RemoteAddr, "error", err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	tried := make(map[*Backend]bool)
+	backend := h.nextBackend(r, nil)
+	for retries := 0; ; retries++ {
+		tried[backend] = true
+		a := &attempt{canRetry: retryable && retries < h.retry.Retries}
+		h.forward(w, attemptRequest(r, a, body), backend, retries)
+		if a.err == nil {
+			return
+		}
+
+		failed := backend
+		if backend = h.nextBackend(r, tried); backend == nil {
+			logger.Warn("No backend left to retry on", "from", r.RemoteAddr, "path", r.URL.Path, "retries", retries, "error", a.err)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		logger.Warn("Retrying request",
+			"path", r.URL.Path,
+			"method", r.Method,
+			"failed", failed.URL,
+			"next", backend.URL,
+			"error", a.err,
+		)
+		w.Header().Set("X-Retry-Count", strconv.Itoa(retries+1))
+	}
+}
 
+// forward proxies one attempt of the request to backend
+func (h *Handler) forward(w http.ResponseWriter, r *http.Request, backend *Backend, retries int) {
 	// Log request details
 	logger.Info("Forwarding request",
+		"pool", h.pool,
 		"from", r.RemoteAddr,
 		"to", backend.URL,
 		"path", r.URL.Path,
 		"method", r.Method,
 		"protocol", r.Proto,
+		"active", backend.ActiveRequests(),
+		"breaker", backend.BreakerState().String(),
+		"retries", retries,
 	)
 
+	done := backend.begin()
+	defer done()
 	backend.Proxy.ServeHTTP(w, r)
 }
 
-// Simple Round Robin
-func (h *Handler) nextBackend() *Backend {
-	h.mu.Lock()
-	defer h.mu.Unlock()
+// nextBackend asks the strategy to pick among the available backends not
+// in tried. With tried nil it falls back to the first backend when none is
+// available, otherwise it returns nil.
+func (h *Handler) nextBackend(r *http.Request, tried map[*Backend]bool) *Backend {
+	refused := make(map[*Backend]bool)
+	for {
+		alive := make([]*Backend, 0, len(h.backends))
+		for _, backend := range h.backends {
+			if backend.Available() && !tried[backend] && !refused[backend] {
+				alive = append(alive, backend)
+			}
+		}
 
-	for i := 0; i < len(h.backends); i++ {
-		backend := h.backends[h.currentIndex]
-		h.currentIndex = (h.currentIndex + 1) % len(h.backends) // can store length as well : will be lil faster
+		if len(alive) == 0 {
+			if tried != nil {
+				return nil
+			}
+			// All dead, return first anyway
+			return h.backends[0]
+		}
 
-		logger.Info("index", "index", h.currentIndex)
-		if backend.IsAlive() {
+		backend := h.strategy.Next(alive, r)
+		if backend.admit() {
 			return backend
 		}
+		// Half-open and another request took the trial meanwhile
+		refused[backend] = true
 	}
+}
 
-	// All dead, return first anyway
-	return h.backends[0]
+// inherit carries the state of old's backends over to the backends with
+// the same URL
+func (h *Handler) inherit(old *Handler) {
+	byURL := make(map[string]*Backend, len(old.backends))
+	for _, backend := range old.backends {
+		byURL[backend.URL] = backend
+	}
+	for _, backend := range h.backends {
+		if previous, ok := byURL[backend.URL]; ok {
+			backend.inherit(previous)
+		}
+	}
 }
 
-// Close cleans up resources
+// Close stops the health checks and closes the idle backend connections.
+// Requests being proxied carry on.
 func (h *Handler) Close() error {
-	// TODO: Close backend connections, stop health checks
 	h.healthCheck.Stop()
+	for _, backend := range h.backends {
+		backend.transport.CloseIdleConnections()
+	}
 	return nil
 }
@@ -3,13 +3,16 @@ package lb
 
 import (
 	"cli-t/internal/command"
+	"cli-t/internal/config"
 	"cli-t/internal/shared/logger"
 	"context"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -25,7 +28,7 @@ func (c *Command) Name() string {
 }
 
 func (c *Command) Usage() string {
-	return "lb --port <port>"
+	return "lb --port <port> --backends <urls> | lb --config lb.yaml"
 }
 
 func (c *Command) Description() string {
@@ -38,6 +41,20 @@ func (c *Command) ValidateArgs(args []string) error {
 
 func (c *Command) DefineFlags() []command.Flag {
 	return []command.Flag{
+		{
+			Name:      "config",
+			Shorthand: "c",
+			Usage:     "YAML config file (e.g., lb.yaml), replaces the other flags; SIGHUP reloads it",
+			Type:      "string",
+			Default:   "",
+		},
+		{
+			Name:      "watch",
+			Shorthand: "",
+			Usage:     "Reload --config every time the file changes",
+			Type:      "bool",
+			Default:   false,
+		},
 		{
 			Name:      "port",
 			Shorthand: "p",
@@ -73,60 +90,219 @@ func (c *Command) DefineFlags() []command.Flag {
 			Type:      "string",
 			Default:   "5s",
 		},
+		{
+			Name:      "strategy",
+			Shorthand: "s",
+			Usage:     "Load-balancing strategy: round-robin, weighted-round-robin, least-requests, power-of-two, ip-hash or consistent-hash",
+			Type:      "string",
+			Default:   StrategyRoundRobin,
+		},
+		{
+			Name:      "weights",
+			Shorthand: "w",
+			Usage:     "Backend weights in the order of --backends (e.g., 5,1,1)",
+			Type:      "string",
+			Default:   "",
+		},
+		{
+			Name:      "hash-key",
+			Shorthand: "",
+			Usage:     "What consistent-hash hashes: header:<name> or cookie:<name> (default: the client IP)",
+			Type:      "string",
+			Default:   "",
+		},
+		{
+			Name:      "max-failures",
+			Shorthand: "",
+			Usage:     "Consecutive failed requests (connection error or 5xx) that eject a backend, 0 to disable",
+			Type:      "int",
+			Default:   5,
+		},
+		{
+			Name:      "max-error-percent",
+			Shorthand: "",
+			Usage:     "Failed percentage of the last --error-window requests that ejects a backend, 0 to disable",
+			Type:      "int",
+			Default:   50,
+		},
+		{
+			Name:      "error-window",
+			Shorthand: "",
+			Usage:     "Number of requests the error rate is computed over",
+			Type:      "int",
+			Default:   20,
+		},
+		{
+			Name:      "breaker-cooldown",
+			Shorthand: "",
+			Usage:     "How long an ejected backend gets no traffic before a trial request (e.g., 30s)",
+			Type:      "string",
+			Default:   "30s",
+		},
+		{
+			Name:      "retries",
+			Shorthand: "r",
+			Usage:     "Other backends a failed request is retried on: any method when the connection failed, idempotent ones on any error",
+			Type:      "int",
+			Default:   1,
+		},
+		{
+			Name:      "retry-body-limit",
+			Shorthand: "",
+			Usage:     "Largest request body in bytes buffered so it can be retried, larger ones are never retried",
+			Type:      "int",
+			Default:   1 << 20,
+		},
 	}
 }
 
 func (c *Command) Execute(ctx context.Context, args *command.Args) error {
-	port, backends, healthCheckInterval, healthCheckPath, healthCheckTimeout := c.parseFlags(args.Flags)
+	configPath, _ := args.Flags["config"].(string)
+	watch, _ := args.Flags["watch"].(bool)
 
-	// Validate backend URL
-	if len(backends) == 0 {
-		return fmt.Errorf("backend URL is required")
+	var cfg *Config
+	var err error
+	if configPath != "" {
+		cfg, err = LoadConfig(configPath)
+	} else if watch {
+		err = fmt.Errorf("--watch needs --config")
+	} else {
+		cfg, err = c.configFromFlags(args.Flags)
+	}
+	if err != nil {
+		return err
 	}
 
 	// Create handler
-	handler, err := NewHandler(backends, healthCheckInterval, healthCheckPath, healthCheckTimeout)
+	handler, err := newBalancer(cfg)
 	if err != nil {
 		return fmt.Errorf("failed to create handler: %w", err)
 	}
 
-	// Create server
-	server := &http.Server{
-		Addr:    fmt.Sprintf(":%d", port),
-		Handler: handler,
+	// Create servers, one per listener
+	servers := make([]*http.Server, len(cfg.Listeners))
+	for i, addr := range cfg.Listeners {
+		servers[i] = &http.Server{
+			Addr:              addr,
+			Handler:           handler,
+			ReadTimeout:       cfg.Timeouts.Read,
+			ReadHeaderTimeout: cfg.Timeouts.ReadHeader,
+			WriteTimeout:      cfg.Timeouts.Write,
+			IdleTimeout:       cfg.Timeouts.Idle,
+		}
 	}
 
-	// Start server in goroutine
-	go func() {
-		logger.Info("Starting load balancer", "port", port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Fatal("Server failed", "error", err)
+	// Reload on SIGHUP, and on every write of the file with --watch. Set up
+	// before the servers start: an unhandled SIGHUP kills the process
+	reload := make(chan struct{}, 1)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	if watch {
+		err := config.WatchFile(configPath, func() {
+			select {
+			case reload <- struct{}{}:
+			default: // one is already pending
+			}
+		})
+		if err != nil {
+			return err
 		}
-	}()
+	}
 
-	// Wait for interrupt signal
+	// Shut down on interrupt
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+
+	// Start servers in goroutines
+	for _, server := range servers {
+		go func() {
+			logger.Info("Starting load balancer", "addr", server.Addr)
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Fatal("Server failed", "error", err)
+			}
+		}()
+	}
+
+	for running := true; running; {
+		select {
+		case <-hup:
+			if configPath == "" {
+				logger.Warn("SIGHUP ignored: no --config to reload")
+				continue
+			}
+			cfg = handler.reload(configPath, cfg)
+		case <-reload:
+			cfg = handler.reload(configPath, cfg)
+		case <-quit:
+			running = false
+		}
+	}
 
 	logger.Info("Shutting down server...")
 
-	// Graceful shutdown
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	// Graceful shutdown: stop accepting, let the requests being proxied finish
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Timeouts.Shutdown)
 	defer cancel()
 
-	if err := handler.Close(); err != nil {
-		logger.Error("Error closing handler", "error", err)
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := server.Shutdown(shutdownCtx); err != nil {
+				logger.Error("Server forced to shutdown", "addr", server.Addr, "error", err)
+			}
+		}()
 	}
+	wg.Wait()
 
-	if err := server.Shutdown(shutdownCtx); err != nil {
-		logger.Fatal("Server forced to shutdown", "error", err)
+	if err := handler.Close(); err != nil {
+		logger.Error("Error closing handler", "error", err)
 	}
 
 	logger.Info("Server stopped gracefully")
 	return nil
 }
 
+// configFromFlags builds a one-pool config out of the flags
+func (c *Command) configFromFlags(flags map[string]interface{}) (*Config, error) {
+	port, backends, healthCheckInterval, healthCheckPath, healthCheckTimeout := c.parseFlags(flags)
+
+	// Validate backend URL
+	if len(backends) == 0 {
+		return nil, fmt.Errorf("backend URL is required")
+	}
+
+	cfg := DefaultConfig()
+	cfg.Listeners = []string{fmt.Sprintf(":%d", port)}
+
+	// Parse duration strings
+	var err error
+	if cfg.HealthCheck.Interval, err = time.ParseDuration(healthCheckInterval); err != nil {
+		return nil, fmt.Errorf("invalid health check interval: %w", err)
+	}
+	if cfg.HealthCheck.Timeout, err = time.ParseDuration(healthCheckTimeout); err != nil {
+		return nil, fmt.Errorf("invalid health check timeout: %w", err)
+	}
+	cfg.HealthCheck.Path = healthCheckPath
+
+	pool, err := c.parsePoolFlags(flags, backends)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Pools = []PoolConfig{pool}
+
+	if cfg.Breaker, err = c.parseBreakerFlags(flags); err != nil {
+		return nil, err
+	}
+
+	retries, _ := flags["retries"].(int)
+	retryBodyLimit, _ := flags["retry-body-limit"].(int)
+	cfg.Retry = RetryConfig{Retries: retries, MaxBodyBytes: int64(retryBodyLimit)}
+
+	return cfg, cfg.Validate()
+}
+
 func (c *Command) parseFlags(flags map[string]interface{}) (int, []string, string, string, string) {
 	port, _ := flags["port"].(int)
 	backendsStr, _ := flags["backends"].(string)
@@ -159,3 +335,59 @@ func (c *Command) parseFlags(flags map[string]interface{}) (int, []string, strin
 
 	return port, backends, healthCheckInterval, healthCheckPath, healthCheckTimeout
 }
+
+// parsePoolFlags builds the pool of --backends with their --weights and
+// the --strategy
+func (c *Command) parsePoolFlags(flags map[string]interface{}, urls []string) (PoolConfig, error) {
+	name, _ := flags["strategy"].(string)
+	hashKey, _ := flags["hash-key"].(string)
+	weightsStr, _ := flags["weights"].(string)
+
+	pool := PoolConfig{Name: "default", Strategy: name, HashKey: hashKey}
+	for _, url := range urls {
+		pool.Backends = append(pool.Backends, BackendConfig{URL: url, Weight: 1})
+	}
+
+	if weightsStr == "" {
+		return pool, nil
+	}
+
+	parts := strings.Split(weightsStr, ",")
+	if len(parts) != len(urls) {
+		return PoolConfig{}, fmt.Errorf("got %d weights for %d backends", len(parts), len(urls))
+	}
+	for i, part := range parts {
+		weight, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return PoolConfig{}, fmt.Errorf("invalid weight %q: %w", part, err)
+		}
+		pool.Backends[i].Weight = weight
+	}
+
+	logger.Debug("Pool flags", "strategy", name, "backends", pool.Backends, "hashKey", hashKey)
+
+	return pool, nil
+}
+
+// parseBreakerFlags builds the circuit breaker settings of the backends
+func (c *Command) parseBreakerFlags(flags map[string]interface{}) (BreakerConfig, error) {
+	maxFailures, _ := flags["max-failures"].(int)
+	maxErrorPercent, _ := flags["max-error-percent"].(int)
+	errorWindow, _ := flags["error-window"].(int)
+	cooldownStr, _ := flags["breaker-cooldown"].(string)
+
+	cooldown, err := time.ParseDuration(cooldownStr)
+	if err != nil {
+		return BreakerConfig{}, fmt.Errorf("invalid breaker cooldown: %w", err)
+	}
+	if maxErrorPercent > 0 && errorWindow <= 0 {
+		return BreakerConfig{}, fmt.Errorf("--error-window must be positive with --max-error-percent")
+	}
+
+	return BreakerConfig{
+		MaxFailures:     maxFailures,
+		MaxErrorPercent: maxErrorPercent,
+		ErrorWindow:     errorWindow,
+		Cooldown:        cooldown,
+	}, nil
+}
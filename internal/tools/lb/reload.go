@@ -0,0 +1,75 @@
+package lb
+
+import (
+	"cli-t/internal/shared/logger"
+	"net/http"
+	"slices"
+	"sync/atomic"
+)
+
+// balancer serves every request with the current router. A reload swaps
+// in a router built from the new config; requests already on the old one
+// finish there.
+type balancer struct {
+	current atomic.Pointer[Router]
+}
+
+func newBalancer(cfg *Config) (*balancer, error) {
+	router, err := NewRouter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	b := &balancer{}
+	b.current.Store(router)
+	return b, nil
+}
+
+func (b *balancer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.current.Load().ServeHTTP(w, r)
+}
+
+// apply switches to the backends of cfg. Backends that were already there
+// keep their health and breaker: the health checker only probes after its
+// interval, a backend known to be down must not get traffic until then.
+func (b *balancer) apply(cfg *Config) error {
+	router, err := NewRouter(cfg)
+	if err != nil {
+		return err
+	}
+	router.inherit(b.current.Load())
+	// Stops the old health checks, the requests it is proxying carry on
+	return b.current.Swap(router).Close()
+}
+
+// reload reads the config file again and applies it, returning the config
+// now in use: the old one when the file is invalid
+func (b *balancer) reload(path string, old *Config) *Config {
+	cfg, err := LoadConfig(path)
+	if err == nil {
+		err = b.apply(cfg)
+	}
+	if err != nil {
+		logger.Error("Reload failed, keeping the current config", "path", path, "error", err)
+		return old
+	}
+
+	// The servers are already listening with the old settings, keep them
+	// so the next reload compares with what is running
+	if !slices.Equal(cfg.Listeners, old.Listeners) || serverTimeouts(cfg.Timeouts) != serverTimeouts(old.Timeouts) {
+		logger.Warn("Listeners and client timeouts only change on restart", "listeners", old.Listeners)
+	}
+	cfg.Listeners = old.Listeners
+	cfg.Timeouts.Read, cfg.Timeouts.ReadHeader = old.Timeouts.Read, old.Timeouts.ReadHeader
+	cfg.Timeouts.Write, cfg.Timeouts.Idle = old.Timeouts.Write, old.Timeouts.Idle
+	logger.Info("Configuration reloaded", "path", path, "pools", len(cfg.Pools), "routes", len(cfg.Routes))
+	return cfg
+}
+
+func (b *balancer) Close() error {
+	return b.current.Load().Close()
+}
+
+// serverTimeouts keeps the timeouts of the client connections
+func serverTimeouts(t TimeoutsConfig) TimeoutsConfig {
+	return TimeoutsConfig{Read: t.Read, ReadHeader: t.ReadHeader, Write: t.Write, Idle: t.Idle}
+}
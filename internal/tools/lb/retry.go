@@ -0,0 +1,96 @@
+package lb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+)
+
+// RetryConfig sets how a request that failed on one backend is sent to
+// another one
+type RetryConfig struct {
+	Retries      int   `mapstructure:"retries"`    // other backends a request may go to, 0 disables
+	MaxBodyBytes int64 `mapstructure:"body_limit"` // larger request bodies aren't buffered, so never retried
+}
+
+// attempt travels in the request context to the backend's ErrorHandler, so
+// a retryable failure is left to the handler instead of answering 502
+type attempt struct {
+	canRetry bool  // retries are left for this request
+	err      error // the failure to retry, nil when the backend answered
+}
+
+type attemptKey struct{}
+
+// retry reports whether the ErrorHandler should leave err to the handler,
+// remembering it if so
+func retry(r *http.Request, err error) bool {
+	a, ok := r.Context().Value(attemptKey{}).(*attempt)
+	if !ok || !a.canRetry || r.Context().Err() != nil {
+		return false
+	}
+	// Anything may have reached a backend unless the connection failed
+	if !idempotent(r) && !dialError(err) {
+		return false
+	}
+	a.err = err
+	return true
+}
+
+// idempotent reports whether sending the request twice does no harm, like
+// net/http decides for its own retries
+func idempotent(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	_, key := r.Header["Idempotency-Key"]
+	_, xKey := r.Header["X-Idempotency-Key"]
+	return key || xKey
+}
+
+// dialError reports whether err happened connecting, before any byte of
+// the request was sent
+func dialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// retryBody buffers the request body so every attempt can send it again.
+// Without a body it returns nil, ok; a body over the limit is left to
+// stream once, ok is false then.
+func retryBody(r *http.Request, limit int64) ([]byte, bool, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, true, nil
+	}
+	if r.ContentLength > limit {
+		return nil, false, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(body)) > limit {
+		// Put back what was read in front of the rest
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		return nil, false, nil
+	}
+	r.Body.Close()
+	return body, true, nil
+}
+
+// attemptRequest is r for one attempt, with a fresh copy of the body
+func attemptRequest(r *http.Request, a *attempt, body []byte) *http.Request {
+	req := r.WithContext(context.WithValue(r.Context(), attemptKey{}, a))
+	if body != nil {
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	return req
+}
@@ -0,0 +1,153 @@
+package lb
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testHandler balances round-robin over urls, without health checks in
+// the time of a test
+func testHandler(t *testing.T, breaker BreakerConfig, retry RetryConfig, urls ...string) *Handler {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.HealthCheck.Interval = time.Hour
+	cfg.Breaker = breaker
+	cfg.Retry = retry
+
+	pool := PoolConfig{Name: "test", Strategy: StrategyRoundRobin}
+	for _, url := range urls {
+		pool.Backends = append(pool.Backends, BackendConfig{URL: url, Weight: 1})
+	}
+	h, err := NewHandler(pool, cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+// retryHandler is a testHandler without circuit breaking
+func retryHandler(t *testing.T, retry RetryConfig, urls ...string) *Handler {
+	return testHandler(t, BreakerConfig{}, retry, urls...)
+}
+
+// closedURL is an address nothing listens on
+func closedURL() string {
+	s := httptest.NewServer(http.NotFoundHandler())
+	s.Close()
+	return s.URL
+}
+
+// echoServer answers with the request body and counts the requests
+func echoServer(t *testing.T) (*httptest.Server, *atomic.Int64) {
+	var hits atomic.Int64
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		io.Copy(w, r.Body)
+	}))
+	t.Cleanup(s.Close)
+	return s, &hits
+}
+
+func TestRetry_ConnectionRefused(t *testing.T) {
+	healthy, hits := echoServer(t)
+	h := retryHandler(t, RetryConfig{Retries: 1, MaxBodyBytes: 1024}, closedURL(), healthy.URL)
+
+	// Even a POST: the connection failed, so nothing reached the first backend
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("payload")))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "payload", rec.Body.String())
+	assert.Equal(t, "1", rec.Header().Get("X-Retry-Count"))
+	assert.Equal(t, int64(1), hits.Load())
+}
+
+func TestRetry_OnlyIdempotentAfterSending(t *testing.T) {
+	// Reads the request, then drops the connection without answering
+	hangUp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		require.NoError(t, err)
+		conn.Close()
+	}))
+	defer hangUp.Close()
+	healthy, hits := echoServer(t)
+
+	h := retryHandler(t, RetryConfig{Retries: 1, MaxBodyBytes: 1024}, hangUp.URL, healthy.URL)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("once")))
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.Equal(t, int64(0), hits.Load())
+
+	// Round-robin is on the healthy one now, skip it
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	hits.Store(0)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/", strings.NewReader("twice")))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "twice", rec.Body.String())
+	assert.Equal(t, int64(1), hits.Load())
+}
+
+func TestRetry_Budget(t *testing.T) {
+	dead := []string{closedURL(), closedURL(), closedURL()}
+
+	// Stops after the budget
+	h := retryHandler(t, RetryConfig{Retries: 1, MaxBodyBytes: 1024}, dead...)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("X-Retry-Count"))
+
+	// Or once every backend was tried
+	h = retryHandler(t, RetryConfig{Retries: 5, MaxBodyBytes: 1024}, dead...)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("X-Retry-Count"))
+
+	// Without another backend to go to
+	h = retryHandler(t, RetryConfig{Retries: 3, MaxBodyBytes: 1024}, dead[0])
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.Empty(t, rec.Header().Get("X-Retry-Count"))
+}
+
+func TestRetry_BodyOverLimit(t *testing.T) {
+	healthy, hits := echoServer(t)
+	h := retryHandler(t, RetryConfig{Retries: 1, MaxBodyBytes: 4}, closedURL(), healthy.URL)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/", strings.NewReader("too long")))
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.Equal(t, int64(0), hits.Load())
+
+	// Unknown length: read past the limit, then streamed whole
+	h = retryHandler(t, RetryConfig{Retries: 1, MaxBodyBytes: 4}, healthy.URL)
+	req := httptest.NewRequest(http.MethodPut, "/", io.MultiReader(strings.NewReader("too "), strings.NewReader("long")))
+	req.ContentLength = -1
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "too long", rec.Body.String())
+}
+
+func TestRetry_FailedAttemptOpensBreaker(t *testing.T) {
+	healthy, _ := echoServer(t)
+	h := testHandler(t, BreakerConfig{MaxFailures: 1, Cooldown: time.Hour}, RetryConfig{Retries: 1, MaxBodyBytes: 1024}, closedURL(), healthy.URL)
+
+	// The failed attempt still counts for the breaker
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, BreakerOpen, h.backends[0].BreakerState())
+}
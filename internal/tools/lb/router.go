@@ -0,0 +1,211 @@
+package lb
+
+import (
+	"cli-t/internal/shared/logger"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// RouteConfig sends the requests it matches to a pool, in the order of
+// the routes: the first match wins
+type RouteConfig struct {
+	Name        string      `mapstructure:"name"`
+	Match       MatchConfig `mapstructure:"match"`
+	Pool        string      `mapstructure:"pool"`
+	StripPrefix bool        `mapstructure:"strip_prefix"` // drop match.path_prefix before forwarding
+	Rewrite     string      `mapstructure:"rewrite"`      // replaces what match.path_regex matched, $1 for groups
+}
+
+// MatchConfig is what a request must have, every condition set must hold
+type MatchConfig struct {
+	Host       string            `mapstructure:"host"`        // exact, or "*.example.com" for the subdomains
+	PathPrefix string            `mapstructure:"path_prefix"` // whole segments: /api matches /api and /api/x, not /apix
+	PathRegex  string            `mapstructure:"path_regex"`
+	Methods    []string          `mapstructure:"methods"`
+	Headers    map[string]string `mapstructure:"headers"` // exact values, "*" for any
+}
+
+// route is a RouteConfig ready to match
+type route struct {
+	name    string
+	handler *Handler
+	config  RouteConfig
+	regex   *regexp.Regexp
+}
+
+func newRoute(rc RouteConfig, handler *Handler) (*route, error) {
+	rt := &route{name: rc.Name, handler: handler, config: rc}
+	if rt.name == "" {
+		rt.name = rc.Pool
+	}
+	if rc.Match.PathRegex != "" {
+		regex, err := regexp.Compile(rc.Match.PathRegex)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: invalid path_regex: %w", rt.name, err)
+		}
+		rt.regex = regex
+	}
+	return rt, nil
+}
+
+func (rt *route) matches(r *http.Request) bool {
+	m := rt.config.Match
+	if m.Host != "" && !matchHost(m.Host, r.Host) {
+		return false
+	}
+	if m.PathPrefix != "" && !hasPathPrefix(r.URL.Path, m.PathPrefix) {
+		return false
+	}
+	if rt.regex != nil && !rt.regex.MatchString(r.URL.Path) {
+		return false
+	}
+	if len(m.Methods) > 0 && !matchMethod(m.Methods, r.Method) {
+		return false
+	}
+	for name, value := range m.Headers {
+		got, present := r.Header[http.CanonicalHeaderKey(name)]
+		if !present || (value != "*" && !containsValue(got, value)) {
+			return false
+		}
+	}
+	return true
+}
+
+// rewrite returns the request with the path the pool should see
+func (rt *route) rewrite(r *http.Request) *http.Request {
+	path := r.URL.Path
+	if rt.config.StripPrefix {
+		// Only the prefix goes: /api//a is //a, not /a
+		path = strings.TrimPrefix(path, strings.TrimSuffix(rt.config.Match.PathPrefix, "/"))
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+	}
+	if rt.regex != nil && rt.config.Rewrite != "" {
+		path = rt.regex.ReplaceAllString(path, rt.config.Rewrite)
+	}
+	if path == r.URL.Path {
+		return r
+	}
+
+	req := r.WithContext(r.Context())
+	u := *r.URL
+	u.Path, u.RawPath = path, ""
+	req.URL = &u
+	req.Header = r.Header.Clone()
+	if rt.config.StripPrefix {
+		req.Header.Set("X-Forwarded-Prefix", strings.TrimSuffix(rt.config.Match.PathPrefix, "/"))
+	}
+	return req
+}
+
+// matchHost compares pattern with the Host header, without its port
+func matchHost(pattern, host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+		return len(host) > len(suffix) && strings.HasSuffix(strings.ToLower(host), strings.ToLower(suffix))
+	}
+	return strings.EqualFold(pattern, host)
+}
+
+func hasPathPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return strings.HasSuffix(prefix, "/") || len(path) == len(prefix) || path[len(prefix)] == '/'
+}
+
+func matchMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsValue(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Router dispatches requests to the pool of the first route they match,
+// the default pool when none does
+type Router struct {
+	routes   []*route
+	pools    map[string]*Handler
+	fallback *Handler // nil answers 404
+}
+
+// NewRouter builds a handler for every pool of cfg and the routes to them
+func NewRouter(cfg *Config) (*Router, error) {
+	rt := &Router{pools: make(map[string]*Handler, len(cfg.Pools))}
+	for _, pool := range cfg.Pools {
+		handler, err := NewHandler(pool, cfg)
+		if err != nil {
+			rt.Close()
+			return nil, fmt.Errorf("pool %s: %w", pool.Name, err)
+		}
+		rt.pools[pool.Name] = handler
+	}
+
+	for _, rc := range cfg.Routes {
+		r, err := newRoute(rc, rt.pools[rc.Pool])
+		if err != nil {
+			rt.Close()
+			return nil, err
+		}
+		rt.routes = append(rt.routes, r)
+	}
+
+	if pool := cfg.defaultPool(); pool != nil {
+		rt.fallback = rt.pools[pool.Name]
+	}
+	return rt, nil
+}
+
+// ServeHTTP implements http.Handler interface
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for _, route := range rt.routes {
+		if route.matches(r) {
+			req := route.rewrite(r)
+			logger.Debug("Routed request", "route", route.name, "host", r.Host, "path", r.URL.Path, "forwardedPath", req.URL.Path)
+			route.handler.ServeHTTP(w, req)
+			return
+		}
+	}
+
+	if rt.fallback == nil {
+		logger.Warn("No route", "host", r.Host, "path", r.URL.Path, "method", r.Method)
+		http.NotFound(w, r)
+		return
+	}
+	rt.fallback.ServeHTTP(w, r)
+}
+
+// inherit carries the backend state of old over to the pools of the same
+// name, for a reload
+func (rt *Router) inherit(old *Router) {
+	for name, handler := range rt.pools {
+		if previous, ok := old.pools[name]; ok {
+			handler.inherit(previous)
+		}
+	}
+}
+
+// Close closes the handler of every pool
+func (rt *Router) Close() error {
+	for _, handler := range rt.pools {
+		handler.Close()
+	}
+	return nil
+}
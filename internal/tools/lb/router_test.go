@@ -0,0 +1,154 @@
+package lb
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// namedServer answers "<name> <path> <X-Forwarded-Prefix>"
+func namedServer(t *testing.T, name string) string {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s %s", name, r.URL.Path, r.Header.Get("X-Forwarded-Prefix"))
+	}))
+	t.Cleanup(s.Close)
+	return s.URL
+}
+
+func TestRouter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lb.yaml")
+	writeConfig(t, path, fmt.Sprintf(`
+health_check: {interval: 1h}
+pools:
+  - {name: web, backends: [{url: '%s'}]}
+  - {name: api, backends: [{url: '%s'}]}
+  - {name: admin, backends: [{url: '%s'}]}
+  - {name: canary, backends: [{url: '%s'}]}
+routes:
+  - name: canary
+    match:
+      path_prefix: /api
+      headers: {X-Canary: "true"}
+    pool: canary
+  - match: {host: admin.example.com}
+    pool: admin
+  - match:
+      path_prefix: /api/
+      methods: [GET, POST]
+    pool: api
+    strip_prefix: true
+  - match: {path_regex: '^/v1/(.*)$'}
+    pool: api
+    rewrite: /legacy/$1
+  - match: {host: '*.static.example.com'}
+    pool: web
+`, namedServer(t, "web"), namedServer(t, "api"), namedServer(t, "admin"), namedServer(t, "canary")))
+
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+	router, err := NewRouter(cfg)
+	require.NoError(t, err)
+	defer router.Close()
+
+	tests := []struct {
+		name    string
+		method  string
+		host    string
+		path    string
+		headers map[string]string
+		want    string
+	}{
+		{"header wins first", "GET", "example.com", "/api/users", map[string]string{"X-Canary": "true"}, "canary /api/users "},
+		{"other header value", "GET", "example.com", "/api/users", map[string]string{"X-Canary": "no"}, "api /users /api"},
+		{"host", "GET", "admin.example.com:8080", "/api/users", nil, "admin /api/users "},
+		{"prefix stripped", "POST", "example.com", "/api/", nil, "api / /api"},
+		{"only the prefix stripped", "GET", "example.com", "/api//users", nil, "api //users /api"},
+		{"method not matched", "DELETE", "example.com", "/api/users", nil, "404"},
+		{"whole segments", "GET", "example.com", "/apix", nil, "404"},
+		{"regex rewrite", "GET", "example.com", "/v1/items/3", nil, "api /legacy/items/3 "},
+		{"wildcard host", "GET", "cdn.static.example.com", "/logo.png", nil, "web /logo.png "},
+		{"wildcard needs a subdomain", "GET", "static.example.com", "/logo.png", nil, "404"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "http://"+tt.host+tt.path, nil)
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, r)
+
+			if tt.want == "404" {
+				assert.Equal(t, http.StatusNotFound, rec.Code)
+			} else {
+				assert.Equal(t, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRouter_DefaultPool(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.HealthCheck.Interval = time.Hour
+	cfg.Pools = []PoolConfig{
+		{Name: "web", Backends: []BackendConfig{{URL: namedServer(t, "web")}}},
+		{Name: "api", Backends: []BackendConfig{{URL: namedServer(t, "api")}}},
+	}
+	cfg.Routes = []RouteConfig{{Match: MatchConfig{PathPrefix: "/api"}, Pool: "api"}}
+	cfg.DefaultPool = "web"
+	require.NoError(t, cfg.Validate())
+
+	router, err := NewRouter(cfg)
+	require.NoError(t, err)
+	defer router.Close()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/elsewhere", nil))
+	assert.True(t, strings.HasPrefix(rec.Body.String(), "web "))
+}
+
+func TestRouter_PoolHealthCheck(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.HealthCheck = HealthCheckConfig{Interval: time.Hour, Path: "/", Timeout: time.Second}
+	cfg.Pools = []PoolConfig{{
+		Name:        "api",
+		Backends:    []BackendConfig{{URL: "http://api:9000"}},
+		HealthCheck: &HealthCheckConfig{Path: "/healthz"},
+	}}
+	require.NoError(t, cfg.Validate())
+
+	assert.Equal(t, &HealthCheckConfig{Interval: time.Hour, Path: "/healthz", Timeout: time.Second}, cfg.Pools[0].HealthCheck)
+
+	router, err := NewRouter(cfg)
+	require.NoError(t, err)
+	defer router.Close()
+	assert.Equal(t, "/healthz", router.pools["api"].healthCheck.path)
+}
+
+func TestRouter_InvalidRoutes(t *testing.T) {
+	pools := []PoolConfig{{Name: "web", Backends: []BackendConfig{{URL: "http://web:9000"}}}}
+	tests := []struct {
+		name  string
+		route RouteConfig
+	}{
+		{"unknown pool", RouteConfig{Pool: "api"}},
+		{"strip without prefix", RouteConfig{Pool: "web", StripPrefix: true}},
+		{"rewrite without regex", RouteConfig{Pool: "web", Rewrite: "/x"}},
+		{"bad regex", RouteConfig{Pool: "web", Match: MatchConfig{PathRegex: "("}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Pools = pools
+			cfg.Routes = []RouteConfig{tt.route}
+			assert.Error(t, cfg.Validate())
+		})
+	}
+}
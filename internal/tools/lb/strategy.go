@@ -0,0 +1,270 @@
+package lb
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Strategy picks the backend for a request. The handler only passes the
+// alive backends, never an empty list, always in the same order.
+type Strategy interface {
+	Next(backends []*Backend, r *http.Request) *Backend
+}
+
+// Strategy names for --strategy
+const (
+	StrategyRoundRobin         = "round-robin"
+	StrategyWeightedRoundRobin = "weighted-round-robin"
+	StrategyLeastRequests      = "least-requests"
+	StrategyPowerOfTwo         = "power-of-two"
+	StrategyIPHash             = "ip-hash"
+	StrategyConsistentHash     = "consistent-hash"
+)
+
+// NewStrategy builds the strategy called name. hashKey is what
+// consistent-hash hashes: "header:<name>", "cookie:<name>" or "" for the
+// client IP.
+func NewStrategy(name, hashKey string) (Strategy, error) {
+	switch name {
+	case StrategyRoundRobin, "":
+		return &roundRobin{}, nil
+	case StrategyWeightedRoundRobin:
+		return &weightedRoundRobin{current: make(map[*Backend]int)}, nil
+	case StrategyLeastRequests:
+		return leastRequests{}, nil
+	case StrategyPowerOfTwo:
+		return powerOfTwo{}, nil
+	case StrategyIPHash:
+		return ipHash{}, nil
+	case StrategyConsistentHash:
+		key, err := parseHashKey(hashKey)
+		if err != nil {
+			return nil, err
+		}
+		return &consistentHash{key: key}, nil
+	}
+	return nil, fmt.Errorf("unknown strategy %q (round-robin, weighted-round-robin, least-requests, power-of-two, ip-hash or consistent-hash)", name)
+}
+
+// Simple Round Robin
+type roundRobin struct {
+	mu   sync.Mutex
+	next int
+}
+
+func (s *roundRobin) Next(backends []*Backend, _ *http.Request) *Backend {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	backend := backends[s.next%len(backends)]
+	s.next = (s.next + 1) % len(backends)
+	return backend
+}
+
+// weightedRoundRobin is nginx' smooth weighted round-robin: every pick each
+// backend gains its weight, the one with the most wins and pays back the
+// total. Weights 5,1,1 give a a b a c a a instead of a a a a a b c.
+type weightedRoundRobin struct {
+	mu      sync.Mutex
+	current map[*Backend]int // only the backends of the last pick
+}
+
+func (s *weightedRoundRobin) Next(backends []*Backend, _ *http.Request) *Backend {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var best *Backend
+	total := 0
+	for _, b := range backends {
+		s.current[b] += b.Weight
+		total += b.Weight
+		if best == nil || s.current[b] > s.current[best] {
+			best = b
+		}
+	}
+	s.current[best] -= total
+
+	if len(s.current) > len(backends) {
+		s.prune(backends)
+	}
+	return best
+}
+
+// prune forgets the backends that aren't in the set anymore (down, ejected,
+// or another set altogether): one that comes back starts from zero
+func (s *weightedRoundRobin) prune(backends []*Backend) {
+	keep := make(map[*Backend]bool, len(backends))
+	for _, b := range backends {
+		keep[b] = true
+	}
+	for b := range s.current {
+		if !keep[b] {
+			delete(s.current, b)
+		}
+	}
+}
+
+// leastRequests picks the backend with the fewest requests in flight for
+// its weight, the first one on ties
+type leastRequests struct{}
+
+func (leastRequests) Next(backends []*Backend, _ *http.Request) *Backend {
+	best := backends[0]
+	for _, b := range backends[1:] {
+		if lessLoaded(b, best) {
+			best = b
+		}
+	}
+	return best
+}
+
+// lessLoaded compares active/weight without dividing
+func lessLoaded(a, b *Backend) bool {
+	return a.ActiveRequests()*int64(b.Weight) < b.ActiveRequests()*int64(a.Weight)
+}
+
+// powerOfTwo compares two backends picked at random and takes the less
+// loaded: nearly as good as leastRequests, without every request going to
+// the same backend between two counter updates
+type powerOfTwo struct{}
+
+func (powerOfTwo) Next(backends []*Backend, _ *http.Request) *Backend {
+	if len(backends) == 1 {
+		return backends[0]
+	}
+	i := rand.Intn(len(backends))
+	j := rand.Intn(len(backends) - 1)
+	if j >= i {
+		j++ // distinct from i
+	}
+	if lessLoaded(backends[j], backends[i]) {
+		return backends[j]
+	}
+	return backends[i]
+}
+
+// ipHash sends every request of a client IP to the same backend, as long
+// as the set of alive backends doesn't change
+type ipHash struct{}
+
+func (ipHash) Next(backends []*Backend, r *http.Request) *Backend {
+	return backends[hash32(clientIP(r))%uint32(len(backends))]
+}
+
+// clientIP is the address the request came from, without the port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func hash32(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return h.Sum32()
+}
+
+// hashKey is where consistent-hash finds the value to hash
+type hashKey struct {
+	cookie bool   // a cookie, otherwise a header
+	name   string // "" hashes the client IP
+}
+
+func parseHashKey(value string) (hashKey, error) {
+	if value == "" {
+		return hashKey{}, nil
+	}
+	kind, name, ok := strings.Cut(value, ":")
+	if ok && name != "" {
+		switch strings.ToLower(kind) {
+		case "header":
+			return hashKey{name: name}, nil
+		case "cookie":
+			return hashKey{cookie: true, name: name}, nil
+		}
+	}
+	return hashKey{}, fmt.Errorf("invalid hash key %q (header:<name> or cookie:<name>)", value)
+}
+
+// value returns the request's key, the client IP when it has none
+func (k hashKey) value(r *http.Request) string {
+	if k.name == "" {
+		return clientIP(r)
+	}
+	if k.cookie {
+		if cookie, err := r.Cookie(k.name); err == nil && cookie.Value != "" {
+			return cookie.Value
+		}
+	} else if v := r.Header.Get(k.name); v != "" {
+		return v
+	}
+	return clientIP(r)
+}
+
+// Virtual nodes per unit of weight: enough points for an even spread
+const ringReplicas = 100
+
+// consistentHash maps keys on a hash ring of the backends. When a backend
+// goes or comes back, only the keys on its part of the ring move.
+type consistentHash struct {
+	key hashKey
+
+	mu      sync.Mutex
+	members []*Backend // the backends the ring was built for
+	ring    []ringPoint
+}
+
+type ringPoint struct {
+	hash    uint32
+	backend *Backend
+}
+
+func (s *consistentHash) Next(backends []*Backend, r *http.Request) *Backend {
+	h := hash32(s.key.value(r))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !sameBackends(s.members, backends) {
+		s.build(backends)
+	}
+	// First point clockwise from the key, wrapping around
+	i := sort.Search(len(s.ring), func(i int) bool { return s.ring[i].hash >= h })
+	if i == len(s.ring) {
+		i = 0
+	}
+	return s.ring[i].backend
+}
+
+// Private helper - assumes s.mu is held!
+func (s *consistentHash) build(backends []*Backend) {
+	s.members = append(s.members[:0], backends...)
+	s.ring = s.ring[:0]
+	for _, b := range backends {
+		for i := 0; i < ringReplicas*b.Weight; i++ {
+			s.ring = append(s.ring, ringPoint{hash32(b.URL + "#" + strconv.Itoa(i)), b})
+		}
+	}
+	sort.Slice(s.ring, func(i, j int) bool { return s.ring[i].hash < s.ring[j].hash })
+}
+
+func sameBackends(a, b []*Backend) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
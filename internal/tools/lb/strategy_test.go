@@ -0,0 +1,172 @@
+package lb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testBackends(t *testing.T, weights ...int) []*Backend {
+	t.Helper()
+	backends := make([]*Backend, len(weights))
+	for i, weight := range weights {
+		b, err := NewBackend("http://backend" + strconv.Itoa(i) + ":8080")
+		require.NoError(t, err)
+		b.Weight = weight
+		backends[i] = b
+	}
+	return backends
+}
+
+func picks(s Strategy, backends []*Backend, r *http.Request, n int) []int {
+	index := make(map[*Backend]int)
+	for i, b := range backends {
+		index[b] = i
+	}
+	out := make([]int, n)
+	for i := range out {
+		out[i] = index[s.Next(backends, r)]
+	}
+	return out
+}
+
+func TestRoundRobin(t *testing.T) {
+	s, err := NewStrategy(StrategyRoundRobin, "")
+	require.NoError(t, err)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	assert.Equal(t, []int{0, 1, 2, 0, 1, 2}, picks(s, testBackends(t, 1, 1, 1), r, 6))
+}
+
+func TestWeightedRoundRobin_Smooth(t *testing.T) {
+	s, err := NewStrategy(StrategyWeightedRoundRobin, "")
+	require.NoError(t, err)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	// Spread out, not five in a row
+	backends := testBackends(t, 5, 1, 1)
+	assert.Equal(t, []int{0, 0, 1, 0, 2, 0, 0, 0, 0, 1, 0, 2, 0, 0}, picks(s, backends, r, 14))
+}
+
+func TestWeightedRoundRobin_ForgetsRemovedBackends(t *testing.T) {
+	s := &weightedRoundRobin{current: make(map[*Backend]int)}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	backends := testBackends(t, 5, 1, 1)
+	picks(s, backends, r, 3)
+	picks(s, backends[:2], r, 3) // the third one is down
+	assert.Len(t, s.current, 2)
+	picks(s, testBackends(t, 1, 1), r, 3) // other backends altogether
+	assert.Len(t, s.current, 2)
+}
+
+func TestLeastRequests(t *testing.T) {
+	s, err := NewStrategy(StrategyLeastRequests, "")
+	require.NoError(t, err)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	backends := testBackends(t, 1, 1, 3)
+
+	assert.Same(t, backends[0], s.Next(backends, r))
+
+	backends[0].begin()
+	assert.Same(t, backends[1], s.Next(backends, r))
+
+	// Two requests on a weight of 3 is less load than one on a weight of 1
+	backends[1].begin()
+	backends[2].begin()
+	backends[2].begin()
+	assert.Same(t, backends[2], s.Next(backends, r))
+}
+
+func TestPowerOfTwo(t *testing.T) {
+	s, err := NewStrategy(StrategyPowerOfTwo, "")
+	require.NoError(t, err)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	backends := testBackends(t, 1, 1)
+
+	// With two backends both are compared every time
+	backends[0].begin()
+	for range 20 {
+		assert.Same(t, backends[1], s.Next(backends, r))
+	}
+	assert.Same(t, backends[0], s.Next(backends[:1], r))
+}
+
+func TestIPHash(t *testing.T) {
+	s, err := NewStrategy(StrategyIPHash, "")
+	require.NoError(t, err)
+	backends := testBackends(t, 1, 1, 1, 1)
+
+	seen := make(map[int]bool)
+	for i := range 50 {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "10.0.0." + strconv.Itoa(i) + ":1234"
+		first := picks(s, backends, r, 1)[0]
+
+		// Same IP, other port: same backend
+		r.RemoteAddr = "10.0.0." + strconv.Itoa(i) + ":5678"
+		assert.Equal(t, first, picks(s, backends, r, 1)[0])
+		seen[first] = true
+	}
+	assert.Len(t, seen, 4)
+}
+
+func TestConsistentHash(t *testing.T) {
+	s, err := NewStrategy(StrategyConsistentHash, "header:X-User")
+	require.NoError(t, err)
+	backends := testBackends(t, 1, 1, 1, 1)
+
+	request := func(user string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-User", user)
+		return r
+	}
+
+	before := make(map[string]*Backend)
+	for i := range 200 {
+		user := "user" + strconv.Itoa(i)
+		before[user] = s.Next(backends, request(user))
+		assert.Same(t, before[user], s.Next(backends, request(user)))
+	}
+
+	// Without backend 3 only its users move
+	moved := 0
+	for user, b := range before {
+		after := s.Next(backends[:3], request(user))
+		if b != backends[3] {
+			assert.Same(t, b, after, user)
+		} else {
+			moved++
+		}
+	}
+	assert.Greater(t, moved, 20)
+	assert.Less(t, moved, 100)
+}
+
+func TestConsistentHash_Cookie(t *testing.T) {
+	s, err := NewStrategy(StrategyConsistentHash, "cookie:session")
+	require.NoError(t, err)
+	backends := testBackends(t, 1, 1, 1)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+	first := s.Next(backends, r)
+	for i := range 10 {
+		// Another client address, still the session's backend
+		r.RemoteAddr = "192.0.2." + strconv.Itoa(i) + ":1234"
+		assert.Same(t, first, s.Next(backends, r))
+	}
+}
+
+func TestNewStrategy_Errors(t *testing.T) {
+	_, err := NewStrategy("fastest", "")
+	assert.Error(t, err)
+	_, err = NewStrategy(StrategyConsistentHash, "query:id")
+	assert.Error(t, err)
+	_, err = NewStrategy(StrategyConsistentHash, "header:")
+	assert.Error(t, err)
+}
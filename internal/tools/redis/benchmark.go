@@ -0,0 +1,188 @@
+package redis
+
+import (
+	"cli-t/internal/command"
+	"cli-t/internal/tools/redis/benchmark"
+
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// BenchmarkCommand is redis-benchmark: load tests a RESP server
+type BenchmarkCommand struct{}
+
+func NewBenchmark() command.Command {
+	return &BenchmarkCommand{}
+}
+
+func (c *BenchmarkCommand) Name() string {
+	return "redis-benchmark"
+}
+
+func (c *BenchmarkCommand) Usage() string {
+	return "redis-benchmark [--host HOST] [--port PORT] [-c CLIENTS] [-n REQUESTS] [-P PIPELINE] [-d SIZE] [-r KEYSPACE] [-t TESTS | --mix NAME=WEIGHT,...] [-q] [--csv] [-- command [arg ...]]"
+}
+
+func (c *BenchmarkCommand) Description() string {
+	return "Measure throughput and latency of a Redis server with concurrent, optionally pipelined clients"
+}
+
+func (c *BenchmarkCommand) ValidateArgs(args []string) error {
+	return nil
+}
+
+func (c *BenchmarkCommand) DefineFlags() []command.Flag {
+	return []command.Flag{
+		{
+			Name:      "host",
+			Shorthand: "",
+			Type:      "string",
+			Default:   "127.0.0.1",
+			Usage:     "server host",
+		},
+		{
+			Name:      "port",
+			Shorthand: "p",
+			Type:      "int",
+			Default:   6379,
+			Usage:     "server port",
+		},
+		{
+			Name:      "pass",
+			Shorthand: "a",
+			Type:      "string",
+			Default:   "",
+			Usage:     "password to AUTH with",
+		},
+		{
+			Name:      "clients",
+			Shorthand: "c",
+			Type:      "int",
+			Default:   50,
+			Usage:     "number of parallel connections",
+		},
+		{
+			Name:      "requests",
+			Shorthand: "n",
+			Type:      "int",
+			Default:   100000,
+			Usage:     "total number of requests per test",
+		},
+		{
+			Name:      "pipeline",
+			Shorthand: "P",
+			Type:      "int",
+			Default:   1,
+			Usage:     "pipeline this many requests per connection",
+		},
+		{
+			Name:      "data-size",
+			Shorthand: "d",
+			Type:      "int",
+			Default:   3,
+			Usage:     "bytes of SET/GET/LPUSH... values",
+		},
+		{
+			Name:      "keyspace",
+			Shorthand: "r",
+			Type:      "int",
+			Default:   0,
+			Usage:     "use random keys in [0, keyspace) for __rand_int__ (0 uses a single key)",
+		},
+		{
+			Name:      "tests",
+			Shorthand: "t",
+			Type:      "string",
+			Default:   "",
+			Usage:     "comma separated tests to run (ping,set,get,incr,lpush,rpush,lpop,rpop,sadd,hset,zadd,lrange_100), all by default",
+		},
+		{
+			Name:      "mix",
+			Shorthand: "",
+			Type:      "string",
+			Default:   "",
+			Usage:     "run one test mixing commands by weight, e.g. get=80,set=20",
+		},
+		{
+			Name:      "quiet",
+			Shorthand: "q",
+			Type:      "bool",
+			Default:   false,
+			Usage:     "only show the requests per second and p50 of each test",
+		},
+		{
+			Name:      "csv",
+			Shorthand: "",
+			Type:      "bool",
+			Default:   false,
+			Usage:     "output CSV",
+		},
+	}
+}
+
+func (c *BenchmarkCommand) Execute(ctx context.Context, args *command.Args) error {
+	host, _ := args.Flags["host"].(string)
+	port, _ := args.Flags["port"].(int)
+	password, _ := args.Flags["pass"].(string)
+	clients, _ := args.Flags["clients"].(int)
+	requests, _ := args.Flags["requests"].(int)
+	pipeline, _ := args.Flags["pipeline"].(int)
+	dataSize, _ := args.Flags["data-size"].(int)
+	keySpace, _ := args.Flags["keyspace"].(int)
+	testList, _ := args.Flags["tests"].(string)
+	mix, _ := args.Flags["mix"].(string)
+	quiet, _ := args.Flags["quiet"].(bool)
+	csv, _ := args.Flags["csv"].(bool)
+
+	if clients < 1 || requests < 1 || pipeline < 1 || dataSize < 0 || keySpace < 0 {
+		return fmt.Errorf("clients, requests and pipeline must be positive, data-size and keyspace not negative")
+	}
+
+	opts := benchmark.Options{
+		Addr:     net.JoinHostPort(host, strconv.Itoa(port)),
+		Password: password,
+		Clients:  clients,
+		Requests: requests,
+		Pipeline: pipeline,
+		DataSize: dataSize,
+		KeySpace: keySpace,
+	}
+
+	var tests []benchmark.Test
+	switch {
+	case len(args.Positional) > 0:
+		tests = []benchmark.Test{benchmark.CustomTest(args.Positional)}
+	case mix != "":
+		test, err := benchmark.ParseMix(mix)
+		if err != nil {
+			return err
+		}
+		tests = []benchmark.Test{test}
+	default:
+		var err error
+		if tests, err = benchmark.ParseTests(testList); err != nil {
+			return err
+		}
+	}
+
+	if csv {
+		benchmark.WriteCSVHeader(args.Stdout)
+	}
+	for _, test := range tests {
+		result, err := benchmark.Run(ctx, opts, test)
+		if err != nil {
+			return fmt.Errorf("%s: %w", test.Name, err)
+		}
+		switch {
+		case csv:
+			benchmark.WriteCSV(args.Stdout, result)
+		case quiet:
+			benchmark.WriteQuiet(args.Stdout, result)
+		default:
+			benchmark.WriteReport(args.Stdout, opts, result)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,337 @@
+// Package benchmark load tests a RESP server the way redis-benchmark does:
+// N connections, each sending its share of the requests, optionally
+// pipelined, while every reply's latency is recorded.
+package benchmark
+
+import (
+	"cli-t/internal/tools/redis/client"
+	"cli-t/internal/tools/redis/protocol"
+
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	randPlaceholder = "__rand_int__" // replaced by a random key number, like redis-benchmark -r
+	dataPlaceholder = "__data__"     // replaced by the payload
+)
+
+// Options are the knobs shared by every test
+type Options struct {
+	Addr     string
+	Password string
+	Clients  int // parallel connections
+	Requests int // total requests per test
+	Pipeline int // requests in flight per connection
+	DataSize int // bytes of SET/LPUSH/... values
+	KeySpace int // random keys drawn from [0, KeySpace), 0 uses the same key every time
+}
+
+// Command is one request template, with placeholders
+type Command []string
+
+// Test is a named workload: one command, or a weighted mix of several
+type Test struct {
+	Name     string
+	Commands []Command
+	Weights  []int // same length as Commands, nil means one command
+}
+
+// builtinTests are the redis-benchmark -t tests, in the order they run
+var builtinTests = []struct {
+	name string
+	cmd  Command
+}{
+	{"ping", Command{"PING"}},
+	{"set", Command{"SET", "key:" + randPlaceholder, dataPlaceholder}},
+	{"get", Command{"GET", "key:" + randPlaceholder}},
+	{"incr", Command{"INCR", "counter:" + randPlaceholder}},
+	{"lpush", Command{"LPUSH", "mylist", dataPlaceholder}},
+	{"rpush", Command{"RPUSH", "mylist", dataPlaceholder}},
+	{"lpop", Command{"LPOP", "mylist"}},
+	{"rpop", Command{"RPOP", "mylist"}},
+	{"sadd", Command{"SADD", "myset", "element:" + randPlaceholder}},
+	{"hset", Command{"HSET", "myhash", "element:" + randPlaceholder, dataPlaceholder}},
+	{"zadd", Command{"ZADD", "myzset", "0", "element:" + randPlaceholder}},
+	{"lrange_100", Command{"LRANGE", "mylist", "0", "99"}},
+}
+
+// TestNames lists the built-in tests
+func TestNames() []string {
+	names := make([]string, len(builtinTests))
+	for i, test := range builtinTests {
+		names[i] = test.name
+	}
+	return names
+}
+
+func builtin(name string) (Command, bool) {
+	for _, test := range builtinTests {
+		if test.name == name {
+			return test.cmd, true
+		}
+	}
+	return nil, false
+}
+
+// ParseTests turns "set,get" into tests; "" selects all of them
+func ParseTests(list string) ([]Test, error) {
+	if list == "" {
+		list = strings.Join(TestNames(), ",")
+	}
+
+	var tests []Test
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		cmd, found := builtin(name)
+		if !found {
+			return nil, fmt.Errorf("unknown test %q, expected one of %s", name, strings.Join(TestNames(), ", "))
+		}
+		tests = append(tests, Test{Name: strings.ToUpper(name), Commands: []Command{cmd}})
+	}
+	return tests, nil
+}
+
+// ParseMix turns "get=80,set=20" into one test that picks a command at
+// random for every request, in proportion to the weights
+func ParseMix(mix string) (Test, error) {
+	test := Test{Name: "MIX " + mix}
+	for _, part := range strings.Split(mix, ",") {
+		name, weightStr, found := strings.Cut(strings.TrimSpace(part), "=")
+		weight, err := strconv.Atoi(weightStr)
+		if !found || err != nil || weight <= 0 {
+			return Test{}, fmt.Errorf("invalid mix entry %q, expected name=weight", part)
+		}
+		cmd, known := builtin(strings.ToLower(name))
+		if !known {
+			return Test{}, fmt.Errorf("unknown test %q in mix", name)
+		}
+		test.Commands = append(test.Commands, cmd)
+		test.Weights = append(test.Weights, weight)
+	}
+	return test, nil
+}
+
+// CustomTest benchmarks an arbitrary command, placeholders included
+func CustomTest(args []string) Test {
+	return Test{Name: strings.Join(args, " "), Commands: []Command{args}}
+}
+
+// Result is what one test measured
+type Result struct {
+	Test      string
+	Requests  int
+	Errors    int // error replies
+	Elapsed   time.Duration
+	Latencies []time.Duration // sorted
+}
+
+// Throughput is requests per second
+func (r Result) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Requests) / r.Elapsed.Seconds()
+}
+
+// Percentile returns the latency below which p percent of requests finished
+func (r Result) Percentile(p float64) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	i := int(float64(len(r.Latencies))*p/100+0.5) - 1
+	return r.Latencies[min(max(i, 0), len(r.Latencies)-1)]
+}
+
+// Average is the mean latency
+func (r Result) Average() time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	var total time.Duration
+	for _, latency := range r.Latencies {
+		total += latency
+	}
+	return total / time.Duration(len(r.Latencies))
+}
+
+// Run executes one test. Every client claims pipeline-sized batches of the
+// remaining requests until none are left, so slow connections do less.
+func Run(ctx context.Context, opts Options, test Test) (Result, error) {
+	opts = withDefaults(opts)
+
+	conns := make([]*client.Client, opts.Clients)
+	defer func() {
+		for _, conn := range conns {
+			if conn != nil {
+				conn.Close()
+			}
+		}
+	}()
+	for i := range conns {
+		conn, err := connect(opts)
+		if err != nil {
+			return Result{}, err
+		}
+		conns[i] = conn
+	}
+
+	payload := strings.Repeat("x", opts.DataSize)
+	var remaining atomic.Int64
+	remaining.Store(int64(opts.Requests))
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		result   = Result{Test: test.Name}
+	)
+	start := time.Now()
+	for i, conn := range conns {
+		wg.Add(1)
+		go func(seed uint64, conn *client.Client) {
+			defer wg.Done()
+			w := &worker{
+				conn:    conn,
+				test:    test,
+				opts:    opts,
+				payload: payload,
+				rng:     rand.New(rand.NewPCG(seed, uint64(start.UnixNano()))),
+			}
+			err := w.run(ctx, &remaining)
+
+			mu.Lock()
+			defer mu.Unlock()
+			result.Requests += len(w.latencies)
+			result.Errors += w.errors
+			result.Latencies = append(result.Latencies, w.latencies...)
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}(uint64(i), conn)
+	}
+	wg.Wait()
+	result.Elapsed = time.Since(start)
+
+	sort.Slice(result.Latencies, func(i, j int) bool { return result.Latencies[i] < result.Latencies[j] })
+	return result, firstErr
+}
+
+func withDefaults(opts Options) Options {
+	opts.Clients = max(opts.Clients, 1)
+	opts.Pipeline = max(opts.Pipeline, 1)
+	opts.Requests = max(opts.Requests, 0)
+	opts.DataSize = max(opts.DataSize, 0)
+	return opts
+}
+
+func connect(opts Options) (*client.Client, error) {
+	conn, err := client.Dial(opts.Addr, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Password != "" {
+		reply, err := conn.Do("AUTH", opts.Password)
+		if err == nil {
+			if errReply, failed := reply.(protocol.Error); failed {
+				err = fmt.Errorf("AUTH failed: %s", errReply.Message)
+			}
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// worker drives one connection
+type worker struct {
+	conn    *client.Client
+	test    Test
+	opts    Options
+	payload string
+	rng     *rand.Rand
+
+	latencies []time.Duration
+	errors    int
+}
+
+func (w *worker) run(ctx context.Context, remaining *atomic.Int64) error {
+	for ctx.Err() == nil {
+		// Claim the next batch
+		batch := int64(w.opts.Pipeline)
+		left := remaining.Add(-batch)
+		if left < 0 {
+			batch += left // only part of it was still there
+		}
+		if batch <= 0 {
+			return nil
+		}
+
+		sent := time.Now()
+		for i := int64(0); i < batch; i++ {
+			if err := w.conn.Send(w.next()...); err != nil {
+				return err
+			}
+		}
+		if err := w.conn.Flush(); err != nil {
+			return err
+		}
+
+		// Pipelined requests all count from the moment the batch went out
+		for i := int64(0); i < batch; i++ {
+			reply, err := w.conn.Receive()
+			if err != nil {
+				return err
+			}
+			w.latencies = append(w.latencies, time.Since(sent))
+			if _, failed := reply.(protocol.Error); failed {
+				w.errors++
+			}
+		}
+	}
+	return ctx.Err()
+}
+
+// next builds the next request, picking from the mix and filling placeholders
+func (w *worker) next() []string {
+	cmd := w.test.Commands[0]
+	if len(w.test.Weights) > 0 {
+		total := 0
+		for _, weight := range w.test.Weights {
+			total += weight
+		}
+		pick := w.rng.IntN(total)
+		for i, weight := range w.test.Weights {
+			if pick < weight {
+				cmd = w.test.Commands[i]
+				break
+			}
+			pick -= weight
+		}
+	}
+
+	args := make([]string, len(cmd))
+	for i, arg := range cmd {
+		if strings.Contains(arg, randPlaceholder) {
+			key := 0
+			if w.opts.KeySpace > 0 {
+				key = w.rng.IntN(w.opts.KeySpace)
+			}
+			arg = strings.ReplaceAll(arg, randPlaceholder, fmt.Sprintf("%012d", key))
+		}
+		if arg == dataPlaceholder {
+			arg = w.payload
+		}
+		args[i] = arg
+	}
+	return args
+}
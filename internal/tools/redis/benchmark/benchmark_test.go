@@ -0,0 +1,114 @@
+package benchmark
+
+import (
+	"cli-t/internal/tools/redis/client"
+	"cli-t/internal/tools/redis/protocol"
+	"cli-t/internal/tools/redis/redistest"
+	"cli-t/internal/tools/redis/server"
+
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun_CountsEveryRequest(t *testing.T) {
+	addr := redistest.Start(t, server.Config{})
+	opts := Options{Addr: addr, Clients: 4, Requests: 1003, Pipeline: 10, KeySpace: 100}
+
+	tests, err := ParseTests("incr")
+	require.NoError(t, err)
+	result, err := Run(context.Background(), opts, tests[0])
+	require.NoError(t, err)
+
+	assert.Equal(t, "INCR", result.Test)
+	assert.Equal(t, 1003, result.Requests)
+	assert.Equal(t, 0, result.Errors)
+	assert.Len(t, result.Latencies, 1003)
+	assert.Positive(t, result.Throughput())
+	assert.LessOrEqual(t, result.Percentile(50), result.Percentile(99))
+	assert.LessOrEqual(t, result.Percentile(99), result.Percentile(100))
+
+	// Every INCR landed on one of the 100 counters
+	c, err := client.Dial(addr, time.Second)
+	require.NoError(t, err)
+	defer c.Close()
+	total := int64(0)
+	for i := 0; i < 100; i++ {
+		reply, err := c.Do("GET", fmt.Sprintf("counter:%012d", i))
+		require.NoError(t, err)
+		if bulk := reply.(protocol.BulkString); !bulk.IsNull {
+			n, _ := strconv.ParseInt(bulk.Value, 10, 64)
+			total += n
+		}
+	}
+	assert.Equal(t, int64(1003), total)
+}
+
+func TestRun_MixAndPayload(t *testing.T) {
+	addr := redistest.Start(t, server.Config{})
+	test, err := ParseMix("set=1,get=1")
+	require.NoError(t, err)
+
+	result, err := Run(context.Background(), Options{Addr: addr, Clients: 2, Requests: 200, DataSize: 16}, test)
+	require.NoError(t, err)
+	assert.Equal(t, 200, result.Requests)
+
+	c, err := client.Dial(addr, time.Second)
+	require.NoError(t, err)
+	defer c.Close()
+	reply, err := c.Do("GET", "key:000000000000")
+	require.NoError(t, err)
+	assert.Equal(t, protocol.BulkString{Value: strings.Repeat("x", 16)}, reply)
+}
+
+func TestRun_ErrorsAndAuth(t *testing.T) {
+	addr := redistest.Start(t, server.Config{RequirePass: "secret"})
+
+	_, err := Run(context.Background(), Options{Addr: addr, Password: "wrong", Requests: 1}, CustomTest([]string{"PING"}))
+	assert.ErrorContains(t, err, "AUTH failed")
+
+	// Error replies are counted, not fatal
+	result, err := Run(context.Background(), Options{Addr: addr, Password: "secret", Requests: 10}, CustomTest([]string{"NOSUCHCOMMAND"}))
+	require.NoError(t, err)
+	assert.Equal(t, 10, result.Requests)
+	assert.Equal(t, 10, result.Errors)
+}
+
+func TestParse(t *testing.T) {
+	tests, err := ParseTests("")
+	require.NoError(t, err)
+	assert.Len(t, tests, len(TestNames()))
+
+	_, err = ParseTests("set,nope")
+	assert.ErrorContains(t, err, `unknown test "nope"`)
+
+	for _, mix := range []string{"get", "get=0", "get=x", "nope=1"} {
+		_, err := ParseMix(mix)
+		assert.Error(t, err, mix)
+	}
+}
+
+func TestResult_Percentile(t *testing.T) {
+	r := Result{Requests: 100, Elapsed: time.Second}
+	for i := 1; i <= 100; i++ {
+		r.Latencies = append(r.Latencies, time.Duration(i)*time.Millisecond)
+	}
+
+	assert.Equal(t, time.Millisecond, r.Percentile(0))
+	assert.Equal(t, 50*time.Millisecond, r.Percentile(50))
+	assert.Equal(t, 99*time.Millisecond, r.Percentile(99))
+	assert.Equal(t, 100*time.Millisecond, r.Percentile(100))
+	assert.Equal(t, 50500*time.Microsecond, r.Average())
+	assert.Equal(t, 100.0, r.Throughput())
+
+	var out bytes.Buffer
+	WriteQuiet(&out, Result{Test: "SET", Requests: 100, Elapsed: time.Second, Latencies: r.Latencies})
+	assert.Equal(t, "SET: 100.00 requests per second, p50=50.000 msec\n", out.String())
+}
@@ -0,0 +1,59 @@
+package benchmark
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// percentiles reported for every test
+var percentiles = []float64{50, 95, 99, 99.9, 100}
+
+// WriteReport prints a result the way redis-benchmark does by default
+func WriteReport(w io.Writer, opts Options, r Result) {
+	opts = withDefaults(opts)
+	fmt.Fprintf(w, "====== %s ======\n", r.Test)
+	fmt.Fprintf(w, "  %d requests completed in %.2f seconds\n", r.Requests, r.Elapsed.Seconds())
+	fmt.Fprintf(w, "  %d parallel clients\n", opts.Clients)
+	fmt.Fprintf(w, "  %d bytes payload\n", opts.DataSize)
+	fmt.Fprintf(w, "  pipeline: %d\n", opts.Pipeline)
+	if r.Errors > 0 {
+		fmt.Fprintf(w, "  %d error replies\n", r.Errors)
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "Latency by percentile distribution:")
+	for _, p := range percentiles {
+		fmt.Fprintf(w, "  %6s%% <= %s msec\n", strconv.FormatFloat(p, 'f', -1, 64), msec(r.Percentile(p)))
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "Summary:")
+	fmt.Fprintf(w, "  throughput summary: %.2f requests per second\n", r.Throughput())
+	fmt.Fprintln(w, "  latency summary (msec):")
+	fmt.Fprintf(w, "  %9s %9s %9s %9s %9s %9s\n", "avg", "min", "p50", "p95", "p99", "max")
+	fmt.Fprintf(w, "  %9s %9s %9s %9s %9s %9s\n\n",
+		msec(r.Average()), msec(r.Percentile(0)), msec(r.Percentile(50)),
+		msec(r.Percentile(95)), msec(r.Percentile(99)), msec(r.Percentile(100)))
+}
+
+// WriteQuiet prints one line per test, like redis-benchmark -q
+func WriteQuiet(w io.Writer, r Result) {
+	fmt.Fprintf(w, "%s: %.2f requests per second, p50=%s msec\n", r.Test, r.Throughput(), msec(r.Percentile(50)))
+}
+
+// WriteCSVHeader and WriteCSV are redis-benchmark --csv
+func WriteCSVHeader(w io.Writer) {
+	fmt.Fprintln(w, `"test","rps","avg_latency_ms","min_latency_ms","p50_latency_ms","p95_latency_ms","p99_latency_ms","max_latency_ms"`)
+}
+
+func WriteCSV(w io.Writer, r Result) {
+	fmt.Fprintf(w, "%q,\"%.2f\",\"%s\",\"%s\",\"%s\",\"%s\",\"%s\",\"%s\"\n",
+		r.Test, r.Throughput(), msec(r.Average()), msec(r.Percentile(0)), msec(r.Percentile(50)),
+		msec(r.Percentile(95)), msec(r.Percentile(99)), msec(r.Percentile(100)))
+}
+
+func msec(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
@@ -0,0 +1,385 @@
+package redis
+
+import (
+	"cli-t/internal/command"
+	"cli-t/internal/shared/lineedit"
+	"cli-t/internal/tools/redis/client"
+	"cli-t/internal/tools/redis/protocol"
+
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const dialTimeout = 5 * time.Second
+
+// CLICommand is redis-cli: a client for the server (or a real redis)
+type CLICommand struct{}
+
+func NewCLI() command.Command {
+	return &CLICommand{}
+}
+
+func (c *CLICommand) Name() string {
+	return "redis-cli"
+}
+
+func (c *CLICommand) Usage() string {
+	return "redis-cli [--host HOST] [--port PORT] [-a PASSWORD] [--user USER] [--resp3] [--raw] [--pipe] [command [arg ...]]"
+}
+
+func (c *CLICommand) Description() string {
+	return "Talk to a Redis server: interactive prompt, one-shot commands, commands from stdin or --pipe mass insert"
+}
+
+func (c *CLICommand) ValidateArgs(args []string) error {
+	return nil
+}
+
+// FlagsBeforeArgs keeps the arguments of a one-shot command away from the
+// flag parser, like redis-cli: LRANGE l 0 -1, ZRANGEBYSCORE z -inf +inf
+func (c *CLICommand) FlagsBeforeArgs() bool {
+	return true
+}
+
+func (c *CLICommand) DefineFlags() []command.Flag {
+	return []command.Flag{
+		{
+			Name:      "host",
+			Shorthand: "",
+			Type:      "string",
+			Default:   "127.0.0.1",
+			Usage:     "server host",
+		},
+		{
+			Name:      "port",
+			Shorthand: "p",
+			Type:      "int",
+			Default:   6379,
+			Usage:     "server port",
+		},
+		{
+			Name:      "pass",
+			Shorthand: "a",
+			Type:      "string",
+			Default:   "",
+			Usage:     "password to AUTH with",
+		},
+		{
+			Name:      "user",
+			Shorthand: "",
+			Type:      "string",
+			Default:   "",
+			Usage:     "ACL user to AUTH as, needs --pass",
+		},
+		{
+			Name:      "db",
+			Shorthand: "n",
+			Type:      "int",
+			Default:   0,
+			Usage:     "database number to SELECT",
+		},
+		{
+			Name:      "resp3",
+			Shorthand: "",
+			Type:      "bool",
+			Default:   false,
+			Usage:     "switch the connection to RESP3 with HELLO 3",
+		},
+		{
+			Name:      "raw",
+			Shorthand: "",
+			Type:      "bool",
+			Default:   false,
+			Usage:     "print bare replies, the default when stdout isn't a terminal",
+		},
+		{
+			Name:      "pipe",
+			Shorthand: "",
+			Type:      "bool",
+			Default:   false,
+			Usage:     "mass insert: send the raw protocol read from stdin and count the replies",
+		},
+	}
+}
+
+// cliSession is the connection and output settings shared by all modes.
+// The connection is (re)opened lazily, so the prompt survives a restart.
+type cliSession struct {
+	addr           string
+	user, password string
+	resp3          bool
+	raw            bool
+	db             int // selected on connect, follows SELECT
+
+	conn *client.Client
+	out  io.Writer
+}
+
+func (c *CLICommand) Execute(ctx context.Context, args *command.Args) error {
+	host, _ := args.Flags["host"].(string)
+	port, _ := args.Flags["port"].(int)
+	password, _ := args.Flags["pass"].(string)
+	user, _ := args.Flags["user"].(string)
+	db, _ := args.Flags["db"].(int)
+	resp3, _ := args.Flags["resp3"].(bool)
+	raw, _ := args.Flags["raw"].(bool)
+	pipe, _ := args.Flags["pipe"].(bool)
+
+	session := &cliSession{
+		addr:     net.JoinHostPort(host, strconv.Itoa(port)),
+		user:     user,
+		password: password,
+		db:       db,
+		resp3:    resp3,
+		raw:      raw || !isTerminal(args.Stdout),
+		out:      args.Stdout,
+	}
+	defer session.close()
+
+	switch {
+	case pipe:
+		return session.pipe(args.Stdin, args.Stderr)
+	case len(args.Positional) > 0:
+		return session.run(args.Positional)
+	case isTerminal(args.Stdin):
+		return session.repl(args.Stdin.(*os.File), args.Env)
+	default:
+		return session.script(args.Stdin)
+	}
+}
+
+func isTerminal(stream any) bool {
+	f, ok := stream.(*os.File)
+	return ok && lineedit.IsTerminal(f.Fd())
+}
+
+// connect dials the server and logs in / switches protocol as asked
+func (s *cliSession) connect() error {
+	conn, err := client.Dial(s.addr, dialTimeout)
+	if err != nil {
+		return fmt.Errorf("could not connect to Redis at %s: %w", s.addr, err)
+	}
+
+	var setup [][]string
+	switch {
+	case s.resp3 && s.password != "":
+		setup = append(setup, []string{"HELLO", "3", "AUTH", s.authUser(), s.password})
+	case s.resp3:
+		setup = append(setup, []string{"HELLO", "3"})
+	case s.password != "":
+		setup = append(setup, []string{"AUTH", s.authUser(), s.password})
+	}
+	if s.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(s.db)})
+	}
+	for _, cmd := range setup {
+		reply, err := conn.Do(cmd...)
+		if err == nil {
+			if errReply, failed := reply.(protocol.Error); failed {
+				err = errors.New(errReply.Message)
+			}
+		}
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("%s failed: %w", cmd[0], err)
+		}
+	}
+
+	s.conn = conn
+	return nil
+}
+
+func (s *cliSession) authUser() string {
+	if s.user == "" {
+		return "default"
+	}
+	return s.user
+}
+
+func (s *cliSession) close() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// streamingCommands keep sending replies after the first one
+var streamingCommands = map[string]bool{
+	"SUBSCRIBE":  true,
+	"PSUBSCRIBE": true,
+	"MONITOR":    true,
+}
+
+// run sends one command and prints the reply
+func (s *cliSession) run(args []string) error {
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return err
+		}
+	}
+
+	reply, err := s.conn.Do(args...)
+	if err != nil {
+		s.close() // reconnect on the next command
+		return err
+	}
+
+	name := strings.ToUpper(args[0])
+	_, failed := reply.(protocol.Error)
+	if name == "SELECT" && !failed && len(args) == 2 {
+		// Reconnecting selects it again
+		s.db, _ = strconv.Atoi(args[1])
+	}
+	if streamingCommands[name] && !failed {
+		// MONITOR's lines speak for themselves, like in redis-cli
+		if !s.raw && name != "MONITOR" {
+			fmt.Fprintln(s.out, "Reading messages... (press Ctrl-C to quit)")
+		}
+		for {
+			s.print(reply, false)
+			if reply, err = s.conn.Receive(); err != nil {
+				s.close()
+				return err
+			}
+		}
+	}
+
+	s.print(reply, forceRaw(args))
+	return nil
+}
+
+// forceRaw is redis-cli's exception for commands whose reply is text meant
+// for humans: INFO and CLIENT LIST are printed as is, not quoted
+func forceRaw(args []string) bool {
+	switch strings.ToUpper(args[0]) {
+	case "INFO":
+		return true
+	case "CLIENT":
+		return len(args) > 1 && (strings.EqualFold(args[1], "LIST") || strings.EqualFold(args[1], "INFO"))
+	}
+	return false
+}
+
+func (s *cliSession) print(reply protocol.RESPValue, raw bool) {
+	if s.raw || raw {
+		fmt.Fprintln(s.out, client.FormatRaw(reply))
+		return
+	}
+	fmt.Fprintln(s.out, client.Format(reply))
+}
+
+// repl is the interactive prompt, with history kept across sessions
+func (s *cliSession) repl(in *os.File, env map[string]string) error {
+	editor := lineedit.New(in, s.out)
+	historyFile := historyPath(env)
+	if historyFile != "" {
+		editor.LoadHistory(historyFile)
+		defer editor.SaveHistory(historyFile)
+	}
+
+	// Connecting early shows a bad address right away, the prompt still opens
+	if err := s.connect(); err != nil {
+		fmt.Fprintln(s.out, err)
+	}
+
+	for {
+		prompt := s.addr + "> "
+		if s.db != 0 {
+			prompt = fmt.Sprintf("%s[%d]> ", s.addr, s.db)
+		}
+		if s.conn == nil {
+			prompt = "not connected> "
+		}
+
+		line, err := editor.ReadLine(prompt)
+		if errors.Is(err, lineedit.ErrInterrupted) {
+			continue
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		args, err := protocol.SplitArgs(line)
+		if err != nil {
+			fmt.Fprintln(s.out, "Invalid argument(s)")
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+		editor.AddHistory(line)
+
+		switch strings.ToLower(args[0]) {
+		case "quit", "exit":
+			return nil
+		case "clear":
+			fmt.Fprint(s.out, "\x1b[H\x1b[2J")
+			continue
+		}
+		if err := s.run(args); err != nil {
+			fmt.Fprintln(s.out, err)
+		}
+	}
+}
+
+// historyPath is where the prompt history lives: $REDISCLI_HISTFILE
+// ("" disables it) or ~/.rediscli_history, like redis-cli
+func historyPath(env map[string]string) string {
+	if path, set := env["REDISCLI_HISTFILE"]; set {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".rediscli_history")
+}
+
+// script runs one command per input line, for `cli-t redis-cli < commands.txt`
+func (s *cliSession) script(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), protocol.MaxInlineSize)
+	for scanner.Scan() {
+		args, err := protocol.SplitArgs(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("invalid line %q: %w", scanner.Text(), err)
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if err := s.run(args); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// pipe is --pipe mass insert
+func (s *cliSession) pipe(in io.Reader, errOut io.Writer) error {
+	if err := s.connect(); err != nil {
+		return err
+	}
+
+	result, err := client.Pipe(s.conn, in, errOut)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(s.out, "All data transferred. Last reply received from server.")
+	fmt.Fprintf(s.out, "errors: %d, replies: %d\n", result.Errors, result.Replies)
+	if result.Errors > 0 {
+		return fmt.Errorf("%d commands failed", result.Errors)
+	}
+	return nil
+}
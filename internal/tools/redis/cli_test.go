@@ -0,0 +1,50 @@
+package redis
+
+import (
+	"cli-t/internal/command"
+	"cli-t/internal/tools/redis/redistest"
+	"cli-t/internal/tools/redis/server"
+
+	"bytes"
+	"context"
+	"net"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// oneShot runs redis-cli with argv the way cli-t does and returns its output
+func oneShot(t *testing.T, argv ...string) string {
+	t.Helper()
+	cli := NewCLI()
+	cobraCmd := &cobra.Command{Use: cli.Name(), Args: cobra.ArbitraryArgs}
+	command.SetupCommand(cobraCmd, cli)
+	require.NoError(t, cobraCmd.ParseFlags(argv))
+
+	var out bytes.Buffer
+	err := cli.Execute(context.Background(), &command.Args{
+		Positional: cobraCmd.Flags().Args(),
+		Flags:      command.ParseFlags(cobraCmd),
+		Stdin:      &bytes.Buffer{},
+		Stdout:     &out,
+		Stderr:     &bytes.Buffer{},
+	})
+	require.NoError(t, err)
+	return out.String()
+}
+
+func TestCLIOneShotNegativeArguments(t *testing.T) {
+	host, port, err := net.SplitHostPort(redistest.Start(t, server.Config{}))
+	require.NoError(t, err)
+	conn := []string{"--host", host, "-p", port}
+
+	oneShot(t, append(conn, "RPUSH", "l", "a", "b", "c")...)
+	oneShot(t, append(conn, "ZADD", "z", "-1", "x", "2", "y")...)
+
+	// What comes after the command is its arguments, even if it looks like a flag
+	assert.Equal(t, "a\nb\nc\n", oneShot(t, append(conn, "LRANGE", "l", "0", "-1")...))
+	assert.Equal(t, "x\ny\n", oneShot(t, append(conn, "ZRANGEBYSCORE", "z", "-inf", "+inf")...))
+	assert.Equal(t, "c\n", oneShot(t, append(conn, "--raw", "LINDEX", "l", "-1")...))
+}
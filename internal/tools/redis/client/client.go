@@ -0,0 +1,87 @@
+// Package client is a small RESP client, the connection side of the
+// redis-cli and redis-benchmark commands.
+package client
+
+import (
+	"cli-t/internal/tools/redis/protocol"
+
+	"bufio"
+	"net"
+	"time"
+)
+
+// Client is one connection to a redis server. Error replies come back as
+// protocol.Error values; the returned error is for the connection itself.
+type Client struct {
+	conn   net.Conn
+	reader *protocol.Reader
+	writer *bufio.Writer
+}
+
+// Dial connects to addr (host:port)
+func Dial(addr string, timeout time.Duration) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return New(conn), nil
+}
+
+// New wraps an established connection
+func New(conn net.Conn) *Client {
+	return &Client{
+		conn:   conn,
+		reader: protocol.NewReader(conn),
+		writer: bufio.NewWriter(conn),
+	}
+}
+
+// Do sends one command and waits for its reply
+func (c *Client) Do(args ...string) (protocol.RESPValue, error) {
+	if err := c.Send(args...); err != nil {
+		return nil, err
+	}
+	if err := c.Flush(); err != nil {
+		return nil, err
+	}
+	return c.Receive()
+}
+
+// Send buffers a command without waiting for the reply, for pipelining.
+// Flush sends the buffered commands, Receive reads the replies in order.
+func (c *Client) Send(args ...string) error {
+	_, err := c.writer.Write(Command(args...).Serialize())
+	return err
+}
+
+// Write buffers bytes that are already RESP (or inline commands)
+func (c *Client) Write(raw []byte) (int, error) {
+	return c.writer.Write(raw)
+}
+
+func (c *Client) Flush() error {
+	return c.writer.Flush()
+}
+
+// Receive reads the next reply, or the next message once subscribed
+func (c *Client) Receive() (protocol.RESPValue, error) {
+	return c.reader.ReadValue()
+}
+
+// SetReadDeadline bounds the next Receive calls, zero removes the bound
+func (c *Client) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Command is args encoded the way clients send commands: an array of bulk strings
+func Command(args ...string) protocol.Array {
+	elements := make([]protocol.RESPValue, len(args))
+	for i, arg := range args {
+		elements[i] = protocol.BulkString{Value: arg}
+	}
+	return protocol.Array{Elements: elements}
+}
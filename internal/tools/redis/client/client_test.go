@@ -0,0 +1,71 @@
+package client
+
+import (
+	"cli-t/internal/tools/redis/protocol"
+	"cli-t/internal/tools/redis/redistest"
+	"cli-t/internal/tools/redis/server"
+
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dial(t *testing.T, addr string) *Client {
+	t.Helper()
+	c, err := Dial(addr, time.Second)
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestClient_DoAndPipeline(t *testing.T) {
+	c := dial(t, redistest.Start(t, server.Config{}))
+
+	reply, err := c.Do("SET", "greeting", "hello world")
+	require.NoError(t, err)
+	assert.Equal(t, protocol.SimpleString{Value: "OK"}, reply)
+
+	reply, err = c.Do("GET", "greeting")
+	require.NoError(t, err)
+	assert.Equal(t, protocol.BulkString{Value: "hello world"}, reply)
+
+	// Error replies aren't Go errors
+	reply, err = c.Do("NOSUCHCOMMAND")
+	require.NoError(t, err)
+	assert.IsType(t, protocol.Error{}, reply)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, c.Send("INCR", "n"))
+	}
+	require.NoError(t, c.Flush())
+	for i := 1; i <= 3; i++ {
+		reply, err := c.Receive()
+		require.NoError(t, err)
+		assert.Equal(t, protocol.Integer{Value: int64(i)}, reply)
+	}
+}
+
+func TestPipe(t *testing.T) {
+	addr := redistest.Start(t, server.Config{})
+
+	var input strings.Builder
+	for i := 0; i < 1000; i++ {
+		input.Write(Command("SET", "key:"+strconv.Itoa(i), "value").Serialize())
+	}
+	input.WriteString("INCR key:0\r\n") // inline commands work too, and this one fails
+
+	var errOut bytes.Buffer
+	result, err := Pipe(dial(t, addr), strings.NewReader(input.String()), &errOut)
+	require.NoError(t, err)
+	assert.Equal(t, PipeResult{Replies: 1001, Errors: 1}, result)
+	assert.Contains(t, errOut.String(), "not an integer")
+
+	reply, err := dial(t, addr).Do("DBSIZE")
+	require.NoError(t, err)
+	assert.Equal(t, protocol.Integer{Value: 1000}, reply)
+}
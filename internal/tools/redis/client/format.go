@@ -0,0 +1,168 @@
+package client
+
+import (
+	"cli-t/internal/tools/redis/protocol"
+
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Format renders a reply the way redis-cli does on a terminal:
+// quoted strings, (integer)/(nil) markers and numbered, indented arrays
+//
+//  1. "a"
+//  2. 1) "nested"
+//  2. (integer) 2
+func Format(value protocol.RESPValue) string {
+	switch v := value.(type) {
+	case protocol.SimpleString:
+		return v.Value
+	case protocol.Error:
+		return "(error) " + v.Message
+	case protocol.Integer:
+		return "(integer) " + strconv.FormatInt(v.Value, 10)
+	case protocol.BulkString:
+		if v.IsNull {
+			return "(nil)"
+		}
+		return Quote(v.Value)
+	case protocol.Array:
+		if v.IsNull {
+			return "(nil)"
+		}
+		return formatElements(v.Elements, ")")
+	case protocol.Push:
+		return formatElements(v.Elements, ")")
+	case protocol.Set:
+		return formatElements(v.Elements, "~")
+	case protocol.Map:
+		return formatMap(v)
+	case protocol.Double:
+		return "(double) " + protocol.FormatDouble(v.Value)
+	case protocol.Boolean:
+		return "(" + strconv.FormatBool(v.Value) + ")"
+	case protocol.Null:
+		return "(nil)"
+	case protocol.BigNumber:
+		return "(big number) " + v.Value
+	case protocol.Verbatim:
+		return strings.TrimRight(v.Value, "\r\n")
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// formatElements numbers the elements, right-aligned, and indents the
+// continuation lines of nested replies under their first line
+func formatElements(elements []protocol.RESPValue, marker string) string {
+	if len(elements) == 0 {
+		return "(empty array)"
+	}
+
+	width := len(strconv.Itoa(len(elements)))
+	lines := make([]string, 0, len(elements))
+	for i, elem := range elements {
+		prefix := fmt.Sprintf("%*d%s ", width, i+1, marker)
+		lines = append(lines, indent(prefix, Format(elem)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func formatMap(m protocol.Map) string {
+	if len(m.Entries) == 0 {
+		return "(empty hash)"
+	}
+
+	width := len(strconv.Itoa(len(m.Entries)))
+	lines := make([]string, 0, len(m.Entries))
+	for i, entry := range m.Entries {
+		prefix := fmt.Sprintf("%*d# %s => ", width, i+1, Format(entry.Key))
+		lines = append(lines, indent(prefix, Format(entry.Value)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// indent puts prefix before the first line of text and lines the others up under it
+func indent(prefix, text string) string {
+	pad := "\n" + strings.Repeat(" ", len(prefix))
+	return prefix + strings.ReplaceAll(text, "\n", pad)
+}
+
+// FormatRaw renders a reply like redis-cli --raw, or when the output isn't
+// a terminal: bare values, one per line, nothing to unquote in scripts
+func FormatRaw(value protocol.RESPValue) string {
+	switch v := value.(type) {
+	case protocol.SimpleString:
+		return v.Value
+	case protocol.Error:
+		return v.Message
+	case protocol.Integer:
+		return strconv.FormatInt(v.Value, 10)
+	case protocol.BulkString:
+		return v.Value // "" for nil, like redis-cli
+	case protocol.Array:
+		return formatRawElements(v.Elements)
+	case protocol.Push:
+		return formatRawElements(v.Elements)
+	case protocol.Set:
+		return formatRawElements(v.Elements)
+	case protocol.Map:
+		lines := make([]string, 0, len(v.Entries)*2)
+		for _, entry := range v.Entries {
+			lines = append(lines, FormatRaw(entry.Key), FormatRaw(entry.Value))
+		}
+		return strings.Join(lines, "\n")
+	case protocol.Double:
+		return protocol.FormatDouble(v.Value)
+	case protocol.Boolean:
+		return strconv.FormatBool(v.Value)
+	case protocol.Null:
+		return ""
+	case protocol.BigNumber:
+		return v.Value
+	case protocol.Verbatim:
+		return strings.TrimRight(v.Value, "\r\n")
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+func formatRawElements(elements []protocol.RESPValue) string {
+	lines := make([]string, len(elements))
+	for i, elem := range elements {
+		lines[i] = FormatRaw(elem)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Quote wraps s in double quotes with redis-cli's escapes (sdscatrepr):
+// \n \r \t \a \b, \" and \\, and \xHH for any other unprintable byte
+func Quote(s string) string {
+	var out strings.Builder
+	out.Grow(len(s) + 2)
+	out.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', '"':
+			out.WriteByte('\\')
+			out.WriteByte(c)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\r':
+			out.WriteString(`\r`)
+		case '\t':
+			out.WriteString(`\t`)
+		case '\a':
+			out.WriteString(`\a`)
+		case '\b':
+			out.WriteString(`\b`)
+		default:
+			if c < ' ' || c > '~' {
+				fmt.Fprintf(&out, `\x%02x`, c)
+			} else {
+				out.WriteByte(c)
+			}
+		}
+	}
+	out.WriteByte('"')
+	return out.String()
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"cli-t/internal/tools/redis/protocol"
+
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func bulk(s string) protocol.BulkString {
+	return protocol.BulkString{Value: s}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		reply protocol.RESPValue
+		want  string
+	}{
+		{protocol.SimpleString{Value: "OK"}, "OK"},
+		{protocol.Error{Message: "ERR nope"}, "(error) ERR nope"},
+		{protocol.Integer{Value: 42}, "(integer) 42"},
+		{bulk("say \"hi\"\n\x01"), `"say \"hi\"\n\x01"`},
+		{protocol.BulkString{IsNull: true}, "(nil)"},
+		{protocol.Array{IsNull: true}, "(nil)"},
+		{protocol.Array{Elements: []protocol.RESPValue{}}, "(empty array)"},
+		{protocol.Double{Value: 1.5}, "(double) 1.5"},
+		{protocol.Boolean{Value: true}, "(true)"},
+		{protocol.Null{}, "(nil)"},
+		{protocol.BigNumber{Value: "12345678901234567890"}, "(big number) 12345678901234567890"},
+		{protocol.Verbatim{Format: "txt", Value: "# Server\r\nredis_version:7.2.0\r\n"}, "# Server\r\nredis_version:7.2.0"},
+		{
+			protocol.Array{Elements: []protocol.RESPValue{
+				bulk("a"),
+				protocol.Array{Elements: []protocol.RESPValue{bulk("nested"), protocol.Integer{Value: 2}}},
+				bulk("c"),
+			}},
+			"1) \"a\"\n2) 1) \"nested\"\n   2) (integer) 2\n3) \"c\"",
+		},
+		{
+			protocol.Map{Entries: []protocol.MapEntry{
+				{Key: bulk("f"), Value: bulk("v")},
+				{Key: bulk("list"), Value: protocol.Set{Elements: []protocol.RESPValue{bulk("x"), bulk("y")}}},
+			}},
+			"1# \"f\" => \"v\"\n2# \"list\" => 1~ \"x\"\n             2~ \"y\"",
+		},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Format(tt.reply))
+	}
+
+	// Indices are right-aligned once there are ten or more
+	elements := make([]protocol.RESPValue, 10)
+	for i := range elements {
+		elements[i] = protocol.Integer{Value: int64(i)}
+	}
+	formatted := Format(protocol.Array{Elements: elements})
+	assert.Contains(t, formatted, " 9) (integer) 8\n10) (integer) 9")
+}
+
+func TestFormatRaw(t *testing.T) {
+	assert.Equal(t, "hello", FormatRaw(bulk("hello")))
+	assert.Equal(t, "", FormatRaw(protocol.BulkString{IsNull: true}))
+	assert.Equal(t, "ERR nope", FormatRaw(protocol.Error{Message: "ERR nope"}))
+	assert.Equal(t, "a\n1\nb\n2", FormatRaw(protocol.Map{Entries: []protocol.MapEntry{
+		{Key: bulk("a"), Value: protocol.Integer{Value: 1}},
+		{Key: bulk("b"), Value: protocol.Integer{Value: 2}},
+	}}))
+	assert.Equal(t, "x\ny", FormatRaw(protocol.Array{Elements: []protocol.RESPValue{bulk("x"), bulk("y")}}))
+}
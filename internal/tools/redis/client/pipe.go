@@ -0,0 +1,74 @@
+package client
+
+import (
+	"cli-t/internal/tools/redis/protocol"
+
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// PipeResult is what a mass insert did
+type PipeResult struct {
+	Replies int64 // replies received, the final ECHO excluded
+	Errors  int64 // how many of them were errors
+}
+
+// Pipe is redis-cli --pipe: it streams in (RESP or inline commands) to the
+// server as fast as it can while counting replies on the side. The number of
+// commands isn't known up front, so once the input ends it sends an ECHO of
+// a random marker and stops reading when that comes back. Error replies are
+// written to errOut.
+func Pipe(c *Client, in io.Reader, errOut io.Writer) (PipeResult, error) {
+	markerBytes := make([]byte, 20)
+	if _, err := rand.Read(markerBytes); err != nil {
+		return PipeResult{}, err
+	}
+	marker := hex.EncodeToString(markerBytes)
+
+	type outcome struct {
+		result PipeResult
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		var result PipeResult
+		for {
+			reply, err := c.Receive()
+			if err != nil {
+				done <- outcome{result, err}
+				return
+			}
+			if bulk, ok := reply.(protocol.BulkString); ok && bulk.Value == marker {
+				done <- outcome{result, nil}
+				return
+			}
+			result.Replies++
+			if errReply, failed := reply.(protocol.Error); failed {
+				result.Errors++
+				fmt.Fprintln(errOut, errReply.Message)
+			}
+		}
+	}()
+
+	err := copyAndMark(c, in, marker)
+	if err != nil {
+		c.Close() // unblocks the reader
+	}
+	res := <-done
+	if err != nil {
+		return res.result, err
+	}
+	return res.result, res.err
+}
+
+func copyAndMark(c *Client, in io.Reader, marker string) error {
+	if _, err := io.Copy(c, in); err != nil {
+		return err
+	}
+	if err := c.Send("ECHO", marker); err != nil {
+		return err
+	}
+	return c.Flush()
+}
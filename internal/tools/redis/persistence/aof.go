@@ -0,0 +1,484 @@
+package persistence
+
+import (
+	"cli-t/internal/shared/logger"
+	inmemory "cli-t/internal/shared/store/inmemory"
+	"cli-t/internal/tools/redis/protocol"
+
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FsyncPolicy controls how often the AOF is flushed to disk (appendfsync)
+type FsyncPolicy string
+
+const (
+	FsyncAlways   FsyncPolicy = "always"   // fsync after every write: safest, slowest
+	FsyncEverySec FsyncPolicy = "everysec" // fsync once per second: lose at most ~1s
+	FsyncNo       FsyncPolicy = "no"       // let the OS decide
+)
+
+var ErrRewriteInProgress = errors.New("ERR Background append only file rewriting already in progress")
+
+// ParseFsyncPolicy validates an --appendfsync value
+func ParseFsyncPolicy(value string) (FsyncPolicy, error) {
+	switch policy := FsyncPolicy(value); policy {
+	case FsyncAlways, FsyncEverySec, FsyncNo:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid appendfsync policy %q (always, everysec or no)", value)
+}
+
+// AOF is an append-only log of write commands in RESP format
+type AOF struct {
+	path   string
+	policy FsyncPolicy
+
+	mu     sync.Mutex
+	file   *os.File
+	writer *bufio.Writer
+
+	// While a rewrite runs, new commands also go here so they can be
+	// appended to the compacted file before it replaces the old one
+	rewriting  bool
+	rewriteBuf []byte
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// OpenAOF opens (or creates) the log at path for appending
+func OpenAOF(path string, policy FsyncPolicy) (*AOF, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &AOF{
+		path:   path,
+		policy: policy,
+		file:   file,
+		writer: bufio.NewWriter(file),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	if policy == FsyncEverySec {
+		go a.syncLoop()
+	} else {
+		close(a.done)
+	}
+	return a, nil
+}
+
+// Append logs one command
+func (a *AOF) Append(args ...string) error {
+	return a.AppendBatch([][]string{args})
+}
+
+// AppendBatch logs several commands with a single write (and fsync)
+func (a *AOF) AppendBatch(commands [][]string) error {
+	var encoded []byte
+	for _, args := range commands {
+		encoded = appendCommand(encoded, args)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.rewriting {
+		a.rewriteBuf = append(a.rewriteBuf, encoded...)
+	}
+
+	if _, err := a.writer.Write(encoded); err != nil {
+		return err
+	}
+	// Always hand the data to the OS, so "no" only risks an OS crash
+	if err := a.writer.Flush(); err != nil {
+		return err
+	}
+	if a.policy == FsyncAlways {
+		return a.file.Sync()
+	}
+	return nil
+}
+
+// Sync flushes buffered data and fsyncs the file
+func (a *AOF) Sync() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.writer.Flush(); err != nil {
+		return err
+	}
+	return a.file.Sync()
+}
+
+func (a *AOF) syncLoop() {
+	defer close(a.done)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.stop:
+			return
+		case <-ticker.C:
+			a.Sync() // errors resurface on the next Append
+		}
+	}
+}
+
+// Close fsyncs and closes the log
+func (a *AOF) Close() error {
+	select {
+	case <-a.stop:
+		return nil // already closed
+	default:
+		close(a.stop)
+	}
+	<-a.done
+
+	err := a.Sync()
+	if closeErr := a.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// StartRewrite begins capturing new commands for a rewrite. The caller must
+// take the dataset snapshot passed to FinishRewrite while no write can run,
+// so every command lands either in the snapshot or in the capture, never both.
+func (a *AOF) StartRewrite() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.rewriting {
+		return ErrRewriteInProgress
+	}
+	a.rewriting = true
+	a.rewriteBuf = nil
+	return nil
+}
+
+// RewriteInProgress reports whether a rewrite is running
+func (a *AOF) RewriteInProgress() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.rewriting
+}
+
+// FinishRewrite writes the shortest command list that rebuilds data,
+// appends what was captured since StartRewrite and swaps the new file in
+func (a *AOF) FinishRewrite(data Dataset) error {
+	err := a.finishRewrite(data)
+	if err != nil {
+		a.mu.Lock()
+		a.rewriting = false
+		a.rewriteBuf = nil
+		a.mu.Unlock()
+	}
+	return err
+}
+
+func (a *AOF) finishRewrite(data Dataset) error {
+	tmp, err := os.CreateTemp(filepath.Dir(a.path), "temp-rewriteaof-*.aof")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	// The slow part runs without the lock, commands keep flowing
+	w := bufio.NewWriter(tmp)
+	if err := writeDataset(w, data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, err := tmp.Write(a.rewriteBuf); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := os.Rename(tmp.Name(), a.path); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	// Keep appending to the new file from now on
+	a.writer.Flush()
+	a.file.Close()
+	a.file = tmp
+	a.writer = bufio.NewWriter(tmp)
+	a.rewriting = false
+	a.rewriteBuf = nil
+	return nil
+}
+
+// Max elements per generated command, keeps rewritten commands reasonable
+const rewriteBatch = 64
+
+// writeDataset encodes data as commands, with absolute PXAT expiries. Each
+// database's keys follow a SELECT, and the output ends back in DB 0, where
+// the commands appended after it are replayed from.
+func writeDataset(w io.Writer, data Dataset) error {
+	selected := 0
+	for db, keys := range data {
+		if len(keys) == 0 {
+			continue
+		}
+		if db != selected {
+			if _, err := w.Write(appendCommand(nil, []string{"SELECT", strconv.Itoa(db)})); err != nil {
+				return err
+			}
+			selected = db
+		}
+		if err := writeKeys(w, keys); err != nil {
+			return err
+		}
+	}
+	if selected != 0 {
+		_, err := w.Write(appendCommand(nil, []string{"SELECT", "0"}))
+		return err
+	}
+	return nil
+}
+
+// writeKeys encodes the keys of one database, sorted
+func writeKeys(w io.Writer, data map[string]inmemory.StoreValue) error {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		val := data[key]
+		var commands [][]string
+
+		switch val.Type {
+		case inmemory.TypeString:
+			cmd := []string{"SET", key, val.Data}
+			if val.ExpiresAt != nil {
+				cmd = append(cmd, "PXAT", strconv.FormatInt(val.ExpiresAt.UnixMilli(), 10))
+			}
+			commands = append(commands, cmd)
+		case inmemory.TypeList:
+			commands = batched("RPUSH", key, val.List)
+		case inmemory.TypeHash:
+			fields := make([]string, 0, len(val.Hash))
+			for field := range val.Hash {
+				fields = append(fields, field)
+			}
+			sort.Strings(fields)
+			pairs := make([]string, 0, 2*len(fields))
+			for _, field := range fields {
+				pairs = append(pairs, field, val.Hash[field])
+			}
+			commands = batchedPairs("HSET", key, pairs)
+		case inmemory.TypeSet:
+			members := make([]string, 0, len(val.Set))
+			for member := range val.Set {
+				members = append(members, member)
+			}
+			sort.Strings(members)
+			commands = batched("SADD", key, members)
+		case inmemory.TypeZSet:
+			pairs := []string{}
+			for _, m := range val.ZSet.Members() {
+				pairs = append(pairs, strconv.FormatFloat(m.Score, 'g', -1, 64), m.Member)
+			}
+			commands = batchedPairs("ZADD", key, pairs)
+		case inmemory.TypeStream:
+			commands = streamCommands(key, val.Stream)
+		default:
+			return fmt.Errorf("can't rewrite key %q of type %q", key, val.Type)
+		}
+
+		if val.ExpiresAt != nil && val.Type != inmemory.TypeString {
+			commands = append(commands, []string{"PEXPIREAT", key, strconv.FormatInt(val.ExpiresAt.UnixMilli(), 10)})
+		}
+
+		for _, cmd := range commands {
+			if _, err := w.Write(appendCommand(nil, cmd)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// streamCommands rebuilds a stream: its entries with their IDs, the last
+// ID, then the groups with their consumers and pending entries
+func streamCommands(key string, st *inmemory.Stream) [][]string {
+	var commands [][]string
+	for _, entry := range st.Entries() {
+		commands = append(commands, append([]string{"XADD", key, entry.ID.String()}, entry.Fields...))
+	}
+	if st.Len() == 0 {
+		// No XADD creates an empty stream: add an entry and trim it right away
+		id, _ := inmemory.StreamID{}.Next()
+		if id.Less(st.LastID()) {
+			id = st.LastID()
+		}
+		commands = append(commands, []string{"XADD", key, "MAXLEN", "0", id.String(), "x", "y"})
+	}
+	commands = append(commands, []string{"XSETID", key, st.LastID().String()})
+
+	for _, group := range st.Groups() {
+		commands = append(commands, []string{"XGROUP", "CREATE", key, group.Name, group.LastID.String()})
+		for _, consumer := range group.Consumers {
+			commands = append(commands, []string{"XGROUP", "CREATECONSUMER", key, group.Name, consumer.Name})
+		}
+		for _, pe := range group.Pending {
+			commands = append(commands, []string{"XCLAIM", key, group.Name, pe.Consumer, "0", pe.ID.String(),
+				"TIME", strconv.FormatInt(pe.DeliveredAt.UnixMilli(), 10),
+				"RETRYCOUNT", strconv.FormatInt(pe.Deliveries, 10), "FORCE", "JUSTID"})
+		}
+	}
+	return commands
+}
+
+func batched(name, key string, items []string) [][]string {
+	var commands [][]string
+	for len(items) > 0 {
+		n := min(len(items), rewriteBatch)
+		commands = append(commands, append([]string{name, key}, items[:n]...))
+		items = items[n:]
+	}
+	return commands
+}
+
+func batchedPairs(name, key string, pairs []string) [][]string {
+	var commands [][]string
+	for len(pairs) > 0 {
+		n := min(len(pairs), 2*rewriteBatch)
+		commands = append(commands, append([]string{name, key}, pairs[:n]...))
+		pairs = pairs[n:]
+	}
+	return commands
+}
+
+// appendCommand encodes args as a RESP array of bulk strings
+func appendCommand(dst []byte, args []string) []byte {
+	dst = append(dst, '*')
+	dst = strconv.AppendInt(dst, int64(len(args)), 10)
+	dst = append(dst, '\r', '\n')
+	for _, arg := range args {
+		dst = append(dst, '$')
+		dst = strconv.AppendInt(dst, int64(len(arg)), 10)
+		dst = append(dst, '\r', '\n')
+		dst = append(dst, arg...)
+		dst = append(dst, '\r', '\n')
+	}
+	return dst
+}
+
+// countingReader tracks how many bytes were read from the file
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// ReplayAOF feeds every logged command to apply, in order.
+//
+// Commands between MULTI and EXEC are handed over together once EXEC is
+// read. A partial command or transaction at the end of the file (crash
+// mid-write) is cut off, like redis' aof-load-truncated. A missing file
+// replays nothing.
+func ReplayAOF(path string, apply func(commands [][]string) error) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	counter := &countingReader{r: file}
+	reader := protocol.NewReader(counter)
+
+	var tx [][]string
+	var valid int64 // end offset of the last complete command / transaction
+
+	for {
+		msg, err := reader.ReadValue()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+
+		arr, ok := msg.(protocol.Array)
+		if !ok {
+			return fmt.Errorf("reading %s: unexpected %T", path, msg)
+		}
+		args := make([]string, len(arr.Elements))
+		for i, elem := range arr.Elements {
+			bulk, ok := elem.(protocol.BulkString)
+			if !ok {
+				return fmt.Errorf("reading %s: unexpected %T argument", path, elem)
+			}
+			args[i] = bulk.Value
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		offset := counter.n - int64(reader.Buffered())
+
+		switch name := args[0]; {
+		case strings.EqualFold(name, "MULTI"):
+			tx = [][]string{}
+		case strings.EqualFold(name, "EXEC") && tx != nil:
+			if err := apply(tx); err != nil {
+				return err
+			}
+			tx = nil
+			valid = offset
+		case tx != nil:
+			tx = append(tx, args)
+		default:
+			if err := apply([][]string{args}); err != nil {
+				return err
+			}
+			valid = offset
+		}
+	}
+
+	if valid == counter.n {
+		return nil
+	}
+
+	// Crash mid-write: drop the unfinished tail so appends start clean
+	logger.Warn("AOF ends with an incomplete command, truncating", "path", path, "bytes", counter.n-valid)
+	return file.Truncate(valid)
+}
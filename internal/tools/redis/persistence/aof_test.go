@@ -0,0 +1,147 @@
+package persistence
+
+import (
+	inmemory "cli-t/internal/shared/store/inmemory"
+
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// replayAll collects what ReplayAOF hands out
+func replayAll(t *testing.T, path string) [][][]string {
+	t.Helper()
+	var batches [][][]string
+	require.NoError(t, ReplayAOF(path, func(commands [][]string) error {
+		batches = append(batches, commands)
+		return nil
+	}))
+	return batches
+}
+
+func TestAOF_AppendAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+
+	for _, policy := range []FsyncPolicy{FsyncAlways, FsyncEverySec, FsyncNo} {
+		os.Remove(path)
+
+		aof, err := OpenAOF(path, policy)
+		require.NoError(t, err)
+		require.NoError(t, aof.Append("SET", "k", "hello\r\nworld"))
+		require.NoError(t, aof.AppendBatch([][]string{{"MULTI"}, {"INCR", "a"}, {"INCR", "b"}, {"EXEC"}}))
+		require.NoError(t, aof.Close())
+
+		assert.Equal(t, [][][]string{
+			{{"SET", "k", "hello\r\nworld"}},
+			{{"INCR", "a"}, {"INCR", "b"}},
+		}, replayAll(t, path), policy)
+	}
+
+	// Missing file replays nothing
+	assert.Empty(t, replayAll(t, filepath.Join(t.TempDir(), "missing.aof")))
+}
+
+func TestAOF_TruncatedTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	complete := "*2\r\n$3\r\nDEL\r\n$1\r\nk\r\n"
+
+	// Half-written command
+	require.NoError(t, os.WriteFile(path, []byte(complete+"*3\r\n$3\r\nSET\r\n$1\r\nk"), 0o644))
+	assert.Equal(t, [][][]string{{{"DEL", "k"}}}, replayAll(t, path))
+	raw, _ := os.ReadFile(path)
+	assert.Equal(t, complete, string(raw), "tail should be cut off")
+
+	// Transaction without EXEC is dropped as a whole
+	require.NoError(t, os.WriteFile(path, []byte(complete+"*1\r\n$5\r\nMULTI\r\n"+complete), 0o644))
+	assert.Equal(t, [][][]string{{{"DEL", "k"}}}, replayAll(t, path))
+	raw, _ = os.ReadFile(path)
+	assert.Equal(t, complete, string(raw))
+}
+
+func TestAOF_Rewrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+
+	aof, err := OpenAOF(path, FsyncAlways)
+	require.NoError(t, err)
+	defer aof.Close()
+
+	for i := 0; i < 100; i++ {
+		require.NoError(t, aof.Append("INCR", "counter"))
+	}
+
+	require.NoError(t, aof.StartRewrite())
+	assert.ErrorIs(t, aof.StartRewrite(), ErrRewriteInProgress)
+
+	// Written after the snapshot: must survive the rewrite
+	require.NoError(t, aof.Append("SADD", "late", "x"))
+
+	zset := inmemory.NewSortedSet()
+	zset.Add("m", 2.5)
+	require.NoError(t, aof.FinishRewrite(Dataset{
+		0: {"counter": {Type: inmemory.TypeString, Data: "100"}},
+		2: {"z": {Type: inmemory.TypeZSet, ZSet: zset}},
+	}))
+	assert.False(t, aof.RewriteInProgress())
+
+	// Appends keep going to the new file
+	require.NoError(t, aof.Append("DEL", "z"))
+
+	assert.Equal(t, [][][]string{
+		{{"SET", "counter", "100"}},
+		{{"SELECT", "2"}},
+		{{"ZADD", "z", "2.5", "m"}},
+		{{"SELECT", "0"}}, // what was appended meanwhile starts in DB 0
+		{{"SADD", "late", "x"}},
+		{{"DEL", "z"}},
+	}, replayAll(t, path))
+}
+
+func TestAOF_RewriteStream(t *testing.T) {
+	stream := inmemory.NewStream()
+	stream.Append(inmemory.StreamEntry{ID: inmemory.StreamID{Ms: 1, Seq: 1}, Fields: []string{"f", "v"}})
+	stream.SetLastID(inmemory.StreamID{Ms: 5, Seq: 0})
+	stream.AddGroup(inmemory.StreamGroup{
+		Name:      "g",
+		LastID:    inmemory.StreamID{Ms: 1, Seq: 1},
+		Pending:   []inmemory.PendingEntry{{ID: inmemory.StreamID{Ms: 1, Seq: 1}, Consumer: "c", DeliveredAt: time.UnixMilli(1000), Deliveries: 2}},
+		Consumers: []inmemory.StreamConsumer{{Name: "c"}},
+	})
+
+	var buf bytes.Buffer
+	require.NoError(t, writeDataset(&buf, Dataset{{
+		"s":     {Type: inmemory.TypeStream, Stream: stream},
+		"empty": {Type: inmemory.TypeStream, Stream: inmemory.NewStream()},
+	}}))
+
+	assert.Equal(t, string(appendCommands(
+		[]string{"XADD", "empty", "MAXLEN", "0", "0-1", "x", "y"},
+		[]string{"XSETID", "empty", "0-0"},
+		[]string{"XADD", "s", "1-1", "f", "v"},
+		[]string{"XSETID", "s", "5-0"},
+		[]string{"XGROUP", "CREATE", "s", "g", "1-1"},
+		[]string{"XGROUP", "CREATECONSUMER", "s", "g", "c"},
+		[]string{"XCLAIM", "s", "g", "c", "0", "1-1", "TIME", "1000", "RETRYCOUNT", "2", "FORCE", "JUSTID"},
+	)), buf.String())
+}
+
+func appendCommands(commands ...[]string) []byte {
+	var out []byte
+	for _, cmd := range commands {
+		out = appendCommand(out, cmd)
+	}
+	return out
+}
+
+func TestParseFsyncPolicy(t *testing.T) {
+	policy, err := ParseFsyncPolicy("everysec")
+	assert.NoError(t, err)
+	assert.Equal(t, FsyncEverySec, policy)
+
+	_, err = ParseFsyncPolicy("sometimes")
+	assert.Error(t, err)
+}
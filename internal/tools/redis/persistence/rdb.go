@@ -0,0 +1,499 @@
+package persistence
+
+import (
+	inmemory "cli-t/internal/shared/store/inmemory"
+	"cli-t/internal/tools/redis/protocol"
+
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+/*
+Snapshot file format (same idea as redis' RDB, much simpler encoding):
+
+	"CLITRDB" <version byte>
+	{ 0xFE <db number> { [0xFC <expiry unix ms, int64>] <type byte> <key> <value> }* }*
+	0xFF <crc64 of everything before, uint64>
+
+Only databases with keys are written. Version 1 had no 0xFE, everything
+in it belongs to DB 0; it still loads.
+
+Strings are a uvarint length followed by the bytes. Aggregates are a
+uvarint element count followed by their elements (hash: field, value;
+zset: member, float64 score). Integers are little endian.
+
+A stream is its entries (ID, field count, fields), its last ID, then its
+consumer groups: name, last ID, pending entries (ID, consumer, delivery
+time, delivery count) and consumers (name, seen time). IDs are two int64s.
+*/
+
+const (
+	rdbMagic   = "CLITRDB"
+	rdbVersion = 2
+
+	opExpireMs = 0xFC
+	opSelectDB = 0xFE
+	opEOF      = 0xFF
+
+	typeString = 0
+	typeList   = 1
+	typeHash   = 2
+	typeSet    = 3
+	typeZSet   = 4
+	typeStream = 5
+)
+
+var (
+	ErrBadMagic    = errors.New("not a snapshot file")
+	ErrBadChecksum = errors.New("snapshot checksum mismatch")
+)
+
+var crcTable = crc64.MakeTable(crc64.ECMA)
+
+// Dataset is the content of every database, indexed by DB number
+type Dataset []map[string]inmemory.StoreValue
+
+// maxDatabases bounds the DB numbers a snapshot may use, so a corrupt one
+// can't make the reader allocate millions of empty databases
+const maxDatabases = 1 << 16
+
+// db returns database n, adding empty ones up to it
+func (d *Dataset) db(n int) map[string]inmemory.StoreValue {
+	for len(*d) <= n {
+		*d = append(*d, make(map[string]inmemory.StoreValue))
+	}
+	return (*d)[n]
+}
+
+// Keys counts the keys of every database
+func (d Dataset) Keys() int {
+	n := 0
+	for _, db := range d {
+		n += len(db)
+	}
+	return n
+}
+
+// WriteRDB encodes data as a snapshot
+func WriteRDB(w io.Writer, data Dataset) error {
+	crc := crc64.New(crcTable)
+	bw := bufio.NewWriter(io.MultiWriter(w, crc))
+	e := &encoder{w: bw}
+
+	e.raw([]byte(rdbMagic))
+	e.byte(rdbVersion)
+
+	for db, keys := range data {
+		if len(keys) == 0 {
+			continue
+		}
+		e.byte(opSelectDB)
+		e.length(db)
+		if err := e.keys(keys); err != nil {
+			return err
+		}
+	}
+
+	e.byte(opEOF)
+	if e.err != nil {
+		return e.err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	// The checksum itself isn't part of what it covers
+	return binary.Write(w, binary.LittleEndian, crc.Sum64())
+}
+
+// keys encodes the keys of one database
+func (e *encoder) keys(data map[string]inmemory.StoreValue) error {
+	for key, val := range data {
+		if val.ExpiresAt != nil {
+			e.byte(opExpireMs)
+			e.int64(val.ExpiresAt.UnixMilli())
+		}
+
+		switch val.Type {
+		case inmemory.TypeString:
+			e.byte(typeString)
+			e.string(key)
+			e.string(val.Data)
+		case inmemory.TypeList:
+			e.byte(typeList)
+			e.string(key)
+			e.length(len(val.List))
+			for _, item := range val.List {
+				e.string(item)
+			}
+		case inmemory.TypeHash:
+			e.byte(typeHash)
+			e.string(key)
+			e.length(len(val.Hash))
+			for field, value := range val.Hash {
+				e.string(field)
+				e.string(value)
+			}
+		case inmemory.TypeSet:
+			e.byte(typeSet)
+			e.string(key)
+			e.length(len(val.Set))
+			for member := range val.Set {
+				e.string(member)
+			}
+		case inmemory.TypeZSet:
+			members := val.ZSet.Members()
+			e.byte(typeZSet)
+			e.string(key)
+			e.length(len(members))
+			for _, m := range members {
+				e.string(m.Member)
+				e.float64(m.Score)
+			}
+		case inmemory.TypeStream:
+			e.byte(typeStream)
+			e.string(key)
+			e.stream(val.Stream)
+		default:
+			return fmt.Errorf("can't encode key %q of type %q", key, val.Type)
+		}
+	}
+	return nil
+}
+
+// Corrupt counts must not turn into huge allocations before the checksum
+// gets a chance to reject the file
+const maxPrealloc = 1024
+
+// ReadRDB decodes a snapshot written by WriteRDB. The dataset ends with
+// the last database that has keys.
+func ReadRDB(r io.Reader) (Dataset, error) {
+	crc := crc64.New(crcTable)
+	d := &decoder{r: bufio.NewReader(r), crc: crc}
+
+	magic := d.raw(len(rdbMagic))
+	if d.err != nil || string(magic) != rdbMagic {
+		return nil, ErrBadMagic
+	}
+	if version := d.byte(); d.err == nil && (version < 1 || version > rdbVersion) {
+		return nil, fmt.Errorf("unsupported snapshot version %d", version)
+	}
+
+	data := Dataset{}
+	db := 0
+	var expiresAt *time.Time
+
+	for d.err == nil {
+		op := d.byte()
+		if d.err != nil {
+			break
+		}
+
+		switch op {
+		case opEOF:
+			sum := crc.Sum64()
+			var stored uint64
+			if err := binary.Read(d.r, binary.LittleEndian, &stored); err != nil {
+				return nil, fmt.Errorf("reading checksum: %w", err)
+			}
+			if stored != sum {
+				return nil, ErrBadChecksum
+			}
+			return data, nil
+
+		case opExpireMs:
+			at := time.UnixMilli(d.int64())
+			expiresAt = &at
+			continue
+
+		case opSelectDB:
+			db = d.length()
+			if db >= maxDatabases {
+				return nil, fmt.Errorf("invalid database number %d in snapshot", db)
+			}
+			continue
+		}
+
+		key := d.string()
+		val := inmemory.StoreValue{ExpiresAt: expiresAt}
+		expiresAt = nil
+
+		switch op {
+		case typeString:
+			val.Type = inmemory.TypeString
+			val.Data = d.string()
+		case typeList:
+			val.Type = inmemory.TypeList
+			n := d.length()
+			val.List = make([]string, 0, min(n, maxPrealloc))
+			for i := 0; i < n && d.err == nil; i++ {
+				val.List = append(val.List, d.string())
+			}
+		case typeHash:
+			val.Type = inmemory.TypeHash
+			n := d.length()
+			val.Hash = make(map[string]string, min(n, maxPrealloc))
+			for i := 0; i < n && d.err == nil; i++ {
+				field := d.string()
+				val.Hash[field] = d.string()
+			}
+		case typeSet:
+			val.Type = inmemory.TypeSet
+			n := d.length()
+			val.Set = make(map[string]struct{}, min(n, maxPrealloc))
+			for i := 0; i < n && d.err == nil; i++ {
+				val.Set[d.string()] = struct{}{}
+			}
+		case typeZSet:
+			val.Type = inmemory.TypeZSet
+			val.ZSet = inmemory.NewSortedSet()
+			n := d.length()
+			for i := 0; i < n && d.err == nil; i++ {
+				member := d.string()
+				val.ZSet.Add(member, d.float64())
+			}
+		case typeStream:
+			val.Type = inmemory.TypeStream
+			val.Stream = d.stream()
+		default:
+			return nil, fmt.Errorf("unknown value type %d in snapshot", op)
+		}
+
+		data.db(db)[key] = val
+	}
+
+	if errors.Is(d.err, io.EOF) {
+		return nil, fmt.Errorf("snapshot is truncated: %w", io.ErrUnexpectedEOF)
+	}
+	return nil, d.err
+}
+
+// SaveRDB writes the snapshot to a temp file and renames it over path,
+// so a crash mid-save never leaves a half-written dump behind
+func SaveRDB(path string, data Dataset) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "temp-*.rdb")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if err := WriteRDB(tmp, data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadRDB reads the snapshot at path. A missing file is an empty dataset.
+func LoadRDB(path string) (Dataset, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Dataset{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadRDB(file)
+}
+
+// encoder remembers the first write error so encoding code stays linear
+type encoder struct {
+	w   io.Writer
+	err error
+	buf [binary.MaxVarintLen64]byte
+}
+
+func (e *encoder) raw(p []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(p)
+	}
+}
+
+func (e *encoder) byte(b byte) {
+	e.raw([]byte{b})
+}
+
+func (e *encoder) length(n int) {
+	e.raw(e.buf[:binary.PutUvarint(e.buf[:], uint64(n))])
+}
+
+func (e *encoder) string(s string) {
+	e.length(len(s))
+	e.raw([]byte(s))
+}
+
+func (e *encoder) int64(n int64) {
+	binary.LittleEndian.PutUint64(e.buf[:8], uint64(n))
+	e.raw(e.buf[:8])
+}
+
+func (e *encoder) float64(f float64) {
+	binary.LittleEndian.PutUint64(e.buf[:8], math.Float64bits(f))
+	e.raw(e.buf[:8])
+}
+
+func (e *encoder) streamID(id inmemory.StreamID) {
+	e.int64(int64(id.Ms))
+	e.int64(int64(id.Seq))
+}
+
+func (e *encoder) stream(st *inmemory.Stream) {
+	entries := st.Entries()
+	e.length(len(entries))
+	for _, entry := range entries {
+		e.streamID(entry.ID)
+		e.length(len(entry.Fields))
+		for _, field := range entry.Fields {
+			e.string(field)
+		}
+	}
+	e.streamID(st.LastID())
+
+	groups := st.Groups()
+	e.length(len(groups))
+	for _, group := range groups {
+		e.string(group.Name)
+		e.streamID(group.LastID)
+		e.length(len(group.Pending))
+		for _, pe := range group.Pending {
+			e.streamID(pe.ID)
+			e.string(pe.Consumer)
+			e.int64(pe.DeliveredAt.UnixMilli())
+			e.int64(pe.Deliveries)
+		}
+		e.length(len(group.Consumers))
+		for _, consumer := range group.Consumers {
+			e.string(consumer.Name)
+			e.int64(consumer.SeenAt.UnixMilli())
+		}
+	}
+}
+
+// decoder mirrors encoder; every byte read is fed to the checksum
+type decoder struct {
+	r   *bufio.Reader
+	crc io.Writer
+	err error
+}
+
+func (d *decoder) raw(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	p := make([]byte, n)
+	if _, d.err = io.ReadFull(d.r, p); d.err != nil {
+		return nil
+	}
+	d.crc.Write(p)
+	return p
+}
+
+func (d *decoder) byte() byte {
+	p := d.raw(1)
+	if p == nil {
+		return 0
+	}
+	return p[0]
+}
+
+func (d *decoder) length() int {
+	if d.err != nil {
+		return 0
+	}
+	var n uint64
+	for shift := 0; ; shift += 7 {
+		b := d.byte()
+		if d.err != nil {
+			return 0
+		}
+		if shift > 63 {
+			d.err = errors.New("invalid length in snapshot")
+			return 0
+		}
+		n |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			break
+		}
+	}
+	if n > protocol.MaxBulkLength {
+		d.err = errors.New("invalid length in snapshot")
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) string() string {
+	return string(d.raw(d.length()))
+}
+
+func (d *decoder) int64() int64 {
+	p := d.raw(8)
+	if p == nil {
+		return 0
+	}
+	return int64(binary.LittleEndian.Uint64(p))
+}
+
+func (d *decoder) float64() float64 {
+	p := d.raw(8)
+	if p == nil {
+		return 0
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(p))
+}
+
+func (d *decoder) streamID() inmemory.StreamID {
+	return inmemory.StreamID{Ms: uint64(d.int64()), Seq: uint64(d.int64())}
+}
+
+func (d *decoder) stream() *inmemory.Stream {
+	st := inmemory.NewStream()
+	n := d.length()
+	for i := 0; i < n && d.err == nil; i++ {
+		entry := inmemory.StreamEntry{ID: d.streamID()}
+		fields := d.length()
+		entry.Fields = make([]string, 0, min(fields, maxPrealloc))
+		for j := 0; j < fields && d.err == nil; j++ {
+			entry.Fields = append(entry.Fields, d.string())
+		}
+		st.Append(entry)
+	}
+	st.SetLastID(d.streamID())
+
+	groups := d.length()
+	for i := 0; i < groups && d.err == nil; i++ {
+		group := inmemory.StreamGroup{Name: d.string(), LastID: d.streamID()}
+		pending := d.length()
+		for j := 0; j < pending && d.err == nil; j++ {
+			pe := inmemory.PendingEntry{ID: d.streamID(), Consumer: d.string()}
+			pe.DeliveredAt = time.UnixMilli(d.int64())
+			pe.Deliveries = d.int64()
+			group.Pending = append(group.Pending, pe)
+		}
+		consumers := d.length()
+		for j := 0; j < consumers && d.err == nil; j++ {
+			consumer := inmemory.StreamConsumer{Name: d.string()}
+			consumer.SeenAt = time.UnixMilli(d.int64())
+			group.Consumers = append(group.Consumers, consumer)
+		}
+		st.AddGroup(group)
+	}
+	return st
+}
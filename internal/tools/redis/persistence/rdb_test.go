@@ -0,0 +1,149 @@
+package persistence
+
+import (
+	inmemory "cli-t/internal/shared/store/inmemory"
+
+	"bytes"
+	"encoding/binary"
+	"hash/crc64"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sampleData() map[string]inmemory.StoreValue {
+	expiresAt := time.UnixMilli(time.Now().Add(time.Hour).UnixMilli())
+
+	zset := inmemory.NewSortedSet()
+	zset.Add("alice", 1.5)
+	zset.Add("bob", -3)
+
+	stream := inmemory.NewStream()
+	stream.Append(inmemory.StreamEntry{ID: inmemory.StreamID{Ms: 1, Seq: 0}, Fields: []string{"temp", "21"}})
+	stream.Append(inmemory.StreamEntry{ID: inmemory.StreamID{Ms: 1, Seq: 5}, Fields: []string{"temp", "22", "unit", "C"}})
+	stream.SetLastID(inmemory.StreamID{Ms: 9, Seq: 0})
+	stream.AddGroup(inmemory.StreamGroup{
+		Name:   "workers",
+		LastID: inmemory.StreamID{Ms: 1, Seq: 5},
+		Pending: []inmemory.PendingEntry{
+			{ID: inmemory.StreamID{Ms: 1, Seq: 5}, Consumer: "alice", DeliveredAt: time.UnixMilli(1700000000000), Deliveries: 3},
+		},
+		Consumers: []inmemory.StreamConsumer{{Name: "alice", SeenAt: time.UnixMilli(1700000000001)}, {Name: "bob", SeenAt: time.UnixMilli(1700000000002)}},
+	})
+
+	return map[string]inmemory.StoreValue{
+		"str":    {Type: inmemory.TypeString, Data: "hello\r\nworld"},
+		"ttl":    {Type: inmemory.TypeString, Data: "", ExpiresAt: &expiresAt},
+		"list":   {Type: inmemory.TypeList, List: []string{"a", "b", "a"}},
+		"hash":   {Type: inmemory.TypeHash, Hash: map[string]string{"f1": "v1", "f2": ""}},
+		"set":    {Type: inmemory.TypeSet, Set: map[string]struct{}{"x": {}, "y": {}}},
+		"zset":   {Type: inmemory.TypeZSet, ZSet: zset},
+		"stream": {Type: inmemory.TypeStream, Stream: stream},
+		"empty":  {Type: inmemory.TypeString},
+	}
+}
+
+func TestRDB_RoundTrip(t *testing.T) {
+	data := Dataset{0: sampleData(), 3: {"db3": {Type: inmemory.TypeString, Data: "three"}}}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteRDB(&buf, data))
+
+	loaded, err := ReadRDB(&buf)
+	require.NoError(t, err)
+	// The databases in between come back empty
+	require.Len(t, loaded, 4)
+	assert.Empty(t, loaded[1])
+	assert.Empty(t, loaded[2])
+
+	for db, keys := range data {
+		require.Len(t, loaded[db], len(keys))
+		assertSameKeys(t, keys, loaded[db])
+	}
+}
+
+func assertSameKeys(t *testing.T, data, loaded map[string]inmemory.StoreValue) {
+	t.Helper()
+	for key, want := range data {
+		got := loaded[key]
+		assert.Equal(t, want.Type, got.Type, key)
+		assert.Equal(t, want.Data, got.Data, key)
+		assert.Equal(t, want.List, got.List, key)
+		assert.Equal(t, want.Hash, got.Hash, key)
+		assert.Equal(t, want.Set, got.Set, key)
+		if want.ZSet != nil {
+			assert.Equal(t, want.ZSet.Members(), got.ZSet.Members(), key)
+		}
+		if want.Stream != nil {
+			assert.Equal(t, want.Stream.Entries(), got.Stream.Entries(), key)
+			assert.Equal(t, want.Stream.LastID(), got.Stream.LastID(), key)
+			assert.Equal(t, want.Stream.Groups(), got.Stream.Groups(), key)
+		}
+		if want.ExpiresAt != nil {
+			require.NotNil(t, got.ExpiresAt, key)
+			assert.True(t, want.ExpiresAt.Equal(*got.ExpiresAt), key)
+		} else {
+			assert.Nil(t, got.ExpiresAt, key)
+		}
+	}
+}
+
+func TestRDB_Version1(t *testing.T) {
+	// One sample for both sides: its TTLs depend on the current millisecond
+	data := sampleData()
+	var buf bytes.Buffer
+	require.NoError(t, WriteRDB(&buf, Dataset{data}))
+	raw := buf.Bytes()
+
+	// Version 1 is the same without the SELECTDB opcode and its DB number
+	body := append([]byte(rdbMagic), 1)
+	body = append(body, raw[len(rdbMagic)+3:len(raw)-8]...)
+	v1 := binary.LittleEndian.AppendUint64(body, crc64.Checksum(body, crcTable))
+
+	loaded, err := ReadRDB(bytes.NewReader(v1))
+	require.NoError(t, err)
+	require.Len(t, loaded, 1)
+	assertSameKeys(t, data, loaded[0])
+}
+
+func TestRDB_Corruption(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteRDB(&buf, Dataset{sampleData()}))
+	raw := buf.Bytes()
+
+	_, err := ReadRDB(bytes.NewReader([]byte("NOTRDB1")))
+	assert.ErrorIs(t, err, ErrBadMagic)
+
+	// Flip one byte in the body
+	flipped := append([]byte(nil), raw...)
+	flipped[len(rdbMagic)+3] ^= 0xFF
+	_, err = ReadRDB(bytes.NewReader(flipped))
+	assert.Error(t, err)
+
+	// Cut the file short anywhere
+	for _, n := range []int{len(rdbMagic) + 1, len(raw) / 2, len(raw) - 1} {
+		_, err = ReadRDB(bytes.NewReader(raw[:n]))
+		assert.Error(t, err, "truncated at %d", n)
+	}
+}
+
+func TestRDB_SaveAndLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.rdb")
+
+	// A missing file is an empty dataset, not an error
+	loaded, err := LoadRDB(path)
+	require.NoError(t, err)
+	assert.Empty(t, loaded)
+
+	require.NoError(t, SaveRDB(path, Dataset{sampleData()}))
+	loaded, err = LoadRDB(path)
+	require.NoError(t, err)
+	assert.Equal(t, len(sampleData()), loaded.Keys())
+
+	// No temp files left behind
+	entries, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "*"))
+	assert.Equal(t, []string{path}, entries)
+}
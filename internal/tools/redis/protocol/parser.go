@@ -5,12 +5,27 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
+)
+
+// ErrIncomplete is returned by Parse when data only holds the beginning of a
+// RESP value. Streaming callers should read more bytes and try again.
+var ErrIncomplete = errors.New("incomplete RESP value")
+
+// Limits mirroring redis-server's defaults (proto-max-bulk-len).
+const (
+	MaxBulkLength  = 512 * 1024 * 1024
+	MaxArrayLength = 1024 * 1024
+
+	// maxPrealloc caps the room reserved from a declared element count, which
+	// is only a claim until the elements actually arrive
+	maxPrealloc = 1024
 )
 
 // TODO: much later Parser Allocations ans use buffer
 func Parse(data []byte) (RESPValue, int, error) {
 	if len(data) == 0 {
-		return nil, 0, errors.New("empty input")
+		return nil, 0, ErrIncomplete
 	}
 
 	switch data[0] {
@@ -24,6 +39,24 @@ func Parse(data []byte) (RESPValue, int, error) {
 		return parseBulkString(data)
 	case '*':
 		return parseArray(data)
+	case '%':
+		return parseMap(data)
+	case '~':
+		elements, consumed, err := parseAggregate(data)
+		return Set{Elements: elements}, consumed, err
+	case '>':
+		elements, consumed, err := parseAggregate(data)
+		return Push{Elements: elements}, consumed, err
+	case ',':
+		return parseDouble(data)
+	case '#':
+		return parseBoolean(data)
+	case '_':
+		return parseNull(data)
+	case '(':
+		return parseBigNumber(data)
+	case '=':
+		return parseVerbatim(data)
 	default:
 		return nil, 0, fmt.Errorf("unknown type byte: %c", data[0])
 	}
@@ -33,7 +66,7 @@ func parseSimpleString(data []byte) (SimpleString, int, error) {
 	// 1. Find where \r\n is
 	idx := bytes.Index(data, []byte("\r\n"))
 	if idx == -1 {
-		return SimpleString{}, 0, errors.New("missing \\r\\n terminator")
+		return SimpleString{}, 0, ErrIncomplete
 	}
 
 	// 2. Check it starts with '+'
@@ -52,7 +85,7 @@ func parseError(data []byte) (Error, int, error) {
 	// 1. Find where \r\n is
 	idx := bytes.Index(data, []byte("\r\n"))
 	if idx == -1 {
-		return Error{}, 0, errors.New("missing \\r\\n terminator")
+		return Error{}, 0, ErrIncomplete
 	}
 
 	// 2. Check it starts with '-'
@@ -71,7 +104,7 @@ func parseInteger(data []byte) (Integer, int, error) {
 	// 1. Find where \r\n is
 	idx := bytes.Index(data, []byte("\r\n"))
 	if idx == -1 {
-		return Integer{}, 0, errors.New("missing \\r\\n terminator")
+		return Integer{}, 0, ErrIncomplete
 	}
 
 	// 2. Check it starts with ':'
@@ -98,7 +131,7 @@ func parseBulkString(data []byte) (BulkString, int, error) {
 	// 2. Find first \r\n (end of length line)
 	idx := bytes.Index(data, []byte("\r\n"))
 	if idx == -1 {
-		return BulkString{}, 0, errors.New("missing \\r\\n terminator")
+		return BulkString{}, 0, ErrIncomplete
 	}
 
 	// 3. Parse the length
@@ -114,20 +147,23 @@ func parseBulkString(data []byte) (BulkString, int, error) {
 		consumed := idx + 2
 		return BulkString{IsNull: true}, consumed, nil
 	}
+	if length < -1 || length > MaxBulkLength {
+		return BulkString{}, 0, fmt.Errorf("invalid bulk length: %d", length)
+	}
 
 	// 5. Extract the actual data (after first \r\n)
 	dataStart := idx + 2 // Skip past first \r\n
 	dataEnd := dataStart + length
 
-	// 6. Validate we have enough data
-	if dataEnd > len(data) {
-		return BulkString{}, 0, errors.New("data shorter than specified length")
+	// 6. Validate we have enough data (payload + final \r\n)
+	if dataEnd+2 > len(data) {
+		return BulkString{}, 0, ErrIncomplete
 	}
 
 	value := string(data[dataStart:dataEnd])
 
 	// 7. Check for final \r\n
-	if dataEnd+2 > len(data) || string(data[dataEnd:dataEnd+2]) != "\r\n" {
+	if string(data[dataEnd:dataEnd+2]) != "\r\n" {
 		return BulkString{}, 0, errors.New("missing final \\r\\n")
 	}
 
@@ -141,27 +177,18 @@ func parseArray(data []byte) (Array, int, error) {
 		return Array{}, 0, errors.New("not a array")
 	}
 
-	// 2. Find first \r\n (end of length line)
-	idx := bytes.Index(data, []byte("\r\n"))
-	if idx == -1 {
-		return Array{}, 0, errors.New("missing \\r\\n terminator")
-	}
-
-	// 3. Parse the length
-	lengthStr := string(data[1:idx]) // Everything between $ and \r\n
-	length, err := strconv.Atoi(lengthStr)
+	// 2. Parse the length line
+	length, pos, err := readArrayHeader(data) // pos is right after "*<count>\r\n"
 	if err != nil {
-		return Array{}, 0, fmt.Errorf("invalid length: %v", err)
+		return Array{}, 0, err
 	}
 
-	// 4. Handle null case
+	// 3. Handle null case
 	if length == -1 {
-		consumed := idx + 2
-		return Array{IsNull: true}, consumed, nil
+		return Array{IsNull: true}, pos, nil
 	}
 
-	elements := make([]RESPValue, 0, length)
-	pos := idx + 2 // Start after "*<count>\r\n"
+	elements := make([]RESPValue, 0, min(length, maxPrealloc))
 
 	for i := 0; i < length; i++ {
 		elem, consumed, err := Parse(data[pos:]) // Recursive!
@@ -176,3 +203,161 @@ func parseArray(data []byte) (Array, int, error) {
 
 	return Array{Elements: elements}, totalConsumed, nil
 }
+
+// readArrayHeader parses "*<count>\r\n", where a count of -1 is the null array
+func readArrayHeader(data []byte) (int, int, error) {
+	line, consumed, err := readLine(data)
+	if err != nil {
+		return 0, 0, err
+	}
+	length, err := strconv.Atoi(line)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid length: %v", err)
+	}
+	if length < -1 || length > MaxArrayLength {
+		return 0, 0, fmt.Errorf("invalid multibulk length: %d", length)
+	}
+	return length, consumed, nil
+}
+
+// readLine returns what follows the type byte up to the first \r\n
+func readLine(data []byte) (string, int, error) {
+	idx := bytes.Index(data, []byte("\r\n"))
+	if idx == -1 {
+		return "", 0, ErrIncomplete
+	}
+	return string(data[1:idx]), idx + 2, nil
+}
+
+// readCount parses the element count of an aggregate type
+func readCount(data []byte) (int, int, error) {
+	line, consumed, err := readLine(data)
+	if err != nil {
+		return 0, 0, err
+	}
+	count, err := strconv.Atoi(line)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid length: %v", err)
+	}
+	if count < 0 || count > MaxArrayLength {
+		return 0, 0, fmt.Errorf("invalid multibulk length: %d", count)
+	}
+	return count, consumed, nil
+}
+
+// parseAggregate parses the elements of a Set or Push
+func parseAggregate(data []byte) ([]RESPValue, int, error) {
+	count, pos, err := readCount(data)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	elements := make([]RESPValue, 0, min(count, maxPrealloc))
+	for i := 0; i < count; i++ {
+		elem, consumed, err := Parse(data[pos:])
+		if err != nil {
+			return nil, 0, err
+		}
+		elements = append(elements, elem)
+		pos += consumed
+	}
+	return elements, pos, nil
+}
+
+func parseMap(data []byte) (Map, int, error) {
+	count, pos, err := readCount(data)
+	if err != nil {
+		return Map{}, 0, err
+	}
+
+	entries := make([]MapEntry, 0, min(count, maxPrealloc))
+	for i := 0; i < count; i++ {
+		key, consumed, err := Parse(data[pos:])
+		if err != nil {
+			return Map{}, 0, err
+		}
+		pos += consumed
+
+		value, consumed, err := Parse(data[pos:])
+		if err != nil {
+			return Map{}, 0, err
+		}
+		pos += consumed
+		entries = append(entries, MapEntry{Key: key, Value: value})
+	}
+	return Map{Entries: entries}, pos, nil
+}
+
+func parseDouble(data []byte) (Double, int, error) {
+	line, consumed, err := readLine(data)
+	if err != nil {
+		return Double{}, 0, err
+	}
+	// ParseFloat already accepts inf, -inf and nan
+	value, err := strconv.ParseFloat(line, 64)
+	if err != nil {
+		return Double{}, 0, errors.New("not a double")
+	}
+	return Double{Value: value}, consumed, nil
+}
+
+func parseBoolean(data []byte) (Boolean, int, error) {
+	line, consumed, err := readLine(data)
+	if err != nil {
+		return Boolean{}, 0, err
+	}
+	switch line {
+	case "t":
+		return Boolean{Value: true}, consumed, nil
+	case "f":
+		return Boolean{Value: false}, consumed, nil
+	}
+	return Boolean{}, 0, errors.New("not a boolean")
+}
+
+func parseNull(data []byte) (Null, int, error) {
+	line, consumed, err := readLine(data)
+	if err != nil {
+		return Null{}, 0, err
+	}
+	if line != "" {
+		return Null{}, 0, errors.New("not a null")
+	}
+	return Null{}, consumed, nil
+}
+
+func parseBigNumber(data []byte) (BigNumber, int, error) {
+	line, consumed, err := readLine(data)
+	if err != nil {
+		return BigNumber{}, 0, err
+	}
+	digits := strings.TrimPrefix(strings.TrimPrefix(line, "-"), "+")
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return BigNumber{}, 0, errors.New("not a big number")
+	}
+	return BigNumber{Value: line}, consumed, nil
+}
+
+func parseVerbatim(data []byte) (Verbatim, int, error) {
+	// Framed like a bulk string, the payload starts with "fmt:"
+	line, start, err := readLine(data)
+	if err != nil {
+		return Verbatim{}, 0, err
+	}
+	length, err := strconv.Atoi(line)
+	if err != nil || length < 4 || length > MaxBulkLength {
+		return Verbatim{}, 0, fmt.Errorf("invalid verbatim length: %q", line)
+	}
+
+	end := start + length
+	if end+2 > len(data) {
+		return Verbatim{}, 0, ErrIncomplete
+	}
+	if string(data[end:end+2]) != "\r\n" {
+		return Verbatim{}, 0, errors.New("missing final \\r\\n")
+	}
+	if data[start+3] != ':' {
+		return Verbatim{}, 0, errors.New("not a verbatim string")
+	}
+	return Verbatim{Format: string(data[start : start+3]), Value: string(data[start+4 : end])}, end + 2, nil
+}
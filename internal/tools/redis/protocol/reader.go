@@ -0,0 +1,375 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ErrProtocol wraps every malformed-input error returned by Reader.
+// The stream cannot be resynchronised after one, so callers should reply
+// with an error and drop the connection (same as redis-server).
+var ErrProtocol = errors.New("protocol error")
+
+const (
+	readChunkSize  = 16 * 1024
+	MaxInlineSize  = 64 * 1024          // redis PROTO_INLINE_MAX_SIZE
+	MaxQueryBuffer = 1024 * 1024 * 1024 // redis client-query-buffer-limit
+)
+
+// Reader is an incremental RESP decoder on top of an io.Reader.
+//
+// Bytes that don't form a complete value yet stay buffered between reads, so
+// a command split across TCP packets is simply completed by the next read, and
+// several pipelined commands arriving in one packet are handed out one by one.
+//
+// A top-level array is decoded element by element as its bytes arrive, so a
+// big MSET or replication stream isn't parsed again from the start on every
+// read.
+type Reader struct {
+	rd  io.Reader
+	buf []byte // unconsumed bytes live in buf[start:end]
+
+	start int
+	end   int
+
+	array *partialArray // the array being decoded, if its elements are still arriving
+}
+
+// partialArray is a top-level array whose header and first elements have
+// already been consumed from the buffer
+type partialArray struct {
+	count    int
+	elements []RESPValue
+}
+
+func NewReader(rd io.Reader) *Reader {
+	return &Reader{
+		rd:  rd,
+		buf: make([]byte, readChunkSize),
+	}
+}
+
+// Buffered returns the number of bytes already received but not decoded yet.
+// A non-zero value means more pipelined input is waiting.
+func (r *Reader) Buffered() int {
+	return r.end - r.start
+}
+
+// ReadValue blocks until one full RESP value is available and returns it.
+func (r *Reader) ReadValue() (RESPValue, error) {
+	for {
+		if r.Buffered() > 0 || r.array != nil {
+			value, err := r.parse()
+			if err == nil {
+				return value, nil
+			}
+			if !errors.Is(err, ErrIncomplete) {
+				r.array = nil
+				return nil, fmt.Errorf("%w: %v", ErrProtocol, err)
+			}
+		}
+
+		if err := r.fill(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parse decodes what it can of the buffered bytes. Arrays are consumed one
+// element at a time and resumed from r.array, everything else is parsed
+// whole once it has fully arrived.
+func (r *Reader) parse() (RESPValue, error) {
+	if r.array == nil {
+		if r.buf[r.start] != '*' {
+			value, consumed, err := Parse(r.buf[r.start:r.end])
+			if err != nil {
+				return nil, err
+			}
+			r.start += consumed
+			return value, nil
+		}
+
+		count, consumed, err := readArrayHeader(r.buf[r.start:r.end])
+		if err != nil {
+			return nil, err
+		}
+		r.start += consumed
+		if count == -1 {
+			return Array{IsNull: true}, nil
+		}
+		r.array = &partialArray{count: count, elements: make([]RESPValue, 0, min(count, maxPrealloc))}
+	}
+
+	array := r.array
+	for len(array.elements) < array.count {
+		elem, consumed, err := Parse(r.buf[r.start:r.end])
+		if err != nil {
+			return nil, err
+		}
+		r.start += consumed
+		array.elements = append(array.elements, elem)
+	}
+	r.array = nil
+	return Array{Elements: array.elements}, nil
+}
+
+// ReadPayload reads a "$<len>\r\n" header followed by exactly len raw bytes
+// without the trailing CRLF, the way a primary sends its snapshot to a
+// replica. Any bytes after the payload stay buffered for ReadCommand.
+func (r *Reader) ReadPayload() ([]byte, error) {
+	for {
+		pending := r.buf[r.start:r.end]
+		if idx := bytes.IndexByte(pending, '\n'); idx != -1 {
+			header := bytes.TrimSuffix(pending[:idx], []byte("\r"))
+			if len(header) < 2 || header[0] != '$' {
+				return nil, fmt.Errorf("%w: expected a bulk payload, got %q", ErrProtocol, header)
+			}
+			size, err := strconv.Atoi(string(header[1:]))
+			if err != nil || size < 0 {
+				return nil, fmt.Errorf("%w: invalid payload length %q", ErrProtocol, header[1:])
+			}
+			r.start += idx + 1
+			return r.readN(size)
+		}
+		if len(pending) > MaxInlineSize {
+			return nil, fmt.Errorf("%w: payload header too long", ErrProtocol)
+		}
+		if err := r.fill(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readN consumes exactly n bytes, reading past the buffer as needed
+func (r *Reader) readN(n int) ([]byte, error) {
+	payload := make([]byte, 0, min(n, MaxInlineSize)) // don't trust n for the allocation
+	for len(payload) < n {
+		if r.Buffered() == 0 {
+			if err := r.fill(); err != nil {
+				return nil, err
+			}
+		}
+		take := min(n-len(payload), r.Buffered())
+		payload = append(payload, r.buf[r.start:r.start+take]...)
+		r.start += take
+	}
+	return payload, nil
+}
+
+// ReadCommand reads the next client command.
+//
+// Like redis-server, anything that doesn't start with '*' is treated as an
+// inline command ("SET foo bar\r\n"), which is what telnet/nc users send.
+// Inline commands are returned as an Array of BulkStrings so callers never
+// need to tell the two forms apart. Empty inline lines are skipped.
+func (r *Reader) ReadCommand() (RESPValue, error) {
+	for {
+		if r.array != nil {
+			return r.ReadValue() // the rest of a command that started arriving
+		}
+		if r.Buffered() == 0 {
+			if err := r.fill(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if r.buf[r.start] == '*' {
+			return r.ReadValue()
+		}
+
+		args, ok, err := r.readInline()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			if err := r.fill(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if len(args) == 0 {
+			continue // blank line
+		}
+
+		elements := make([]RESPValue, len(args))
+		for i, arg := range args {
+			elements[i] = BulkString{Value: arg}
+		}
+		return Array{Elements: elements}, nil
+	}
+}
+
+// readInline consumes one inline line if it is complete.
+// ok is false when the terminating '\n' hasn't arrived yet.
+func (r *Reader) readInline() (args []string, ok bool, err error) {
+	pending := r.buf[r.start:r.end]
+
+	idx := bytes.IndexByte(pending, '\n')
+	if idx == -1 {
+		if len(pending) > MaxInlineSize {
+			return nil, false, fmt.Errorf("%w: too big inline request", ErrProtocol)
+		}
+		return nil, false, nil
+	}
+
+	line := pending[:idx]
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	r.start += idx + 1
+
+	args, err = SplitArgs(string(line))
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %v", ErrProtocol, err)
+	}
+	return args, true, nil
+}
+
+// fill reads more bytes from the underlying reader, compacting or growing
+// the buffer as needed.
+func (r *Reader) fill() error {
+	// Reclaim the consumed prefix before reading more
+	if r.start > 0 {
+		copy(r.buf, r.buf[r.start:r.end])
+		r.end -= r.start
+		r.start = 0
+	}
+
+	if r.end == len(r.buf) {
+		if len(r.buf) >= MaxQueryBuffer {
+			return fmt.Errorf("%w: query buffer limit exceeded", ErrProtocol)
+		}
+		grown := make([]byte, len(r.buf)*2)
+		copy(grown, r.buf[:r.end])
+		r.buf = grown
+	}
+
+	n, err := r.rd.Read(r.buf[r.end:])
+	r.end += n
+	if n > 0 {
+		return nil // hand back the data, surface err on the next call
+	}
+	if err == nil {
+		return io.ErrNoProgress
+	}
+	return err
+}
+
+// SplitArgs splits an inline command line into arguments.
+// It follows redis' sdssplitargs: whitespace separates arguments, "double
+// quotes" support \n \r \t \b \a \\ \" and \xHH escapes, 'single quotes'
+// only support \'. A closing quote must be followed by whitespace.
+func SplitArgs(line string) ([]string, error) {
+	args := []string{}
+	i := 0
+
+	for {
+		// Skip blanks
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		if i >= len(line) {
+			return args, nil
+		}
+
+		var current []byte
+		inDouble, inSingle := false, false
+		done := false
+
+		for !done {
+			if inDouble {
+				if i >= len(line) {
+					return nil, errors.New("unbalanced quotes in request")
+				}
+				c := line[i]
+				switch {
+				case c == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHex(line[i+2]) && isHex(line[i+3]):
+					current = append(current, hexValue(line[i+2])<<4|hexValue(line[i+3]))
+					i += 3
+				case c == '\\' && i+1 < len(line):
+					i++
+					switch line[i] {
+					case 'n':
+						current = append(current, '\n')
+					case 'r':
+						current = append(current, '\r')
+					case 't':
+						current = append(current, '\t')
+					case 'b':
+						current = append(current, '\b')
+					case 'a':
+						current = append(current, '\a')
+					default:
+						current = append(current, line[i])
+					}
+				case c == '"':
+					// Closing quote must be followed by a space or end of line
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, errors.New("unbalanced quotes in request")
+					}
+					done = true
+				default:
+					current = append(current, c)
+				}
+			} else if inSingle {
+				if i >= len(line) {
+					return nil, errors.New("unbalanced quotes in request")
+				}
+				c := line[i]
+				switch {
+				case c == '\\' && i+1 < len(line) && line[i+1] == '\'':
+					i++
+					current = append(current, '\'')
+				case c == '\'':
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, errors.New("unbalanced quotes in request")
+					}
+					done = true
+				default:
+					current = append(current, c)
+				}
+			} else {
+				if i >= len(line) {
+					break
+				}
+				c := line[i]
+				switch {
+				case isSpace(c):
+					done = true
+				case c == '"':
+					inDouble = true
+				case c == '\'':
+					inSingle = true
+				default:
+					current = append(current, c)
+				}
+			}
+			if i < len(line) {
+				i++
+			}
+		}
+
+		args = append(args, string(current))
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func hexValue(c byte) byte {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
@@ -0,0 +1,225 @@
+package protocol
+
+import (
+	"errors"
+	"io"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chunkReader hands out one chunk per Read call, like TCP packets
+type chunkReader struct {
+	chunks []string
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	if len(c.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, c.chunks[0])
+	c.chunks[0] = c.chunks[0][n:]
+	if c.chunks[0] == "" {
+		c.chunks = c.chunks[1:]
+	}
+	return n, nil
+}
+
+func command(args ...string) Array {
+	elements := make([]RESPValue, len(args))
+	for i, arg := range args {
+		elements[i] = BulkString{Value: arg}
+	}
+	return Array{Elements: elements}
+}
+
+func TestReader_SplitAcrossReads(t *testing.T) {
+	r := NewReader(&chunkReader{chunks: []string{
+		"*3\r\n$3\r\nSET\r\n$3\r",
+		"\nfoo\r\n$5\r\nhel",
+		"lo\r\n",
+	}})
+
+	msg, err := r.ReadCommand()
+	require.NoError(t, err)
+	assert.Equal(t, command("SET", "foo", "hello"), msg)
+
+	_, err = r.ReadCommand()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestReader_OneByteAtATime(t *testing.T) {
+	input := "*2\r\n$4\r\nECHO\r\n$12\r\nhello\r\nworld\r\n"
+	r := NewReader(iotest.OneByteReader(&chunkReader{chunks: []string{input}}))
+
+	msg, err := r.ReadCommand()
+	require.NoError(t, err)
+	assert.Equal(t, command("ECHO", "hello\r\nworld"), msg)
+}
+
+// chunked splits a command with n arguments into reads of size bytes
+func chunked(n, size int) ([]string, []string) {
+	args := make([]string, n)
+	for i := range args {
+		args[i] = strconv.Itoa(i)
+	}
+	wire := string(command(args...).Serialize())
+
+	var chunks []string
+	for len(wire) > size {
+		chunks = append(chunks, wire[:size])
+		wire = wire[size:]
+	}
+	return args, append(chunks, wire)
+}
+
+func TestReader_ArrayAcrossManyReads(t *testing.T) {
+	args, chunks := chunked(100000, 7) // elements split at every possible place
+	chunks = append(chunks, "*1\r\n$4\r\nPING\r\n")
+	r := NewReader(&chunkReader{chunks: chunks})
+
+	msg, err := r.ReadCommand()
+	require.NoError(t, err)
+	assert.Equal(t, command(args...), msg)
+	msg, err = r.ReadCommand()
+	require.NoError(t, err)
+	assert.Equal(t, command("PING"), msg)
+}
+
+func TestReader_HugeArrayHeader(t *testing.T) {
+	// An array that only claims a million elements, then trickles in
+	chunks := []string{"*1048576\r\n"}
+	for i := 0; i < 100; i++ {
+		chunks = append(chunks, "$1\r\na\r\n")
+	}
+	r := NewReader(&chunkReader{chunks: chunks})
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := r.ReadValue()
+	runtime.ReadMemStats(&after)
+
+	assert.Equal(t, io.EOF, err)
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(1<<20), "the claimed length isn't allocated up front")
+}
+
+func BenchmarkReader_LargeCommand(b *testing.B) {
+	_, chunks := chunked(100000, readChunkSize)
+	b.SetBytes(int64(len(strings.Join(chunks, ""))))
+	for i := 0; i < b.N; i++ {
+		r := NewReader(&chunkReader{chunks: append([]string(nil), chunks...)})
+		if _, err := r.ReadCommand(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestReader_Pipelined(t *testing.T) {
+	r := NewReader(&chunkReader{chunks: []string{
+		"*1\r\n$4\r\nPING\r\n*2\r\n$3\r\nGET\r\n$1\r\na\r\n*2\r\n$4\r\nINCR\r\n$1\r\nb\r\n",
+	}})
+
+	want := []Array{command("PING"), command("GET", "a"), command("INCR", "b")}
+	for i, w := range want {
+		msg, err := r.ReadCommand()
+		require.NoError(t, err)
+		assert.Equal(t, w, msg)
+
+		// Everything arrived in one read, so only the last command drains it
+		if i < len(want)-1 {
+			assert.Greater(t, r.Buffered(), 0)
+		} else {
+			assert.Equal(t, 0, r.Buffered())
+		}
+	}
+}
+
+func TestReader_Inline(t *testing.T) {
+	r := NewReader(&chunkReader{chunks: []string{
+		"PING\r\n",
+		"\r\n",
+		"SET key \"hello world\"\n",
+		"SET 'it\\'s' \"\\x41\\n\"\r\n",
+	}})
+
+	msg, err := r.ReadCommand()
+	require.NoError(t, err)
+	assert.Equal(t, command("PING"), msg)
+
+	// Blank line is skipped
+	msg, err = r.ReadCommand()
+	require.NoError(t, err)
+	assert.Equal(t, command("SET", "key", "hello world"), msg)
+
+	msg, err = r.ReadCommand()
+	require.NoError(t, err)
+	assert.Equal(t, command("SET", "it's", "A\n"), msg)
+}
+
+func TestReader_ProtocolErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "unbalanced quotes", input: "SET \"foo bar\r\n"},
+		{name: "bad multibulk length", input: "*abc\r\n"},
+		{name: "bad bulk length", input: "*1\r\n$-5\r\n"},
+		{name: "bulk without terminator", input: "*1\r\n$3\r\nfooXY"},
+		{name: "unknown type byte", input: "*1\r\n!3\r\nfoo\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReader(&chunkReader{chunks: []string{tt.input}})
+			_, err := r.ReadCommand()
+			assert.True(t, errors.Is(err, ErrProtocol), "got %v", err)
+		})
+	}
+}
+
+func TestReader_ReadValue(t *testing.T) {
+	r := NewReader(&chunkReader{chunks: []string{"+OK\r\n:4", "2\r\n$-1\r\n"}})
+
+	v, err := r.ReadValue()
+	require.NoError(t, err)
+	assert.Equal(t, SimpleString{Value: "OK"}, v)
+
+	v, err = r.ReadValue()
+	require.NoError(t, err)
+	assert.Equal(t, Integer{Value: 42}, v)
+
+	v, err = r.ReadValue()
+	require.NoError(t, err)
+	assert.Equal(t, BulkString{IsNull: true}, v)
+}
+
+func TestReader_ReadPayload(t *testing.T) {
+	// A snapshot has no trailing CRLF and the command stream follows it directly
+	r := NewReader(&chunkReader{chunks: []string{
+		"+FULLRESYNC id 0\r\n$11\r\nabc",
+		"\x00\r\n\xffdefg*1\r\n$4\r\nPING\r\n",
+	}})
+
+	msg, err := r.ReadValue()
+	require.NoError(t, err)
+	assert.Equal(t, SimpleString{Value: "FULLRESYNC id 0"}, msg)
+
+	payload, err := r.ReadPayload()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("abc\x00\r\n\xffdefg"), payload)
+
+	msg, err = r.ReadCommand()
+	require.NoError(t, err)
+	assert.Equal(t, command("PING"), msg)
+
+	_, err = NewReader(&chunkReader{chunks: []string{"+OK\r\n"}}).ReadPayload()
+	assert.ErrorIs(t, err, ErrProtocol)
+
+	_, err = NewReader(&chunkReader{chunks: []string{"$10\r\nabc"}}).ReadPayload()
+	assert.Equal(t, io.EOF, err)
+}
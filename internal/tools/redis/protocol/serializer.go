@@ -2,6 +2,8 @@ package protocol
 
 import (
 	"fmt"
+	"math"
+	"strconv"
 )
 
 func (s SimpleString) Serialize() []byte {
@@ -41,3 +43,64 @@ func (a Array) Serialize() []byte {
 
 	return result
 }
+
+func (m Map) Serialize() []byte {
+	result := []byte(fmt.Sprintf("%%%d\r\n", len(m.Entries)))
+	for _, entry := range m.Entries {
+		result = append(result, entry.Key.Serialize()...)
+		result = append(result, entry.Value.Serialize()...)
+	}
+	return result
+}
+
+func (s Set) Serialize() []byte {
+	return serializeAggregate('~', s.Elements)
+}
+
+func (p Push) Serialize() []byte {
+	return serializeAggregate('>', p.Elements)
+}
+
+func serializeAggregate(prefix byte, elements []RESPValue) []byte {
+	result := []byte(fmt.Sprintf("%c%d\r\n", prefix, len(elements)))
+	for _, elem := range elements {
+		result = append(result, elem.Serialize()...)
+	}
+	return result
+}
+
+func (d Double) Serialize() []byte {
+	return []byte("," + FormatDouble(d.Value) + "\r\n")
+}
+
+// FormatDouble renders a float the way redis does: "3", "1.5", "inf", "nan"
+func FormatDouble(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func (b Boolean) Serialize() []byte {
+	if b.Value {
+		return []byte("#t\r\n")
+	}
+	return []byte("#f\r\n")
+}
+
+func (Null) Serialize() []byte {
+	return []byte("_\r\n")
+}
+
+func (n BigNumber) Serialize() []byte {
+	return []byte("(" + n.Value + "\r\n")
+}
+
+func (v Verbatim) Serialize() []byte {
+	return []byte(fmt.Sprintf("=%d\r\n%s:%s\r\n", len(v.Format)+1+len(v.Value), v.Format, v.Value))
+}
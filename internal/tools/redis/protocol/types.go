@@ -32,6 +32,53 @@ type Array struct {
 	Elements []RESPValue
 }
 
+// RESP3 types, sent to clients that switched protocols with HELLO 3.
+// ToVersion turns them back into RESP2 for everyone else.
+
+// Map: "%1\r\n+key\r\n:1\r\n", entries in order
+type Map struct {
+	Entries []MapEntry
+}
+
+type MapEntry struct {
+	Key   RESPValue
+	Value RESPValue
+}
+
+// Set: "~2\r\n+a\r\n+b\r\n"
+type Set struct {
+	Elements []RESPValue
+}
+
+// Double: ",1.5\r\n", also ",inf\r\n", ",-inf\r\n" and ",nan\r\n"
+type Double struct {
+	Value float64
+}
+
+// Boolean: "#t\r\n" or "#f\r\n"
+type Boolean struct {
+	Value bool
+}
+
+// Null: "_\r\n", the one RESP3 null for what were null bulk strings and arrays
+type Null struct{}
+
+// BigNumber: "(3492890328409238509324850943850943825024385\r\n", kept as digits
+type BigNumber struct {
+	Value string
+}
+
+// Verbatim string: "=15\r\ntxt:Some string\r\n", Format is three characters (txt, mkd)
+type Verbatim struct {
+	Format string
+	Value  string
+}
+
+// Push: ">3\r\n$7\r\nmessage\r\n...", out-of-band data like pub/sub messages
+type Push struct {
+	Elements []RESPValue
+}
+
 // Examples of what we need to represent:
 // "+OK\r\n"        → SimpleString{value: "OK"}
 // ":42\r\n"        → Integer{value: 42}
@@ -0,0 +1,86 @@
+package protocol
+
+// Protocol versions a connection can speak, switched with HELLO
+const (
+	RESP2 = 2
+	RESP3 = 3
+)
+
+// ToVersion rewrites a reply for a client speaking the given version.
+// Replies are built with the richest type that fits (a Map for HGETALL, a
+// Double for ZSCORE); RESP2 clients get them flattened the way redis does.
+// RESP3 clients get Null instead of the RESP2 null bulk string and array.
+// Types this package doesn't know are returned unchanged.
+func ToVersion(value RESPValue, version int) RESPValue {
+	if version == RESP3 {
+		return toRESP3(value)
+	}
+	return toRESP2(value)
+}
+
+func toRESP2(value RESPValue) RESPValue {
+	switch v := value.(type) {
+	case Array:
+		return Array{IsNull: v.IsNull, Elements: mapElements(v.Elements, toRESP2)}
+	case Map:
+		elements := make([]RESPValue, 0, len(v.Entries)*2)
+		for _, entry := range v.Entries {
+			elements = append(elements, toRESP2(entry.Key), toRESP2(entry.Value))
+		}
+		return Array{Elements: elements}
+	case Set:
+		return Array{Elements: mapElements(v.Elements, toRESP2)}
+	case Push:
+		return Array{Elements: mapElements(v.Elements, toRESP2)}
+	case Double:
+		return BulkString{Value: FormatDouble(v.Value)}
+	case Boolean:
+		if v.Value {
+			return Integer{Value: 1}
+		}
+		return Integer{Value: 0}
+	case Null:
+		return BulkString{IsNull: true}
+	case BigNumber:
+		return BulkString{Value: v.Value}
+	case Verbatim:
+		return BulkString{Value: v.Value}
+	}
+	return value
+}
+
+func toRESP3(value RESPValue) RESPValue {
+	switch v := value.(type) {
+	case BulkString:
+		if v.IsNull {
+			return Null{}
+		}
+	case Array:
+		if v.IsNull {
+			return Null{}
+		}
+		return Array{Elements: mapElements(v.Elements, toRESP3)}
+	case Map:
+		entries := make([]MapEntry, len(v.Entries))
+		for i, entry := range v.Entries {
+			entries[i] = MapEntry{Key: toRESP3(entry.Key), Value: toRESP3(entry.Value)}
+		}
+		return Map{Entries: entries}
+	case Set:
+		return Set{Elements: mapElements(v.Elements, toRESP3)}
+	case Push:
+		return Push{Elements: mapElements(v.Elements, toRESP3)}
+	}
+	return value
+}
+
+func mapElements(elements []RESPValue, convert func(RESPValue) RESPValue) []RESPValue {
+	if elements == nil {
+		return nil
+	}
+	converted := make([]RESPValue, len(elements))
+	for i, elem := range elements {
+		converted[i] = convert(elem)
+	}
+	return converted
+}
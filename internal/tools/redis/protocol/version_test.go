@@ -0,0 +1,79 @@
+package protocol
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRESP3_SerializeAndParse(t *testing.T) {
+	tests := []struct {
+		value RESPValue
+		wire  string
+	}{
+		{Map{Entries: []MapEntry{{BulkString{Value: "a"}, Integer{Value: 1}}}}, "%1\r\n$1\r\na\r\n:1\r\n"},
+		{Set{Elements: []RESPValue{SimpleString{Value: "x"}}}, "~1\r\n+x\r\n"},
+		{Push{Elements: []RESPValue{BulkString{Value: "message"}}}, ">1\r\n$7\r\nmessage\r\n"},
+		{Double{Value: 1.5}, ",1.5\r\n"},
+		{Double{Value: math.Inf(-1)}, ",-inf\r\n"},
+		{Boolean{Value: true}, "#t\r\n"},
+		{Boolean{Value: false}, "#f\r\n"},
+		{Null{}, "_\r\n"},
+		{BigNumber{Value: "-3492890328409238509324850943850943825024385"}, "(-3492890328409238509324850943850943825024385\r\n"},
+		{Verbatim{Format: "txt", Value: "Some string"}, "=15\r\ntxt:Some string\r\n"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.wire, string(tt.value.Serialize()))
+
+		parsed, consumed, err := Parse([]byte(tt.wire))
+		require.NoError(t, err, tt.wire)
+		assert.Equal(t, tt.value, parsed)
+		assert.Equal(t, len(tt.wire), consumed)
+
+		// Every prefix is incomplete, never an error
+		for i := 1; i < len(tt.wire); i++ {
+			_, _, err := Parse([]byte(tt.wire[:i]))
+			assert.ErrorIs(t, err, ErrIncomplete, "%q", tt.wire[:i])
+		}
+	}
+}
+
+func TestRESP3_ParseErrors(t *testing.T) {
+	for _, wire := range []string{"#x\r\n", "_x\r\n", ",abc\r\n", "(12a\r\n", "=3\r\ntxt\r\n", "%-1\r\n"} {
+		_, _, err := Parse([]byte(wire))
+		assert.Error(t, err, wire)
+		assert.NotErrorIs(t, err, ErrIncomplete, wire)
+	}
+}
+
+func TestToVersion(t *testing.T) {
+	reply := Array{Elements: []RESPValue{
+		Map{Entries: []MapEntry{{BulkString{Value: "f"}, BulkString{Value: "v"}}}},
+		Double{Value: 2},
+		Boolean{Value: true},
+		BulkString{IsNull: true},
+		Array{IsNull: true},
+		Verbatim{Format: "txt", Value: "info"},
+	}}
+
+	assert.Equal(t, Array{Elements: []RESPValue{
+		Array{Elements: []RESPValue{BulkString{Value: "f"}, BulkString{Value: "v"}}},
+		BulkString{Value: "2"},
+		Integer{Value: 1},
+		BulkString{IsNull: true},
+		Array{IsNull: true},
+		BulkString{Value: "info"},
+	}}, ToVersion(reply, RESP2))
+
+	assert.Equal(t, Array{Elements: []RESPValue{
+		Map{Entries: []MapEntry{{BulkString{Value: "f"}, BulkString{Value: "v"}}}},
+		Double{Value: 2},
+		Boolean{Value: true},
+		Null{},
+		Null{},
+		Verbatim{Format: "txt", Value: "info"},
+	}}, ToVersion(reply, RESP3))
+}
@@ -4,9 +4,12 @@ import (
 	"cli-t/internal/command"
 	"cli-t/internal/shared/logger"
 	inmemory "cli-t/internal/shared/store/inmemory"
+	"cli-t/internal/tools/redis/persistence"
 	"cli-t/internal/tools/redis/server"
 
 	"context"
+	"fmt"
+	"net"
 	"os"
 	"os/signal"
 	"syscall"
@@ -24,7 +27,7 @@ func (c *Command) Name() string {
 }
 
 func (c *Command) Usage() string {
-	return "redis [--host HOST] [--port PORT]"
+	return "redis [--host HOST] [--port PORT] [--databases N] [--db-file PATH] [--save-interval SECONDS] [--appendonly] [--appendfsync always|everysec|no] [--maxmemory BYTES] [--maxmemory-policy POLICY] [--replicaof HOST:PORT] [--requirepass PASSWORD] [--notify-keyspace-events FLAGS]"
 }
 
 func (c *Command) Description() string {
@@ -36,7 +39,6 @@ func (c *Command) ValidateArgs(args []string) error {
 }
 
 // can also learn about detached mode?
-// --db-file
 func (c *Command) DefineFlags() []command.Flag {
 	return []command.Flag{
 		{
@@ -53,6 +55,104 @@ func (c *Command) DefineFlags() []command.Flag {
 			Default:   6379,
 			Usage:     "port on which server is running",
 		},
+		{
+			Name:      "databases",
+			Shorthand: "",
+			Type:      "int",
+			Default:   server.DefaultDatabases,
+			Usage:     "number of databases, SELECT picks one of 0 to N-1",
+		},
+		{
+			Name:      "db-file",
+			Shorthand: "",
+			Type:      "string",
+			Default:   "dump.rdb",
+			Usage:     "snapshot file loaded on startup and written by SAVE/BGSAVE (empty disables persistence)",
+		},
+		{
+			Name:      "save-interval",
+			Shorthand: "",
+			Type:      "int",
+			Default:   0,
+			Usage:     "seconds between automatic background saves when keys changed (0 disables)",
+		},
+		{
+			Name:      "appendonly",
+			Shorthand: "",
+			Type:      "bool",
+			Default:   false,
+			Usage:     "log every write to an append-only file and replay it on startup",
+		},
+		{
+			Name:      "appendfilename",
+			Shorthand: "",
+			Type:      "string",
+			Default:   "appendonly.aof",
+			Usage:     "append-only file path",
+		},
+		{
+			Name:      "appendfsync",
+			Shorthand: "",
+			Type:      "string",
+			Default:   "everysec",
+			Usage:     "when to fsync the append-only file: always, everysec or no",
+		},
+		{
+			Name:      "maxmemory",
+			Shorthand: "",
+			Type:      "string",
+			Default:   "0",
+			Usage:     "memory limit for the dataset, e.g. 100mb or 1gb (0 disables it)",
+		},
+		{
+			Name:      "maxmemory-policy",
+			Shorthand: "",
+			Type:      "string",
+			Default:   "noeviction",
+			Usage:     "what to evict over the limit: noeviction, allkeys-lru, volatile-lru, allkeys-lfu, volatile-lfu, allkeys-random, volatile-random or volatile-ttl",
+		},
+		{
+			Name:      "maxmemory-samples",
+			Shorthand: "",
+			Type:      "int",
+			Default:   inmemory.DefaultEvictionSamples,
+			Usage:     "keys sampled per eviction, more is more accurate but slower",
+		},
+		{
+			Name:      "replicaof",
+			Shorthand: "",
+			Type:      "string",
+			Default:   "",
+			Usage:     "start as a replica of the primary at HOST:PORT",
+		},
+		{
+			Name:      "replica-read-only",
+			Shorthand: "",
+			Type:      "bool",
+			Default:   true,
+			Usage:     "refuse client writes while following a primary",
+		},
+		{
+			Name:      "masterauth",
+			Shorthand: "",
+			Type:      "string",
+			Default:   "",
+			Usage:     "password to AUTH with on the primary",
+		},
+		{
+			Name:      "requirepass",
+			Shorthand: "",
+			Type:      "string",
+			Default:   "",
+			Usage:     "password clients must AUTH with before running commands",
+		},
+		{
+			Name:      "notify-keyspace-events",
+			Shorthand: "",
+			Type:      "string",
+			Default:   "",
+			Usage:     "keyspace notifications to publish, e.g. KEA for all or Ex for expired keys (empty disables them)",
+		},
 	}
 }
 
@@ -60,10 +160,13 @@ func (c *Command) DefineFlags() []command.Flag {
 Redis Serialization Protocol (RESP)
 */
 func (c *Command) Execute(ctx context.Context, args *command.Args) error {
-	host, port := c.parseFlags(args.Flags)
+	cfg, err := c.parseFlags(args.Flags)
+	if err != nil {
+		return err
+	}
 
 	store := inmemory.New()
-	server := server.New(host, port, store)
+	server := server.New(cfg, store)
 
 	// Start server in goroutine
 	go func() {
@@ -93,8 +196,74 @@ func (c *Command) Execute(ctx context.Context, args *command.Args) error {
 	return nil
 }
 
-func (c *Command) parseFlags(flags map[string]interface{}) (string, int) {
+func (c *Command) parseFlags(flags map[string]interface{}) (server.Config, error) {
 	host, _ := flags["host"].(string)
 	port, _ := flags["port"].(int)
-	return host, port
+	databases, _ := flags["databases"].(int)
+	dumpPath, _ := flags["db-file"].(string)
+	saveInterval, _ := flags["save-interval"].(int)
+	appendOnly, _ := flags["appendonly"].(bool)
+	appendFilename, _ := flags["appendfilename"].(string)
+	appendFsync, _ := flags["appendfsync"].(string)
+	maxMemory, _ := flags["maxmemory"].(string)
+	maxMemoryPolicy, _ := flags["maxmemory-policy"].(string)
+	maxMemorySamples, _ := flags["maxmemory-samples"].(int)
+	replicaOf, _ := flags["replicaof"].(string)
+	replicaReadOnly, _ := flags["replica-read-only"].(bool)
+	masterAuth, _ := flags["masterauth"].(string)
+	requirePass, _ := flags["requirepass"].(string)
+	notifyEvents, _ := flags["notify-keyspace-events"].(string)
+
+	fsync, err := persistence.ParseFsyncPolicy(appendFsync)
+	if err != nil {
+		return server.Config{}, err
+	}
+
+	limit, err := server.ParseMemory(maxMemory)
+	if err != nil {
+		return server.Config{}, err
+	}
+
+	policy, err := inmemory.ParseEvictionPolicy(maxMemoryPolicy)
+	if err != nil {
+		return server.Config{}, err
+	}
+
+	events, err := server.ParseKeyspaceEvents(notifyEvents)
+	if err != nil {
+		return server.Config{}, fmt.Errorf("invalid --notify-keyspace-events %q: %w", notifyEvents, err)
+	}
+
+	if databases <= 0 {
+		return server.Config{}, fmt.Errorf("invalid --databases %d: must be at least 1", databases)
+	}
+
+	if replicaOf != "" {
+		if _, _, err := net.SplitHostPort(replicaOf); err != nil {
+			return server.Config{}, fmt.Errorf("invalid --replicaof %q: %w", replicaOf, err)
+		}
+	}
+
+	return server.Config{
+		Host:           host,
+		Port:           port,
+		Databases:      databases,
+		DumpPath:       dumpPath,
+		SaveInterval:   time.Duration(saveInterval) * time.Second,
+		AppendOnly:     appendOnly,
+		AppendFilename: appendFilename,
+		AppendFsync:    fsync,
+
+		MaxMemory:        limit,
+		MaxMemoryPolicy:  policy,
+		MaxMemorySamples: maxMemorySamples,
+
+		ReplicaOf:       replicaOf,
+		ReplicaReadOnly: replicaReadOnly,
+		MasterAuth:      masterAuth,
+
+		RequirePass: requirePass,
+
+		NotifyKeyspaceEvents: events,
+	}, nil
 }
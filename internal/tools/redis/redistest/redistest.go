@@ -0,0 +1,34 @@
+// Package redistest starts redis servers for the tests of the packages that
+// talk to one, like net/http/httptest does for HTTP.
+package redistest
+
+import (
+	inmemory "cli-t/internal/shared/store/inmemory"
+	"cli-t/internal/tools/redis/server"
+
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Start runs a server with cfg on a free loopback port and returns its
+// address. The listener is opened here and handed over to the server, so
+// the port can't be taken in between and can be dialed right away.
+func Start(t testing.TB, cfg server.Config) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	cfg.Host, cfg.Port = "127.0.0.1", listener.Addr().(*net.TCPAddr).Port
+	s := server.New(cfg, inmemory.New())
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.Serve(ctx, listener)
+	t.Cleanup(func() {
+		cancel()
+		s.Stop(context.Background())
+	})
+	return listener.Addr().String()
+}
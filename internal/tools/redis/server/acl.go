@@ -0,0 +1,562 @@
+package server
+
+import (
+	"cli-t/internal/shared/glob"
+	"cli-t/internal/tools/redis/protocol"
+
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const defaultUser = "default"
+
+var (
+	errNoAuth    = errors.New("NOAUTH Authentication required.")
+	errWrongPass = errors.New("WRONGPASS invalid username-password pair or user is disabled.")
+)
+
+// allowedUnauthenticated skip the NOAUTH and ACL checks, so a client can log
+// in. HELLO checks the login itself, it may carry AUTH.
+var allowedUnauthenticated = map[string]bool{
+	"AUTH":  true,
+	"HELLO": true,
+	"QUIT":  true,
+}
+
+// commandCategories puts every command in its ACL categories (+@list,
+// -@dangerous, ...). @read, @write and @blocking come from the command flags.
+var commandCategories = map[string][]string{
+	"connection":  {"ping", "echo", "quit", "auth", "hello", "client", "command", "select"},
+	"string":      {"set", "get", "mset", "mget", "incr", "decr"},
+	"keyspace":    {"ttl", "expire", "pexpireat", "exists", "del", "unlink", "keys", "scan", "type", "rename", "renamenx", "copy", "persist", "pexpire", "expireat", "pttl", "randomkey", "dbsize", "flushdb", "flushall", "move", "swapdb"},
+	"list":        {"lpush", "rpush", "lrange", "lpop", "rpop", "llen", "lindex", "lset", "lrem", "ltrim", "linsert", "lmove", "blpop", "brpop", "blmove"},
+	"hash":        {"hset", "hmset", "hsetnx", "hget", "hmget", "hgetall", "hdel", "hincrby", "hkeys", "hvals", "hlen", "hexists"},
+	"set":         {"sadd", "srem", "smembers", "sismember", "scard", "sinter", "sunion", "sdiff"},
+	"sortedset":   {"zadd", "zincrby", "zrange", "zrevrange", "zrangebyscore", "zrevrangebyscore", "zrank", "zrevrank", "zscore", "zrem", "zcard"},
+	"stream":      {"xadd", "xlen", "xrange", "xrevrange", "xdel", "xtrim", "xsetid", "xread", "xgroup", "xreadgroup", "xack", "xpending", "xclaim"},
+	"pubsub":      {"subscribe", "psubscribe", "unsubscribe", "punsubscribe", "publish", "pubsub"},
+	"transaction": {"multi", "exec", "discard", "watch", "unwatch"},
+	"admin":       {"save", "bgsave", "lastsave", "bgrewriteaof", "replicaof", "slaveof", "sync", "psync", "replconf", "role", "config", "acl", "monitor"},
+	"dangerous":   {"keys", "flushdb", "flushall", "swapdb", "save", "bgsave", "bgrewriteaof", "replicaof", "slaveof", "sync", "psync", "replconf", "role", "config", "acl", "info", "client", "monitor"},
+}
+
+// categories returns every ACL category of a command, without the leading @
+func (spec *commandSpec) categories() []string {
+	var cats []string
+	for cat, names := range commandCategories {
+		for _, name := range names {
+			if name == spec.name {
+				cats = append(cats, cat)
+				break
+			}
+		}
+	}
+	switch {
+	case spec.write:
+		cats = append(cats, "write")
+	case spec.hasKeys():
+		cats = append(cats, "read")
+	}
+	if spec.blocking {
+		cats = append(cats, "blocking")
+	}
+	sort.Strings(cats)
+	return cats
+}
+
+// aclCategories lists every category ACL rules accept
+func aclCategories() []string {
+	cats := []string{"read", "write", "blocking"}
+	for cat := range commandCategories {
+		cats = append(cats, cat)
+	}
+	sort.Strings(cats)
+	return cats
+}
+
+// aclUser is one ACL user, modified with ACL SETUSER rules
+type aclUser struct {
+	name      string
+	enabled   bool
+	nopass    bool
+	passwords map[string]struct{} // sha256 hex digests, never the passwords
+
+	commands     map[string]bool // allowed command names
+	commandRules []string        // +/- rules since the last allcommands/nocommands, for display
+	allowAll     bool            // the base rule was +@all rather than -@all
+
+	keyPatterns []string // ~patterns, "*" for allkeys
+}
+
+func newACLUser(name string) *aclUser {
+	return &aclUser{
+		name:      name,
+		passwords: make(map[string]struct{}),
+		commands:  make(map[string]bool),
+	}
+}
+
+func hashPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+var errPasswordHash = errors.New("The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters")
+
+// validPasswordHash reports whether hash can be a hashPassword digest:
+// anything else could never match a password
+func validPasswordHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	for i := 0; i < len(hash); i++ {
+		if !('0' <= hash[i] && hash[i] <= '9' || 'a' <= hash[i] && hash[i] <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// clone copies a user, so a failing SETUSER leaves the original untouched
+func (u *aclUser) clone() *aclUser {
+	clone := *u
+	clone.passwords = make(map[string]struct{}, len(u.passwords))
+	for hash := range u.passwords {
+		clone.passwords[hash] = struct{}{}
+	}
+	clone.commands = make(map[string]bool, len(u.commands))
+	for name := range u.commands {
+		clone.commands[name] = true
+	}
+	clone.commandRules = append([]string(nil), u.commandRules...)
+	clone.keyPatterns = append([]string(nil), u.keyPatterns...)
+	return &clone
+}
+
+// applyRule applies one ACL SETUSER rule
+func (u *aclUser) applyRule(rule string) error {
+	lower := strings.ToLower(rule)
+	switch lower {
+	case "on":
+		u.enabled = true
+	case "off":
+		u.enabled = false
+	case "nopass":
+		u.nopass = true
+		u.passwords = make(map[string]struct{})
+	case "resetpass":
+		u.nopass = false
+		u.passwords = make(map[string]struct{})
+	case "allkeys":
+		u.keyPatterns = []string{"*"}
+	case "resetkeys":
+		u.keyPatterns = nil
+	case "allcommands":
+		u.setAllCommands(true)
+	case "nocommands":
+		u.setAllCommands(false)
+	case "reset":
+		*u = *newACLUser(u.name)
+	default:
+		switch rule[0] {
+		case '>':
+			u.passwords[hashPassword(rule[1:])] = struct{}{}
+			u.nopass = false
+		case '<':
+			delete(u.passwords, hashPassword(rule[1:]))
+		case '#':
+			if !validPasswordHash(rule[1:]) {
+				return errPasswordHash
+			}
+			u.passwords[rule[1:]] = struct{}{}
+			u.nopass = false
+		case '!':
+			if !validPasswordHash(rule[1:]) {
+				return errPasswordHash
+			}
+			delete(u.passwords, rule[1:])
+		case '~':
+			u.keyPatterns = append(u.keyPatterns, rule[1:])
+		case '+', '-':
+			return u.applyCommandRule(lower)
+		default:
+			return fmt.Errorf("Syntax error")
+		}
+	}
+	return nil
+}
+
+func (u *aclUser) setAllCommands(allow bool) {
+	u.allowAll = allow
+	u.commandRules = nil
+	u.commands = make(map[string]bool)
+	if allow {
+		for _, spec := range commandTable {
+			u.commands[spec.name] = true
+		}
+	}
+}
+
+// applyCommandRule handles +cmd, -cmd, +@category and -@category
+func (u *aclUser) applyCommandRule(rule string) error {
+	allow := rule[0] == '+'
+	target := rule[1:]
+
+	if target == "@all" {
+		u.setAllCommands(allow)
+		return nil
+	}
+
+	var names []string
+	if cat, isCategory := strings.CutPrefix(target, "@"); isCategory {
+		known := false
+		for _, spec := range commandTable {
+			for _, c := range spec.categories() {
+				if c == cat {
+					names = append(names, spec.name)
+					known = true
+				}
+			}
+		}
+		if !known && !containsString(aclCategories(), cat) {
+			return fmt.Errorf("Unknown command or category name in ACL")
+		}
+	} else {
+		if _, found := commandTable[strings.ToUpper(target)]; !found {
+			return fmt.Errorf("Unknown command or category name in ACL")
+		}
+		names = []string{target}
+	}
+
+	for _, name := range names {
+		if allow {
+			u.commands[name] = true
+		} else {
+			delete(u.commands, name)
+		}
+	}
+	u.commandRules = append(u.commandRules, rule)
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *aclUser) checkPassword(password string) bool {
+	if u.nopass {
+		return true
+	}
+	_, ok := u.passwords[hashPassword(password)]
+	return ok
+}
+
+// canAccess reports whether every key matches one of the user's patterns
+func (u *aclUser) canAccess(keys []string) bool {
+	for _, key := range keys {
+		allowed := false
+		for _, pattern := range u.keyPatterns {
+			if glob.Match(pattern, key) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// flags are the GETUSER flags
+func (u *aclUser) flags() []string {
+	flags := []string{"off"}
+	if u.enabled {
+		flags[0] = "on"
+	}
+	if u.nopass {
+		flags = append(flags, "nopass")
+	}
+	return flags
+}
+
+func (u *aclUser) commandsDescription() string {
+	parts := []string{"-@all"}
+	if u.allowAll {
+		parts[0] = "+@all"
+	}
+	return strings.Join(append(parts, u.commandRules...), " ")
+}
+
+func (u *aclUser) keysDescription() string {
+	parts := make([]string, len(u.keyPatterns))
+	for i, pattern := range u.keyPatterns {
+		parts[i] = "~" + pattern
+	}
+	return strings.Join(parts, " ")
+}
+
+func (u *aclUser) passwordHashes() []string {
+	hashes := make([]string, 0, len(u.passwords))
+	for hash := range u.passwords {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	return hashes
+}
+
+// describe is the ACL LIST line of the user
+func (u *aclUser) describe() string {
+	parts := append([]string{"user", u.name}, u.flags()...)
+	for _, hash := range u.passwordHashes() {
+		parts = append(parts, "#"+hash)
+	}
+	if keys := u.keysDescription(); keys != "" {
+		parts = append(parts, keys)
+	} else {
+		parts = append(parts, "resetkeys")
+	}
+	return strings.Join(append(parts, u.commandsDescription()), " ")
+}
+
+// aclRegistry holds the users. The default user starts with every
+// permission and no password, like a fresh redis.
+type aclRegistry struct {
+	mu    sync.RWMutex
+	users map[string]*aclUser
+}
+
+func newACLRegistry(requirePass string) *aclRegistry {
+	def := newACLUser(defaultUser)
+	def.enabled = true
+	def.keyPatterns = []string{"*"}
+	def.setAllCommands(true)
+	def.nopass = true
+
+	acl := &aclRegistry{users: map[string]*aclUser{defaultUser: def}}
+	acl.setDefaultPassword(requirePass)
+	return acl
+}
+
+// setDefaultPassword is requirepass: "" lets everyone in as default
+func (a *aclRegistry) setDefaultPassword(password string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	def := a.users[defaultUser]
+	def.passwords = make(map[string]struct{})
+	def.nopass = password == ""
+	if password != "" {
+		def.passwords[hashPassword(password)] = struct{}{}
+	}
+}
+
+// authenticate checks a username/password pair
+func (a *aclRegistry) authenticate(name, password string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	user, found := a.users[name]
+	return found && user.enabled && user.checkPassword(password)
+}
+
+// defaultNoPass reports whether new connections are logged in right away
+func (a *aclRegistry) defaultNoPass() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	def := a.users[defaultUser]
+	return def.enabled && def.nopass
+}
+
+// check returns the NOPERM error for user running spec on args, or nil
+func (a *aclRegistry) check(name string, spec *commandSpec, args []protocol.RESPValue) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	user, found := a.users[name]
+	if !found || !user.commands[spec.name] {
+		return fmt.Errorf("NOPERM User %s has no permissions to run the '%s' command", name, spec.name)
+	}
+	if !user.canAccess(commandKeys(spec, args)) {
+		return errors.New("NOPERM No permissions to access a key")
+	}
+	return nil
+}
+
+// commandKeys extracts the key arguments using the command's key positions
+func commandKeys(spec *commandSpec, args []protocol.RESPValue) []string {
+	if spec.keys != nil {
+		return spec.keys(args)
+	}
+	if spec.firstKey <= 0 {
+		return nil
+	}
+	last := spec.lastKey
+	if last < 0 {
+		last += len(args)
+	}
+
+	var keys []string
+	for i := spec.firstKey; i <= last && i < len(args); i += spec.keyStep {
+		if bulk, ok := args[i].(protocol.BulkString); ok {
+			keys = append(keys, bulk.Value)
+		}
+	}
+	return keys
+}
+
+// AUTH [username] password
+func (s *Server) handleAuth(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	strs, ok := bulkStrings(args)
+	if !ok || len(strs) > 3 {
+		return protocol.Error{Message: "ERR syntax error"}
+	}
+
+	name, password := defaultUser, strs[1]
+	if len(strs) == 3 {
+		name, password = strs[1], strs[2]
+	} else if s.acl.defaultNoPass() {
+		return protocol.Error{Message: "ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?"}
+	}
+
+	if !s.acl.authenticate(name, password) {
+		return errorReply(errWrongPass)
+	}
+	c.login(name)
+	return protocol.SimpleString{Value: "OK"}
+}
+
+// ACL SETUSER | GETUSER | DELUSER | LIST | USERS | WHOAMI | CAT
+func (s *Server) handleACL(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR syntax error"}
+	}
+
+	switch sub := strings.ToUpper(strs[1]); sub {
+	case "WHOAMI":
+		return protocol.BulkString{Value: c.userName()}
+	case "SETUSER":
+		if len(strs) < 3 {
+			return wrongArgs("acl|setuser")
+		}
+		return s.aclSetUser(strs[2], strs[3:])
+	case "GETUSER":
+		if len(strs) != 3 {
+			return wrongArgs("acl|getuser")
+		}
+		return s.aclGetUser(strs[2])
+	case "DELUSER":
+		if len(strs) < 3 {
+			return wrongArgs("acl|deluser")
+		}
+		return s.aclDelUser(strs[2:])
+	case "LIST", "USERS":
+		s.acl.mu.RLock()
+		names := make([]string, 0, len(s.acl.users))
+		for name := range s.acl.users {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		lines := names
+		if sub == "LIST" {
+			lines = make([]string, len(names))
+			for i, name := range names {
+				lines[i] = s.acl.users[name].describe()
+			}
+		}
+		s.acl.mu.RUnlock()
+		return stringArray(lines)
+	case "CAT":
+		if len(strs) == 2 {
+			return stringArray(aclCategories())
+		}
+		cat := strings.ToLower(strs[2])
+		if !containsString(aclCategories(), cat) {
+			return protocol.Error{Message: "ERR Unknown category '" + strs[2] + "'"}
+		}
+		var names []string
+		for _, spec := range commandTable {
+			if containsString(spec.categories(), cat) {
+				names = append(names, spec.name)
+			}
+		}
+		sort.Strings(names)
+		return stringArray(names)
+	default:
+		return protocol.Error{Message: "ERR unknown subcommand '" + strs[1] + "'. Try ACL HELP."}
+	}
+}
+
+// aclSetUser creates or modifies a user. Rules apply to a copy, so one bad
+// rule leaves the user as it was.
+func (s *Server) aclSetUser(name string, rules []string) protocol.RESPValue {
+	s.acl.mu.Lock()
+	defer s.acl.mu.Unlock()
+
+	user := newACLUser(name)
+	if existing, found := s.acl.users[name]; found {
+		user = existing.clone()
+	}
+	for _, rule := range rules {
+		if rule == "" {
+			continue
+		}
+		if err := user.applyRule(rule); err != nil {
+			return protocol.Error{Message: fmt.Sprintf("ERR Error in ACL SETUSER modifier '%s': %s", rule, err)}
+		}
+	}
+	s.acl.users[name] = user
+	return protocol.SimpleString{Value: "OK"}
+}
+
+func (s *Server) aclGetUser(name string) protocol.RESPValue {
+	s.acl.mu.RLock()
+	defer s.acl.mu.RUnlock()
+
+	user, found := s.acl.users[name]
+	if !found {
+		return protocol.Array{IsNull: true}
+	}
+	return protocol.Map{Entries: []protocol.MapEntry{
+		{Key: protocol.BulkString{Value: "flags"}, Value: stringSet(user.flags())},
+		{Key: protocol.BulkString{Value: "passwords"}, Value: stringArray(user.passwordHashes())},
+		{Key: protocol.BulkString{Value: "commands"}, Value: protocol.BulkString{Value: user.commandsDescription()}},
+		{Key: protocol.BulkString{Value: "keys"}, Value: protocol.BulkString{Value: user.keysDescription()}},
+	}}
+}
+
+// aclDelUser removes users and disconnects the clients logged in as them
+func (s *Server) aclDelUser(names []string) protocol.RESPValue {
+	s.acl.mu.Lock()
+	deleted := make(map[string]bool)
+	for _, name := range names {
+		if name == defaultUser {
+			s.acl.mu.Unlock()
+			return protocol.Error{Message: "ERR The 'default' user cannot be removed"}
+		}
+		if _, found := s.acl.users[name]; found {
+			delete(s.acl.users, name)
+			deleted[name] = true
+		}
+	}
+	s.acl.mu.Unlock()
+
+	for _, other := range s.sortedClients() {
+		if deleted[other.userName()] {
+			other.conn.Close()
+		}
+	}
+	return protocol.Integer{Value: int64(len(deleted))}
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"cli-t/internal/tools/redis/protocol"
+
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var okReply = protocol.SimpleString{Value: "OK"}
+
+func TestRequirePass(t *testing.T) {
+	s, conn, r := connect(t)
+	assert.Equal(t, "ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?",
+		do(t, conn, r, "AUTH", "secret").(protocol.Error).Message)
+
+	// Connections already logged in stay logged in
+	assert.Equal(t, okReply, do(t, conn, r, "CONFIG", "SET", "requirepass", "secret"))
+	assert.Equal(t, okReply, do(t, conn, r, "SET", "k", "v"))
+
+	other, otherR := attach(t, s)
+	assert.Equal(t, errorReply(errNoAuth), do(t, other, otherR, "GET", "k"))
+	assert.Equal(t, errorReply(errWrongPass), do(t, other, otherR, "AUTH", "wrong"))
+	assert.Equal(t, errorReply(errNoAuth), do(t, other, otherR, "PING"))
+	assert.Equal(t, okReply, do(t, other, otherR, "AUTH", "secret"))
+	assert.Equal(t, protocol.BulkString{Value: "v"}, do(t, other, otherR, "GET", "k"))
+	assert.Equal(t, protocol.BulkString{Value: "default"}, do(t, other, otherR, "ACL", "WHOAMI"))
+
+	// MULTI can't be used to sneak commands in
+	third, thirdR := attach(t, s)
+	send(t, third, string(stringArray([]string{"MULTI"}).Serialize()))
+	assert.Equal(t, errorReply(errNoAuth), readReply(t, thirdR))
+}
+
+func TestACLUsers(t *testing.T) {
+	s, conn, r := connect(t)
+
+	assert.Equal(t, okReply, do(t, conn, r, "ACL", "SETUSER", "reader", "on", ">pw", "~cache:*", "+@read", "+@connection", "-client"))
+	assert.Equal(t, okReply, do(t, conn, r, "SET", "cache:a", "1"))
+	assert.Equal(t, okReply, do(t, conn, r, "SET", "secret", "2"))
+
+	other, otherR := attach(t, s)
+	assert.Equal(t, errorReply(errWrongPass), do(t, other, otherR, "AUTH", "reader", "nope"))
+	assert.Equal(t, okReply, do(t, other, otherR, "AUTH", "reader", "pw"))
+	clients := do(t, conn, r, "CLIENT", "LIST").(protocol.BulkString)
+	assert.Contains(t, clients.Value, "cmd=auth user=reader resp=2\n")
+	assert.Equal(t, protocol.BulkString{Value: "1"}, do(t, other, otherR, "GET", "cache:a"))
+	assert.Equal(t, "NOPERM No permissions to access a key", do(t, other, otherR, "GET", "secret").(protocol.Error).Message)
+	assert.Equal(t, "NOPERM User reader has no permissions to run the 'set' command",
+		do(t, other, otherR, "SET", "cache:a", "3").(protocol.Error).Message)
+	assert.Equal(t, "NOPERM User reader has no permissions to run the 'client' command",
+		do(t, other, otherR, "CLIENT", "ID").(protocol.Error).Message)
+	// Every key of a multi-key command is checked
+	assert.IsType(t, protocol.Error{}, do(t, other, otherR, "EXISTS", "cache:a", "secret"))
+
+	// Changes apply to connections already logged in as the user
+	assert.Equal(t, okReply, do(t, conn, r, "ACL", "SETUSER", "reader", "allkeys"))
+	assert.Equal(t, protocol.BulkString{Value: "2"}, do(t, other, otherR, "GET", "secret"))
+
+	getUser := do(t, conn, r, "ACL", "GETUSER", "reader").(protocol.Array)
+	require.Len(t, getUser.Elements, 8)
+	assert.Equal(t, stringArray([]string{"on"}), getUser.Elements[1])
+	assert.Equal(t, stringArray([]string{hashPassword("pw")}), getUser.Elements[3])
+	assert.Equal(t, protocol.BulkString{Value: "-@all +@read +@connection -client"}, getUser.Elements[5])
+	assert.Equal(t, protocol.BulkString{Value: "~*"}, getUser.Elements[7])
+	assert.Equal(t, protocol.Array{IsNull: true}, do(t, conn, r, "ACL", "GETUSER", "nobody"))
+
+	list := do(t, conn, r, "ACL", "LIST").(protocol.Array)
+	require.Len(t, list.Elements, 2)
+	assert.Equal(t, protocol.BulkString{Value: "user default on nopass ~* +@all"}, list.Elements[0])
+	assert.True(t, strings.HasPrefix(list.Elements[1].(protocol.BulkString).Value, "user reader on #"))
+
+	// A bad rule changes nothing
+	assert.IsType(t, protocol.Error{}, do(t, conn, r, "ACL", "SETUSER", "reader", "off", "+nosuchcommand"))
+	assert.Equal(t, protocol.BulkString{Value: "1"}, do(t, other, otherR, "GET", "cache:a"))
+
+	// Deleting a user disconnects its clients
+	assert.Equal(t, protocol.Integer{Value: 1}, do(t, conn, r, "ACL", "DELUSER", "reader"))
+	_, err := otherR.ReadValue()
+	assert.Error(t, err)
+	assert.Equal(t, "ERR The 'default' user cannot be removed", do(t, conn, r, "ACL", "DELUSER", "default").(protocol.Error).Message)
+}
+
+func TestACLDisabledUser(t *testing.T) {
+	_, conn, r := connect(t)
+
+	assert.Equal(t, okReply, do(t, conn, r, "ACL", "SETUSER", "ghost", ">pw", "+@all"))
+	assert.Equal(t, errorReply(errWrongPass), do(t, conn, r, "AUTH", "ghost", "pw")) // users start off
+	assert.Equal(t, okReply, do(t, conn, r, "ACL", "SETUSER", "ghost", "on"))
+	assert.Equal(t, okReply, do(t, conn, r, "AUTH", "ghost", "pw"))
+	// No key patterns yet
+	assert.Equal(t, "NOPERM No permissions to access a key", do(t, conn, r, "GET", "k").(protocol.Error).Message)
+	assert.Equal(t, protocol.SimpleString{Value: "PONG"}, do(t, conn, r, "PING"))
+}
+
+func TestACLPasswordHashes(t *testing.T) {
+	_, conn, r := connect(t)
+	hash := hashPassword("pw")
+
+	// Only what hashPassword can produce: anything else would never match
+	for _, bad := range []string{strings.ToUpper(hash), hash[:63] + "g", hash[:62]} {
+		for _, rule := range []string{"#" + bad, "!" + bad} {
+			reply := do(t, conn, r, "ACL", "SETUSER", "hashed", rule)
+			require.IsType(t, protocol.Error{}, reply, rule)
+			assert.Contains(t, reply.(protocol.Error).Message, "lowercase hexadecimal", rule)
+		}
+	}
+
+	assert.Equal(t, okReply, do(t, conn, r, "ACL", "SETUSER", "hashed", "on", "#"+hash, "+@all"))
+	assert.Equal(t, okReply, do(t, conn, r, "AUTH", "hashed", "pw"))
+	assert.Equal(t, okReply, do(t, conn, r, "ACL", "SETUSER", "hashed", "!"+hash))
+	assert.Equal(t, errorReply(errWrongPass), do(t, conn, r, "AUTH", "hashed", "pw"))
+}
+
+func TestCommandCategories(t *testing.T) {
+	for _, spec := range commandTable {
+		hasOwn := false
+		for _, cat := range spec.categories() {
+			if cat != "read" && cat != "write" && cat != "blocking" {
+				hasOwn = true
+			}
+		}
+		assert.True(t, hasOwn, "%s has no ACL category", spec.name)
+	}
+}
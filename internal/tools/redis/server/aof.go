@@ -0,0 +1,245 @@
+package server
+
+import (
+	"cli-t/internal/shared/logger"
+	"cli-t/internal/tools/redis/persistence"
+	"cli-t/internal/tools/redis/protocol"
+
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dbCommand is a write and the database it ran in
+type dbCommand struct {
+	db   int
+	args []string
+}
+
+// propagate records successful writes in the AOF and streams them to
+// replicas. Several commands (an EXEC) are wrapped in MULTI/EXEC so replay
+// applies all of them or none.
+func (s *Server) propagate(commands ...dbCommand) {
+	if len(commands) == 0 {
+		return
+	}
+
+	// Writes to other keys run concurrently: the AOF and the replicas must
+	// still see them in the same order
+	s.propMu.Lock()
+	defer s.propMu.Unlock()
+
+	s.appendToAOF(commands)
+	// A replica passes on its primary's stream instead, see applyReplicated
+	if !s.repl.following() {
+		s.repl.feedWrites(commands)
+	}
+}
+
+// withSelect turns writes into the commands that replay them: SELECTs
+// where the database changes, and MULTI/EXEC around several writes.
+// *selected is the database the reader is in, -1 when unknown, and is
+// updated. A batch outside DB 0 always starts with its SELECT, so a reader
+// joining at DB 0 (a new replica, the tail of a rewritten AOF) doesn't
+// depend on what it missed.
+func withSelect(commands []dbCommand, selected *int) [][]string {
+	var prefix, body [][]string
+	if first := commands[0].db; first != 0 || *selected != 0 {
+		prefix = [][]string{{"SELECT", strconv.Itoa(first)}}
+	}
+	db := commands[0].db
+	for _, cmd := range commands {
+		if cmd.db != db {
+			body = append(body, []string{"SELECT", strconv.Itoa(cmd.db)})
+			db = cmd.db
+		}
+		body = append(body, cmd.args)
+	}
+	*selected = db
+	return append(prefix, wrapMulti(body)...)
+}
+
+// wrapMulti turns several commands into one MULTI/EXEC block
+func wrapMulti(commands [][]string) [][]string {
+	if len(commands) <= 1 {
+		return commands
+	}
+	return append(append([][]string{{"MULTI"}}, commands...), []string{"EXEC"})
+}
+
+func (s *Server) appendToAOF(commands []dbCommand) {
+	if s.aof == nil || len(commands) == 0 {
+		return
+	}
+	if err := s.aof.AppendBatch(withSelect(commands, &s.aofDB)); err != nil {
+		logger.Error("Failed to write to the AOF", "error", err)
+	}
+}
+
+// alsoPropagate logs a write, or holds it back until the end of the EXEC
+// it runs in
+func (s *Server) alsoPropagate(c *client, args []string) {
+	cmd := dbCommand{c.db, args}
+	if c.execing {
+		c.txWrites = append(c.txWrites, cmd)
+		return
+	}
+	s.propagate(cmd)
+}
+
+// propagationForm rewrites a command so replaying it later has the same
+// effect: relative expiries become absolute PXAT/PEXPIREAT times and
+// generated stream IDs the ID they got.
+// Called right after the command ran, while its keys are still locked.
+func (s *Server) propagationForm(c *client, args []string) []string {
+	switch strings.ToUpper(args[0]) {
+	case "SET":
+		for i := 3; i < len(args)-1; i++ {
+			switch strings.ToUpper(args[i]) {
+			case "EX", "PX", "EXAT":
+				form := append([]string{}, args[:i]...)
+				form = append(form, args[i+2:]...)
+				if at, ok := s.expiresAtMillis(c, args[1]); ok {
+					form = append(form, "PXAT", at)
+				}
+				return form
+			}
+		}
+	case "EXPIRE", "PEXPIRE":
+		if at, ok := s.expiresAtMillis(c, args[1]); ok {
+			return []string{"PEXPIREAT", args[1], at}
+		}
+		// The key is gone (expired right away) or never existed
+		return []string{"DEL", args[1]}
+	case "XADD":
+		// An auto-generated ID is replayed as the ID it got
+		if _, idIndex, errReply := parseXAdd(args); errReply == nil && strings.Contains(args[idIndex], "*") {
+			if last, ok, _ := s.db(c).XLastID(args[1]); ok {
+				form := append([]string{}, args...)
+				form[idIndex] = last.String()
+				return form
+			}
+		}
+	}
+	return args
+}
+
+// expiresAtMillis returns the key's absolute expiry in unix milliseconds
+func (s *Server) expiresAtMillis(c *client, key string) (string, bool) {
+	val, exists := s.db(c).Get(key)
+	if !exists || val.ExpiresAt == nil {
+		return "", false
+	}
+	return strconv.FormatInt(val.ExpiresAt.UnixMilli(), 10), true
+}
+
+// loadData restores the dataset on startup. With appendonly the AOF is the
+// source of truth; the snapshot only seeds a brand new AOF.
+func (s *Server) loadData() error {
+	if !s.cfg.AppendOnly {
+		return s.loadSnapshot()
+	}
+
+	_, statErr := os.Stat(s.cfg.AppendFilename)
+	if errors.Is(statErr, os.ErrNotExist) {
+		if err := s.loadSnapshot(); err != nil {
+			return err
+		}
+		return s.openAOF(true)
+	}
+
+	start := time.Now()
+	s.snapshot.lastSave.Store(start.Unix())
+
+	replay := newClient(nil)
+	s.loading = true
+	err := persistence.ReplayAOF(s.cfg.AppendFilename, func(commands [][]string) error {
+		for _, args := range commands {
+			_, reply, err := s.applyCommand(replay, args)
+			if err != nil {
+				return err
+			}
+			if errReply, failed := reply.(protocol.Error); failed {
+				logger.Warn("AOF command failed on replay", "command", args[0], "error", errReply.Message)
+			}
+		}
+		return nil
+	})
+	s.loading = false
+	if err != nil {
+		return err
+	}
+	s.snapshot.dirty.Store(0)
+
+	logger.Info("DB loaded from append only file", "path", s.cfg.AppendFilename, "duration", time.Since(start))
+	return s.openAOF(false)
+}
+
+// applyCommand runs a command that was already accepted once, replayed
+// from the AOF or streamed from a primary. The caller holds the locks.
+func (s *Server) applyCommand(c *client, args []string) (*commandSpec, protocol.RESPValue, error) {
+	spec, found := commandTable[strings.ToUpper(args[0])]
+	if !found || !spec.checkArity(len(args)) {
+		return nil, nil, fmt.Errorf("unknown or malformed command %q", args[0])
+	}
+	return spec, spec.handler(s, c, stringArray(args).Elements), nil
+}
+
+// openAOF starts logging writes. writeBase dumps the current dataset first,
+// so an AOF created after a snapshot was loaded is complete on its own.
+func (s *Server) openAOF(writeBase bool) error {
+	aof, err := persistence.OpenAOF(s.cfg.AppendFilename, s.cfg.AppendFsync)
+	if err != nil {
+		return err
+	}
+
+	if writeBase {
+		if err := aof.StartRewrite(); err != nil {
+			aof.Close()
+			return err
+		}
+		if err := aof.FinishRewrite(s.dataset()); err != nil {
+			aof.Close()
+			return err
+		}
+	}
+
+	s.aof = aof
+	logger.Info("Append only file enabled", "path", s.cfg.AppendFilename, "fsync", s.cfg.AppendFsync)
+	return nil
+}
+
+// BGREWRITEAOF runs exclusively, so the snapshot below and the start of the
+// capture happen with no write in between
+func (s *Server) handleBgRewriteAOF(args []protocol.RESPValue) protocol.RESPValue {
+	if s.aof == nil {
+		return protocol.Error{Message: "ERR append only file is disabled (--appendonly)"}
+	}
+	if err := s.startAOFRewrite(); err != nil {
+		return errorReply(err)
+	}
+	return protocol.SimpleString{Value: "Background append only file rewriting started"}
+}
+
+// startAOFRewrite compacts the AOF in the background. The caller holds
+// execMu exclusively.
+func (s *Server) startAOFRewrite() error {
+	if err := s.aof.StartRewrite(); err != nil {
+		return err
+	}
+
+	copyData := s.beginDataset()
+	go func() {
+		start := time.Now()
+		data := copyData()
+		if err := s.aof.FinishRewrite(data); err != nil {
+			logger.Error("Background AOF rewrite failed", "error", err)
+			return
+		}
+		logger.Info("Background AOF rewrite terminated with success", "keys", data.Keys(), "duration", time.Since(start))
+	}()
+	return nil
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	inmemory "cli-t/internal/shared/store/inmemory"
+	"cli-t/internal/tools/redis/persistence"
+	"cli-t/internal/tools/redis/protocol"
+
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// connectAOF starts a test server that logs writes to a temp AOF
+func connectAOF(t *testing.T, path string) (*Server, *protocol.Reader, func(args ...string) protocol.RESPValue) {
+	t.Helper()
+
+	s, conn, r := connect(t)
+	s.cfg.AppendOnly = true
+	s.cfg.AppendFilename = path
+	s.cfg.AppendFsync = persistence.FsyncAlways
+	require.NoError(t, s.loadData())
+	t.Cleanup(func() { s.aof.Close() })
+
+	return s, r, func(args ...string) protocol.RESPValue { return do(t, conn, r, args...) }
+}
+
+// reload replays the AOF into a brand new store
+func reload(t *testing.T, path string) inmemory.Store {
+	t.Helper()
+
+	store := inmemory.New()
+	s := New(Config{AppendOnly: true, AppendFilename: path, AppendFsync: persistence.FsyncNo}, store)
+	require.NoError(t, s.loadData())
+	require.NoError(t, s.aof.Close())
+	return store
+}
+
+func TestAOF_ReplayRestoresWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	s, _, run := connectAOF(t, path)
+
+	run("SET", "name", "ann")
+	run("SET", "session", "abc", "EX", "100")
+	run("RPUSH", "list", "a", "b")
+	run("EXPIRE", "list", "100")
+	run("INCR", "counter")
+	run("MULTI")
+	run("INCR", "counter")
+	run("HSET", "h", "f", "v")
+	run("EXEC")
+	run("GET", "name")            // reads aren't logged
+	run("HSET", "name", "f", "v") // failed writes aren't either
+	require.NoError(t, s.aof.Sync())
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), "GET")
+	assert.NotContains(t, string(raw), "\r\nEX\r\n", "relative expiries must not be logged")
+	assert.Contains(t, string(raw), "PXAT")
+	assert.Contains(t, string(raw), "PEXPIREAT")
+	assert.Contains(t, string(raw), "MULTI")
+
+	store := reload(t, path)
+	value, _ := store.Get("name")
+	assert.Equal(t, "ann", value.Data)
+	value, _ = store.Get("counter")
+	assert.Equal(t, "2", value.Data)
+	list, _ := store.LRange("list", 0, -1)
+	assert.Equal(t, []string{"a", "b"}, list)
+	field, _, _ := store.HGet("h", "f")
+	assert.Equal(t, "v", field)
+
+	// Expiries replay as the same absolute time, not "100s from replay"
+	original, _ := s.dbs[0].Get("session")
+	replayed, _ := store.Get("session")
+	require.NotNil(t, replayed.ExpiresAt)
+	assert.Equal(t, original.ExpiresAt.UnixMilli(), replayed.ExpiresAt.UnixMilli())
+	assert.Greater(t, store.GetTTL("list"), int64(90))
+}
+
+func TestAOF_ReplayHonoursPastExpiry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	past := time.Now().Add(-time.Minute).UnixMilli()
+
+	aof, err := persistence.OpenAOF(path, persistence.FsyncNo)
+	require.NoError(t, err)
+	aof.Append("SET", "k", "old")
+	aof.Append("SET", "k", "new", "PXAT", strconv.FormatInt(past, 10))
+	require.NoError(t, aof.Close())
+
+	// The key was overwritten and has expired since: it must not come back as "old"
+	store := reload(t, path)
+	assert.Equal(t, 0, store.Exists("k"))
+}
+
+func TestAOF_BgRewrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	s, _, run := connectAOF(t, path)
+
+	for i := 0; i < 50; i++ {
+		run("INCR", "counter")
+	}
+	run("SADD", "tags", "a", "b")
+	run("EXPIRE", "tags", "100")
+
+	assert.Equal(t, protocol.SimpleString{Value: "Background append only file rewriting started"}, run("BGREWRITEAOF"))
+	assert.Eventually(t, func() bool { return !s.aof.RewriteInProgress() }, time.Second, 10*time.Millisecond)
+	run("INCR", "counter")
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), "INCR\r\n$7\r\ncounter\r\n*2\r\n$4\r\nINCR", "log should be compacted")
+
+	store := reload(t, path)
+	value, _ := store.Get("counter")
+	assert.Equal(t, "51", value.Data)
+	assert.Greater(t, store.GetTTL("tags"), int64(90))
+}
+
+func TestAOF_BlockingPopLoggedAsPop(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	s, _, run := connectAOF(t, path)
+
+	run("RPUSH", "jobs", "a", "b")
+	run("BLPOP", "jobs", "0")
+	run("BLMOVE", "jobs", "done", "LEFT", "RIGHT", "0")
+	require.NoError(t, s.aof.Sync())
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), "BLPOP")
+	assert.NotContains(t, string(raw), "BLMOVE")
+
+	store := reload(t, path)
+	assert.Equal(t, 0, store.Exists("jobs"))
+	done, _ := store.LRange("done", 0, -1)
+	assert.Equal(t, []string{"b"}, done)
+}
+
+func TestAOF_ConcurrentWritesKeepTheirOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	s, _, _ := connectAOF(t, path)
+
+	// Writes share execMu: the last SET applied to a key must also be the
+	// last one logged, or the replay ends up with another value
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			c := newClient(nil)
+			c.authenticated = true
+			for i := 0; i < 200; i++ {
+				value := strconv.Itoa(g) + ":" + strconv.Itoa(i)
+				s.handleCommand(c, stringArray([]string{"SET", "shared", value}))
+				s.handleCommand(c, stringArray([]string{"RPUSH", "list", value}))
+				s.handleCommand(c, stringArray([]string{"SET", "own:" + strconv.Itoa(g), value}))
+			}
+		}(g)
+	}
+	wg.Wait()
+	require.NoError(t, s.aof.Sync())
+
+	replayed := reload(t, path)
+	for _, key := range []string{"shared", "own:0", "own:7"} {
+		want, _ := s.dbs[0].Get(key)
+		got, _ := replayed.Get(key)
+		assert.Equal(t, want.Data, got.Data, key)
+	}
+	want, _ := s.dbs[0].LRange("list", 0, -1)
+	got, _ := replayed.LRange("list", 0, -1)
+	assert.Equal(t, want, got)
+}
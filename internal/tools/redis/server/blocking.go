@@ -0,0 +1,183 @@
+package server
+
+import (
+	"cli-t/internal/tools/redis/protocol"
+
+	"errors"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	errTimeoutNotFloat = errors.New("ERR timeout is not a float or out of range")
+	errTimeoutNegative = errors.New("ERR timeout is negative")
+)
+
+// waiter is one client blocked on a set of keys of its database
+type waiter struct {
+	db    int
+	keys  []string
+	ready chan struct{} // signalled (non-blocking, capacity 1) when a key changes
+}
+
+// blockedClients maps keys to the clients waiting for them (BLPOP & co).
+// The store's change hook calls keyModified, which wakes every waiter on
+// the key; woken clients retry and block again if someone else won.
+type blockedClients struct {
+	mu   sync.Mutex
+	keys map[dbKey]map[*waiter]struct{}
+}
+
+func newBlockedClients() *blockedClients {
+	return &blockedClients{
+		keys: make(map[dbKey]map[*waiter]struct{}),
+	}
+}
+
+func (b *blockedClients) block(db int, keys []string) *waiter {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	w := &waiter{db: db, keys: keys, ready: make(chan struct{}, 1)}
+	for _, name := range keys {
+		key := dbKey{db, name}
+		if b.keys[key] == nil {
+			b.keys[key] = make(map[*waiter]struct{})
+		}
+		b.keys[key][w] = struct{}{}
+	}
+	return w
+}
+
+func (b *blockedClients) unblock(w *waiter) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, name := range w.keys {
+		key := dbKey{w.db, name}
+		delete(b.keys[key], w)
+		if len(b.keys[key]) == 0 {
+			delete(b.keys, key)
+		}
+	}
+}
+
+// keyModified is called from the store's change hook (store lock held)
+func (b *blockedClients) keyModified(db int, key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for w := range b.keys[dbKey{db, key}] {
+		w.wake()
+	}
+}
+
+// dbModified wakes every client blocked on a key of db, whose content was
+// replaced as a whole (SWAPDB)
+func (b *blockedClients) dbModified(db int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for key, waiters := range b.keys {
+		if key.db != db {
+			continue
+		}
+		for w := range waiters {
+			w.wake()
+		}
+	}
+}
+
+func (w *waiter) wake() {
+	select {
+	case w.ready <- struct{}{}:
+	default: // already signalled
+	}
+}
+
+// waiting returns how many clients are blocked on key of db
+func (b *blockedClients) waiting(db int, key string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.keys[dbKey{db, key}])
+}
+
+// serveBlocking runs try, and while it can't serve the client waits for one
+// of keys to change, the timeout (0 = forever) or the client to disconnect.
+//
+// try runs with writes locked out. Registering the waiter happens under the
+// same lock, so a push can't slip in between a failed try and the wait.
+// Inside EXEC nothing may block: try runs once and its reply stands.
+func (s *Server) serveBlocking(c *client, keys []string, timeout time.Duration, timedOut protocol.RESPValue, try func() (protocol.RESPValue, bool)) protocol.RESPValue {
+	if c.execing {
+		if reply, served := try(); served {
+			return reply
+		}
+		return timedOut
+	}
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	defer c.blocked.Store(false)
+
+	for {
+		s.execMu.Lock()
+		reply, served := try()
+		if served {
+			s.execMu.Unlock()
+			return reply
+		}
+		w := s.blocking.block(c.db, keys)
+		s.execMu.Unlock()
+		c.blocked.Store(true)
+
+		select {
+		case <-w.ready:
+			s.blocking.unblock(w) // retry
+		case <-deadline:
+			s.blocking.unblock(w)
+			return timedOut
+		case <-c.disconnected:
+			s.blocking.unblock(w)
+			return timedOut // nobody will read it
+		case <-s.shutdown:
+			s.blocking.unblock(w)
+			return timedOut
+		}
+	}
+}
+
+// serveOnce runs try a single time for a blocking command called without a
+// timeout (XREAD without BLOCK), locked like the blocking form
+func (s *Server) serveOnce(c *client, notServed protocol.RESPValue, try func() (protocol.RESPValue, bool)) protocol.RESPValue {
+	if !c.execing {
+		s.execMu.Lock()
+		defer s.execMu.Unlock()
+	}
+	if reply, served := try(); served {
+		return reply
+	}
+	return notServed
+}
+
+// parseTimeout parses a blocking timeout in (fractional) seconds
+func parseTimeout(arg protocol.RESPValue) (time.Duration, error) {
+	bulk, ok := arg.(protocol.BulkString)
+	if !ok {
+		return 0, errTimeoutNotFloat
+	}
+	seconds, err := strconv.ParseFloat(bulk.Value, 64)
+	if err != nil || math.IsNaN(seconds) || seconds > math.MaxInt64/float64(time.Second) {
+		return 0, errTimeoutNotFloat
+	}
+	if seconds < 0 {
+		return 0, errTimeoutNegative
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
@@ -0,0 +1,285 @@
+package server
+
+import (
+	"cli-t/internal/shared/logger"
+	"cli-t/internal/tools/redis/protocol"
+
+	"bufio"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// pushOutputLimit is how many bytes of pushed messages (pub/sub, MONITOR)
+// may wait for a client that doesn't read them, like redis'
+// client-output-buffer-limit for pubsub. Past it the client is dropped.
+const pushOutputLimit = 32 << 20
+
+var errOutputLimit = errors.New("client output buffer limit reached")
+
+// client is the per-connection state
+type client struct {
+	id        int64 // unique, increasing, assigned by the server (CLIENT ID)
+	conn      net.Conn
+	addr      string // remote address, "" for internal clients (AOF replay, primary link)
+	createdAt time.Time
+
+	writer *bufio.Writer
+	mu     sync.Mutex   // guards writer: replies and pushed messages come from different goroutines
+	resp   atomic.Int32 // protocol version replies are encoded with, switched by HELLO
+
+	// Pushed messages waiting for pushLoop, see push
+	pushMu    sync.Mutex
+	pushQueue [][]byte
+	pushSize  int  // bytes queued or being written
+	pushing   bool // a pushLoop goroutine is running
+	dropped   bool // over pushOutputLimit or the socket failed: nothing is queued anymore
+
+	// Pub/Sub subscriptions, guarded by pubSub.mu
+	channels map[string]struct{}
+	patterns map[string]struct{}
+
+	// MULTI/WATCH state; watched and watchDirty are guarded by watchRegistry.mu
+	tx         *transaction
+	watched    map[dbKey]struct{}
+	watchDirty bool
+	execing    bool        // running the queued commands of EXEC
+	txWrites   []dbCommand // writes of the running EXEC, propagated together
+
+	disconnected chan struct{} // closed once the connection can't be read anymore
+
+	replicaPort string // REPLCONF listening-port of a replica connection
+
+	blocked atomic.Bool // waiting in BLPOP & co
+
+	authenticated bool // passed AUTH, or the default user needs no password
+
+	// CLIENT LIST details, read by other connections
+	infoMu      sync.Mutex
+	name        string
+	user        string // ACL user the connection runs as
+	lastCommand string
+	lastActive  time.Time
+	multi       int // commands queued in MULTI, -1 outside of one
+	db          int // selected by SELECT; the client's own goroutine reads it unlocked
+
+	closeAfterReply bool // set by QUIT
+}
+
+func newClient(conn net.Conn) *client {
+	now := time.Now()
+	c := &client{
+		conn:       conn,
+		createdAt:  now,
+		lastActive: now,
+		multi:      -1,
+		user:       defaultUser,
+		writer:     bufio.NewWriter(conn),
+		channels:   make(map[string]struct{}),
+		patterns:   make(map[string]struct{}),
+		watched:    make(map[dbKey]struct{}),
+
+		disconnected: make(chan struct{}),
+	}
+	c.resp.Store(protocol.RESP2)
+	if conn != nil {
+		c.addr = conn.RemoteAddr().String()
+	}
+	return c
+}
+
+// recordCommand remembers the last command for CLIENT LIST. Only the
+// client's own goroutine calls it, so reading tx is safe here.
+func (c *client) recordCommand(name string) {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+	c.lastCommand = name
+	c.lastActive = time.Now()
+	c.multi = -1
+	if c.tx != nil {
+		c.multi = len(c.tx.queued)
+	}
+}
+
+func (c *client) selectDB(db int) {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+	c.db = db
+}
+
+func (c *client) setName(name string) {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+	c.name = name
+}
+
+func (c *client) getName() string {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+	return c.name
+}
+
+// login switches the connection to user after a successful AUTH
+func (c *client) login(user string) {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+	c.user = user
+	c.authenticated = true
+}
+
+func (c *client) userName() string {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+	return c.user
+}
+
+// incoming is one decoded command, or the error that ended the stream
+type incoming struct {
+	msg  protocol.RESPValue
+	more bool // more pipelined input is already buffered
+	err  error
+}
+
+// readLoop decodes commands in its own goroutine, so a client waiting in
+// BLPOP still notices when its connection goes away. It stops after a read
+// error or once done is closed.
+func (c *client) readLoop(reader *protocol.Reader, commands chan<- incoming, done <-chan struct{}) {
+	for {
+		msg, err := reader.ReadCommand()
+		if err != nil {
+			close(c.disconnected)
+			select {
+			case commands <- incoming{err: err}:
+			case <-done:
+			}
+			return
+		}
+
+		select {
+		case commands <- incoming{msg: msg, more: reader.Buffered() > 0}:
+		case <-done:
+			return
+		}
+	}
+}
+
+// writeReply buffers a reply and flushes it when flush is set.
+// Callers skip the flush while more pipelined commands are pending.
+func (c *client) writeReply(value protocol.RESPValue, flush bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := c.writer.Write(c.encode(value)); err != nil {
+		return err
+	}
+	if flush {
+		return c.writer.Flush()
+	}
+	return nil
+}
+
+// encode serializes a reply in the client's protocol version
+func (c *client) encode(value protocol.RESPValue) []byte {
+	if replies, ok := value.(multiReply); ok {
+		var result []byte
+		for _, reply := range replies {
+			result = append(result, c.encode(reply)...)
+		}
+		return result
+	}
+	return protocol.ToVersion(value, c.protocolVersion()).Serialize()
+}
+
+func (c *client) setProtocol(version int) {
+	c.resp.Store(int32(version))
+}
+
+func (c *client) protocolVersion() int {
+	return int(c.resp.Load())
+}
+
+// push queues an out-of-band message (a published message, a MONITOR line)
+// for c and returns right away, so PUBLISH or the command being monitored
+// never waits for c's socket. Like the notifier, a goroutine started for
+// the first queued message writes them in order and exits once the queue
+// is empty. A client that lets more than pushOutputLimit bytes pile up is
+// disconnected instead of growing the queue.
+func (c *client) push(value protocol.RESPValue) error {
+	buf := c.encode(value)
+
+	c.pushMu.Lock()
+	defer c.pushMu.Unlock()
+
+	if c.dropped {
+		return errOutputLimit
+	}
+	if c.pushSize+len(buf) > pushOutputLimit {
+		logger.Warn("Client output buffer limit reached, dropping it", "addr", c.addr, "id", c.id)
+		c.dropped = true
+		c.pushQueue = nil
+		c.conn.Close()
+		return errOutputLimit
+	}
+
+	c.pushQueue = append(c.pushQueue, buf)
+	c.pushSize += len(buf)
+	if !c.pushing {
+		c.pushing = true
+		go c.pushLoop()
+	}
+	return nil
+}
+
+// pushLoop writes the queued messages, one flush per batch
+func (c *client) pushLoop() {
+	for {
+		c.pushMu.Lock()
+		queue := c.pushQueue
+		c.pushQueue = nil
+		if len(queue) == 0 || c.dropped {
+			c.pushing = false
+			c.pushMu.Unlock()
+			return
+		}
+		c.pushMu.Unlock()
+
+		// Counted until written, so a stuck write still counts against the limit
+		written := 0
+		for i, buf := range queue {
+			if err := c.writeReply(rawReply(buf), i == len(queue)-1); err != nil {
+				c.pushMu.Lock()
+				c.dropped, c.pushing, c.pushQueue = true, false, nil
+				c.pushMu.Unlock()
+				c.conn.Close()
+				return
+			}
+			written += len(buf)
+		}
+
+		c.pushMu.Lock()
+		c.pushSize -= written
+		c.pushMu.Unlock()
+	}
+}
+
+// multiReply is several replies produced by one command,
+// e.g. SUBSCRIBE a b answers once per channel.
+type multiReply []protocol.RESPValue
+
+func (m multiReply) Serialize() []byte {
+	var result []byte
+	for _, reply := range m {
+		result = append(result, reply.Serialize()...)
+	}
+	return result
+}
+
+// rawReply is output that is already encoded, like the snapshot sent to a
+// replica. rawReply(nil) writes nothing, for commands that don't answer.
+type rawReply []byte
+
+func (r rawReply) Serialize() []byte {
+	return r
+}
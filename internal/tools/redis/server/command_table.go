@@ -0,0 +1,234 @@
+package server
+
+import (
+	"cli-t/internal/tools/redis/protocol"
+
+	"strings"
+)
+
+// handlerFunc executes one command for a client
+type handlerFunc func(s *Server, c *client, args []protocol.RESPValue) protocol.RESPValue
+
+// commandSpec describes one command, like an entry of redis' command table
+type commandSpec struct {
+	name    string
+	arity   int // exactly N arguments (command name included), or at least -N
+	handler handlerFunc
+
+	write      bool // may modify the dataset: locks its keys and is propagated to the AOF
+	exclusive  bool // needs the whole server to itself (EXEC, FLUSHALL, BGSAVE, CONFIG, ...)
+	blocking   bool // may wait for other clients: takes the lock by itself
+	propagates bool // logs its own replay form (BLPOP as LPOP), not the command as sent
+	denyOOM    bool // may grow the dataset: refused when maxmemory can't be met
+
+	firstKey, lastKey, keyStep int // where the keys are, for COMMAND; set from keyPositions
+
+	// keys finds keys that move around (XREAD's STREAMS), firstKey is 0 then
+	keys func(args []protocol.RESPValue) []string
+}
+
+// checkArity validates the argument count before dispatching or queueing
+func (spec *commandSpec) checkArity(argc int) bool {
+	if spec.arity >= 0 {
+		return argc == spec.arity
+	}
+	return argc >= -spec.arity
+}
+
+// hasKeys tells whether the command takes key arguments
+func (spec *commandSpec) hasKeys() bool {
+	return spec.firstKey > 0 || spec.keys != nil
+}
+
+// noClient adapts handlers that don't need the connection state
+func noClient(fn func(s *Server, args []protocol.RESPValue) protocol.RESPValue) handlerFunc {
+	return func(s *Server, _ *client, args []protocol.RESPValue) protocol.RESPValue {
+		return fn(s, args)
+	}
+}
+
+// commandTable maps upper-case command names to their spec
+var commandTable = map[string]*commandSpec{}
+
+func init() {
+	specs := []*commandSpec{
+		// Connection
+		{name: "ping", arity: -1, handler: (*Server).handlePing},
+		{name: "echo", arity: 2, handler: noClient((*Server).handleEcho)},
+		{name: "quit", arity: -1, handler: (*Server).handleQuit},
+		{name: "auth", arity: -2, handler: (*Server).handleAuth},
+		{name: "hello", arity: -1, handler: (*Server).handleHello},
+
+		// Strings & keyspace
+		{name: "set", arity: -3, handler: (*Server).handleSet, write: true, denyOOM: true},
+		{name: "get", arity: 2, handler: (*Server).handleGet},
+		{name: "mset", arity: -3, handler: (*Server).handleMSet, write: true, denyOOM: true},
+		{name: "mget", arity: -2, handler: (*Server).handleMGet},
+		{name: "incr", arity: 2, handler: (*Server).handleIncr, write: true, denyOOM: true},
+		{name: "decr", arity: 2, handler: (*Server).handleDecr, write: true, denyOOM: true},
+		{name: "ttl", arity: 2, handler: (*Server).handleTtl},
+		{name: "expire", arity: 3, handler: (*Server).handleExpire, write: true},
+		{name: "pexpireat", arity: 3, handler: (*Server).handlePExpireAt, write: true},
+		{name: "exists", arity: -2, handler: (*Server).handleExists},
+		{name: "del", arity: -2, handler: (*Server).handleDelete, write: true},
+		{name: "unlink", arity: -2, handler: (*Server).handleDelete, write: true},
+		{name: "keys", arity: 2, handler: (*Server).handleKeys},
+		{name: "scan", arity: -2, handler: (*Server).handleScan},
+		{name: "type", arity: 2, handler: (*Server).handleType},
+		{name: "rename", arity: 3, handler: (*Server).handleRename, write: true},
+		{name: "renamenx", arity: 3, handler: (*Server).handleRenameNX, write: true},
+		{name: "copy", arity: -3, handler: (*Server).handleCopy, write: true, denyOOM: true},
+		{name: "persist", arity: 2, handler: (*Server).handlePersist, write: true},
+		{name: "pexpire", arity: 3, handler: (*Server).handlePExpire, write: true},
+		{name: "expireat", arity: 3, handler: (*Server).handleExpireAt, write: true},
+		{name: "pttl", arity: 2, handler: (*Server).handlePTtl},
+		{name: "randomkey", arity: 1, handler: (*Server).handleRandomKey},
+		{name: "dbsize", arity: 1, handler: (*Server).handleDBSize},
+		{name: "flushdb", arity: -1, handler: (*Server).handleFlushDB, write: true, exclusive: true},
+		{name: "flushall", arity: -1, handler: noClient((*Server).handleFlushAll), write: true, exclusive: true},
+		{name: "select", arity: 2, handler: (*Server).handleSelect},
+		{name: "move", arity: 3, handler: (*Server).handleMove, write: true},
+		{name: "swapdb", arity: 3, handler: (*Server).handleSwapDB, write: true, exclusive: true},
+
+		// Lists
+		{name: "lpush", arity: -3, handler: (*Server).handleLPush, write: true, denyOOM: true},
+		{name: "rpush", arity: -3, handler: (*Server).handleRPush, write: true, denyOOM: true},
+		{name: "lrange", arity: 4, handler: (*Server).handleLRange},
+		{name: "lpop", arity: -2, handler: (*Server).handleLPop, write: true},
+		{name: "rpop", arity: -2, handler: (*Server).handleRPop, write: true},
+		{name: "llen", arity: 2, handler: (*Server).handleLLen},
+		{name: "lindex", arity: 3, handler: (*Server).handleLIndex},
+		{name: "lset", arity: 4, handler: (*Server).handleLSet, write: true, denyOOM: true},
+		{name: "lrem", arity: 4, handler: (*Server).handleLRem, write: true},
+		{name: "ltrim", arity: 4, handler: (*Server).handleLTrim, write: true},
+		{name: "linsert", arity: 5, handler: (*Server).handleLInsert, write: true, denyOOM: true},
+		{name: "lmove", arity: 5, handler: (*Server).handleLMove, write: true, denyOOM: true},
+		{name: "blpop", arity: -3, handler: (*Server).handleBLPop, write: true, blocking: true, propagates: true},
+		{name: "brpop", arity: -3, handler: (*Server).handleBRPop, write: true, blocking: true, propagates: true},
+		{name: "blmove", arity: 6, handler: (*Server).handleBLMove, write: true, blocking: true, propagates: true},
+
+		// Hashes
+		{name: "hset", arity: -4, handler: (*Server).handleHSet, write: true, denyOOM: true},
+		{name: "hmset", arity: -4, handler: (*Server).handleHMSet, write: true, denyOOM: true},
+		{name: "hsetnx", arity: 4, handler: (*Server).handleHSetNX, write: true, denyOOM: true},
+		{name: "hget", arity: 3, handler: (*Server).handleHGet},
+		{name: "hmget", arity: -3, handler: (*Server).handleHMGet},
+		{name: "hgetall", arity: 2, handler: (*Server).handleHGetAll},
+		{name: "hdel", arity: -3, handler: (*Server).handleHDel, write: true},
+		{name: "hincrby", arity: 4, handler: (*Server).handleHIncrBy, write: true, denyOOM: true},
+		{name: "hkeys", arity: 2, handler: (*Server).handleHKeys},
+		{name: "hvals", arity: 2, handler: (*Server).handleHVals},
+		{name: "hlen", arity: 2, handler: (*Server).handleHLen},
+		{name: "hexists", arity: 3, handler: (*Server).handleHExists},
+
+		// Sets
+		{name: "sadd", arity: -3, handler: (*Server).handleSAdd, write: true, denyOOM: true},
+		{name: "srem", arity: -3, handler: (*Server).handleSRem, write: true},
+		{name: "smembers", arity: 2, handler: (*Server).handleSMembers},
+		{name: "sismember", arity: 3, handler: (*Server).handleSIsMember},
+		{name: "scard", arity: 2, handler: (*Server).handleSCard},
+		{name: "sinter", arity: -2, handler: (*Server).handleSInter},
+		{name: "sunion", arity: -2, handler: (*Server).handleSUnion},
+		{name: "sdiff", arity: -2, handler: (*Server).handleSDiff},
+
+		// Sorted sets
+		{name: "zadd", arity: -4, handler: (*Server).handleZAdd, write: true, denyOOM: true},
+		{name: "zincrby", arity: 4, handler: (*Server).handleZIncrBy, write: true, denyOOM: true},
+		{name: "zrange", arity: -4, handler: (*Server).handleZRange},
+		{name: "zrevrange", arity: -4, handler: (*Server).handleZRevRange},
+		{name: "zrangebyscore", arity: -4, handler: (*Server).handleZRangeByScore},
+		{name: "zrevrangebyscore", arity: -4, handler: (*Server).handleZRevRangeByScore},
+		{name: "zrank", arity: 3, handler: (*Server).handleZRank},
+		{name: "zrevrank", arity: 3, handler: (*Server).handleZRevRank},
+		{name: "zscore", arity: 3, handler: (*Server).handleZScore},
+		{name: "zrem", arity: -3, handler: (*Server).handleZRem, write: true},
+		{name: "zcard", arity: 2, handler: (*Server).handleZCard},
+
+		// Streams
+		{name: "xadd", arity: -5, handler: (*Server).handleXAdd, write: true, denyOOM: true},
+		{name: "xlen", arity: 2, handler: (*Server).handleXLen},
+		{name: "xrange", arity: -4, handler: (*Server).handleXRange},
+		{name: "xrevrange", arity: -4, handler: (*Server).handleXRevRange},
+		{name: "xdel", arity: -3, handler: (*Server).handleXDel, write: true},
+		{name: "xtrim", arity: -4, handler: (*Server).handleXTrim, write: true},
+		{name: "xsetid", arity: -3, handler: (*Server).handleXSetID, write: true, denyOOM: true},
+		{name: "xread", arity: -4, handler: (*Server).handleXRead, blocking: true, keys: streamsKeys},
+		{name: "xgroup", arity: -2, handler: (*Server).handleXGroup, write: true, denyOOM: true},
+		{name: "xreadgroup", arity: -7, handler: (*Server).handleXReadGroup, write: true, blocking: true, propagates: true, keys: streamsKeys},
+		{name: "xack", arity: -4, handler: (*Server).handleXAck, write: true},
+		{name: "xpending", arity: -3, handler: (*Server).handleXPending},
+		{name: "xclaim", arity: -6, handler: (*Server).handleXClaim, write: true, propagates: true},
+
+		// Pub/Sub
+		{name: "subscribe", arity: -2, handler: (*Server).handleSubscribe},
+		{name: "psubscribe", arity: -2, handler: (*Server).handlePSubscribe},
+		{name: "unsubscribe", arity: -1, handler: (*Server).handleUnsubscribe},
+		{name: "punsubscribe", arity: -1, handler: (*Server).handlePUnsubscribe},
+		{name: "publish", arity: 3, handler: noClient((*Server).handlePublish)},
+		{name: "pubsub", arity: -2, handler: noClient((*Server).handlePubSub)},
+
+		// Persistence
+		{name: "save", arity: 1, handler: noClient((*Server).handleSave), exclusive: true},
+		{name: "bgsave", arity: -1, handler: noClient((*Server).handleBgSave), exclusive: true},
+		{name: "lastsave", arity: 1, handler: noClient((*Server).handleLastSave)},
+		{name: "bgrewriteaof", arity: 1, handler: noClient((*Server).handleBgRewriteAOF), exclusive: true},
+
+		// Replication
+		{name: "replicaof", arity: 3, handler: noClient((*Server).handleReplicaOf), exclusive: true},
+		{name: "slaveof", arity: 3, handler: noClient((*Server).handleReplicaOf), exclusive: true},
+		{name: "sync", arity: 1, handler: (*Server).handleSync, exclusive: true},
+		{name: "psync", arity: 3, handler: (*Server).handlePSync, exclusive: true},
+		{name: "replconf", arity: -1, handler: (*Server).handleReplConf},
+		{name: "role", arity: 1, handler: noClient((*Server).handleRole)},
+
+		// Server
+		{name: "info", arity: -1, handler: noClient((*Server).handleInfo)},
+		{name: "config", arity: -2, handler: noClient((*Server).handleConfig), exclusive: true},
+		{name: "client", arity: -2, handler: (*Server).handleClientCommand},
+		{name: "command", arity: -1, handler: noClient((*Server).handleCommandInfo)},
+		{name: "acl", arity: -2, handler: (*Server).handleACL},
+		{name: "monitor", arity: 1, handler: (*Server).handleMonitor},
+
+		// Transactions
+		{name: "multi", arity: 1, handler: (*Server).handleMulti},
+		{name: "exec", arity: 1, handler: (*Server).handleExec, exclusive: true},
+		{name: "discard", arity: 1, handler: (*Server).handleDiscard},
+		{name: "watch", arity: -2, handler: (*Server).handleWatch},
+		{name: "unwatch", arity: 1, handler: (*Server).handleUnwatch},
+	}
+
+	for _, spec := range specs {
+		if pos, listed := keyPositions[spec.name]; listed {
+			spec.firstKey, spec.lastKey, spec.keyStep = pos[0], pos[1], pos[2]
+		} else {
+			spec.firstKey, spec.lastKey, spec.keyStep = 1, 1, 1
+		}
+		commandTable[strings.ToUpper(spec.name)] = spec
+	}
+}
+
+// keyPositions are the [first, last, step] key arguments of the commands
+// that don't take exactly one key right after the name. A negative last
+// counts from the end, like redis: -1 is the last argument.
+var keyPositions = map[string][3]int{
+	"del": {1, -1, 1}, "unlink": {1, -1, 1}, "exists": {1, -1, 1}, "watch": {1, -1, 1},
+	"mget": {1, -1, 1}, "mset": {1, -1, 2},
+	"sinter": {1, -1, 1}, "sunion": {1, -1, 1}, "sdiff": {1, -1, 1},
+	"rename": {1, 2, 1}, "renamenx": {1, 2, 1}, "copy": {1, 2, 1},
+	"lmove": {1, 2, 1}, "blmove": {1, 2, 1},
+	"blpop": {1, -2, 1}, "brpop": {1, -2, 1},
+	"xgroup": {2, 2, 1},
+
+	// Found by the spec's keys func
+	"xread": {}, "xreadgroup": {},
+
+	// No keys at all
+	"ping": {}, "echo": {}, "quit": {}, "auth": {}, "hello": {}, "keys": {}, "scan": {}, "randomkey": {},
+	"dbsize": {}, "flushdb": {}, "flushall": {}, "select": {}, "swapdb": {},
+	"subscribe": {}, "psubscribe": {}, "unsubscribe": {}, "punsubscribe": {},
+	"publish": {}, "pubsub": {},
+	"save": {}, "bgsave": {}, "lastsave": {}, "bgrewriteaof": {},
+	"replicaof": {}, "slaveof": {}, "sync": {}, "psync": {}, "replconf": {}, "role": {},
+	"info": {}, "config": {}, "client": {}, "command": {}, "acl": {}, "monitor": {},
+	"multi": {}, "exec": {}, "discard": {}, "unwatch": {},
+}
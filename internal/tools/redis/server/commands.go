@@ -11,7 +11,7 @@ import (
 )
 
 // RESP Protocol Rule: Commands Are Always Arrays of Bulk Strings
-func (s *Server) handleCommand(msg protocol.RESPValue) protocol.RESPValue {
+func (s *Server) handleCommand(c *client, msg protocol.RESPValue) protocol.RESPValue {
 	// Redis commands come as Arrays of BulkStrings
 	// Example: ["PING"] or ["SET", "key", "value"]
 
@@ -29,41 +29,123 @@ func (s *Server) handleCommand(msg protocol.RESPValue) protocol.RESPValue {
 	// Commands are case-insensitive
 	cmd := strings.ToUpper(cmdName.Value)
 
-	// Route to appropriate handler
-	switch cmd {
-	case "PING":
-		return s.handlePing(arr.Elements)
-	case "ECHO":
-		return s.handleEcho(arr.Elements)
-	case "SET":
-		return s.handleSet(arr.Elements)
-	case "GET":
-		return s.handleGet(arr.Elements)
-	case "TTL":
-		return s.handleTtl(arr.Elements)
-	case "EXPIRE":
-		return s.handleExpire(arr.Elements)
-	case "EXISTS":
-		return s.handleExists(arr.Elements)
-	case "DEL":
-		return s.handleDelete(arr.Elements)
-	case "INCR":
-		return s.handleIncr(arr.Elements)
-	case "DECR":
-		return s.handleDecr(arr.Elements)
-	case "LPUSH":
-		return s.handleLPush(arr.Elements)
-	case "RPUSH":
-		return s.handleRPush(arr.Elements)
-	case "LRANGE":
-		return s.handleLRange(arr.Elements)
-	default:
+	spec, found := commandTable[cmd]
+	if !found {
+		if c.tx != nil {
+			c.tx.aborted = true
+		}
 		return protocol.Error{Message: "ERR unknown command '" + cmd + "'"}
 	}
+	if !spec.checkArity(len(arr.Elements)) {
+		if c.tx != nil {
+			c.tx.aborted = true
+		}
+		return wrongArgs(spec.name)
+	}
+	s.stats.commandsProcessed.Add(1)
+	c.recordCommand(spec.name)
+
+	// Nothing but logging in before AUTH, then only what the ACL user allows
+	if !allowedUnauthenticated[cmd] {
+		err := errNoAuth
+		if c.authenticated {
+			err = s.acl.check(c.userName(), spec, arr.Elements)
+		}
+		if err != nil {
+			if c.tx != nil {
+				c.tx.aborted = true
+			}
+			return errorReply(err)
+		}
+	}
+	s.monitors.feed(c, spec, arr.Elements)
+
+	// Subscribed RESP2 clients may only manage their subscriptions; RESP3
+	// tells messages and replies apart, so it has no such restriction
+	if !allowedWhileSubscribed[cmd] && c.protocolVersion() == protocol.RESP2 && s.pubsub.subscriptionCount(c) > 0 {
+		return protocol.Error{Message: "ERR Can't execute '" + spec.name +
+			"': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context"}
+	}
+
+	// A replica only takes writes from its primary
+	if spec.write && s.config().ReplicaReadOnly && s.repl.following() {
+		if c.tx != nil {
+			c.tx.aborted = true
+		}
+		return errorReply(errReadOnly)
+	}
+
+	// Inside MULTI everything but the transaction commands is queued
+	if c.tx != nil && !transactionCommands[cmd] {
+		c.tx.queued = append(c.tx.queued, queuedCommand{spec: spec, args: arr.Elements})
+		return protocol.SimpleString{Value: "QUEUED"}
+	}
+
+	if spec.blocking {
+		return spec.handler(s, c, arr.Elements)
+	}
+
+	// Evict before the command runs, so it can't push memory over the limit.
+	// Eviction deletes keys other commands may be using, so it runs alone.
+	if spec.denyOOM && s.overMemory() {
+		s.execMu.Lock()
+		oom := s.freeMemory()
+		s.execMu.Unlock()
+		if oom != nil {
+			return oom
+		}
+	}
+
+	// EXEC and the commands that work on every key (FLUSHALL, SWAPDB,
+	// CONFIG, ...) need the server to themselves. Everything else runs side
+	// by side: the store's shard locks keep each call atomic, and writes
+	// also lock their keys here, so two writes of the same key are applied
+	// and propagated in the same order.
+	if spec.exclusive {
+		s.execMu.Lock()
+		defer s.execMu.Unlock()
+	} else {
+		s.execMu.RLock()
+		defer s.execMu.RUnlock()
+		if spec.write {
+			unlock := s.keyLocks.lock(commandKeys(spec, arr.Elements))
+			defer unlock()
+		}
+	}
+
+	reply := spec.handler(s, c, arr.Elements)
+	if _, failed := reply.(protocol.Error); spec.write && !spec.propagates && !failed {
+		if args, ok := bulkStrings(arr.Elements); ok {
+			s.alsoPropagate(c, s.propagationForm(c, args))
+		}
+	}
+	return reply
 }
 
 // Implement these handlers:
-func (s *Server) handlePing(args []protocol.RESPValue) protocol.RESPValue {
+func (s *Server) handlePing(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if len(args) > 2 {
+		return wrongArgs("ping")
+	}
+
+	message := ""
+	if len(args) == 2 {
+		arg, ok := args[1].(protocol.BulkString)
+		if !ok {
+			return protocol.Error{Message: "ERR argument must be a string"}
+		}
+		message = arg.Value
+	}
+
+	// In RESP2 subscribed mode PING answers with a pub/sub style array,
+	// RESP3 keeps replies and pushes apart so it answers as usual
+	if c.protocolVersion() == protocol.RESP2 && s.pubsub.subscriptionCount(c) > 0 {
+		return stringArray([]string{"pong", message})
+	}
+
+	if len(args) == 2 {
+		return protocol.BulkString{Value: message}
+	}
 	return protocol.SimpleString{
 		Value: "PONG",
 	}
@@ -87,7 +169,7 @@ func (s *Server) handleEcho(args []protocol.RESPValue) protocol.RESPValue {
 	}
 }
 
-func (s *Server) handleSet(args []protocol.RESPValue) protocol.RESPValue {
+func (s *Server) handleSet(c *client, args []protocol.RESPValue) protocol.RESPValue {
 	if len(args) < 3 {
 		return protocol.Error{Message: "ERR wrong number of arguments for 'set' command"}
 	}
@@ -171,7 +253,8 @@ func (s *Server) handleSet(args []protocol.RESPValue) protocol.RESPValue {
 			}
 
 			timestamp := time.Unix(timestampInt, 0)
-			if time.Until(timestamp) <= 0 {
+			// While replaying the AOF a past time means "overwritten, then expired"
+			if time.Until(timestamp) <= 0 && !s.loading {
 				return protocol.Error{Message: "ERR invalid expire time in 'set' command"}
 			}
 
@@ -195,7 +278,8 @@ func (s *Server) handleSet(args []protocol.RESPValue) protocol.RESPValue {
 			}
 
 			timestamp := time.Unix(timestampMs/1000, (timestampMs%1000)*1000000)
-			if time.Until(timestamp) <= 0 {
+			// While replaying the AOF a past time means "overwritten, then expired"
+			if time.Until(timestamp) <= 0 && !s.loading {
 				return protocol.Error{Message: "ERR invalid expire time in 'set' command"}
 			}
 
@@ -208,7 +292,7 @@ func (s *Server) handleSet(args []protocol.RESPValue) protocol.RESPValue {
 		}
 	}
 
-	s.store.Set(key.Value, inmemory.StoreValue{
+	s.db(c).Set(key.Value, inmemory.StoreValue{
 		Data:      value.Value,
 		ExpiresAt: expiresAt,
 		Type:      inmemory.TypeString,
@@ -217,7 +301,7 @@ func (s *Server) handleSet(args []protocol.RESPValue) protocol.RESPValue {
 	return protocol.SimpleString{Value: "OK"}
 }
 
-func (s *Server) handleGet(args []protocol.RESPValue) protocol.RESPValue {
+func (s *Server) handleGet(c *client, args []protocol.RESPValue) protocol.RESPValue {
 	if len(args) != 2 { //  GET key (2 args total)
 		return protocol.Error{Message: "ERR wrong number of arguments for 'get' command"}
 	}
@@ -228,7 +312,7 @@ func (s *Server) handleGet(args []protocol.RESPValue) protocol.RESPValue {
 		return protocol.Error{Message: "ERR key must be a string"}
 	}
 
-	value, exists := s.store.Get(key.Value)
+	value, exists := s.db(c).Get(key.Value)
 	if !exists {
 		// Key not found → return null bulk string
 		return protocol.BulkString{
@@ -236,6 +320,10 @@ func (s *Server) handleGet(args []protocol.RESPValue) protocol.RESPValue {
 		}
 	}
 
+	if value.Type != inmemory.TypeString {
+		return protocol.Error{Message: inmemory.ErrWrongType.Error()}
+	}
+
 	// Key found → return the value
 	return protocol.BulkString{
 		Value:  value.Data,
@@ -243,55 +331,67 @@ func (s *Server) handleGet(args []protocol.RESPValue) protocol.RESPValue {
 	}
 }
 
-func (s *Server) handleTtl(args []protocol.RESPValue) protocol.RESPValue {
-	if len(args) != 2 { //  GET key (2 args total)
-		return protocol.Error{Message: "ERR wrong number of arguments for 'ttl' command"}
-	}
-
-	// Safe type assertion
-	key, ok := args[1].(protocol.BulkString)
+// MGET key [key ...] (nil for missing keys and keys that aren't strings)
+func (s *Server) handleMGet(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	keys, ok := bulkStrings(args[1:])
 	if !ok {
 		return protocol.Error{Message: "ERR key must be a string"}
 	}
 
-	ttl := s.store.GetTTL(key.Value)
-	return protocol.Integer{
-		Value: ttl,
+	values := s.db(c).MGet(keys...)
+	elements := make([]protocol.RESPValue, len(values))
+	for i, value := range values {
+		if value == nil || value.Type != inmemory.TypeString {
+			elements[i] = protocol.BulkString{IsNull: true}
+			continue
+		}
+		elements[i] = protocol.BulkString{Value: value.Data}
+	}
+	return protocol.Array{Elements: elements}
+}
+
+// MSET key value [key value ...], all keys are set at once
+func (s *Server) handleMSet(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if len(args)%2 != 1 {
+		return wrongArgs("mset")
+	}
+	pairs, ok := bulkStrings(args[1:])
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
 	}
 
+	values := make(map[string]inmemory.StoreValue, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		values[pairs[i]] = inmemory.StoreValue{Type: inmemory.TypeString, Data: pairs[i+1]}
+	}
+	s.db(c).MSet(values)
+	return protocol.SimpleString{Value: "OK"}
 }
 
-func (s *Server) handleExpire(args []protocol.RESPValue) protocol.RESPValue {
-	if len(args) != 3 {
-		return protocol.Error{Message: "ERR wrong number of arguments for 'expire' command"}
+func (s *Server) handleTtl(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if len(args) != 2 { //  GET key (2 args total)
+		return protocol.Error{Message: "ERR wrong number of arguments for 'ttl' command"}
 	}
 
-	// Safe type assertions
+	// Safe type assertion
 	key, ok := args[1].(protocol.BulkString)
 	if !ok {
 		return protocol.Error{Message: "ERR key must be a string"}
 	}
 
-	expireBulk, ok := args[2].(protocol.BulkString)
-	if !ok {
-		return protocol.Error{Message: "ERR value must be a string"}
-	}
-
-	expire, err := strconv.Atoi(expireBulk.Value)
-	if err != nil || expire < 0 {
-		return protocol.Error{Message: "ERR value is not an integer or out of range"}
+	ttl := s.db(c).GetTTL(key.Value)
+	return protocol.Integer{
+		Value: ttl,
 	}
 
-	success := s.store.SetExpiry(key.Value, expire)
-	if success {
-		return protocol.Integer{Value: 1}
-	} else {
-		return protocol.Integer{Value: 0}
-	}
+}
 
+// EXPIRE key seconds (zero or negative deletes the key, like redis)
+func (s *Server) handleExpire(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	return s.expireAt(c, args, "expire", time.Second, false)
 }
 
-func (s *Server) handleExists(args []protocol.RESPValue) protocol.RESPValue {
+func (s *Server) handleExists(c *client, args []protocol.RESPValue) protocol.RESPValue {
 	if len(args) < 2 {
 		return protocol.Error{Message: "ERR wrong number of arguments for 'EXISTS' command"}
 	}
@@ -307,11 +407,11 @@ func (s *Server) handleExists(args []protocol.RESPValue) protocol.RESPValue {
 		keys = append(keys, key.Value)
 	}
 
-	exists := s.store.Exists(keys...)
+	exists := s.db(c).Exists(keys...)
 	return protocol.Integer{Value: int64(exists)}
 }
 
-func (s *Server) handleDelete(args []protocol.RESPValue) protocol.RESPValue {
+func (s *Server) handleDelete(c *client, args []protocol.RESPValue) protocol.RESPValue {
 	if len(args) < 2 {
 		return protocol.Error{Message: "ERR wrong number of arguments for 'DEL' command"}
 	}
@@ -327,14 +427,14 @@ func (s *Server) handleDelete(args []protocol.RESPValue) protocol.RESPValue {
 		keys = append(keys, key.Value)
 	}
 
-	count := s.store.Delete(keys...)
+	count := s.db(c).Delete(keys...)
 	return protocol.Integer{Value: int64(count)}
 }
 
-func (s *Server) handleIncr(args []protocol.RESPValue) protocol.RESPValue {
+func (s *Server) handleIncr(c *client, args []protocol.RESPValue) protocol.RESPValue {
 	// Check arg count
 	// Extract key
-	// Call s.store.Incr(key)
+	// Call s.db(c).Incr(key)
 	// If error, return protocol.Error
 	// Otherwise, return protocol.Integer with new value
 	if len(args) != 2 { //  GET key (2 args total)
@@ -347,7 +447,7 @@ func (s *Server) handleIncr(args []protocol.RESPValue) protocol.RESPValue {
 		return protocol.Error{Message: "ERR key must be a string"}
 	}
 
-	newVal, err := s.store.Incr(key.Value)
+	newVal, err := s.db(c).Incr(key.Value)
 	if err != nil {
 		return protocol.Error{Message: err.Error()}
 	}
@@ -357,10 +457,10 @@ func (s *Server) handleIncr(args []protocol.RESPValue) protocol.RESPValue {
 	}
 }
 
-func (s *Server) handleDecr(args []protocol.RESPValue) protocol.RESPValue {
+func (s *Server) handleDecr(c *client, args []protocol.RESPValue) protocol.RESPValue {
 	// Check arg count
 	// Extract key
-	// Call s.store.Decr(key)
+	// Call s.db(c).Decr(key)
 	// If error, return protocol.Error
 	// Otherwise, return protocol.Integer with new value
 	if len(args) != 2 { //  GET key (2 args total)
@@ -373,7 +473,7 @@ func (s *Server) handleDecr(args []protocol.RESPValue) protocol.RESPValue {
 		return protocol.Error{Message: "ERR key must be a string"}
 	}
 
-	newVal, err := s.store.Decr(key.Value)
+	newVal, err := s.db(c).Decr(key.Value)
 	if err != nil {
 		return protocol.Error{Message: err.Error()}
 	}
@@ -383,7 +483,7 @@ func (s *Server) handleDecr(args []protocol.RESPValue) protocol.RESPValue {
 	}
 }
 
-func (s *Server) handleLPush(args []protocol.RESPValue) protocol.RESPValue {
+func (s *Server) handleLPush(c *client, args []protocol.RESPValue) protocol.RESPValue {
 	if len(args) < 3 { // LPUSH key value1 [value2 ...]
 		return protocol.Error{Message: "ERR wrong number of arguments for 'lpush' command"}
 	}
@@ -403,7 +503,7 @@ func (s *Server) handleLPush(args []protocol.RESPValue) protocol.RESPValue {
 		values = append(values, val.Value)
 	}
 
-	count, err := s.store.LPush(key.Value, values...)
+	count, err := s.db(c).LPush(key.Value, values...)
 	if err != nil {
 		return protocol.Error{Message: err.Error()}
 	}
@@ -411,7 +511,7 @@ func (s *Server) handleLPush(args []protocol.RESPValue) protocol.RESPValue {
 	return protocol.Integer{Value: count}
 }
 
-func (s *Server) handleRPush(args []protocol.RESPValue) protocol.RESPValue {
+func (s *Server) handleRPush(c *client, args []protocol.RESPValue) protocol.RESPValue {
 	if len(args) < 3 { // RPUSH key value1 [value2 ...]
 		return protocol.Error{Message: "ERR wrong number of arguments for 'lpush' command"}
 	}
@@ -431,7 +531,7 @@ func (s *Server) handleRPush(args []protocol.RESPValue) protocol.RESPValue {
 		values = append(values, val.Value)
 	}
 
-	count, err := s.store.RPush(key.Value, values...)
+	count, err := s.db(c).RPush(key.Value, values...)
 	if err != nil {
 		return protocol.Error{Message: err.Error()}
 	}
@@ -439,7 +539,7 @@ func (s *Server) handleRPush(args []protocol.RESPValue) protocol.RESPValue {
 	return protocol.Integer{Value: count}
 }
 
-func (s *Server) handleLRange(args []protocol.RESPValue) protocol.RESPValue {
+func (s *Server) handleLRange(c *client, args []protocol.RESPValue) protocol.RESPValue {
 	if len(args) != 4 { // LRANGE key start stop
 		return protocol.Error{Message: "ERR wrong number of arguments for 'lrange' command"}
 	}
@@ -470,7 +570,7 @@ func (s *Server) handleLRange(args []protocol.RESPValue) protocol.RESPValue {
 	}
 
 	// Redis allows negative indice
-	result, err := s.store.LRange(key.Value, start, stop)
+	result, err := s.db(c).LRange(key.Value, start, stop)
 	if err != nil {
 		return protocol.Error{Message: err.Error()}
 	}
@@ -483,3 +583,56 @@ func (s *Server) handleLRange(args []protocol.RESPValue) protocol.RESPValue {
 
 	return protocol.Array{Elements: elements}
 }
+
+// Helpers shared by the command handlers
+
+// wrongArgs is the standard arity error for a command
+func wrongArgs(cmd string) protocol.Error {
+	return protocol.Error{Message: "ERR wrong number of arguments for '" + strings.ToLower(cmd) + "' command"}
+}
+
+// bulkStrings converts command arguments to plain strings.
+// Returns false if any argument isn't a bulk string.
+func bulkStrings(args []protocol.RESPValue) ([]string, bool) {
+	result := make([]string, len(args))
+	for i, arg := range args {
+		bulk, ok := arg.(protocol.BulkString)
+		if !ok {
+			return nil, false
+		}
+		result[i] = bulk.Value
+	}
+	return result, true
+}
+
+// stringArray converts []string to an Array of BulkStrings
+func stringArray(values []string) protocol.Array {
+	elements := make([]protocol.RESPValue, len(values))
+	for i, val := range values {
+		elements[i] = protocol.BulkString{Value: val}
+	}
+	return protocol.Array{Elements: elements}
+}
+
+// stringSet is an unordered reply, a RESP3 set
+func stringSet(values []string) protocol.Set {
+	return protocol.Set{Elements: stringArray(values).Elements}
+}
+
+// stringPush is out-of-band data like a pub/sub message, a RESP3 push
+func stringPush(values ...string) protocol.Push {
+	return protocol.Push{Elements: stringArray(values).Elements}
+}
+
+// boolInteger is the 1/0 integer reply redis uses for booleans
+func boolInteger(b bool) protocol.Integer {
+	if b {
+		return protocol.Integer{Value: 1}
+	}
+	return protocol.Integer{Value: 0}
+}
+
+// errorReply converts a store error to a RESP error
+func errorReply(err error) protocol.Error {
+	return protocol.Error{Message: err.Error()}
+}
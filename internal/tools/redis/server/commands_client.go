@@ -0,0 +1,319 @@
+package server
+
+import (
+	"cli-t/internal/tools/redis/protocol"
+
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CLIENT ID | GETNAME | SETNAME name | INFO | LIST [TYPE type] [ID id ...] | KILL ...
+func (s *Server) handleClientCommand(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR syntax error"}
+	}
+
+	switch sub := strings.ToUpper(strs[1]); sub {
+	case "ID":
+		return protocol.Integer{Value: c.id}
+	case "GETNAME":
+		name := c.getName()
+		if name == "" {
+			return protocol.BulkString{IsNull: true}
+		}
+		return protocol.BulkString{Value: name}
+	case "SETNAME":
+		if len(strs) != 3 {
+			return wrongArgs("client|setname")
+		}
+		if !validClientName(strs[2]) {
+			return errorReply(errClientName)
+		}
+		c.setName(strs[2])
+		return protocol.SimpleString{Value: "OK"}
+	case "INFO":
+		return protocol.Verbatim{Format: "txt", Value: s.clientInfoLine(c) + "\n"}
+	case "LIST":
+		return s.clientList(strs[2:])
+	case "KILL":
+		return s.clientKill(c, strs[2:])
+	default:
+		return protocol.Error{Message: "ERR unknown subcommand '" + strs[1] + "'. Try CLIENT HELP."}
+	}
+}
+
+var errClientName = errors.New("ERR Client names cannot contain spaces, newlines or special characters.")
+
+func validClientName(name string) bool {
+	for _, ch := range name {
+		if ch <= ' ' || ch > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// HELLO [protover [AUTH username password] [SETNAME clientname]] switches the
+// protocol version, optionally logging in and naming the connection first
+func (s *Server) handleHello(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR syntax error"}
+	}
+
+	version := c.protocolVersion()
+	if len(strs) > 1 {
+		parsed, err := strconv.Atoi(strs[1])
+		if err != nil {
+			return protocol.Error{Message: "ERR Protocol version is not an integer or out of range"}
+		}
+		if parsed != protocol.RESP2 && parsed != protocol.RESP3 {
+			return protocol.Error{Message: "NOPROTO unsupported protocol version"}
+		}
+		version = parsed
+	}
+
+	user, password, name := "", "", ""
+	for i := 2; i < len(strs); i++ {
+		switch opt := strings.ToUpper(strs[i]); {
+		case opt == "AUTH" && i+2 < len(strs):
+			user, password = strs[i+1], strs[i+2]
+			i += 2
+		case opt == "SETNAME" && i+1 < len(strs):
+			name = strs[i+1]
+			if !validClientName(name) {
+				return errorReply(errClientName)
+			}
+			i++
+		default:
+			return protocol.Error{Message: "ERR Syntax error in HELLO option '" + strs[i] + "'"}
+		}
+	}
+
+	if user != "" {
+		if !s.acl.authenticate(user, password) {
+			return errorReply(errWrongPass)
+		}
+		c.login(user)
+	}
+	if !c.authenticated {
+		return protocol.Error{Message: "NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time"}
+	}
+	if name != "" {
+		c.setName(name)
+	}
+
+	// The reply already uses the new version
+	c.setProtocol(version)
+
+	role := "master"
+	if s.repl.following() {
+		role = "replica"
+	}
+	return protocol.Map{Entries: []protocol.MapEntry{
+		{Key: protocol.BulkString{Value: "server"}, Value: protocol.BulkString{Value: "redis"}},
+		{Key: protocol.BulkString{Value: "version"}, Value: protocol.BulkString{Value: redisVersion}},
+		{Key: protocol.BulkString{Value: "proto"}, Value: protocol.Integer{Value: int64(version)}},
+		{Key: protocol.BulkString{Value: "id"}, Value: protocol.Integer{Value: c.id}},
+		{Key: protocol.BulkString{Value: "mode"}, Value: protocol.BulkString{Value: "standalone"}},
+		{Key: protocol.BulkString{Value: "role"}, Value: protocol.BulkString{Value: role}},
+		{Key: protocol.BulkString{Value: "modules"}, Value: protocol.Array{Elements: []protocol.RESPValue{}}},
+	}}
+}
+
+// sortedClients returns the connected clients by id, oldest first
+func (s *Server) sortedClients() []*client {
+	s.mu.Lock()
+	clients := make([]*client, 0, len(s.clients))
+	for _, c := range s.clients {
+		clients = append(clients, c)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(clients, func(i, j int) bool { return clients[i].id < clients[j].id })
+	return clients
+}
+
+// clientType is what CLIENT LIST/KILL TYPE filters on
+func (s *Server) clientType(c *client) string {
+	s.repl.mu.Lock()
+	_, isReplica := s.repl.replicas[c]
+	s.repl.mu.Unlock()
+
+	switch {
+	case isReplica:
+		return "replica"
+	case s.pubsub.subscriptionCount(c) > 0:
+		return "pubsub"
+	}
+	return "normal"
+}
+
+func validClientType(kind string) (string, bool) {
+	switch kind = strings.ToLower(kind); kind {
+	case "normal", "replica", "pubsub":
+		return kind, true
+	case "slave":
+		return "replica", true
+	}
+	return "", false
+}
+
+// clientInfoLine is one line of CLIENT LIST
+func (s *Server) clientInfoLine(c *client) string {
+	now := time.Now()
+	channels, patterns := s.pubsub.counts(c)
+
+	flags := ""
+	switch {
+	case s.clientType(c) == "replica":
+		flags += "S"
+	case s.monitors.has(c):
+		flags += "O"
+	case c.blocked.Load():
+		flags += "b"
+	}
+
+	c.infoMu.Lock()
+	name, user, cmd, idle, multi, db := c.name, c.user, c.lastCommand, now.Sub(c.lastActive), c.multi, c.db
+	resp := c.protocolVersion()
+	c.infoMu.Unlock()
+	if multi >= 0 {
+		flags += "x"
+	}
+	if flags == "" {
+		flags = "N"
+	}
+
+	laddr := ""
+	if c.conn != nil {
+		laddr = c.conn.LocalAddr().String()
+	}
+	return fmt.Sprintf("id=%d addr=%s laddr=%s name=%s age=%d idle=%d flags=%s db=%d sub=%d psub=%d multi=%d cmd=%s user=%s resp=%d",
+		c.id, c.addr, laddr, name, int64(now.Sub(c.createdAt).Seconds()), int64(idle.Seconds()),
+		flags, db, channels, patterns, multi, cmd, user, resp)
+}
+
+// CLIENT LIST [TYPE normal|replica|pubsub] [ID id [id ...]]
+func (s *Server) clientList(opts []string) protocol.RESPValue {
+	kind := ""
+	var ids map[int64]bool
+	for i := 0; i < len(opts); i++ {
+		switch strings.ToUpper(opts[i]) {
+		case "TYPE":
+			if i+1 >= len(opts) {
+				return protocol.Error{Message: "ERR syntax error"}
+			}
+			var ok bool
+			if kind, ok = validClientType(opts[i+1]); !ok {
+				return protocol.Error{Message: "ERR Unknown client type '" + opts[i+1] + "'"}
+			}
+			i++
+		case "ID":
+			if i+1 >= len(opts) {
+				return protocol.Error{Message: "ERR syntax error"}
+			}
+			ids = make(map[int64]bool)
+			for i++; i < len(opts); i++ {
+				id, err := strconv.ParseInt(opts[i], 10, 64)
+				if err != nil || id <= 0 {
+					return protocol.Error{Message: "ERR Invalid client ID"}
+				}
+				ids[id] = true
+			}
+		default:
+			return protocol.Error{Message: "ERR syntax error"}
+		}
+	}
+
+	var out strings.Builder
+	for _, other := range s.sortedClients() {
+		if kind != "" && s.clientType(other) != kind {
+			continue
+		}
+		if ids != nil && !ids[other.id] {
+			continue
+		}
+		out.WriteString(s.clientInfoLine(other) + "\n")
+	}
+	return protocol.Verbatim{Format: "txt", Value: out.String()}
+}
+
+// CLIENT KILL addr (old form, replies OK) or
+// CLIENT KILL [ID id] [ADDR addr] [LADDR addr] [TYPE type] [SKIPME yes|no]
+// (replies with the number of clients killed)
+func (s *Server) clientKill(c *client, opts []string) protocol.RESPValue {
+	if len(opts) == 1 {
+		for _, other := range s.sortedClients() {
+			if other.addr == opts[0] {
+				s.kill(c, other)
+				return protocol.SimpleString{Value: "OK"}
+			}
+		}
+		return protocol.Error{Message: "ERR No such client"}
+	}
+	if len(opts) == 0 || len(opts)%2 != 0 {
+		return protocol.Error{Message: "ERR syntax error"}
+	}
+
+	var id int64
+	addr, laddr, kind := "", "", ""
+	skipMe := true
+	for i := 0; i < len(opts); i += 2 {
+		value := opts[i+1]
+		switch strings.ToUpper(opts[i]) {
+		case "ID":
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || parsed <= 0 {
+				return protocol.Error{Message: "ERR client-id should be greater than 0"}
+			}
+			id = parsed
+		case "ADDR":
+			addr = value
+		case "LADDR":
+			laddr = value
+		case "TYPE":
+			var ok bool
+			if kind, ok = validClientType(value); !ok {
+				return protocol.Error{Message: "ERR Unknown client type '" + value + "'"}
+			}
+		case "SKIPME":
+			yes, err := parseYesNo(value)
+			if err != nil {
+				return protocol.Error{Message: "ERR syntax error"}
+			}
+			skipMe = yes
+		default:
+			return protocol.Error{Message: "ERR syntax error"}
+		}
+	}
+
+	killed := int64(0)
+	for _, other := range s.sortedClients() {
+		switch {
+		case id != 0 && other.id != id,
+			addr != "" && other.addr != addr,
+			laddr != "" && other.conn.LocalAddr().String() != laddr,
+			kind != "" && s.clientType(other) != kind,
+			skipMe && other == c:
+			continue
+		}
+		s.kill(c, other)
+		killed++
+	}
+	return protocol.Integer{Value: killed}
+}
+
+// kill disconnects target. Killing yourself still gets the reply out first.
+func (s *Server) kill(self, target *client) {
+	if target == self {
+		self.closeAfterReply = true
+		return
+	}
+	target.conn.Close()
+}
@@ -0,0 +1,260 @@
+package server
+
+import (
+	"cli-t/internal/tools/redis/protocol"
+
+	"sort"
+	"strconv"
+)
+
+// HSET key field value [field value ...]
+func (s *Server) handleHSet(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if len(args) < 4 || len(args)%2 != 0 {
+		return wrongArgs("hset")
+	}
+
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	fields := make(map[string]string, (len(strs)-2)/2)
+	for i := 2; i < len(strs); i += 2 {
+		fields[strs[i]] = strs[i+1] // later duplicates win, like redis
+	}
+
+	added, err := s.db(c).HSet(strs[1], fields)
+	if err != nil {
+		return errorReply(err)
+	}
+	return protocol.Integer{Value: added}
+}
+
+// HMSET key field value [field value ...] (deprecated alias of HSET replying OK)
+func (s *Server) handleHMSet(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if len(args) < 4 || len(args)%2 != 0 {
+		return wrongArgs("hmset")
+	}
+
+	reply := s.handleHSet(c, args)
+	if _, isErr := reply.(protocol.Error); isErr {
+		return reply
+	}
+	return protocol.SimpleString{Value: "OK"}
+}
+
+// HSETNX key field value
+func (s *Server) handleHSetNX(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if len(args) != 4 {
+		return wrongArgs("hsetnx")
+	}
+
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	set, err := s.db(c).HSetNX(strs[1], strs[2], strs[3])
+	if err != nil {
+		return errorReply(err)
+	}
+	return boolInteger(set)
+}
+
+// HGET key field
+func (s *Server) handleHGet(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if len(args) != 3 {
+		return wrongArgs("hget")
+	}
+
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	value, found, err := s.db(c).HGet(strs[1], strs[2])
+	if err != nil {
+		return errorReply(err)
+	}
+	if !found {
+		return protocol.BulkString{IsNull: true}
+	}
+	return protocol.BulkString{Value: value}
+}
+
+// HMGET key field [field ...]
+func (s *Server) handleHMGet(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if len(args) < 3 {
+		return wrongArgs("hmget")
+	}
+
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	// One snapshot so all fields come from the same version of the hash
+	hash, err := s.db(c).HGetAll(strs[1])
+	if err != nil {
+		return errorReply(err)
+	}
+
+	elements := make([]protocol.RESPValue, 0, len(strs)-2)
+	for _, field := range strs[2:] {
+		if value, found := hash[field]; found {
+			elements = append(elements, protocol.BulkString{Value: value})
+		} else {
+			elements = append(elements, protocol.BulkString{IsNull: true})
+		}
+	}
+	return protocol.Array{Elements: elements}
+}
+
+// HGETALL key → [field1, value1, field2, value2, ...]
+func (s *Server) handleHGetAll(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if len(args) != 2 {
+		return wrongArgs("hgetall")
+	}
+
+	key, ok := args[1].(protocol.BulkString)
+	if !ok {
+		return protocol.Error{Message: "ERR key must be a string"}
+	}
+
+	hash, err := s.db(c).HGetAll(key.Value)
+	if err != nil {
+		return errorReply(err)
+	}
+
+	// Sorted so the reply matches HKEYS/HVALS ordering
+	entries := make([]protocol.MapEntry, 0, len(hash))
+	for _, field := range sortedKeys(hash) {
+		entries = append(entries, protocol.MapEntry{
+			Key:   protocol.BulkString{Value: field},
+			Value: protocol.BulkString{Value: hash[field]},
+		})
+	}
+	return protocol.Map{Entries: entries}
+}
+
+// HDEL key field [field ...]
+func (s *Server) handleHDel(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if len(args) < 3 {
+		return wrongArgs("hdel")
+	}
+
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	removed, err := s.db(c).HDel(strs[1], strs[2:]...)
+	if err != nil {
+		return errorReply(err)
+	}
+	return protocol.Integer{Value: removed}
+}
+
+// HINCRBY key field increment
+func (s *Server) handleHIncrBy(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if len(args) != 4 {
+		return wrongArgs("hincrby")
+	}
+
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	delta, err := strconv.ParseInt(strs[3], 10, 64)
+	if err != nil {
+		return protocol.Error{Message: "ERR value is not an integer or out of range"}
+	}
+
+	newValue, err := s.db(c).HIncrBy(strs[1], strs[2], delta)
+	if err != nil {
+		return errorReply(err)
+	}
+	return protocol.Integer{Value: newValue}
+}
+
+// HKEYS key
+func (s *Server) handleHKeys(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if len(args) != 2 {
+		return wrongArgs("hkeys")
+	}
+
+	key, ok := args[1].(protocol.BulkString)
+	if !ok {
+		return protocol.Error{Message: "ERR key must be a string"}
+	}
+
+	fields, err := s.db(c).HKeys(key.Value)
+	if err != nil {
+		return errorReply(err)
+	}
+	return stringArray(fields)
+}
+
+// HVALS key
+func (s *Server) handleHVals(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if len(args) != 2 {
+		return wrongArgs("hvals")
+	}
+
+	key, ok := args[1].(protocol.BulkString)
+	if !ok {
+		return protocol.Error{Message: "ERR key must be a string"}
+	}
+
+	values, err := s.db(c).HVals(key.Value)
+	if err != nil {
+		return errorReply(err)
+	}
+	return stringArray(values)
+}
+
+// HLEN key
+func (s *Server) handleHLen(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if len(args) != 2 {
+		return wrongArgs("hlen")
+	}
+
+	key, ok := args[1].(protocol.BulkString)
+	if !ok {
+		return protocol.Error{Message: "ERR key must be a string"}
+	}
+
+	length, err := s.db(c).HLen(key.Value)
+	if err != nil {
+		return errorReply(err)
+	}
+	return protocol.Integer{Value: length}
+}
+
+// HEXISTS key field
+func (s *Server) handleHExists(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if len(args) != 3 {
+		return wrongArgs("hexists")
+	}
+
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	exists, err := s.db(c).HExists(strs[1], strs[2])
+	if err != nil {
+		return errorReply(err)
+	}
+	return boolInteger(exists)
+}
+
+func sortedKeys(hash map[string]string) []string {
+	keys := make([]string, 0, len(hash))
+	for k := range hash {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,237 @@
+package server
+
+import (
+	inmemory "cli-t/internal/shared/store/inmemory"
+	"cli-t/internal/tools/redis/protocol"
+
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KEYS pattern
+func (s *Server) handleKeys(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	pattern, ok := args[1].(protocol.BulkString)
+	if !ok {
+		return protocol.Error{Message: "ERR pattern must be a string"}
+	}
+	return stringArray(s.db(c).Keys(pattern.Value))
+}
+
+// SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+func (s *Server) handleScan(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	cursor, err := strconv.ParseUint(strs[1], 10, 64)
+	if err != nil {
+		return protocol.Error{Message: "ERR invalid cursor"}
+	}
+
+	opts := inmemory.ScanOptions{Count: 10}
+	for i := 2; i < len(strs); i += 2 {
+		if i+1 >= len(strs) {
+			return protocol.Error{Message: "ERR syntax error"}
+		}
+		switch strings.ToUpper(strs[i]) {
+		case "MATCH":
+			opts.Match = strs[i+1]
+		case "COUNT":
+			count, err := strconv.Atoi(strs[i+1])
+			if err != nil {
+				return protocol.Error{Message: "ERR value is not an integer or out of range"}
+			}
+			if count < 1 {
+				return protocol.Error{Message: "ERR syntax error"}
+			}
+			opts.Count = count
+		case "TYPE":
+			opts.Type = inmemory.ValueType(strings.ToLower(strs[i+1]))
+		default:
+			return protocol.Error{Message: "ERR syntax error"}
+		}
+	}
+
+	keys, next := s.db(c).Scan(cursor, opts)
+	return protocol.Array{Elements: []protocol.RESPValue{
+		protocol.BulkString{Value: strconv.FormatUint(next, 10)},
+		stringArray(keys),
+	}}
+}
+
+// TYPE key
+func (s *Server) handleType(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	key, ok := args[1].(protocol.BulkString)
+	if !ok {
+		return protocol.Error{Message: "ERR key must be a string"}
+	}
+
+	typ, exists := s.db(c).Type(key.Value)
+	if !exists {
+		return protocol.SimpleString{Value: "none"}
+	}
+	return protocol.SimpleString{Value: string(typ)}
+}
+
+// RENAME key newkey
+func (s *Server) handleRename(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	if _, err := s.db(c).Rename(strs[1], strs[2], false); err != nil {
+		return errorReply(err)
+	}
+	return protocol.SimpleString{Value: "OK"}
+}
+
+// RENAMENX key newkey
+func (s *Server) handleRenameNX(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	renamed, err := s.db(c).Rename(strs[1], strs[2], true)
+	if err != nil {
+		return errorReply(err)
+	}
+	return boolInteger(renamed)
+}
+
+// COPY source destination [DB destination-db] [REPLACE]
+func (s *Server) handleCopy(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	replace := false
+	for i := 3; i < len(strs); i++ {
+		switch strings.ToUpper(strs[i]) {
+		case "REPLACE":
+			replace = true
+		case "DB":
+			// Only the default database exists
+			if i+1 >= len(strs) {
+				return protocol.Error{Message: "ERR syntax error"}
+			}
+			if strs[i+1] != "0" {
+				return protocol.Error{Message: "ERR DB index is out of range"}
+			}
+			i++
+		default:
+			return protocol.Error{Message: "ERR syntax error"}
+		}
+	}
+
+	return boolInteger(s.db(c).Copy(strs[1], strs[2], replace))
+}
+
+// PERSIST key
+func (s *Server) handlePersist(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	key, ok := args[1].(protocol.BulkString)
+	if !ok {
+		return protocol.Error{Message: "ERR key must be a string"}
+	}
+	return boolInteger(s.db(c).Persist(key.Value))
+}
+
+// PEXPIRE key milliseconds
+func (s *Server) handlePExpire(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	return s.expireAt(c, args, "pexpire", time.Millisecond, false)
+}
+
+// EXPIREAT key unix-time-seconds
+func (s *Server) handleExpireAt(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	return s.expireAt(c, args, "expireat", time.Second, true)
+}
+
+// PEXPIREAT key unix-time-milliseconds
+func (s *Server) handlePExpireAt(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	return s.expireAt(c, args, "pexpireat", time.Millisecond, true)
+}
+
+// expireAt handles the EXPIRE family: the integer argument counts units,
+// either from now or from the unix epoch (absolute)
+func (s *Server) expireAt(c *client, args []protocol.RESPValue, cmd string, unit time.Duration, absolute bool) protocol.RESPValue {
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	n, err := strconv.ParseInt(strs[2], 10, 64)
+	if err != nil {
+		return protocol.Error{Message: "ERR value is not an integer or out of range"}
+	}
+	if n > math.MaxInt64/int64(unit) || n < math.MinInt64/int64(unit) {
+		return protocol.Error{Message: "ERR invalid expire time in '" + cmd + "' command"}
+	}
+
+	var at time.Time
+	if absolute {
+		at = time.Unix(0, 0).Add(time.Duration(n) * unit)
+	} else {
+		at = time.Now().Add(time.Duration(n) * unit)
+	}
+	return boolInteger(s.db(c).SetExpiryAt(strs[1], at))
+}
+
+// PTTL key
+func (s *Server) handlePTtl(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	key, ok := args[1].(protocol.BulkString)
+	if !ok {
+		return protocol.Error{Message: "ERR key must be a string"}
+	}
+	return protocol.Integer{Value: s.db(c).GetPTTL(key.Value)}
+}
+
+// RANDOMKEY
+func (s *Server) handleRandomKey(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	key, found := s.db(c).RandomKey()
+	if !found {
+		return protocol.BulkString{IsNull: true}
+	}
+	return protocol.BulkString{Value: key}
+}
+
+// DBSIZE
+func (s *Server) handleDBSize(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	return protocol.Integer{Value: int64(s.db(c).DBSize())}
+}
+
+// FLUSHDB [ASYNC|SYNC]: empties the selected database
+func (s *Server) handleFlushDB(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if !validFlushArgs(args) {
+		return protocol.Error{Message: "ERR syntax error"}
+	}
+	s.db(c).Flush()
+	return protocol.SimpleString{Value: "OK"}
+}
+
+// FLUSHALL [ASYNC|SYNC]: empties every database
+func (s *Server) handleFlushAll(args []protocol.RESPValue) protocol.RESPValue {
+	if !validFlushArgs(args) {
+		return protocol.Error{Message: "ERR syntax error"}
+	}
+	for _, db := range s.dbs {
+		db.Flush()
+	}
+	return protocol.SimpleString{Value: "OK"}
+}
+
+func validFlushArgs(args []protocol.RESPValue) bool {
+	if len(args) > 2 {
+		return false
+	}
+	if len(args) == 2 {
+		// Both modes free memory the same way here, the GC does the work
+		mode, ok := args[1].(protocol.BulkString)
+		return ok && (strings.EqualFold(mode.Value, "ASYNC") || strings.EqualFold(mode.Value, "SYNC"))
+	}
+	return true
+}
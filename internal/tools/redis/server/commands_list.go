@@ -0,0 +1,298 @@
+package server
+
+import (
+	"cli-t/internal/tools/redis/protocol"
+
+	"strconv"
+	"strings"
+)
+
+var errNotPositive = protocol.Error{Message: "ERR value is out of range, must be positive"}
+
+// LPOP key [count]
+func (s *Server) handleLPop(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	return s.pop(c, args, true)
+}
+
+// RPOP key [count]
+func (s *Server) handleRPop(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	return s.pop(c, args, false)
+}
+
+func (s *Server) pop(c *client, args []protocol.RESPValue, left bool) protocol.RESPValue {
+	if len(args) > 3 {
+		if left {
+			return wrongArgs("lpop")
+		}
+		return wrongArgs("rpop")
+	}
+
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	count := 1
+	if len(strs) == 3 {
+		n, err := strconv.Atoi(strs[2])
+		if err != nil || n < 0 {
+			return errNotPositive
+		}
+		count = n
+	}
+
+	var popped []string
+	var err error
+	if left {
+		popped, err = s.db(c).LPop(strs[1], count)
+	} else {
+		popped, err = s.db(c).RPop(strs[1], count)
+	}
+	if err != nil {
+		return errorReply(err)
+	}
+
+	// With a count the reply is always an array
+	if len(strs) == 3 {
+		if popped == nil {
+			return protocol.Array{IsNull: true}
+		}
+		return stringArray(popped)
+	}
+	if len(popped) == 0 {
+		return protocol.BulkString{IsNull: true}
+	}
+	return protocol.BulkString{Value: popped[0]}
+}
+
+// LLEN key
+func (s *Server) handleLLen(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	key, ok := args[1].(protocol.BulkString)
+	if !ok {
+		return protocol.Error{Message: "ERR key must be a string"}
+	}
+
+	length, err := s.db(c).LLen(key.Value)
+	if err != nil {
+		return errorReply(err)
+	}
+	return protocol.Integer{Value: length}
+}
+
+// LINDEX key index
+func (s *Server) handleLIndex(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	index, err := strconv.Atoi(strs[2])
+	if err != nil {
+		return protocol.Error{Message: "ERR value is not an integer or out of range"}
+	}
+
+	element, found, err := s.db(c).LIndex(strs[1], index)
+	if err != nil {
+		return errorReply(err)
+	}
+	if !found {
+		return protocol.BulkString{IsNull: true}
+	}
+	return protocol.BulkString{Value: element}
+}
+
+// LSET key index element
+func (s *Server) handleLSet(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	index, err := strconv.Atoi(strs[2])
+	if err != nil {
+		return protocol.Error{Message: "ERR value is not an integer or out of range"}
+	}
+
+	if err := s.db(c).LSet(strs[1], index, strs[3]); err != nil {
+		return errorReply(err)
+	}
+	return protocol.SimpleString{Value: "OK"}
+}
+
+// LREM key count element
+func (s *Server) handleLRem(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	count, err := strconv.Atoi(strs[2])
+	if err != nil {
+		return protocol.Error{Message: "ERR value is not an integer or out of range"}
+	}
+
+	removed, err := s.db(c).LRem(strs[1], count, strs[3])
+	if err != nil {
+		return errorReply(err)
+	}
+	return protocol.Integer{Value: removed}
+}
+
+// LTRIM key start stop
+func (s *Server) handleLTrim(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	start, err1 := strconv.Atoi(strs[2])
+	stop, err2 := strconv.Atoi(strs[3])
+	if err1 != nil || err2 != nil {
+		return protocol.Error{Message: "ERR value is not an integer or out of range"}
+	}
+
+	if err := s.db(c).LTrim(strs[1], start, stop); err != nil {
+		return errorReply(err)
+	}
+	return protocol.SimpleString{Value: "OK"}
+}
+
+// LINSERT key BEFORE|AFTER pivot element
+func (s *Server) handleLInsert(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	var before bool
+	switch strings.ToUpper(strs[2]) {
+	case "BEFORE":
+		before = true
+	case "AFTER":
+		before = false
+	default:
+		return protocol.Error{Message: "ERR syntax error"}
+	}
+
+	length, err := s.db(c).LInsert(strs[1], before, strs[3], strs[4])
+	if err != nil {
+		return errorReply(err)
+	}
+	return protocol.Integer{Value: length}
+}
+
+// LMOVE source destination LEFT|RIGHT LEFT|RIGHT
+func (s *Server) handleLMove(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	fromLeft, ok1 := parseDirection(strs[3])
+	toLeft, ok2 := parseDirection(strs[4])
+	if !ok1 || !ok2 {
+		return protocol.Error{Message: "ERR syntax error"}
+	}
+
+	element, moved, err := s.db(c).LMove(strs[1], strs[2], fromLeft, toLeft)
+	if err != nil {
+		return errorReply(err)
+	}
+	if !moved {
+		return protocol.BulkString{IsNull: true}
+	}
+	return protocol.BulkString{Value: element}
+}
+
+// BLPOP key [key ...] timeout
+func (s *Server) handleBLPop(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	return s.blockingPop(c, args, true)
+}
+
+// BRPOP key [key ...] timeout
+func (s *Server) handleBRPop(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	return s.blockingPop(c, args, false)
+}
+
+// blockingPop pops from the first non-empty key, in argument order
+func (s *Server) blockingPop(c *client, args []protocol.RESPValue, left bool) protocol.RESPValue {
+	keys, ok := bulkStrings(args[1 : len(args)-1])
+	if !ok {
+		return protocol.Error{Message: "ERR key must be a string"}
+	}
+	timeout, err := parseTimeout(args[len(args)-1])
+	if err != nil {
+		return errorReply(err)
+	}
+
+	popCmd := "RPOP"
+	if left {
+		popCmd = "LPOP"
+	}
+
+	return s.serveBlocking(c, keys, timeout, protocol.Array{IsNull: true}, func() (protocol.RESPValue, bool) {
+		for _, key := range keys {
+			var popped []string
+			var err error
+			if left {
+				popped, err = s.db(c).LPop(key, 1)
+			} else {
+				popped, err = s.db(c).RPop(key, 1)
+			}
+			if err != nil {
+				return errorReply(err), true
+			}
+			if len(popped) == 0 {
+				continue
+			}
+
+			// Replays as the non-blocking pop that actually happened
+			s.alsoPropagate(c, []string{popCmd, key})
+			return stringArray([]string{key, popped[0]}), true
+		}
+		return nil, false
+	})
+}
+
+// BLMOVE source destination LEFT|RIGHT LEFT|RIGHT timeout
+func (s *Server) handleBLMove(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	strs, ok := bulkStrings(args[:5])
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	fromLeft, ok1 := parseDirection(strs[3])
+	toLeft, ok2 := parseDirection(strs[4])
+	if !ok1 || !ok2 {
+		return protocol.Error{Message: "ERR syntax error"}
+	}
+	timeout, err := parseTimeout(args[5])
+	if err != nil {
+		return errorReply(err)
+	}
+
+	src, dst := strs[1], strs[2]
+	return s.serveBlocking(c, []string{src}, timeout, protocol.BulkString{IsNull: true}, func() (protocol.RESPValue, bool) {
+		element, moved, err := s.db(c).LMove(src, dst, fromLeft, toLeft)
+		if err != nil {
+			return errorReply(err), true
+		}
+		if !moved {
+			return nil, false
+		}
+
+		s.alsoPropagate(c, []string{"LMOVE", src, dst, strings.ToUpper(strs[3]), strings.ToUpper(strs[4])})
+		return protocol.BulkString{Value: element}, true
+	})
+}
+
+// parseDirection parses LEFT/RIGHT, returning true for LEFT
+func parseDirection(arg string) (left bool, ok bool) {
+	switch strings.ToUpper(arg) {
+	case "LEFT":
+		return true, true
+	case "RIGHT":
+		return false, true
+	}
+	return false, false
+}
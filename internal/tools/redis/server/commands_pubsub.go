@@ -0,0 +1,166 @@
+package server
+
+import (
+	"cli-t/internal/tools/redis/protocol"
+
+	"strings"
+)
+
+// Commands a client may still send once it has subscriptions
+var allowedWhileSubscribed = map[string]bool{
+	"SUBSCRIBE":    true,
+	"PSUBSCRIBE":   true,
+	"UNSUBSCRIBE":  true,
+	"PUNSUBSCRIBE": true,
+	"PING":         true,
+	"QUIT":         true,
+}
+
+// SUBSCRIBE channel [channel ...]
+func (s *Server) handleSubscribe(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if len(args) < 2 {
+		return wrongArgs("subscribe")
+	}
+
+	channels, ok := bulkStrings(args[1:])
+	if !ok {
+		return protocol.Error{Message: "ERR channel must be a string"}
+	}
+
+	replies := make(multiReply, 0, len(channels))
+	for _, channel := range channels {
+		count := s.pubsub.subscribe(c, channel)
+		replies = append(replies, subscriptionReply("subscribe", channel, count))
+	}
+	return replies
+}
+
+// PSUBSCRIBE pattern [pattern ...]
+func (s *Server) handlePSubscribe(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if len(args) < 2 {
+		return wrongArgs("psubscribe")
+	}
+
+	patterns, ok := bulkStrings(args[1:])
+	if !ok {
+		return protocol.Error{Message: "ERR pattern must be a string"}
+	}
+
+	replies := make(multiReply, 0, len(patterns))
+	for _, pattern := range patterns {
+		count := s.pubsub.psubscribe(c, pattern)
+		replies = append(replies, subscriptionReply("psubscribe", pattern, count))
+	}
+	return replies
+}
+
+// UNSUBSCRIBE [channel ...] (no arguments = all channels)
+func (s *Server) handleUnsubscribe(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	return s.unsubscribeReplies(c, args, false)
+}
+
+// PUNSUBSCRIBE [pattern ...] (no arguments = all patterns)
+func (s *Server) handlePUnsubscribe(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	return s.unsubscribeReplies(c, args, true)
+}
+
+func (s *Server) unsubscribeReplies(c *client, args []protocol.RESPValue, patterns bool) protocol.RESPValue {
+	kind := "unsubscribe"
+	remove := s.pubsub.unsubscribe
+	if patterns {
+		kind = "punsubscribe"
+		remove = s.pubsub.punsubscribe
+	}
+
+	names, ok := bulkStrings(args[1:])
+	if !ok {
+		return protocol.Error{Message: "ERR channel must be a string"}
+	}
+	if len(names) == 0 {
+		names = s.pubsub.subscriptions(c, patterns)
+	}
+
+	// Nothing to unsubscribe from still gets one reply with a null name
+	if len(names) == 0 {
+		return protocol.Push{Elements: []protocol.RESPValue{
+			protocol.BulkString{Value: kind},
+			protocol.BulkString{IsNull: true},
+			protocol.Integer{Value: int64(s.pubsub.subscriptionCount(c))},
+		}}
+	}
+
+	replies := make(multiReply, 0, len(names))
+	for _, name := range names {
+		count := remove(c, name)
+		replies = append(replies, subscriptionReply(kind, name, count))
+	}
+	return replies
+}
+
+// PUBLISH channel message
+func (s *Server) handlePublish(args []protocol.RESPValue) protocol.RESPValue {
+	if len(args) != 3 {
+		return wrongArgs("publish")
+	}
+
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	receivers := s.pubsub.publish(strs[1], strs[2])
+	return protocol.Integer{Value: int64(receivers)}
+}
+
+// PUBSUB CHANNELS [pattern] | NUMSUB [channel ...] | NUMPAT
+func (s *Server) handlePubSub(args []protocol.RESPValue) protocol.RESPValue {
+	if len(args) < 2 {
+		return wrongArgs("pubsub")
+	}
+
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	sub := strings.ToUpper(strs[1])
+	switch {
+	case sub == "CHANNELS" && len(strs) <= 3:
+		pattern := ""
+		if len(strs) == 3 {
+			pattern = strs[2]
+		}
+		return stringArray(s.pubsub.activeChannels(pattern))
+
+	case sub == "NUMSUB":
+		entries := make([]protocol.MapEntry, 0, len(strs)-2)
+		for _, channel := range strs[2:] {
+			entries = append(entries, protocol.MapEntry{
+				Key:   protocol.BulkString{Value: channel},
+				Value: protocol.Integer{Value: int64(s.pubsub.numSub(channel))},
+			})
+		}
+		return protocol.Map{Entries: entries}
+
+	case sub == "NUMPAT" && len(strs) == 2:
+		return protocol.Integer{Value: int64(s.pubsub.numPat())}
+
+	default:
+		return protocol.Error{Message: "ERR unknown subcommand or wrong number of arguments for '" + strs[1] + "'. Try PUBSUB HELP."}
+	}
+}
+
+// QUIT replies OK and closes the connection
+func (s *Server) handleQuit(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	c.closeAfterReply = true
+	return protocol.SimpleString{Value: "OK"}
+}
+
+// ["subscribe", channel, count] style confirmation
+func subscriptionReply(kind, name string, count int) protocol.Push {
+	return protocol.Push{Elements: []protocol.RESPValue{
+		protocol.BulkString{Value: kind},
+		protocol.BulkString{Value: name},
+		protocol.Integer{Value: int64(count)},
+	}}
+}
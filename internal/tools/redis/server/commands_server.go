@@ -0,0 +1,93 @@
+package server
+
+import (
+	"cli-t/internal/tools/redis/protocol"
+
+	"sort"
+	"strings"
+)
+
+// COMMAND | COMMAND COUNT | COMMAND LIST | COMMAND INFO name ... | COMMAND DOCS
+func (s *Server) handleCommandInfo(args []protocol.RESPValue) protocol.RESPValue {
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR syntax error"}
+	}
+	if len(strs) == 1 {
+		return commandInfoArray(sortedCommandNames())
+	}
+
+	switch sub := strings.ToUpper(strs[1]); sub {
+	case "COUNT":
+		return protocol.Integer{Value: int64(len(commandTable))}
+	case "LIST":
+		return stringArray(sortedCommandNames())
+	case "INFO":
+		if len(strs) == 2 {
+			return commandInfoArray(sortedCommandNames())
+		}
+		return commandInfoArray(strs[2:])
+	case "DOCS":
+		// No docs to offer; an empty reply tells clients to do without
+		return protocol.Array{Elements: []protocol.RESPValue{}}
+	default:
+		return protocol.Error{Message: "ERR unknown subcommand '" + strs[1] + "'. Try COMMAND HELP."}
+	}
+}
+
+func sortedCommandNames() []string {
+	names := make([]string, 0, len(commandTable))
+	for _, spec := range commandTable {
+		names = append(names, spec.name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// commandInfoArray describes each command, unknown ones as a null array
+func commandInfoArray(names []string) protocol.Array {
+	infos := make([]protocol.RESPValue, len(names))
+	for i, name := range names {
+		spec, found := commandTable[strings.ToUpper(name)]
+		if !found {
+			infos[i] = protocol.Array{IsNull: true}
+			continue
+		}
+		infos[i] = spec.info()
+	}
+	return protocol.Array{Elements: infos}
+}
+
+// info is the COMMAND INFO entry of redis 7: name, arity, flags, key
+// positions, then ACL categories, tips, key specs and subcommands (empty)
+func (spec *commandSpec) info() protocol.Array {
+	var flags []protocol.RESPValue
+	addFlag := func(flag string) {
+		flags = append(flags, protocol.SimpleString{Value: flag})
+	}
+	if spec.write {
+		addFlag("write")
+	} else if spec.hasKeys() {
+		addFlag("readonly")
+	}
+	if spec.denyOOM {
+		addFlag("denyoom")
+	}
+	if spec.blocking {
+		addFlag("blocking")
+	}
+	if spec.keys != nil {
+		addFlag("movablekeys")
+	}
+
+	empty := protocol.Array{Elements: []protocol.RESPValue{}}
+	return protocol.Array{Elements: []protocol.RESPValue{
+		protocol.BulkString{Value: spec.name},
+		protocol.Integer{Value: int64(spec.arity)},
+		protocol.Array{Elements: append([]protocol.RESPValue{}, flags...)},
+		protocol.Integer{Value: int64(spec.firstKey)},
+		protocol.Integer{Value: int64(spec.lastKey)},
+		protocol.Integer{Value: int64(spec.keyStep)},
+		empty, empty, empty, empty,
+	}}
+}
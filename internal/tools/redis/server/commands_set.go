@@ -0,0 +1,127 @@
+package server
+
+import (
+	"cli-t/internal/tools/redis/protocol"
+)
+
+// SADD key member [member ...]
+func (s *Server) handleSAdd(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if len(args) < 3 {
+		return wrongArgs("sadd")
+	}
+
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	added, err := s.db(c).SAdd(strs[1], strs[2:]...)
+	if err != nil {
+		return errorReply(err)
+	}
+	return protocol.Integer{Value: added}
+}
+
+// SREM key member [member ...]
+func (s *Server) handleSRem(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if len(args) < 3 {
+		return wrongArgs("srem")
+	}
+
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	removed, err := s.db(c).SRem(strs[1], strs[2:]...)
+	if err != nil {
+		return errorReply(err)
+	}
+	return protocol.Integer{Value: removed}
+}
+
+// SMEMBERS key
+func (s *Server) handleSMembers(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if len(args) != 2 {
+		return wrongArgs("smembers")
+	}
+
+	key, ok := args[1].(protocol.BulkString)
+	if !ok {
+		return protocol.Error{Message: "ERR key must be a string"}
+	}
+
+	members, err := s.db(c).SMembers(key.Value)
+	if err != nil {
+		return errorReply(err)
+	}
+	return stringSet(members)
+}
+
+// SISMEMBER key member
+func (s *Server) handleSIsMember(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if len(args) != 3 {
+		return wrongArgs("sismember")
+	}
+
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	isMember, err := s.db(c).SIsMember(strs[1], strs[2])
+	if err != nil {
+		return errorReply(err)
+	}
+	return boolInteger(isMember)
+}
+
+// SCARD key
+func (s *Server) handleSCard(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if len(args) != 2 {
+		return wrongArgs("scard")
+	}
+
+	key, ok := args[1].(protocol.BulkString)
+	if !ok {
+		return protocol.Error{Message: "ERR key must be a string"}
+	}
+
+	count, err := s.db(c).SCard(key.Value)
+	if err != nil {
+		return errorReply(err)
+	}
+	return protocol.Integer{Value: count}
+}
+
+// SINTER key [key ...]
+func (s *Server) handleSInter(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	return s.setAlgebra("sinter", args, s.db(c).SInter)
+}
+
+// SUNION key [key ...]
+func (s *Server) handleSUnion(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	return s.setAlgebra("sunion", args, s.db(c).SUnion)
+}
+
+// SDIFF key [key ...]
+func (s *Server) handleSDiff(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	return s.setAlgebra("sdiff", args, s.db(c).SDiff)
+}
+
+func (s *Server) setAlgebra(cmd string, args []protocol.RESPValue, op func(keys ...string) ([]string, error)) protocol.RESPValue {
+	if len(args) < 2 {
+		return wrongArgs(cmd)
+	}
+
+	keys, ok := bulkStrings(args[1:])
+	if !ok {
+		return protocol.Error{Message: "ERR key must be a string"}
+	}
+
+	members, err := op(keys...)
+	if err != nil {
+		return errorReply(err)
+	}
+	return stringSet(members)
+}
@@ -0,0 +1,805 @@
+package server
+
+import (
+	inmemory "cli-t/internal/shared/store/inmemory"
+	"cli-t/internal/tools/redis/protocol"
+
+	"strconv"
+	"strings"
+	"time"
+)
+
+// XADD key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold [LIMIT count]] *|id field value [field value ...]
+func (s *Server) handleXAdd(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	opts, idIndex, errReply := parseXAdd(strs)
+	if errReply != nil {
+		return errReply
+	}
+	fields := strs[idIndex+1:]
+	if len(fields) == 0 || len(fields)%2 != 0 {
+		return wrongArgs("xadd")
+	}
+
+	id, added, err := s.db(c).XAdd(strs[1], strs[idIndex], fields, opts)
+	if err != nil {
+		return errorReply(err)
+	}
+	if !added {
+		return protocol.BulkString{IsNull: true}
+	}
+	return protocol.BulkString{Value: id.String()}
+}
+
+// parseXAdd parses the options between the key and the ID, returns them
+// with the index of the ID argument
+func parseXAdd(strs []string) (inmemory.XAddOptions, int, protocol.RESPValue) {
+	var opts inmemory.XAddOptions
+	for i := 2; i < len(strs); i++ {
+		switch strings.ToUpper(strs[i]) {
+		case "NOMKSTREAM":
+			opts.NoMkStream = true
+		case "MAXLEN", "MINID":
+			trim, next, errReply := parseStreamTrim(strs, i)
+			if errReply != nil {
+				return opts, 0, errReply
+			}
+			opts.Trim = &trim
+			i = next - 1
+		default:
+			return opts, i, nil
+		}
+	}
+	return opts, 0, wrongArgs("xadd")
+}
+
+// parseStreamTrim parses MAXLEN|MINID [=|~] threshold [LIMIT count] at
+// strs[i], returns the index after it. LIMIT only bounds approximate
+// trimming, which is always exact here, so it's checked and ignored.
+func parseStreamTrim(strs []string, i int) (inmemory.StreamTrim, int, protocol.RESPValue) {
+	trim := inmemory.StreamTrim{ByID: strings.ToUpper(strs[i]) == "MINID"}
+	i++
+	if i < len(strs) && (strs[i] == "=" || strs[i] == "~") {
+		i++
+	}
+	if i >= len(strs) {
+		return trim, i, protocol.Error{Message: "ERR syntax error"}
+	}
+
+	if trim.ByID {
+		id, err := inmemory.ParseStreamID(strs[i], 0)
+		if err != nil {
+			return trim, i, errorReply(err)
+		}
+		trim.MinID = id
+	} else {
+		n, err := strconv.Atoi(strs[i])
+		if err != nil {
+			return trim, i, protocol.Error{Message: "ERR value is not an integer or out of range"}
+		}
+		if n < 0 {
+			return trim, i, protocol.Error{Message: "ERR The MAXLEN argument must be >= 0."}
+		}
+		trim.MaxLen = n
+	}
+	i++
+
+	if i+1 < len(strs) && strings.ToUpper(strs[i]) == "LIMIT" {
+		if _, err := strconv.Atoi(strs[i+1]); err != nil {
+			return trim, i, protocol.Error{Message: "ERR value is not an integer or out of range"}
+		}
+		i += 2
+	}
+	return trim, i, nil
+}
+
+// XTRIM key MAXLEN|MINID [=|~] threshold [LIMIT count]
+func (s *Server) handleXTrim(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	if mode := strings.ToUpper(strs[2]); mode != "MAXLEN" && mode != "MINID" {
+		return protocol.Error{Message: "ERR syntax error"}
+	}
+	trim, next, errReply := parseStreamTrim(strs, 2)
+	if errReply != nil {
+		return errReply
+	}
+	if next != len(strs) {
+		return protocol.Error{Message: "ERR syntax error"}
+	}
+
+	trimmed, err := s.db(c).XTrim(strs[1], trim)
+	if err != nil {
+		return errorReply(err)
+	}
+	return protocol.Integer{Value: trimmed}
+}
+
+// XLEN key
+func (s *Server) handleXLen(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	key, ok := args[1].(protocol.BulkString)
+	if !ok {
+		return protocol.Error{Message: "ERR key must be a string"}
+	}
+
+	n, err := s.db(c).XLen(key.Value)
+	if err != nil {
+		return errorReply(err)
+	}
+	return protocol.Integer{Value: n}
+}
+
+// XRANGE key start end [COUNT count]
+func (s *Server) handleXRange(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	return s.xrange(c, args, false)
+}
+
+// XREVRANGE key end start [COUNT count]
+func (s *Server) handleXRevRange(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	return s.xrange(c, args, true)
+}
+
+func (s *Server) xrange(c *client, args []protocol.RESPValue, reverse bool) protocol.RESPValue {
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	startArg, endArg := strs[2], strs[3]
+	if reverse {
+		startArg, endArg = endArg, startArg
+	}
+	start, errReply := parseRangeID(startArg, false)
+	if errReply != nil {
+		return errReply
+	}
+	end, errReply := parseRangeID(endArg, true)
+	if errReply != nil {
+		return errReply
+	}
+
+	count := 0
+	switch {
+	case len(strs) == 6 && strings.ToUpper(strs[4]) == "COUNT":
+		n, err := strconv.Atoi(strs[5])
+		if err != nil {
+			return protocol.Error{Message: "ERR value is not an integer or out of range"}
+		}
+		if n <= 0 {
+			return protocol.Array{IsNull: true} // like redis
+		}
+		count = n
+	case len(strs) != 4:
+		return protocol.Error{Message: "ERR syntax error"}
+	}
+
+	entries, err := s.db(c).XRange(strs[1], start, end, count, reverse)
+	if err != nil {
+		return errorReply(err)
+	}
+	return entryArray(entries)
+}
+
+// parseRangeID parses an XRANGE bound: an ID, "-", "+", or "(id" to leave
+// the ID itself out. A bare millisecond time covers the whole millisecond.
+func parseRangeID(arg string, end bool) (inmemory.StreamID, protocol.RESPValue) {
+	missingSeq := uint64(0)
+	if end {
+		missingSeq = inmemory.MaxStreamID.Seq
+	}
+
+	exclusive := strings.HasPrefix(arg, "(")
+	if exclusive {
+		arg = arg[1:]
+		if arg == "-" || arg == "+" {
+			return inmemory.StreamID{}, errorReply(inmemory.ErrStreamID)
+		}
+	}
+	id, err := inmemory.ParseStreamID(arg, missingSeq)
+	if err != nil {
+		return id, errorReply(err)
+	}
+	if !exclusive {
+		return id, nil
+	}
+
+	if end {
+		if id, ok := id.Prev(); ok {
+			return id, nil
+		}
+		return id, protocol.Error{Message: "ERR invalid end ID for the interval"}
+	}
+	if id, ok := id.Next(); ok {
+		return id, nil
+	}
+	return id, protocol.Error{Message: "ERR invalid start ID for the interval"}
+}
+
+// entryArray is the reply for a list of entries: [id, [field, value, ...]]
+// each, with a null array for the fields of a deleted entry
+func entryArray(entries []inmemory.StreamEntry) protocol.Array {
+	elements := make([]protocol.RESPValue, len(entries))
+	for i, entry := range entries {
+		fields := protocol.Array{IsNull: true}
+		if entry.Fields != nil {
+			fields = stringArray(entry.Fields)
+		}
+		elements[i] = protocol.Array{Elements: []protocol.RESPValue{
+			protocol.BulkString{Value: entry.ID.String()},
+			fields,
+		}}
+	}
+	return protocol.Array{Elements: elements}
+}
+
+// parseStreamIDs parses a list of exact IDs
+func parseStreamIDs(strs []string) ([]inmemory.StreamID, protocol.RESPValue) {
+	ids := make([]inmemory.StreamID, len(strs))
+	for i, arg := range strs {
+		id, err := inmemory.ParseStreamID(arg, 0)
+		if err != nil || arg == "-" || arg == "+" {
+			return nil, errorReply(inmemory.ErrStreamID)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// XDEL key id [id ...]
+func (s *Server) handleXDel(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	ids, errReply := parseStreamIDs(strs[2:])
+	if errReply != nil {
+		return errReply
+	}
+	deleted, err := s.db(c).XDel(strs[1], ids...)
+	if err != nil {
+		return errorReply(err)
+	}
+	return protocol.Integer{Value: deleted}
+}
+
+// XSETID key last-id [ENTRIESADDED entries-added] [MAXDELETEDID max-deleted-id]
+func (s *Server) handleXSetID(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	ids, errReply := parseStreamIDs(strs[2:3])
+	if errReply != nil {
+		return errReply
+	}
+	// The counters these set are only reported by XINFO, which isn't here
+	for i := 3; i < len(strs); i += 2 {
+		switch opt := strings.ToUpper(strs[i]); {
+		case i+1 >= len(strs), opt != "ENTRIESADDED" && opt != "MAXDELETEDID":
+			return protocol.Error{Message: "ERR syntax error"}
+		}
+	}
+
+	if err := s.db(c).XSetID(strs[1], ids[0]); err != nil {
+		return errorReply(err)
+	}
+	return protocol.SimpleString{Value: "OK"}
+}
+
+// streamRead is a parsed XREAD or XREADGROUP
+type streamRead struct {
+	count  int
+	block  time.Duration
+	blocks bool // BLOCK was given, 0 waits forever
+	noAck  bool
+	keys   []string
+	ids    []string
+}
+
+// parseStreamRead parses [COUNT count] [BLOCK ms] [NOACK] STREAMS key [key ...] id [id ...],
+// NOACK only for XREADGROUP
+func parseStreamRead(cmd string, strs []string) (streamRead, protocol.RESPValue) {
+	var read streamRead
+	for i := 0; i < len(strs); i++ {
+		switch flag := strings.ToUpper(strs[i]); {
+		case flag == "COUNT" && i+1 < len(strs):
+			n, err := strconv.Atoi(strs[i+1])
+			if err != nil {
+				return read, protocol.Error{Message: "ERR value is not an integer or out of range"}
+			}
+			read.count = max(n, 0)
+			i++
+		case flag == "BLOCK" && i+1 < len(strs):
+			ms, err := strconv.ParseInt(strs[i+1], 10, 64)
+			if err != nil {
+				return read, protocol.Error{Message: "ERR timeout is not an integer or out of range"}
+			}
+			if ms < 0 {
+				return read, errorReply(errTimeoutNegative)
+			}
+			read.block, read.blocks = time.Duration(ms)*time.Millisecond, true
+			i++
+		case flag == "NOACK" && cmd == "xreadgroup":
+			read.noAck = true
+		case flag == "STREAMS":
+			rest := strs[i+1:]
+			if len(rest) == 0 || len(rest)%2 != 0 {
+				return read, protocol.Error{Message: "ERR Unbalanced '" + cmd + "' list of streams: for each stream key an ID or '$' must be specified."}
+			}
+			read.keys, read.ids = rest[:len(rest)/2], rest[len(rest)/2:]
+			return read, nil
+		default:
+			return read, protocol.Error{Message: "ERR syntax error"}
+		}
+	}
+	return read, protocol.Error{Message: "ERR syntax error"}
+}
+
+// streamsKeys finds the keys of XREAD and XREADGROUP, the first half of
+// what follows STREAMS
+func streamsKeys(args []protocol.RESPValue) []string {
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return nil
+	}
+	for i := 1; i < len(strs); i++ {
+		switch strings.ToUpper(strs[i]) {
+		case "GROUP":
+			i += 2 // group and consumer, either may be called STREAMS
+		case "COUNT", "BLOCK":
+			i++
+		case "STREAMS":
+			rest := strs[i+1:]
+			return rest[:len(rest)/2]
+		}
+	}
+	return nil
+}
+
+// streamEntries are the entries read from one stream
+type streamEntries struct {
+	key     string
+	entries []inmemory.StreamEntry
+}
+
+// streamsReply is the XREAD and XREADGROUP reply: a map from key to
+// entries for RESP3, [[key, entries], ...] for RESP2
+func streamsReply(c *client, results []streamEntries) protocol.RESPValue {
+	if c.protocolVersion() == protocol.RESP3 {
+		entries := make([]protocol.MapEntry, len(results))
+		for i, result := range results {
+			entries[i] = protocol.MapEntry{Key: protocol.BulkString{Value: result.key}, Value: entryArray(result.entries)}
+		}
+		return protocol.Map{Entries: entries}
+	}
+
+	elements := make([]protocol.RESPValue, len(results))
+	for i, result := range results {
+		elements[i] = protocol.Array{Elements: []protocol.RESPValue{
+			protocol.BulkString{Value: result.key},
+			entryArray(result.entries),
+		}}
+	}
+	return protocol.Array{Elements: elements}
+}
+
+// XREAD [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+func (s *Server) handleXRead(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+	read, errReply := parseStreamRead("xread", strs[1:])
+	if errReply != nil {
+		return errReply
+	}
+
+	// "$" is the last ID when the command arrives, so waiting for it means
+	// waiting for anything added later
+	after := make([]inmemory.StreamID, len(read.keys))
+	for i, arg := range read.ids {
+		if arg != "$" {
+			id, err := inmemory.ParseStreamID(arg, 0)
+			if err != nil {
+				return errorReply(err)
+			}
+			after[i] = id
+			continue
+		}
+		last, _, err := s.db(c).XLastID(read.keys[i])
+		if err != nil {
+			return errorReply(err)
+		}
+		after[i] = last
+	}
+
+	try := func() (protocol.RESPValue, bool) {
+		var results []streamEntries
+		for i, key := range read.keys {
+			start, ok := after[i].Next()
+			if !ok {
+				continue
+			}
+			entries, err := s.db(c).XRange(key, start, inmemory.MaxStreamID, read.count, false)
+			if err != nil {
+				return errorReply(err), true
+			}
+			if len(entries) > 0 {
+				results = append(results, streamEntries{key, entries})
+			}
+		}
+		if len(results) == 0 {
+			return nil, false
+		}
+		return streamsReply(c, results), true
+	}
+
+	if read.blocks {
+		return s.serveBlocking(c, read.keys, read.block, protocol.Array{IsNull: true}, try)
+	}
+	return s.serveOnce(c, protocol.Array{IsNull: true}, try)
+}
+
+// XREADGROUP GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+func (s *Server) handleXReadGroup(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+	if strings.ToUpper(strs[1]) != "GROUP" {
+		return protocol.Error{Message: "ERR syntax error"}
+	}
+	group, consumer := strs[2], strs[3]
+	read, errReply := parseStreamRead("xreadgroup", strs[4:])
+	if errReply != nil {
+		return errReply
+	}
+
+	// Only new entries (">") are waited for; reading the history answers
+	// right away, even with nothing in it
+	onlyNew := true
+	opts := make([]inmemory.XReadGroupOptions, len(read.keys))
+	for i, arg := range read.ids {
+		opts[i] = inmemory.XReadGroupOptions{Count: read.count, NoAck: read.noAck}
+		if arg == ">" {
+			opts[i].New = true
+			continue
+		}
+		id, err := inmemory.ParseStreamID(arg, 0)
+		if err != nil {
+			return errorReply(err)
+		}
+		opts[i].After = id
+		onlyNew = false
+	}
+
+	try := func() (protocol.RESPValue, bool) {
+		var results []streamEntries
+		for i, key := range read.keys {
+			entries, err := s.db(c).XReadGroup(key, group, consumer, opts[i])
+			if err != nil {
+				return errorReply(err), true
+			}
+			if opts[i].New && len(entries) == 0 {
+				continue
+			}
+			s.propagateGroupRead(c, key, group, consumer, opts[i], entries)
+			results = append(results, streamEntries{key, entries})
+		}
+		if len(results) == 0 {
+			return nil, false
+		}
+		return streamsReply(c, results), true
+	}
+
+	if read.blocks && onlyNew {
+		return s.serveBlocking(c, read.keys, read.block, protocol.Array{IsNull: true}, try)
+	}
+	return s.serveOnce(c, protocol.Array{IsNull: true}, try)
+}
+
+// propagateGroupRead logs a consumer group read as commands with the same
+// effect, like redis: XCLAIM of the delivered entries and XGROUP SETID for
+// the group's new last ID. Replaying XREADGROUP itself could block.
+func (s *Server) propagateGroupRead(c *client, key, group, consumer string, opts inmemory.XReadGroupOptions, entries []inmemory.StreamEntry) {
+	if !opts.New || !opts.NoAck {
+		claim := []string{"XCLAIM", key, group, consumer, "0"}
+		for _, entry := range entries {
+			if entry.Fields != nil { // deleted entries stay as they are
+				claim = append(claim, entry.ID.String())
+			}
+		}
+		if len(claim) > 5 {
+			s.alsoPropagate(c, append(claim, "FORCE"))
+		}
+	}
+	if opts.New && len(entries) > 0 {
+		s.alsoPropagate(c, []string{"XGROUP", "SETID", key, group, entries[len(entries)-1].ID.String()})
+	}
+}
+
+// XGROUP CREATE|SETID|DESTROY|CREATECONSUMER|DELCONSUMER key group ...
+func (s *Server) handleXGroup(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	sub := strings.ToUpper(strs[1])
+	argc := map[string]int{"CREATE": 5, "SETID": 5, "DESTROY": 4, "CREATECONSUMER": 5, "DELCONSUMER": 5}
+	if want, known := argc[sub]; !known || len(strs) < want {
+		return protocol.Error{Message: "ERR unknown subcommand or wrong number of arguments for '" + strs[1] + "'. Try XGROUP HELP."}
+	}
+	key, group := strs[2], strs[3]
+
+	switch sub {
+	case "CREATE", "SETID":
+		mkStream := false
+		for i := 5; i < len(strs); i++ {
+			switch strings.ToUpper(strs[i]) {
+			case "MKSTREAM":
+				if sub != "CREATE" {
+					return protocol.Error{Message: "ERR syntax error"}
+				}
+				mkStream = true
+			case "ENTRIESREAD": // only reported by XINFO, which isn't here
+				if i+1 >= len(strs) {
+					return protocol.Error{Message: "ERR syntax error"}
+				}
+				i++
+			default:
+				return protocol.Error{Message: "ERR syntax error"}
+			}
+		}
+
+		var err error
+		if sub == "CREATE" {
+			err = s.db(c).XGroupCreate(key, group, strs[4], mkStream)
+		} else {
+			err = s.db(c).XGroupSetID(key, group, strs[4])
+		}
+		if err != nil {
+			return errorReply(err)
+		}
+		return protocol.SimpleString{Value: "OK"}
+
+	case "DESTROY":
+		destroyed, err := s.db(c).XGroupDestroy(key, group)
+		if err != nil {
+			return errorReply(err)
+		}
+		return boolInteger(destroyed)
+
+	case "CREATECONSUMER":
+		created, err := s.db(c).XGroupCreateConsumer(key, group, strs[4])
+		if err != nil {
+			return errorReply(err)
+		}
+		return boolInteger(created)
+
+	default: // DELCONSUMER
+		pending, err := s.db(c).XGroupDelConsumer(key, group, strs[4])
+		if err != nil {
+			return errorReply(err)
+		}
+		return protocol.Integer{Value: pending}
+	}
+}
+
+// XACK key group id [id ...]
+func (s *Server) handleXAck(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	ids, errReply := parseStreamIDs(strs[3:])
+	if errReply != nil {
+		return errReply
+	}
+	acked, err := s.db(c).XAck(strs[1], strs[2], ids...)
+	if err != nil {
+		return errorReply(err)
+	}
+	return protocol.Integer{Value: acked}
+}
+
+// XPENDING key group [[IDLE min-idle-time] start end count [consumer]]
+func (s *Server) handleXPending(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+	key, group := strs[1], strs[2]
+
+	if len(strs) == 3 {
+		summary, err := s.db(c).XPendingSummary(key, group)
+		if err != nil {
+			return errorReply(err)
+		}
+		if summary.Count == 0 {
+			return protocol.Array{Elements: []protocol.RESPValue{
+				protocol.Integer{Value: 0}, protocol.BulkString{IsNull: true},
+				protocol.BulkString{IsNull: true}, protocol.Array{IsNull: true},
+			}}
+		}
+		consumers := make([]protocol.RESPValue, len(summary.Consumers))
+		for i, consumer := range summary.Consumers {
+			consumers[i] = stringArray([]string{consumer.Name, strconv.FormatInt(consumer.Count, 10)})
+		}
+		return protocol.Array{Elements: []protocol.RESPValue{
+			protocol.Integer{Value: summary.Count},
+			protocol.BulkString{Value: summary.Min.String()},
+			protocol.BulkString{Value: summary.Max.String()},
+			protocol.Array{Elements: consumers},
+		}}
+	}
+
+	var opts inmemory.XPendingOptions
+	rest := strs[3:]
+	if strings.ToUpper(rest[0]) == "IDLE" && len(rest) > 1 {
+		ms, err := strconv.ParseInt(rest[1], 10, 64)
+		if err != nil {
+			return protocol.Error{Message: "ERR value is not an integer or out of range"}
+		}
+		opts.MinIdle = time.Duration(ms) * time.Millisecond
+		rest = rest[2:]
+	}
+	if len(rest) != 3 && len(rest) != 4 {
+		return protocol.Error{Message: "ERR syntax error"}
+	}
+
+	var errReply protocol.RESPValue
+	if opts.Start, errReply = parseRangeID(rest[0], false); errReply != nil {
+		return errReply
+	}
+	if opts.End, errReply = parseRangeID(rest[1], true); errReply != nil {
+		return errReply
+	}
+	count, err := strconv.Atoi(rest[2])
+	if err != nil {
+		return protocol.Error{Message: "ERR value is not an integer or out of range"}
+	}
+	opts.Count = max(count, 0)
+	if len(rest) == 4 {
+		opts.Consumer = rest[3]
+	}
+
+	pending, err := s.db(c).XPending(key, group, opts)
+	if err != nil {
+		return errorReply(err)
+	}
+	now := time.Now()
+	elements := make([]protocol.RESPValue, len(pending))
+	for i, pe := range pending {
+		elements[i] = protocol.Array{Elements: []protocol.RESPValue{
+			protocol.BulkString{Value: pe.ID.String()},
+			protocol.BulkString{Value: pe.Consumer},
+			protocol.Integer{Value: now.Sub(pe.DeliveredAt).Milliseconds()},
+			protocol.Integer{Value: pe.Deliveries},
+		}}
+	}
+	return protocol.Array{Elements: elements}
+}
+
+// XCLAIM key group consumer min-idle-time id [id ...] [IDLE ms] [TIME unix-time-milliseconds]
+// [RETRYCOUNT count] [FORCE] [JUSTID] [LASTID lastid]
+func (s *Server) handleXClaim(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+	key, group, consumer := strs[1], strs[2], strs[3]
+
+	minIdle, err := strconv.ParseInt(strs[4], 10, 64)
+	if err != nil {
+		return protocol.Error{Message: "ERR Invalid min-idle-time argument for XCLAIM"}
+	}
+
+	// IDs go up to the first argument that isn't one
+	i := 5
+	var ids []inmemory.StreamID
+	for ; i < len(strs); i++ {
+		id, err := inmemory.ParseStreamID(strs[i], 0)
+		if err != nil {
+			break
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return errorReply(inmemory.ErrStreamID)
+	}
+
+	now := time.Now()
+	opts := inmemory.XClaimOptions{DeliveredAt: now}
+	for ; i < len(strs); i++ {
+		opt := strings.ToUpper(strs[i])
+		switch opt {
+		case "FORCE":
+			opts.Force = true
+		case "JUSTID":
+			opts.JustID = true
+		case "IDLE", "TIME", "RETRYCOUNT", "LASTID":
+			if i+1 >= len(strs) {
+				return protocol.Error{Message: "ERR syntax error"}
+			}
+			i++
+			if opt == "LASTID" { // only matters for XINFO's group state
+				if _, errReply := parseStreamIDs(strs[i : i+1]); errReply != nil {
+					return errReply
+				}
+				continue
+			}
+			n, err := strconv.ParseInt(strs[i], 10, 64)
+			if err != nil {
+				return protocol.Error{Message: "ERR Invalid " + opt + " option argument for XCLAIM"}
+			}
+			switch opt {
+			case "IDLE":
+				opts.DeliveredAt = now.Add(-time.Duration(n) * time.Millisecond)
+			case "TIME":
+				opts.DeliveredAt = time.UnixMilli(n)
+			default:
+				opts.RetryCount = &n
+			}
+		default:
+			return protocol.Error{Message: "ERR Unrecognized XCLAIM option '" + strs[i] + "'"}
+		}
+	}
+
+	claimed, err := s.db(c).XClaim(key, group, consumer, time.Duration(max(minIdle, 0))*time.Millisecond, ids, opts)
+	if err != nil {
+		return errorReply(err)
+	}
+	s.propagateClaim(c, strs[:4], ids, claimed, opts)
+
+	if !opts.JustID {
+		return entryArray(claimed)
+	}
+	justIDs := make([]string, len(claimed))
+	for i, entry := range claimed {
+		justIDs[i] = entry.ID.String()
+	}
+	return stringArray(justIDs)
+}
+
+// propagateClaim logs what XCLAIM did independent of the clock: the
+// entries it claimed, at an absolute delivery time, and the deleted ones
+// it dropped from the PEL. Replaying the original could claim other
+// entries, idle times start over on a reload.
+func (s *Server) propagateClaim(c *client, prefix []string, ids []inmemory.StreamID, claimed []inmemory.StreamEntry, opts inmemory.XClaimOptions) {
+	isClaimed := make(map[inmemory.StreamID]bool, len(claimed))
+	for _, entry := range claimed {
+		isClaimed[entry.ID] = true
+	}
+
+	form := append(append([]string{}, prefix...), "0")
+	for _, id := range ids {
+		if isClaimed[id] {
+			form = append(form, id.String())
+		} else if gone, _ := s.db(c).XRange(prefix[1], id, id, 1, false); len(gone) == 0 {
+			form = append(form, id.String()) // dropped from the PEL on replay too
+		}
+	}
+	if len(form) == len(prefix)+1 {
+		return
+	}
+
+	form = append(form, "TIME", strconv.FormatInt(opts.DeliveredAt.UnixMilli(), 10))
+	if opts.RetryCount != nil {
+		form = append(form, "RETRYCOUNT", strconv.FormatInt(*opts.RetryCount, 10))
+	}
+	if opts.JustID {
+		form = append(form, "JUSTID")
+	}
+	s.alsoPropagate(c, append(form, "FORCE"))
+}
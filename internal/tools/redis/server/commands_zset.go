@@ -0,0 +1,416 @@
+package server
+
+import (
+	inmemory "cli-t/internal/shared/store/inmemory"
+	"cli-t/internal/tools/redis/protocol"
+
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ZADD key [NX|XX] [GT|LT] [CH] [INCR] score member [score member ...]
+func (s *Server) handleZAdd(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if len(args) < 4 {
+		return wrongArgs("zadd")
+	}
+
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	// Parse leading flags
+	var opts inmemory.ZAddOptions
+	incr := false
+	i := 2
+flags:
+	for ; i < len(strs); i++ {
+		switch strings.ToUpper(strs[i]) {
+		case "NX":
+			opts.NX = true
+		case "XX":
+			opts.XX = true
+		case "GT":
+			opts.GT = true
+		case "LT":
+			opts.LT = true
+		case "CH":
+			opts.CH = true
+		case "INCR":
+			incr = true
+		default:
+			break flags
+		}
+	}
+
+	rest := strs[i:]
+	if len(rest) == 0 || len(rest)%2 != 0 {
+		return protocol.Error{Message: "ERR syntax error"}
+	}
+
+	members := make([]inmemory.ZMember, 0, len(rest)/2)
+	for j := 0; j < len(rest); j += 2 {
+		score, err := parseFloat(rest[j])
+		if err != nil {
+			return errorReply(err)
+		}
+		members = append(members, inmemory.ZMember{Member: rest[j+1], Score: score})
+	}
+
+	if incr {
+		if len(members) != 1 {
+			return protocol.Error{Message: "ERR INCR option supports a single increment-element pair"}
+		}
+		if opts.NX || opts.XX || opts.GT || opts.LT {
+			return protocol.Error{Message: "ERR syntax error"}
+		}
+		newScore, err := s.db(c).ZIncrBy(strs[1], members[0].Score, members[0].Member)
+		if err != nil {
+			return errorReply(err)
+		}
+		return protocol.Double{Value: newScore}
+	}
+
+	count, err := s.db(c).ZAdd(strs[1], members, opts)
+	if err != nil {
+		return errorReply(err)
+	}
+	return protocol.Integer{Value: count}
+}
+
+// ZINCRBY key increment member
+func (s *Server) handleZIncrBy(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if len(args) != 4 {
+		return wrongArgs("zincrby")
+	}
+
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	delta, err := parseFloat(strs[2])
+	if err != nil {
+		return errorReply(err)
+	}
+
+	newScore, err := s.db(c).ZIncrBy(strs[1], delta, strs[3])
+	if err != nil {
+		return errorReply(err)
+	}
+	return protocol.BulkString{Value: formatFloat(newScore)}
+}
+
+// ZRANGE key start stop [BYSCORE] [REV] [LIMIT offset count] [WITHSCORES]
+func (s *Server) handleZRange(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if len(args) < 4 {
+		return wrongArgs("zrange")
+	}
+
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	byScore, reverse := false, false
+	opts, errReply := parseRangeOptions(strs[4:], func(flag string) bool {
+		switch flag {
+		case "BYSCORE":
+			byScore = true
+		case "REV":
+			reverse = true
+		default:
+			return false
+		}
+		return true
+	})
+	if errReply != nil {
+		return errReply
+	}
+
+	if byScore {
+		// With REV the range is given as max min
+		min, max := strs[2], strs[3]
+		if reverse {
+			min, max = max, min
+		}
+		return s.zrangeByScore(c, strs[1], min, max, opts, reverse)
+	}
+
+	if opts.hasLimit {
+		return protocol.Error{Message: "ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX"}
+	}
+	return s.zrangeByRank(c, strs[1], strs[2], strs[3], opts.withScores, reverse)
+}
+
+// ZREVRANGE key start stop [WITHSCORES]
+func (s *Server) handleZRevRange(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if len(args) < 4 {
+		return wrongArgs("zrevrange")
+	}
+
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	opts, errReply := parseRangeOptions(strs[4:], nil)
+	if errReply != nil {
+		return errReply
+	}
+	if opts.hasLimit {
+		return protocol.Error{Message: "ERR syntax error"}
+	}
+	return s.zrangeByRank(c, strs[1], strs[2], strs[3], opts.withScores, true)
+}
+
+// ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count]
+func (s *Server) handleZRangeByScore(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if len(args) < 4 {
+		return wrongArgs("zrangebyscore")
+	}
+
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	opts, errReply := parseRangeOptions(strs[4:], nil)
+	if errReply != nil {
+		return errReply
+	}
+	return s.zrangeByScore(c, strs[1], strs[2], strs[3], opts, false)
+}
+
+// ZREVRANGEBYSCORE key max min [WITHSCORES] [LIMIT offset count]
+func (s *Server) handleZRevRangeByScore(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if len(args) < 4 {
+		return wrongArgs("zrevrangebyscore")
+	}
+
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	opts, errReply := parseRangeOptions(strs[4:], nil)
+	if errReply != nil {
+		return errReply
+	}
+	return s.zrangeByScore(c, strs[1], strs[3], strs[2], opts, true)
+}
+
+// ZRANK key member
+func (s *Server) handleZRank(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	return s.zrank(c, args, false)
+}
+
+// ZREVRANK key member
+func (s *Server) handleZRevRank(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	return s.zrank(c, args, true)
+}
+
+func (s *Server) zrank(c *client, args []protocol.RESPValue, reverse bool) protocol.RESPValue {
+	if len(args) != 3 {
+		if reverse {
+			return wrongArgs("zrevrank")
+		}
+		return wrongArgs("zrank")
+	}
+
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	rank, found, err := s.db(c).ZRank(strs[1], strs[2], reverse)
+	if err != nil {
+		return errorReply(err)
+	}
+	if !found {
+		return protocol.BulkString{IsNull: true}
+	}
+	return protocol.Integer{Value: rank}
+}
+
+// ZSCORE key member
+func (s *Server) handleZScore(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if len(args) != 3 {
+		return wrongArgs("zscore")
+	}
+
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	score, found, err := s.db(c).ZScore(strs[1], strs[2])
+	if err != nil {
+		return errorReply(err)
+	}
+	if !found {
+		return protocol.BulkString{IsNull: true}
+	}
+	return protocol.Double{Value: score}
+}
+
+// ZREM key member [member ...]
+func (s *Server) handleZRem(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if len(args) < 3 {
+		return wrongArgs("zrem")
+	}
+
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR arguments must be strings"}
+	}
+
+	removed, err := s.db(c).ZRem(strs[1], strs[2:]...)
+	if err != nil {
+		return errorReply(err)
+	}
+	return protocol.Integer{Value: removed}
+}
+
+// ZCARD key
+func (s *Server) handleZCard(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if len(args) != 2 {
+		return wrongArgs("zcard")
+	}
+
+	key, ok := args[1].(protocol.BulkString)
+	if !ok {
+		return protocol.Error{Message: "ERR key must be a string"}
+	}
+
+	count, err := s.db(c).ZCard(key.Value)
+	if err != nil {
+		return errorReply(err)
+	}
+	return protocol.Integer{Value: count}
+}
+
+// rangeOptions are the trailing WITHSCORES / LIMIT arguments of range commands
+type rangeOptions struct {
+	withScores bool
+	hasLimit   bool
+	offset     int
+	count      int
+}
+
+// parseRangeOptions parses WITHSCORES and LIMIT; extra lets a command accept
+// its own flags (BYSCORE, REV, ...) and returns false for unknown ones.
+func parseRangeOptions(args []string, extra func(flag string) bool) (rangeOptions, protocol.RESPValue) {
+	opts := rangeOptions{count: -1}
+
+	for i := 0; i < len(args); i++ {
+		flag := strings.ToUpper(args[i])
+		switch {
+		case flag == "WITHSCORES":
+			opts.withScores = true
+		case flag == "LIMIT":
+			if i+2 >= len(args) {
+				return opts, protocol.Error{Message: "ERR syntax error"}
+			}
+			offset, err1 := strconv.Atoi(args[i+1])
+			count, err2 := strconv.Atoi(args[i+2])
+			if err1 != nil || err2 != nil {
+				return opts, protocol.Error{Message: "ERR value is not an integer or out of range"}
+			}
+			opts.hasLimit = true
+			opts.offset, opts.count = offset, count
+			i += 2
+		case extra != nil && extra(flag):
+		default:
+			return opts, protocol.Error{Message: "ERR syntax error"}
+		}
+	}
+	return opts, nil
+}
+
+func (s *Server) zrangeByRank(c *client, key, startArg, stopArg string, withScores, reverse bool) protocol.RESPValue {
+	start, err1 := strconv.Atoi(startArg)
+	stop, err2 := strconv.Atoi(stopArg)
+	if err1 != nil || err2 != nil {
+		return protocol.Error{Message: "ERR value is not an integer or out of range"}
+	}
+
+	members, err := s.db(c).ZRange(key, start, stop, reverse)
+	if err != nil {
+		return errorReply(err)
+	}
+	return zmemberArray(c, members, withScores)
+}
+
+func (s *Server) zrangeByScore(c *client, key, minArg, maxArg string, opts rangeOptions, reverse bool) protocol.RESPValue {
+	min, err1 := parseScoreBound(minArg)
+	max, err2 := parseScoreBound(maxArg)
+	if err1 != nil || err2 != nil {
+		return protocol.Error{Message: "ERR min or max is not a float"}
+	}
+
+	members, err := s.db(c).ZRangeByScore(key, min, max, opts.offset, opts.count, reverse)
+	if err != nil {
+		return errorReply(err)
+	}
+	return zmemberArray(c, members, opts.withScores)
+}
+
+// zmemberArray builds [member1, (score1,) member2, (score2,) ...], or
+// [[member1, score1], ...] with double scores for RESP3
+func zmemberArray(c *client, members []inmemory.ZMember, withScores bool) protocol.Array {
+	if withScores && c.protocolVersion() == protocol.RESP3 {
+		pairs := make([]protocol.RESPValue, len(members))
+		for i, m := range members {
+			pairs[i] = protocol.Array{Elements: []protocol.RESPValue{
+				protocol.BulkString{Value: m.Member}, protocol.Double{Value: m.Score},
+			}}
+		}
+		return protocol.Array{Elements: pairs}
+	}
+
+	size := len(members)
+	if withScores {
+		size *= 2
+	}
+
+	elements := make([]protocol.RESPValue, 0, size)
+	for _, m := range members {
+		elements = append(elements, protocol.BulkString{Value: m.Member})
+		if withScores {
+			elements = append(elements, protocol.BulkString{Value: formatFloat(m.Score)})
+		}
+	}
+	return protocol.Array{Elements: elements}
+}
+
+// parseScoreBound parses "1.5", "(1.5", "-inf" and "+inf"
+func parseScoreBound(arg string) (inmemory.ScoreBound, error) {
+	bound := inmemory.ScoreBound{}
+	if strings.HasPrefix(arg, "(") {
+		bound.Exclusive = true
+		arg = arg[1:]
+	}
+
+	value, err := parseFloat(arg)
+	if err != nil {
+		return bound, err
+	}
+	bound.Value = value
+	return bound, nil
+}
+
+// parseFloat accepts what redis accepts (including inf), but never NaN
+func parseFloat(arg string) (float64, error) {
+	value, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(value) {
+		return 0, inmemory.ErrNotFloat
+	}
+	return value, nil
+}
+
+// formatFloat renders scores the way redis does ("3", "1.5", "inf")
+func formatFloat(f float64) string {
+	return protocol.FormatDouble(f)
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"cli-t/internal/shared/glob"
+	inmemory "cli-t/internal/shared/store/inmemory"
+	"cli-t/internal/tools/redis/protocol"
+
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// configParam is one parameter of CONFIG GET/SET, named like redis.conf
+type configParam struct {
+	name string
+	get  func(s *Server, cfg Config) string
+	// set validates value and returns how to apply it; nil means the
+	// parameter can only be set on the command line
+	set func(value string) (func(cfg *Config), error)
+}
+
+var configParams = []configParam{
+	{name: "bind", get: func(_ *Server, cfg Config) string { return cfg.Host }},
+	{name: "port", get: func(s *Server, _ Config) string { return strconv.Itoa(s.listenPort()) }},
+	{name: "databases", get: func(_ *Server, cfg Config) string { return strconv.Itoa(cfg.Databases) }},
+	{name: "dbfilename", get: func(_ *Server, cfg Config) string { return cfg.DumpPath }},
+	{name: "save-interval", get: func(_ *Server, cfg Config) string {
+		return strconv.FormatInt(int64(cfg.SaveInterval/time.Second), 10)
+	}},
+	{name: "appendonly", get: func(_ *Server, cfg Config) string { return yesNo(cfg.AppendOnly) }},
+	{name: "appendfilename", get: func(_ *Server, cfg Config) string { return cfg.AppendFilename }},
+	{name: "appendfsync", get: func(_ *Server, cfg Config) string { return string(cfg.AppendFsync) }},
+	{
+		name: "maxmemory",
+		get:  func(_ *Server, cfg Config) string { return strconv.FormatInt(cfg.MaxMemory, 10) },
+		set: func(value string) (func(cfg *Config), error) {
+			limit, err := ParseMemory(value)
+			return func(cfg *Config) { cfg.MaxMemory = limit }, err
+		},
+	},
+	{
+		name: "maxmemory-policy",
+		get:  func(_ *Server, cfg Config) string { return string(cfg.MaxMemoryPolicy) },
+		set: func(value string) (func(cfg *Config), error) {
+			policy, err := inmemory.ParseEvictionPolicy(value)
+			return func(cfg *Config) { cfg.MaxMemoryPolicy = policy }, err
+		},
+	},
+	{
+		name: "maxmemory-samples",
+		get:  func(_ *Server, cfg Config) string { return strconv.Itoa(cfg.MaxMemorySamples) },
+		set: func(value string) (func(cfg *Config), error) {
+			samples, err := strconv.Atoi(value)
+			if err != nil || samples <= 0 {
+				return nil, errors.New("argument must be a positive integer")
+			}
+			return func(cfg *Config) { cfg.MaxMemorySamples = samples }, nil
+		},
+	},
+	{name: "replicaof", get: func(s *Server, _ Config) string {
+		if link := s.currentLink(); link != nil {
+			return link.host + " " + link.port
+		}
+		return ""
+	}},
+	{
+		name: "replica-read-only",
+		get:  func(_ *Server, cfg Config) string { return yesNo(cfg.ReplicaReadOnly) },
+		set: func(value string) (func(cfg *Config), error) {
+			readOnly, err := parseYesNo(value)
+			return func(cfg *Config) { cfg.ReplicaReadOnly = readOnly }, err
+		},
+	},
+	{
+		name: "masterauth",
+		get:  func(_ *Server, cfg Config) string { return cfg.MasterAuth },
+		set: func(value string) (func(cfg *Config), error) {
+			return func(cfg *Config) { cfg.MasterAuth = value }, nil
+		},
+	},
+	{
+		name: "requirepass",
+		get:  func(_ *Server, cfg Config) string { return cfg.RequirePass },
+		set: func(value string) (func(cfg *Config), error) {
+			return func(cfg *Config) { cfg.RequirePass = value }, nil
+		},
+	},
+	{
+		name: "notify-keyspace-events",
+		get:  func(_ *Server, cfg Config) string { return cfg.NotifyKeyspaceEvents.String() },
+		set: func(value string) (func(cfg *Config), error) {
+			events, err := ParseKeyspaceEvents(value)
+			return func(cfg *Config) { cfg.NotifyKeyspaceEvents = events }, err
+		},
+	},
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func parseYesNo(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "yes":
+		return true, nil
+	case "no":
+		return false, nil
+	}
+	return false, errors.New("argument must be 'yes' or 'no'")
+}
+
+func findConfigParam(name string) *configParam {
+	for i := range configParams {
+		if strings.EqualFold(configParams[i].name, name) {
+			return &configParams[i]
+		}
+	}
+	return nil
+}
+
+// CONFIG GET pattern [pattern ...] | SET param value [param value ...] | RESETSTAT | REWRITE
+func (s *Server) handleConfig(args []protocol.RESPValue) protocol.RESPValue {
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR syntax error"}
+	}
+
+	switch sub := strings.ToUpper(strs[1]); sub {
+	case "GET":
+		if len(strs) < 3 {
+			return wrongArgs("config|get")
+		}
+		return s.configGet(strs[2:])
+	case "SET":
+		if len(strs) < 4 || len(strs)%2 != 0 {
+			return wrongArgs("config|set")
+		}
+		return s.configSet(strs[2:])
+	case "RESETSTAT":
+		for _, db := range s.dbs {
+			db.ResetStats()
+		}
+		s.stats.connectionsReceived.Store(0)
+		s.stats.commandsProcessed.Store(0)
+		return protocol.SimpleString{Value: "OK"}
+	case "REWRITE":
+		return protocol.Error{Message: "ERR The server is running without a config file"}
+	default:
+		return protocol.Error{Message: "ERR unknown subcommand '" + strs[1] + "'. Try CONFIG HELP."}
+	}
+}
+
+func (s *Server) configGet(patterns []string) protocol.RESPValue {
+	cfg := s.config()
+
+	var entries []protocol.MapEntry
+	for _, param := range configParams {
+		for _, pattern := range patterns {
+			if glob.Match(strings.ToLower(pattern), param.name) {
+				entries = append(entries, protocol.MapEntry{
+					Key:   protocol.BulkString{Value: param.name},
+					Value: protocol.BulkString{Value: param.get(s, cfg)},
+				})
+				break
+			}
+		}
+	}
+	return protocol.Map{Entries: entries}
+}
+
+// configSet applies every pair or none of them. It runs exclusively, so a
+// lower maxmemory can evict right away.
+func (s *Server) configSet(pairs []string) protocol.RESPValue {
+	applies := make([]func(cfg *Config), 0, len(pairs)/2)
+	passwordChanged := false
+	for i := 0; i < len(pairs); i += 2 {
+		param := findConfigParam(pairs[i])
+		if param == nil {
+			return protocol.Error{Message: "ERR Unknown option or number of arguments for CONFIG SET - '" + pairs[i] + "'"}
+		}
+		if param.set == nil {
+			return configSetFailed(param.name, "can't set immutable config")
+		}
+		apply, err := param.set(pairs[i+1])
+		if err != nil {
+			return configSetFailed(param.name, err.Error())
+		}
+		applies = append(applies, apply)
+		passwordChanged = passwordChanged || param.name == "requirepass"
+	}
+
+	s.configMu.Lock()
+	for _, apply := range applies {
+		apply(&s.cfg)
+	}
+	cfg := s.cfg
+	s.configMu.Unlock()
+
+	if passwordChanged {
+		s.acl.setDefaultPassword(cfg.RequirePass)
+	}
+	s.notify.setEvents(cfg.NotifyKeyspaceEvents)
+	for _, db := range s.dbs {
+		db.SetMaxMemory(cfg.MaxMemory, cfg.MaxMemoryPolicy, cfg.MaxMemorySamples)
+	}
+	s.freeMemory() // like redis, going over the new limit isn't an error
+	return protocol.SimpleString{Value: "OK"}
+}
+
+func configSetFailed(param, reason string) protocol.Error {
+	return protocol.Error{Message: "ERR CONFIG SET failed (possibly related to argument '" + param + "') - " + reason}
+}
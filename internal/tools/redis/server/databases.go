@@ -0,0 +1,139 @@
+package server
+
+import (
+	inmemory "cli-t/internal/shared/store/inmemory"
+	"cli-t/internal/tools/redis/persistence"
+	"cli-t/internal/tools/redis/protocol"
+
+	"fmt"
+	"strconv"
+)
+
+// db returns the database c selected
+func (s *Server) db(c *client) inmemory.Store {
+	return s.dbs[c.db]
+}
+
+// hookDB points the store hooks of database i at it, again once SWAPDB
+// moved another store there
+func (s *Server) hookDB(i int) {
+	s.dbs[i].OnKeyChange(func(key string) { s.keyChanged(i, key) })
+	s.dbs[i].OnKeyEvent(func(event, key string) { s.notify.keyEvent(i, event, key) })
+}
+
+// dataset copies every database. The caller keeps writes out with execMu,
+// so all of them are copied at the same point.
+func (s *Server) dataset() persistence.Dataset {
+	data := make(persistence.Dataset, len(s.dbs))
+	for i, db := range s.dbs {
+		data[i] = db.Snapshot()
+	}
+	return data
+}
+
+// beginDataset is dataset for the background: it only fixes the point in
+// time, and the returned function makes the copy (copy-on-write, see the
+// store's BeginSnapshot). It must be called exactly once.
+func (s *Server) beginDataset() func() persistence.Dataset {
+	copies := make([]func() map[string]inmemory.StoreValue, len(s.dbs))
+	for i, db := range s.dbs {
+		copies[i] = db.BeginSnapshot()
+	}
+	return func() persistence.Dataset {
+		data := make(persistence.Dataset, len(copies))
+		for i, copyDB := range copies {
+			data[i] = copyDB()
+		}
+		return data
+	}
+}
+
+// loadDataset replaces the content of every database with data
+func (s *Server) loadDataset(data persistence.Dataset) error {
+	for i := len(s.dbs); i < len(data); i++ {
+		if len(data[i]) > 0 {
+			return fmt.Errorf("the dataset has keys in DB %d but only %d databases are configured (--databases)", i, len(s.dbs))
+		}
+	}
+	for i, db := range s.dbs {
+		if i < len(data) {
+			db.Load(data[i])
+		} else {
+			db.Flush()
+		}
+	}
+	return nil
+}
+
+// parseDBIndex validates a database number argument
+func (s *Server) parseDBIndex(arg protocol.RESPValue) (int, protocol.RESPValue) {
+	bulk, _ := arg.(protocol.BulkString)
+	index, err := strconv.Atoi(bulk.Value)
+	if err != nil {
+		return 0, protocol.Error{Message: "ERR value is not an integer or out of range"}
+	}
+	if index < 0 || index >= len(s.dbs) {
+		return 0, protocol.Error{Message: "ERR DB index is out of range"}
+	}
+	return index, nil
+}
+
+// SELECT index
+func (s *Server) handleSelect(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	index, errReply := s.parseDBIndex(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	c.selectDB(index)
+	return protocol.SimpleString{Value: "OK"}
+}
+
+// MOVE key db: moves the key unless db already has one by that name
+func (s *Server) handleMove(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	key, ok := args[1].(protocol.BulkString)
+	if !ok {
+		return protocol.Error{Message: "ERR key must be a string"}
+	}
+	index, errReply := s.parseDBIndex(args[2])
+	if errReply != nil {
+		return errReply
+	}
+	if index == c.db {
+		return protocol.Error{Message: "ERR source and destination objects are the same"}
+	}
+
+	// The key is locked in every database, so nothing changes it in between
+	src, dst := s.db(c), s.dbs[index]
+	val, exists := src.Get(key.Value)
+	if !exists || dst.Exists(key.Value) > 0 {
+		return protocol.Integer{Value: 0}
+	}
+	dst.Set(key.Value, val)
+	src.Delete(key.Value)
+	return protocol.Integer{Value: 1}
+}
+
+// SWAPDB index1 index2: clients of one database see the other's content
+// from now on
+func (s *Server) handleSwapDB(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	a, errReply := s.parseDBIndex(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	b, errReply := s.parseDBIndex(args[2])
+	if errReply != nil {
+		return errReply
+	}
+	if a == b {
+		return protocol.SimpleString{Value: "OK"}
+	}
+
+	s.dbs[a], s.dbs[b] = s.dbs[b], s.dbs[a]
+	for _, db := range []int{a, b} {
+		s.hookDB(db)
+		// Every key may be different now
+		s.watches.dbModified(db)
+		s.blocking.dbModified(db)
+	}
+	return protocol.SimpleString{Value: "OK"}
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	inmemory "cli-t/internal/shared/store/inmemory"
+	"cli-t/internal/tools/redis/persistence"
+	"cli-t/internal/tools/redis/protocol"
+
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelect(t *testing.T) {
+	s, conn, r := connect(t)
+	other, or := attach(t, s)
+
+	ok := protocol.SimpleString{Value: "OK"}
+	do(t, conn, r, "SET", "k", "zero")
+	assert.Equal(t, ok, do(t, conn, r, "SELECT", "3"))
+	assert.Equal(t, protocol.BulkString{IsNull: true}, do(t, conn, r, "GET", "k"))
+	do(t, conn, r, "SET", "k", "three")
+	assert.Equal(t, protocol.Integer{Value: 1}, do(t, conn, r, "DBSIZE"))
+
+	// The selection is per connection
+	assert.Equal(t, protocol.BulkString{Value: "zero"}, do(t, other, or, "GET", "k"))
+	assert.Contains(t, do(t, conn, r, "CLIENT", "INFO").(protocol.BulkString).Value, " db=3 ")
+
+	assert.Equal(t, protocol.Error{Message: "ERR DB index is out of range"}, do(t, conn, r, "SELECT", "16"))
+	assert.Equal(t, protocol.Error{Message: "ERR value is not an integer or out of range"}, do(t, conn, r, "SELECT", "x"))
+
+	info := do(t, conn, r, "INFO", "keyspace")
+	assert.Equal(t, "keys=1,expires=0,avg_ttl=0", infoField(t, info, "db0"))
+	assert.Equal(t, "keys=1,expires=0,avg_ttl=0", infoField(t, info, "db3"))
+	assert.NotContains(t, info.(protocol.BulkString).Value, "db1:")
+
+	// FLUSHDB only empties the selected database, FLUSHALL every one
+	assert.Equal(t, ok, do(t, conn, r, "FLUSHDB"))
+	assert.Equal(t, protocol.Integer{Value: 1}, do(t, other, or, "DBSIZE"))
+	do(t, conn, r, "SET", "k", "three")
+	assert.Equal(t, ok, do(t, other, or, "FLUSHALL"))
+	assert.Equal(t, protocol.Integer{Value: 0}, do(t, conn, r, "DBSIZE"))
+	assert.Equal(t, protocol.Integer{Value: 0}, do(t, other, or, "DBSIZE"))
+}
+
+func TestMove(t *testing.T) {
+	_, conn, r := connect(t)
+
+	do(t, conn, r, "SET", "k", "v", "EX", "100")
+	assert.Equal(t, protocol.Integer{Value: 1}, do(t, conn, r, "MOVE", "k", "1"))
+	assert.Equal(t, protocol.Integer{Value: 0}, do(t, conn, r, "EXISTS", "k"))
+	assert.Equal(t, protocol.Integer{Value: 0}, do(t, conn, r, "MOVE", "missing", "1"))
+
+	do(t, conn, r, "SELECT", "1")
+	assert.Equal(t, protocol.BulkString{Value: "v"}, do(t, conn, r, "GET", "k"))
+	assert.Greater(t, do(t, conn, r, "TTL", "k").(protocol.Integer).Value, int64(90))
+
+	// Not moved over an existing key
+	do(t, conn, r, "SELECT", "0")
+	do(t, conn, r, "SET", "k", "other")
+	assert.Equal(t, protocol.Integer{Value: 0}, do(t, conn, r, "MOVE", "k", "1"))
+	assert.Equal(t, protocol.BulkString{Value: "other"}, do(t, conn, r, "GET", "k"))
+
+	assert.Equal(t, protocol.Error{Message: "ERR source and destination objects are the same"}, do(t, conn, r, "MOVE", "k", "0"))
+	assert.Equal(t, protocol.Error{Message: "ERR DB index is out of range"}, do(t, conn, r, "MOVE", "k", "99"))
+}
+
+func TestSwapDB(t *testing.T) {
+	s, conn, r := connect(t)
+	watcher, wr := attach(t, s)
+	waiter, blr := attach(t, s)
+
+	do(t, conn, r, "SET", "k", "zero")
+	do(t, conn, r, "SELECT", "1")
+	do(t, conn, r, "RPUSH", "jobs", "j1")
+
+	// A client watching DB 0 and one blocked on DB 0
+	do(t, watcher, wr, "WATCH", "k")
+	send(t, waiter, string(stringArray([]string{"BLPOP", "jobs", "5"}).Serialize()))
+	require.Eventually(t, func() bool { return s.blocking.waiting(0, "jobs") == 1 }, time.Second, 5*time.Millisecond)
+
+	assert.Equal(t, protocol.SimpleString{Value: "OK"}, do(t, conn, r, "SWAPDB", "0", "1"))
+
+	// The blocked client now sees DB 1's list
+	assert.Equal(t, stringArray([]string{"jobs", "j1"}), readReply(t, blr))
+
+	assert.Equal(t, protocol.BulkString{Value: "zero"}, do(t, conn, r, "GET", "k"))
+	do(t, watcher, wr, "MULTI")
+	do(t, watcher, wr, "SET", "k", "x")
+	assert.Equal(t, protocol.Array{IsNull: true}, do(t, watcher, wr, "EXEC"))
+
+	// Changes after the swap go through the hooks of the new position
+	do(t, watcher, wr, "WATCH", "k")
+	do(t, conn, r, "SELECT", "0")
+	do(t, conn, r, "SET", "k", "changed")
+	do(t, watcher, wr, "MULTI")
+	assert.Equal(t, protocol.Array{IsNull: true}, do(t, watcher, wr, "EXEC"))
+}
+
+func TestWatchIsPerDatabase(t *testing.T) {
+	s, conn, r := connect(t)
+	other, or := attach(t, s)
+
+	do(t, conn, r, "WATCH", "k")
+	do(t, other, or, "SELECT", "2")
+	do(t, other, or, "SET", "k", "elsewhere")
+
+	do(t, conn, r, "MULTI")
+	do(t, conn, r, "SET", "k", "v")
+	assert.Equal(t, protocol.Array{Elements: []protocol.RESPValue{protocol.SimpleString{Value: "OK"}}}, do(t, conn, r, "EXEC"))
+}
+
+func TestAOF_ReplaysDatabases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	s, _, run := connectAOF(t, path)
+
+	run("SET", "a", "zero")
+	run("SELECT", "2")
+	run("SET", "a", "two")
+	run("MULTI")
+	run("INCR", "n")
+	run("SELECT", "5")
+	run("INCR", "n")
+	run("EXEC")
+	run("MOVE", "n", "0")
+	run("SELECT", "0")
+	run("RPUSH", "list", "x")
+	require.NoError(t, s.aof.Sync())
+
+	replayed := New(Config{AppendOnly: true, AppendFilename: path, AppendFsync: persistence.FsyncNo}, inmemory.New())
+	require.NoError(t, replayed.loadData())
+	require.NoError(t, replayed.aof.Close())
+
+	get := func(db int, key string) string {
+		val, _ := replayed.dbs[db].Get(key)
+		return val.Data
+	}
+	assert.Equal(t, "zero", get(0, "a"))
+	assert.Equal(t, "1", get(0, "n"))
+	assert.Equal(t, "two", get(2, "a"))
+	assert.Equal(t, "1", get(2, "n"))
+	assert.Equal(t, 0, replayed.dbs[5].DBSize())
+	list, _ := replayed.dbs[0].LRange("list", 0, -1)
+	assert.Equal(t, []string{"x"}, list)
+}
+
+func TestLoadDataset_TooFewDatabases(t *testing.T) {
+	s := New(Config{Databases: 2}, inmemory.New())
+
+	assert.NoError(t, s.loadDataset(persistence.Dataset{1: {"k": {Type: inmemory.TypeString, Data: "v"}}, 5: {}}))
+	assert.Equal(t, 1, s.dbs[1].DBSize())
+	assert.Error(t, s.loadDataset(persistence.Dataset{5: {"k": {Type: inmemory.TypeString, Data: "v"}}}))
+}
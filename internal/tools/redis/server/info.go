@@ -0,0 +1,176 @@
+package server
+
+import (
+	"cli-t/internal/tools/redis/protocol"
+
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// redisVersion is what INFO reports; client libraries use it to decide
+// which commands they can rely on
+const redisVersion = "7.2.0"
+
+// serverStats are the counters the server keeps itself, the store keeps
+// the keyspace ones
+type serverStats struct {
+	startTime           time.Time
+	connectionsReceived atomic.Int64
+	commandsProcessed   atomic.Int64
+}
+
+// infoSection is one "# Name" block of INFO
+type infoSection struct {
+	name  string
+	lines func(s *Server) []string
+}
+
+// infoSections in the order INFO prints them
+var infoSections = []infoSection{
+	{name: "Server", lines: (*Server).serverInfo},
+	{name: "Clients", lines: (*Server).clientsInfo},
+	{name: "Memory", lines: (*Server).memoryInfo},
+	{name: "Persistence", lines: (*Server).persistenceInfo},
+	{name: "Stats", lines: (*Server).statsInfo},
+	{name: "Replication", lines: (*Server).replicationInfo},
+	{name: "Keyspace", lines: (*Server).keyspaceInfo},
+}
+
+// INFO [section ...]
+func (s *Server) handleInfo(args []protocol.RESPValue) protocol.RESPValue {
+	strs, ok := bulkStrings(args[1:])
+	if !ok {
+		return protocol.Error{Message: "ERR syntax error"}
+	}
+
+	wanted := make(map[string]bool, len(strs))
+	for _, name := range strs {
+		wanted[strings.ToLower(name)] = true
+	}
+	all := len(wanted) == 0 || wanted["all"] || wanted["everything"] || wanted["default"]
+
+	var out strings.Builder
+	for _, section := range infoSections {
+		if !all && !wanted[strings.ToLower(section.name)] {
+			continue
+		}
+		if out.Len() > 0 {
+			out.WriteString("\r\n")
+		}
+		out.WriteString("# " + section.name + "\r\n")
+		for _, line := range section.lines(s) {
+			out.WriteString(line + "\r\n")
+		}
+	}
+	return protocol.Verbatim{Format: "txt", Value: out.String()}
+}
+
+func (s *Server) serverInfo() []string {
+	uptime := time.Since(s.stats.startTime)
+	return []string{
+		"redis_version:" + redisVersion,
+		"redis_mode:standalone",
+		"os:" + runtime.GOOS + " " + runtime.GOARCH,
+		"arch_bits:" + strconv.Itoa(strconv.IntSize),
+		"go_version:" + runtime.Version(),
+		"process_id:" + strconv.Itoa(os.Getpid()),
+		"tcp_port:" + strconv.Itoa(s.listenPort()),
+		"server_time_usec:" + strconv.FormatInt(time.Now().UnixMicro(), 10),
+		"uptime_in_seconds:" + strconv.FormatInt(int64(uptime.Seconds()), 10),
+		"uptime_in_days:" + strconv.FormatInt(int64(uptime.Hours()/24), 10),
+	}
+}
+
+func (s *Server) clientsInfo() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	blocked := 0
+	for _, c := range s.clients {
+		if c.blocked.Load() {
+			blocked++
+		}
+	}
+	return []string{
+		"connected_clients:" + strconv.Itoa(len(s.clients)),
+		"blocked_clients:" + strconv.Itoa(blocked),
+	}
+}
+
+func (s *Server) memoryInfo() []string {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	cfg := s.config()
+	used := s.usedMemory()
+	return []string{
+		"used_memory:" + strconv.FormatInt(used, 10),
+		"used_memory_human:" + humanBytes(used),
+		"used_memory_rss:" + strconv.FormatUint(mem.Sys, 10),
+		"used_memory_rss_human:" + humanBytes(int64(mem.Sys)),
+		"used_memory_heap:" + strconv.FormatUint(mem.HeapAlloc, 10),
+		"maxmemory:" + strconv.FormatInt(cfg.MaxMemory, 10),
+		"maxmemory_human:" + humanBytes(cfg.MaxMemory),
+		"maxmemory_policy:" + string(cfg.MaxMemoryPolicy),
+	}
+}
+
+func (s *Server) persistenceInfo() []string {
+	rewriting := s.aof != nil && s.aof.RewriteInProgress()
+	return []string{
+		"loading:0",
+		"rdb_changes_since_last_save:" + strconv.FormatInt(s.snapshot.dirty.Load(), 10),
+		"rdb_bgsave_in_progress:" + boolFlag(s.snapshot.inProgress.Load()),
+		"rdb_last_save_time:" + strconv.FormatInt(s.snapshot.lastSave.Load(), 10),
+		"aof_enabled:" + boolFlag(s.aof != nil),
+		"aof_rewrite_in_progress:" + boolFlag(rewriting),
+	}
+}
+
+func (s *Server) statsInfo() []string {
+	var expired, evicted int64
+	for _, db := range s.dbs {
+		stats := db.Stats()
+		expired += stats.ExpiredKeys
+		evicted += stats.EvictedKeys
+	}
+	return []string{
+		"total_connections_received:" + strconv.FormatInt(s.stats.connectionsReceived.Load(), 10),
+		"total_commands_processed:" + strconv.FormatInt(s.stats.commandsProcessed.Load(), 10),
+		"expired_keys:" + strconv.FormatInt(expired, 10),
+		"evicted_keys:" + strconv.FormatInt(evicted, 10),
+	}
+}
+
+func (s *Server) keyspaceInfo() []string {
+	var lines []string
+	for i, db := range s.dbs {
+		stats := db.Stats()
+		if stats.Keys == 0 {
+			continue // redis leaves empty databases out
+		}
+		lines = append(lines, fmt.Sprintf("db%d:keys=%d,expires=%d,avg_ttl=0", i, stats.Keys, stats.Expires))
+	}
+	return lines
+}
+
+// humanBytes formats a size the way INFO's *_human fields do: 1023B, 1.50K
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return strconv.FormatInt(n, 10) + "B"
+	}
+	value, suffix := float64(n)/unit, "K"
+	for _, next := range []string{"M", "G", "T"} {
+		if value < unit {
+			break
+		}
+		value, suffix = value/unit, next
+	}
+	return strconv.FormatFloat(value, 'f', 2, 64) + suffix
+}
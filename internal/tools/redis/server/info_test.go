@@ -0,0 +1,136 @@
+package server
+
+import (
+	"cli-t/internal/tools/redis/protocol"
+
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// infoField extracts one "name:value" line of an INFO reply
+func infoField(t *testing.T, reply protocol.RESPValue, name string) string {
+	t.Helper()
+	bulk, ok := reply.(protocol.BulkString)
+	require.True(t, ok, "INFO replied %#v", reply)
+	for _, line := range strings.Split(bulk.Value, "\r\n") {
+		if value, found := strings.CutPrefix(line, name+":"); found {
+			return value
+		}
+	}
+	t.Fatalf("no %q in INFO", name)
+	return ""
+}
+
+func TestInfo(t *testing.T) {
+	s, conn, r := connect(t)
+	attach(t, s)
+
+	do(t, conn, r, "SET", "a", "1")
+	do(t, conn, r, "SET", "b", "2", "PX", "1")
+	time.Sleep(5 * time.Millisecond)
+	do(t, conn, r, "GET", "b") // expires lazily
+
+	info := do(t, conn, r, "INFO")
+	assert.Equal(t, redisVersion, infoField(t, info, "redis_version"))
+	assert.Equal(t, "2", infoField(t, info, "connected_clients"))
+	assert.Equal(t, "1", infoField(t, info, "expired_keys"))
+	assert.Equal(t, "4", infoField(t, info, "total_commands_processed")) // INFO included
+	assert.Equal(t, "role:master", "role:"+infoField(t, info, "role"))
+	assert.Equal(t, "keys=1,expires=0,avg_ttl=0", infoField(t, info, "db0"))
+
+	// Only the requested sections
+	memory := do(t, conn, r, "INFO", "memory").(protocol.BulkString)
+	assert.True(t, strings.HasPrefix(memory.Value, "# Memory\r\n"))
+	assert.NotContains(t, memory.Value, "# Server")
+	used, err := strconv.Atoi(infoField(t, memory, "used_memory"))
+	require.NoError(t, err)
+	assert.Greater(t, used, 0)
+
+	assert.Equal(t, protocol.SimpleString{Value: "OK"}, do(t, conn, r, "CONFIG", "RESETSTAT"))
+	assert.Equal(t, "0", infoField(t, do(t, conn, r, "INFO", "stats"), "expired_keys"))
+}
+
+func TestConfigGetSet(t *testing.T) {
+	s, conn, r := connect(t)
+
+	assert.Equal(t, stringArray([]string{"maxmemory", "0", "maxmemory-policy", "noeviction", "maxmemory-samples", "5"}),
+		do(t, conn, r, "CONFIG", "GET", "maxmemory*"))
+	assert.Equal(t, protocol.Array{Elements: []protocol.RESPValue{}}, do(t, conn, r, "CONFIG", "GET", "nope"))
+
+	assert.Equal(t, protocol.SimpleString{Value: "OK"},
+		do(t, conn, r, "CONFIG", "SET", "maxmemory", "1mb", "maxmemory-policy", "allkeys-lru"))
+	assert.Equal(t, int64(1<<20), s.config().MaxMemory)
+	assert.Equal(t, stringArray([]string{"maxmemory-policy", "allkeys-lru"}),
+		do(t, conn, r, "CONFIG", "GET", "maxmemory-policy"))
+
+	// All or nothing
+	reply := do(t, conn, r, "CONFIG", "SET", "maxmemory", "2mb", "maxmemory-policy", "lru")
+	assert.Contains(t, reply.(protocol.Error).Message, "'maxmemory-policy'")
+	assert.Equal(t, int64(1<<20), s.config().MaxMemory)
+
+	reply = do(t, conn, r, "CONFIG", "SET", "port", "1")
+	assert.Contains(t, reply.(protocol.Error).Message, "can't set immutable config")
+	reply = do(t, conn, r, "CONFIG", "SET", "bogus", "1")
+	assert.Contains(t, reply.(protocol.Error).Message, "Unknown option")
+}
+
+func TestClientCommands(t *testing.T) {
+	s, conn, r := connect(t)
+	other, otherR := attach(t, s)
+
+	id := do(t, conn, r, "CLIENT", "ID").(protocol.Integer)
+	assert.Equal(t, protocol.BulkString{IsNull: true}, do(t, conn, r, "CLIENT", "GETNAME"))
+	assert.Equal(t, protocol.SimpleString{Value: "OK"}, do(t, conn, r, "CLIENT", "SETNAME", "worker-1"))
+	assert.Equal(t, protocol.BulkString{Value: "worker-1"}, do(t, conn, r, "CLIENT", "GETNAME"))
+	assert.IsType(t, protocol.Error{}, do(t, conn, r, "CLIENT", "SETNAME", "has space"))
+
+	do(t, other, otherR, "PING")
+	list := do(t, conn, r, "CLIENT", "LIST").(protocol.BulkString)
+	lines := strings.Split(strings.TrimSuffix(list.Value, "\n"), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], "id="+strconv.FormatInt(id.Value, 10)+" ")
+	assert.Contains(t, lines[0], "name=worker-1")
+	assert.Contains(t, lines[0], "cmd=client")
+	assert.Contains(t, lines[1], "cmd=ping")
+
+	mine := do(t, conn, r, "CLIENT", "LIST", "ID", strconv.FormatInt(id.Value, 10)).(protocol.BulkString)
+	assert.Equal(t, 1, strings.Count(mine.Value, "\n"))
+
+	// SKIPME defaults to yes: only the other client goes
+	assert.Equal(t, protocol.Integer{Value: 1}, do(t, conn, r, "CLIENT", "KILL", "TYPE", "normal"))
+	_, err := otherR.ReadValue()
+	assert.Error(t, err)
+	assert.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.clients) == 1
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, protocol.Error{Message: "ERR No such client"}, do(t, conn, r, "CLIENT", "KILL", "1.2.3.4:5"))
+}
+
+func TestCommandIntrospection(t *testing.T) {
+	_, conn, r := connect(t)
+
+	count := do(t, conn, r, "COMMAND", "COUNT").(protocol.Integer)
+	assert.Equal(t, int64(len(commandTable)), count.Value)
+	all := do(t, conn, r, "COMMAND").(protocol.Array)
+	assert.Len(t, all.Elements, len(commandTable))
+
+	info := do(t, conn, r, "COMMAND", "INFO", "set", "blpop", "nope").(protocol.Array)
+	set := info.Elements[0].(protocol.Array).Elements
+	assert.Equal(t, protocol.BulkString{Value: "set"}, set[0])
+	assert.Equal(t, protocol.Integer{Value: -3}, set[1])
+	assert.Equal(t, protocol.Array{Elements: []protocol.RESPValue{
+		protocol.SimpleString{Value: "write"}, protocol.SimpleString{Value: "denyoom"},
+	}}, set[2])
+	assert.Equal(t, []protocol.RESPValue{protocol.Integer{Value: 1}, protocol.Integer{Value: 1}, protocol.Integer{Value: 1}}, set[3:6])
+
+	blpop := info.Elements[1].(protocol.Array).Elements
+	assert.Equal(t, protocol.Integer{Value: -2}, blpop[4])
+	assert.Equal(t, protocol.Array{IsNull: true}, info.Elements[2])
+}
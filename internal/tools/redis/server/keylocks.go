@@ -0,0 +1,63 @@
+package server
+
+import (
+	"sort"
+	"sync"
+)
+
+// keyLockStripes is how many mutexes the keys of writes are spread over
+const keyLockStripes = 256
+
+// keyLocks serializes writes to the same key. Writes share execMu, and the
+// store only locks a key for the duration of one call: without this, two
+// SETs of one key could be applied in one order and reach the AOF and the
+// replicas in the other, and a handler making several store calls (MOVE,
+// EXPIRE reading back the expiry it propagates) could see another write in
+// between.
+//
+// Keys hash to a fixed set of stripes (the database doesn't matter, so MOVE
+// holds its key in both), locked in index order like the store's lockKeys
+// so two multi-key writes can't deadlock.
+type keyLocks [keyLockStripes]sync.Mutex
+
+// stripe hashes key with FNV-1a, like the store's shardIndex
+func stripe(key string) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return int(h % keyLockStripes)
+}
+
+// lock takes the stripes of keys and returns the matching unlock
+func (l *keyLocks) lock(keys []string) func() {
+	switch len(keys) {
+	case 0:
+		return func() {}
+	case 1:
+		mu := &l[stripe(keys[0])]
+		mu.Lock()
+		return mu.Unlock
+	}
+
+	indexes := make([]int, 0, len(keys))
+	for _, key := range keys {
+		indexes = append(indexes, stripe(key))
+	}
+	sort.Ints(indexes)
+
+	locked := make([]int, 0, len(indexes))
+	for i, index := range indexes {
+		if i > 0 && index == indexes[i-1] {
+			continue // several keys in the same stripe
+		}
+		l[index].Lock()
+		locked = append(locked, index)
+	}
+	return func() {
+		for _, index := range locked {
+			l[index].Unlock()
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"cli-t/internal/tools/redis/protocol"
+
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyspaceCommands(t *testing.T) {
+	_, conn, r := connect(t)
+
+	do(t, conn, r, "SET", "user:1", "a")
+	do(t, conn, r, "SET", "user:2", "b")
+	do(t, conn, r, "RPUSH", "queue", "x")
+
+	assert.Equal(t, stringArray([]string{"user:1", "user:2"}), do(t, conn, r, "KEYS", "user:?"))
+	assert.Equal(t, protocol.SimpleString{Value: "list"}, do(t, conn, r, "TYPE", "queue"))
+	assert.Equal(t, protocol.SimpleString{Value: "none"}, do(t, conn, r, "TYPE", "missing"))
+	assert.Equal(t, protocol.Integer{Value: 3}, do(t, conn, r, "DBSIZE"))
+
+	assert.Equal(t, protocol.SimpleString{Value: "OK"}, do(t, conn, r, "RENAME", "user:1", "user:3"))
+	assert.Equal(t, protocol.Error{Message: "ERR no such key"}, do(t, conn, r, "RENAME", "user:1", "x"))
+	assert.Equal(t, protocol.Integer{Value: 0}, do(t, conn, r, "RENAMENX", "user:2", "user:3"))
+	assert.Equal(t, protocol.Integer{Value: 1}, do(t, conn, r, "COPY", "user:2", "copy"))
+	assert.Equal(t, protocol.Integer{Value: 0}, do(t, conn, r, "COPY", "user:2", "copy"))
+	assert.Equal(t, protocol.Integer{Value: 1}, do(t, conn, r, "COPY", "user:2", "copy", "REPLACE"))
+
+	assert.Equal(t, protocol.Integer{Value: 1}, do(t, conn, r, "PEXPIRE", "copy", "100000"))
+	pttl := do(t, conn, r, "PTTL", "copy").(protocol.Integer)
+	assert.InDelta(t, 100000, pttl.Value, 1000)
+	assert.Equal(t, protocol.Integer{Value: 1}, do(t, conn, r, "PERSIST", "copy"))
+	assert.Equal(t, protocol.Integer{Value: -1}, do(t, conn, r, "TTL", "copy"))
+
+	// An EXPIREAT in the past deletes the key
+	assert.Equal(t, protocol.Integer{Value: 1}, do(t, conn, r, "EXPIREAT", "copy", "1"))
+	assert.Equal(t, protocol.Integer{Value: 0}, do(t, conn, r, "EXISTS", "copy"))
+
+	assert.Equal(t, protocol.Integer{Value: 1}, do(t, conn, r, "UNLINK", "queue", "missing"))
+	assert.IsType(t, protocol.BulkString{}, do(t, conn, r, "RANDOMKEY"))
+
+	assert.Equal(t, protocol.SimpleString{Value: "OK"}, do(t, conn, r, "FLUSHALL"))
+	assert.Equal(t, protocol.Integer{Value: 0}, do(t, conn, r, "DBSIZE"))
+	assert.Equal(t, protocol.BulkString{IsNull: true}, do(t, conn, r, "RANDOMKEY"))
+}
+
+func TestMultiKeyCommands(t *testing.T) {
+	_, conn, r := connect(t)
+
+	assert.Equal(t, protocol.SimpleString{Value: "OK"}, do(t, conn, r, "MSET", "a", "1", "b", "2", "c", "3"))
+	do(t, conn, r, "RPUSH", "list", "x")
+
+	assert.Equal(t, protocol.Array{Elements: []protocol.RESPValue{
+		protocol.BulkString{Value: "1"},
+		protocol.BulkString{IsNull: true},
+		protocol.BulkString{Value: "3"},
+		protocol.BulkString{IsNull: true}, // not a string
+	}}, do(t, conn, r, "MGET", "a", "missing", "c", "list"))
+	assert.Equal(t, protocol.Integer{Value: 3}, do(t, conn, r, "EXISTS", "a", "b", "b"))
+	assert.Equal(t, protocol.Integer{Value: 2}, do(t, conn, r, "DEL", "a", "b", "missing"))
+
+	assert.Equal(t, protocol.Error{Message: "ERR wrong number of arguments for 'mset' command"}, do(t, conn, r, "MSET", "a", "1", "b"))
+}
+
+func TestScanCommand(t *testing.T) {
+	_, conn, r := connect(t)
+
+	for i := 0; i < 30; i++ {
+		do(t, conn, r, "SET", "k"+strconv.Itoa(i), "v")
+	}
+	do(t, conn, r, "SADD", "set", "x")
+
+	seen := map[string]bool{}
+	cursor := "0"
+	for {
+		reply := do(t, conn, r, "SCAN", cursor, "MATCH", "k*", "COUNT", "7", "TYPE", "string").(protocol.Array)
+		require.Len(t, reply.Elements, 2)
+		for _, key := range reply.Elements[1].(protocol.Array).Elements {
+			seen[key.(protocol.BulkString).Value] = true
+		}
+		cursor = reply.Elements[0].(protocol.BulkString).Value
+		if cursor == "0" {
+			break
+		}
+	}
+	assert.Len(t, seen, 30)
+
+	assert.Equal(t, protocol.Error{Message: "ERR invalid cursor"}, do(t, conn, r, "SCAN", "abc"))
+	assert.Equal(t, protocol.Error{Message: "ERR syntax error"}, do(t, conn, r, "SCAN", "0", "COUNT"))
+}
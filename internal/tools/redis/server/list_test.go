@@ -0,0 +1,87 @@
+package server
+
+import (
+	"cli-t/internal/tools/redis/protocol"
+
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListCommands(t *testing.T) {
+	_, conn, r := connect(t)
+
+	assert.Equal(t, protocol.Integer{Value: 4}, do(t, conn, r, "RPUSH", "l", "a", "b", "c", "d"))
+	assert.Equal(t, protocol.BulkString{Value: "a"}, do(t, conn, r, "LPOP", "l"))
+	assert.Equal(t, stringArray([]string{"d", "c"}), do(t, conn, r, "RPOP", "l", "2"))
+	assert.Equal(t, protocol.Integer{Value: 1}, do(t, conn, r, "LLEN", "l"))
+	assert.Equal(t, protocol.BulkString{Value: "b"}, do(t, conn, r, "LINDEX", "l", "0"))
+	assert.Equal(t, protocol.SimpleString{Value: "OK"}, do(t, conn, r, "LSET", "l", "0", "B"))
+	assert.Equal(t, protocol.Error{Message: "ERR index out of range"}, do(t, conn, r, "LSET", "l", "9", "x"))
+	assert.Equal(t, protocol.Integer{Value: 2}, do(t, conn, r, "LINSERT", "l", "AFTER", "B", "C"))
+	assert.Equal(t, protocol.Integer{Value: 1}, do(t, conn, r, "LREM", "l", "0", "C"))
+	assert.Equal(t, protocol.SimpleString{Value: "OK"}, do(t, conn, r, "LTRIM", "l", "0", "0"))
+	assert.Equal(t, protocol.BulkString{Value: "B"}, do(t, conn, r, "LMOVE", "l", "other", "LEFT", "RIGHT"))
+	assert.Equal(t, protocol.BulkString{IsNull: true}, do(t, conn, r, "LPOP", "l"))
+	assert.Equal(t, protocol.Array{IsNull: true}, do(t, conn, r, "LPOP", "l", "1"))
+	assert.Equal(t, errNotPositive, do(t, conn, r, "LPOP", "other", "-1"))
+}
+
+func TestBlockingPop_WakesOnPush(t *testing.T) {
+	s, conn, r := connect(t)
+	pusher, pusherR := attach(t, s)
+
+	send(t, conn, string(stringArray([]string{"BLPOP", "jobs", "urgent", "0"}).Serialize()))
+	assert.Eventually(t, func() bool { return s.blocking.waiting(0, "jobs") == 1 }, time.Second, 5*time.Millisecond)
+
+	do(t, pusher, pusherR, "RPUSH", "urgent", "job-1")
+	assert.Equal(t, stringArray([]string{"urgent", "job-1"}), readReply(t, r))
+	assert.Equal(t, 0, s.blocking.waiting(0, "jobs"))
+
+	// Data already there: no blocking, first non-empty key wins
+	do(t, pusher, pusherR, "RPUSH", "jobs", "a", "b")
+	assert.Equal(t, stringArray([]string{"jobs", "b"}), do(t, conn, r, "BRPOP", "urgent", "jobs", "1"))
+}
+
+func TestBlockingPop_Timeout(t *testing.T) {
+	_, conn, r := connect(t)
+
+	start := time.Now()
+	assert.Equal(t, protocol.Array{IsNull: true}, do(t, conn, r, "BLPOP", "empty", "0.1"))
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+
+	assert.Equal(t, protocol.BulkString{IsNull: true}, do(t, conn, r, "BLMOVE", "empty", "dst", "LEFT", "LEFT", "0.05"))
+	assert.Equal(t, protocol.Error{Message: "ERR timeout is negative"}, do(t, conn, r, "BLPOP", "k", "-1"))
+	assert.Equal(t, protocol.Error{Message: "ERR timeout is not a float or out of range"}, do(t, conn, r, "BLPOP", "k", "soon"))
+}
+
+func TestBlockingMove_WakesOnPush(t *testing.T) {
+	s, conn, r := connect(t)
+	pusher, pusherR := attach(t, s)
+
+	send(t, conn, string(stringArray([]string{"BLMOVE", "queue", "processing", "RIGHT", "LEFT", "5"}).Serialize()))
+	assert.Eventually(t, func() bool { return s.blocking.waiting(0, "queue") == 1 }, time.Second, 5*time.Millisecond)
+
+	do(t, pusher, pusherR, "LPUSH", "queue", "task")
+	assert.Equal(t, protocol.BulkString{Value: "task"}, readReply(t, r))
+	assert.Equal(t, stringArray([]string{"task"}), do(t, pusher, pusherR, "LRANGE", "processing", "0", "-1"))
+}
+
+func TestBlockingPop_InsideMultiDoesNotBlock(t *testing.T) {
+	_, conn, r := connect(t)
+
+	do(t, conn, r, "MULTI")
+	do(t, conn, r, "BLPOP", "empty", "0")
+	assert.Equal(t, protocol.Array{Elements: []protocol.RESPValue{protocol.Array{IsNull: true}}}, do(t, conn, r, "EXEC"))
+}
+
+func TestBlockingPop_DisconnectUnblocks(t *testing.T) {
+	s, conn, _ := connect(t)
+
+	send(t, conn, string(stringArray([]string{"BLPOP", "jobs", "0"}).Serialize()))
+	assert.Eventually(t, func() bool { return s.blocking.waiting(0, "jobs") == 1 }, time.Second, 5*time.Millisecond)
+
+	conn.Close()
+	assert.Eventually(t, func() bool { return s.blocking.waiting(0, "jobs") == 0 }, time.Second, 5*time.Millisecond)
+}
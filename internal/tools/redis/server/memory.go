@@ -0,0 +1,120 @@
+package server
+
+import (
+	"cli-t/internal/shared/logger"
+	inmemory "cli-t/internal/shared/store/inmemory"
+	"cli-t/internal/tools/redis/protocol"
+
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// freeMemory makes room before a command that may grow the dataset, like
+// redis' performEvictions. Must be called with execMu held for writing.
+// Returns the OOM error to reply with when the limit can't be met.
+//
+// maxmemory covers every database together. The biggest ones evict first,
+// each down to what the others leave of the limit.
+func (s *Server) freeMemory() protocol.RESPValue {
+	cfg := s.config()
+	if cfg.MaxMemory == 0 {
+		return nil
+	}
+
+	used := make([]int64, len(s.dbs))
+	var total int64
+	for i, db := range s.dbs {
+		used[i] = db.UsedMemory()
+		total += used[i]
+	}
+	if total <= cfg.MaxMemory {
+		return nil
+	}
+
+	order := make([]int, len(s.dbs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return used[order[a]] > used[order[b]] })
+
+	for _, i := range order {
+		if used[i] == 0 {
+			break
+		}
+		err := s.evict(i, max(cfg.MaxMemory-(total-used[i]), 1), cfg)
+		if err == nil {
+			return nil
+		}
+		if cfg.MaxMemoryPolicy == inmemory.NoEviction {
+			break
+		}
+		// Not enough to evict here (volatile policies): try the next one
+		total += s.dbs[i].UsedMemory() - used[i]
+	}
+	return protocol.Error{Message: inmemory.ErrOOM.Error()}
+}
+
+// evict frees database i down to limit bytes
+func (s *Server) evict(i int, limit int64, cfg Config) error {
+	evicted, err := s.dbs[i].FreeMemory(limit)
+	if len(evicted) > 0 {
+		logger.Debug("Evicted keys", "db", i, "count", len(evicted), "policy", cfg.MaxMemoryPolicy)
+		// Replicas and the AOF must forget the keys too
+		s.propagate(dbCommand{i, append([]string{"DEL"}, evicted...)})
+	}
+	return err
+}
+
+// overMemory is the cheap check every command that may grow the dataset
+// runs first: the eviction itself needs execMu exclusively
+func (s *Server) overMemory() bool {
+	limit := s.config().MaxMemory
+	if limit == 0 {
+		return false
+	}
+	s.execMu.RLock() // SWAPDB moves the databases around
+	defer s.execMu.RUnlock()
+	return s.usedMemory() > limit
+}
+
+// usedMemory is the estimated size of every database together
+func (s *Server) usedMemory() int64 {
+	var used int64
+	for _, db := range s.dbs {
+		used += db.UsedMemory()
+	}
+	return used
+}
+
+// memoryUnits are the suffixes accepted by ParseMemory, same as redis.conf
+var memoryUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+	{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+	{"b", 1},
+}
+
+// ParseMemory parses a --maxmemory value: plain bytes or a number with a
+// k/kb/m/mb/g/gb suffix (case-insensitive)
+func ParseMemory(value string) (int64, error) {
+	lower := strings.ToLower(strings.TrimSpace(value))
+
+	multiplier := int64(1)
+	for _, unit := range memoryUnits {
+		if strings.HasSuffix(lower, unit.suffix) {
+			lower = strings.TrimSuffix(lower, unit.suffix)
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil || n < 0 || n > (1<<63-1)/multiplier {
+		return 0, fmt.Errorf("invalid memory size %q", value)
+	}
+	return n * multiplier, nil
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	inmemory "cli-t/internal/shared/store/inmemory"
+	"cli-t/internal/tools/redis/protocol"
+
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxMemoryNoEviction(t *testing.T) {
+	_, conn, r := connect(t)
+	do(t, conn, r, "CONFIG", "SET", "maxmemory", "1000")
+
+	big := strings.Repeat("x", 2000)
+	assert.Equal(t, protocol.SimpleString{Value: "OK"}, do(t, conn, r, "SET", "big", big))
+
+	// Over the limit: writes that grow memory are refused, the rest still work
+	oom := protocol.Error{Message: inmemory.ErrOOM.Error()}
+	assert.Equal(t, oom, do(t, conn, r, "SET", "other", "x"))
+	assert.Equal(t, oom, do(t, conn, r, "RPUSH", "list", "x"))
+	assert.Equal(t, protocol.BulkString{Value: big}, do(t, conn, r, "GET", "big"))
+
+	do(t, conn, r, "MULTI")
+	do(t, conn, r, "SET", "other", "x")
+	assert.Equal(t, oom, do(t, conn, r, "EXEC"))
+
+	assert.Equal(t, protocol.Integer{Value: 1}, do(t, conn, r, "DEL", "big"))
+	assert.Equal(t, protocol.SimpleString{Value: "OK"}, do(t, conn, r, "SET", "other", "x"))
+}
+
+func TestMaxMemoryEvicts(t *testing.T) {
+	_, conn, r := connect(t)
+	do(t, conn, r, "CONFIG", "SET", "maxmemory", "1000", "maxmemory-policy", "allkeys-lru")
+
+	value := strings.Repeat("x", 300)
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		assert.Equal(t, protocol.SimpleString{Value: "OK"}, do(t, conn, r, "SET", key, value))
+	}
+
+	// Each write made room first, so at most the last one is over the limit
+	dbsize := do(t, conn, r, "DBSIZE").(protocol.Integer)
+	assert.Less(t, dbsize.Value, int64(5))
+	assert.Equal(t, protocol.BulkString{Value: value}, do(t, conn, r, "GET", "e"))
+}
+
+func TestMaxMemoryAcrossDatabases(t *testing.T) {
+	_, conn, r := connect(t)
+	do(t, conn, r, "CONFIG", "SET", "maxmemory", "1000", "maxmemory-policy", "allkeys-lru")
+
+	value := strings.Repeat("x", 300)
+	do(t, conn, r, "SELECT", "1")
+	do(t, conn, r, "SET", "a", value)
+	do(t, conn, r, "SET", "b", value)
+
+	// The limit is for all databases: room is made in DB 1, which holds the data
+	do(t, conn, r, "SELECT", "0")
+	do(t, conn, r, "SET", "c", value)
+	do(t, conn, r, "SET", "d", value)
+	assert.Equal(t, protocol.Integer{Value: 2}, do(t, conn, r, "DBSIZE"))
+	do(t, conn, r, "SELECT", "1")
+	assert.Less(t, do(t, conn, r, "DBSIZE").(protocol.Integer).Value, int64(2))
+}
+
+func TestParseMemory(t *testing.T) {
+	for input, want := range map[string]int64{
+		"0": 0, "1024": 1024, "100mb": 100 << 20, "1GB": 1 << 30, "10k": 10000, "5b": 5,
+	} {
+		got, err := ParseMemory(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, want, got, input)
+	}
+
+	for _, input := range []string{"", "mb", "-1", "1tb", "99999999999gb"} {
+		_, err := ParseMemory(input)
+		assert.Error(t, err, input)
+	}
+}
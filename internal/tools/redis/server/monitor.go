@@ -0,0 +1,155 @@
+package server
+
+import (
+	"cli-t/internal/tools/redis/protocol"
+
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// monitors are the clients that ran MONITOR; each gets a line for every
+// command the server processes
+type monitors struct {
+	mu      sync.RWMutex
+	clients map[*client]struct{}
+}
+
+func newMonitors() *monitors {
+	return &monitors{clients: make(map[*client]struct{})}
+}
+
+func (m *monitors) add(c *client) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clients[c] = struct{}{}
+}
+
+func (m *monitors) remove(c *client) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.clients, c)
+}
+
+func (m *monitors) has(c *client) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.clients[c]
+	return ok
+}
+
+// unmonitored are the commands MONITOR doesn't show. Like in redis these
+// are the admin ones: CONFIG SET requirepass and ACL SETUSER ... >password
+// would hand out secrets, REPLCONF, PSYNC & co are the server's own business.
+var unmonitored = func() map[string]bool {
+	names := map[string]bool{}
+	for _, name := range commandCategories["admin"] {
+		names[name] = true
+	}
+	return names
+}()
+
+// feed sends the command c is about to run to every monitor, as redis
+// prints it: +1700000000.123456 [0 127.0.0.1:50000] "set" "k" "v"
+func (m *monitors) feed(c *client, spec *commandSpec, args []protocol.RESPValue) {
+	if unmonitored[spec.name] {
+		return
+	}
+
+	m.mu.RLock()
+	if len(m.clients) == 0 {
+		m.mu.RUnlock()
+		return
+	}
+	// Queued outside the lock like published messages. push never waits for
+	// the monitor's socket: this runs on the goroutine of every command.
+	recipients := make([]*client, 0, len(m.clients))
+	for monitor := range m.clients {
+		recipients = append(recipients, monitor)
+	}
+	m.mu.RUnlock()
+
+	line := protocol.SimpleString{Value: monitorLine(time.Now(), c, args)}
+	for _, monitor := range recipients {
+		monitor.push(line)
+	}
+}
+
+func monitorLine(now time.Time, c *client, args []protocol.RESPValue) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d.%06d [%d %s]", now.Unix(), now.Nanosecond()/1000, c.db, c.addr)
+
+	redacted := redactedArgs(args)
+	for i, arg := range args {
+		b.WriteByte(' ')
+		if i >= redacted {
+			b.WriteString(`"(redacted)"`)
+			continue
+		}
+		value := ""
+		if bulk, ok := arg.(protocol.BulkString); ok {
+			value = bulk.Value
+		}
+		b.WriteString(quoteArg(value))
+	}
+	return b.String()
+}
+
+// redactedArgs returns the index from which arguments are passwords that
+// must not show up in the MONITOR output
+func redactedArgs(args []protocol.RESPValue) int {
+	name, _ := args[0].(protocol.BulkString)
+	switch strings.ToUpper(name.Value) {
+	case "AUTH":
+		return 1
+	case "HELLO":
+		for i := 2; i < len(args); i++ {
+			if opt, ok := args[i].(protocol.BulkString); ok && strings.EqualFold(opt.Value, "AUTH") {
+				return i + 1
+			}
+		}
+	}
+	return len(args)
+}
+
+// quoteArg quotes like redis' sdscatrepr: printable bytes as they are, the
+// usual escapes and \xHH for anything else
+func quoteArg(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; ch {
+		case '\\', '"':
+			b.WriteByte('\\')
+			b.WriteByte(ch)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\a':
+			b.WriteString(`\a`)
+		case '\b':
+			b.WriteString(`\b`)
+		default:
+			if ch < 0x20 || ch > 0x7e {
+				fmt.Fprintf(&b, `\x%02x`, ch)
+			} else {
+				b.WriteByte(ch)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// MONITOR turns the connection into a feed of every processed command
+func (s *Server) handleMonitor(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if c.execing {
+		return protocol.Error{Message: "ERR Command not allowed inside a transaction"}
+	}
+	s.monitors.add(c)
+	return protocol.SimpleString{Value: "OK"}
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"cli-t/internal/tools/redis/protocol"
+
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonitor(t *testing.T) {
+	s, conn, r := connect(t)
+	mon, monR := attach(t, s)
+
+	assert.Equal(t, protocol.SimpleString{Value: "OK"}, do(t, mon, monR, "MONITOR"))
+	assert.Contains(t, do(t, conn, r, "CLIENT", "LIST").(protocol.BulkString).Value, "flags=O")
+	line, ok := readReply(t, monR).(protocol.SimpleString)
+	require.True(t, ok)
+	assert.True(t, strings.HasSuffix(line.Value, `"CLIENT" "LIST"`), line.Value)
+
+	do(t, conn, r, "SET", "k", "a \"quoted\"\nvalue")
+	line = readReply(t, monR).(protocol.SimpleString)
+	assert.Regexp(t, regexp.MustCompile(`^\d+\.\d{6} \[0 127\.0\.0\.1:\d+\] "SET" "k" "a \\"quoted\\"\\nvalue"$`), line.Value)
+
+	// Passwords never show up
+	do(t, conn, r, "AUTH", "secret")
+	line = readReply(t, monR).(protocol.SimpleString)
+	assert.True(t, strings.HasSuffix(line.Value, `"AUTH" "(redacted)"`), line.Value)
+
+	mon.Close()
+	assert.Eventually(t, func() bool {
+		s.monitors.mu.RLock()
+		defer s.monitors.mu.RUnlock()
+		return len(s.monitors.clients) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestMonitor_SkipsAdminCommands(t *testing.T) {
+	s, conn, r := connect(t)
+	mon, monR := attach(t, s)
+	do(t, mon, monR, "MONITOR")
+
+	// Both carry passwords: they must not reach the monitor at all
+	do(t, conn, r, "ACL", "SETUSER", "alice", "on", ">secret")
+	do(t, conn, r, "CONFIG", "SET", "requirepass", "secret")
+	do(t, conn, r, "AUTH", "secret")
+	do(t, conn, r, "PING")
+
+	line := readReply(t, monR).(protocol.SimpleString)
+	assert.True(t, strings.HasSuffix(line.Value, `"AUTH" "(redacted)"`), line.Value)
+	line = readReply(t, monR).(protocol.SimpleString)
+	assert.True(t, strings.HasSuffix(line.Value, `"PING"`), line.Value)
+}
+
+func TestMonitor_SlowMonitorIsDropped(t *testing.T) {
+	s, conn, r := connect(t)
+	mon, monR := attach(t, s)
+	do(t, mon, monR, "MONITOR")
+
+	// The monitor stops reading: commands must not wait for it, and once
+	// its queue is over the limit it is disconnected
+	value := strings.Repeat("x", 1<<20)
+	for i := 0; i < 2*pushOutputLimit/len(value); i++ {
+		do(t, conn, r, "SET", "k", value)
+	}
+	assert.Eventually(t, func() bool {
+		s.monitors.mu.RLock()
+		defer s.monitors.mu.RUnlock()
+		return len(s.monitors.clients) == 0
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestMonitor_NotInTransaction(t *testing.T) {
+	_, conn, r := connect(t)
+
+	do(t, conn, r, "MULTI")
+	do(t, conn, r, "MONITOR")
+	assert.Equal(t, protocol.Array{Elements: []protocol.RESPValue{
+		protocol.Error{Message: "ERR Command not allowed inside a transaction"},
+	}}, do(t, conn, r, "EXEC"))
+}
@@ -0,0 +1,201 @@
+package server
+
+import (
+	"cli-t/internal/shared/logger"
+
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// KeyspaceEvents selects the keyspace notifications that get published,
+// the notify-keyspace-events flags of redis
+type KeyspaceEvents uint32
+
+const (
+	notifyKeyspace KeyspaceEvents = 1 << iota // K: __keyspace@<db>__:<key>, the event as message
+	notifyKeyevent                            // E: __keyevent@<db>__:<event>, the key as message
+	notifyGeneric                             // g: DEL, EXPIRE, RENAME, ...
+	notifyString                              // $
+	notifyList                                // l
+	notifySet                                 // s
+	notifyHash                                // h
+	notifyZSet                                // z
+	notifyExpired                             // x: a key's TTL ran out
+	notifyEvicted                             // e: maxmemory evicted a key
+	notifyStream                              // t
+
+	// notifyAll is "A", every class but K and E
+	notifyAll = notifyGeneric | notifyString | notifyList | notifySet | notifyHash |
+		notifyZSet | notifyExpired | notifyEvicted | notifyStream
+)
+
+// keyspaceEventFlags in the order CONFIG GET prints them
+var keyspaceEventFlags = []struct {
+	char byte
+	flag KeyspaceEvents
+}{
+	{'g', notifyGeneric}, {'$', notifyString}, {'l', notifyList}, {'s', notifySet},
+	{'h', notifyHash}, {'z', notifyZSet}, {'x', notifyExpired}, {'e', notifyEvicted},
+	{'t', notifyStream}, {'K', notifyKeyspace}, {'E', notifyKeyevent},
+}
+
+var errKeyspaceEvents = errors.New("Invalid event class character. Use 'Ag$lshzxetKE'.")
+
+// ParseKeyspaceEvents parses a notify-keyspace-events value like "KEA" or
+// "Kx", "" disables notifications
+func ParseKeyspaceEvents(value string) (KeyspaceEvents, error) {
+	var events KeyspaceEvents
+	for i := 0; i < len(value); i++ {
+		if value[i] == 'A' {
+			events |= notifyAll
+			continue
+		}
+		found := false
+		for _, f := range keyspaceEventFlags {
+			if f.char == value[i] {
+				events |= f.flag
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, errKeyspaceEvents
+		}
+	}
+	return events, nil
+}
+
+func (e KeyspaceEvents) String() string {
+	var b strings.Builder
+	for _, f := range keyspaceEventFlags {
+		if f.flag&notifyAll != 0 && e&notifyAll == notifyAll {
+			if f.flag == notifyGeneric {
+				b.WriteByte('A')
+			}
+			continue
+		}
+		if e&f.flag != 0 {
+			b.WriteByte(f.char)
+		}
+	}
+	return b.String()
+}
+
+// keyEventClasses maps the events the store reports to their class;
+// events missing here are generic
+var keyEventClasses = map[string]KeyspaceEvents{
+	"set": notifyString, "incrby": notifyString, "decrby": notifyString,
+
+	"lpush": notifyList, "rpush": notifyList, "lpop": notifyList, "rpop": notifyList,
+	"lset": notifyList, "lrem": notifyList, "ltrim": notifyList, "linsert": notifyList,
+
+	"hset": notifyHash, "hdel": notifyHash, "hincrby": notifyHash,
+	"sadd": notifySet, "srem": notifySet,
+	"zadd": notifyZSet, "zincr": notifyZSet, "zrem": notifyZSet,
+
+	"xadd": notifyStream, "xdel": notifyStream, "xtrim": notifyStream, "xsetid": notifyStream,
+	"xgroup-create": notifyStream, "xgroup-setid": notifyStream, "xgroup-destroy": notifyStream,
+	"xgroup-createconsumer": notifyStream, "xgroup-delconsumer": notifyStream,
+
+	"expired": notifyExpired,
+	"evicted": notifyEvicted,
+}
+
+// keyEventQueueLimit is how many events may wait to be published. Publishing
+// only queues the messages on the subscribers, so the queue stays short
+// unless events come in faster than they can be formatted; past the limit
+// they are dropped rather than piling up.
+const keyEventQueueLimit = 1 << 16
+
+type keyEvent struct {
+	db         int
+	event, key string
+}
+
+// keyspaceNotifier publishes the store's key events as keyspace
+// notifications.
+//
+// The store reports events with a shard lock held, so they are only queued
+// there; a goroutine started for the first queued event publishes them in
+// order and exits once the queue is empty. That keeps socket writes out of
+// the store locks, and events from the expiry worker need no client to
+// deliver them.
+type keyspaceNotifier struct {
+	pubsub *pubSub
+	events atomic.Uint32 // KeyspaceEvents
+
+	mu       sync.Mutex
+	queue    []keyEvent
+	draining bool
+	dropped  int // events dropped since the queue was last full
+}
+
+func newKeyspaceNotifier(ps *pubSub, events KeyspaceEvents) *keyspaceNotifier {
+	n := &keyspaceNotifier{pubsub: ps}
+	n.setEvents(events)
+	return n
+}
+
+func (n *keyspaceNotifier) setEvents(events KeyspaceEvents) {
+	n.events.Store(uint32(events))
+}
+
+// keyEvent is the event hook of database db's store
+func (n *keyspaceNotifier) keyEvent(db int, event, key string) {
+	events := KeyspaceEvents(n.events.Load())
+	if events&(notifyKeyspace|notifyKeyevent) == 0 {
+		return
+	}
+	class, ok := keyEventClasses[event]
+	if !ok {
+		class = notifyGeneric
+	}
+	if events&class == 0 {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if len(n.queue) >= keyEventQueueLimit {
+		if n.dropped == 0 {
+			logger.Warn("Keyspace notification queue full, dropping events", "limit", keyEventQueueLimit)
+		}
+		n.dropped++
+		return
+	}
+	n.queue = append(n.queue, keyEvent{db, event, key})
+	if !n.draining {
+		n.draining = true
+		go n.drain()
+	}
+}
+
+func (n *keyspaceNotifier) drain() {
+	for {
+		n.mu.Lock()
+		queue := n.queue
+		n.queue = nil
+		n.dropped = 0
+		if len(queue) == 0 {
+			n.draining = false
+			n.mu.Unlock()
+			return
+		}
+		n.mu.Unlock()
+
+		// Read again: CONFIG SET may have turned K or E off meanwhile
+		events := KeyspaceEvents(n.events.Load())
+		for _, e := range queue {
+			db := strconv.Itoa(e.db)
+			if events&notifyKeyspace != 0 {
+				n.pubsub.publish("__keyspace@"+db+"__:"+e.key, e.event)
+			}
+			if events&notifyKeyevent != 0 {
+				n.pubsub.publish("__keyevent@"+db+"__:"+e.event, e.key)
+			}
+		}
+	}
+}
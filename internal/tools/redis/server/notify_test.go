@@ -0,0 +1,81 @@
+package server
+
+import (
+	"cli-t/internal/tools/redis/protocol"
+
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKeyspaceEvents(t *testing.T) {
+	tests := []struct {
+		value, canonical string
+	}{
+		{"", ""},
+		{"KEA", "AKE"},
+		{"Ex", "xE"},
+		{"K$lg", "g$lK"},
+		{"Eg$lshzxet", "AE"},
+	}
+	for _, tt := range tests {
+		events, err := ParseKeyspaceEvents(tt.value)
+		require.NoError(t, err, tt.value)
+		assert.Equal(t, tt.canonical, events.String(), tt.value)
+	}
+
+	_, err := ParseKeyspaceEvents("KEq")
+	assert.Error(t, err)
+}
+
+func TestKeyspaceNotifications(t *testing.T) {
+	s, conn, r := connect(t)
+	sub, subR := attach(t, s)
+
+	assert.Equal(t, protocol.SimpleString{Value: "OK"}, do(t, conn, r, "CONFIG", "SET", "notify-keyspace-events", "KEA"))
+	assert.Equal(t, stringArray([]string{"notify-keyspace-events", "AKE"}), do(t, conn, r, "CONFIG", "GET", "notify-keyspace-events"))
+	do(t, sub, subR, "PSUBSCRIBE", "__key*__:*")
+
+	message := func(channel, msg string) protocol.RESPValue {
+		return stringArray([]string{"pmessage", "__key*__:*", channel, msg})
+	}
+
+	do(t, conn, r, "SET", "k", "v")
+	assert.Equal(t, message("__keyspace@0__:k", "set"), readReply(t, subR))
+	assert.Equal(t, message("__keyevent@0__:set", "k"), readReply(t, subR))
+
+	// Nothing is published for a DEL that deleted nothing
+	do(t, conn, r, "DEL", "missing", "k")
+	assert.Equal(t, message("__keyspace@0__:k", "del"), readReply(t, subR))
+	assert.Equal(t, message("__keyevent@0__:del", "k"), readReply(t, subR))
+
+	// Keys removed by the expiry worker are published too
+	do(t, conn, r, "CONFIG", "SET", "notify-keyspace-events", "Ex")
+	do(t, conn, r, "SET", "temp", "v", "PX", "10")
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 1, s.dbs[0].CleanExpiredKeys())
+	assert.Equal(t, message("__keyevent@0__:expired", "temp"), readReply(t, subR))
+
+	// Disabled again: the next message seen is the PUBLISH below
+	do(t, conn, r, "CONFIG", "SET", "notify-keyspace-events", "")
+	do(t, conn, r, "SET", "k", "v")
+	do(t, conn, r, "PUBLISH", "__keyspace@0__:marker", "x")
+	assert.Equal(t, message("__keyspace@0__:marker", "x"), readReply(t, subR))
+
+	reply, ok := do(t, conn, r, "CONFIG", "SET", "notify-keyspace-events", "KQ").(protocol.Error)
+	require.True(t, ok)
+	assert.Contains(t, reply.Message, "Invalid event class character")
+}
+
+func TestKeyspaceNotifications_QueueIsBounded(t *testing.T) {
+	n := newKeyspaceNotifier(newPubSub(), notifyKeyevent|notifyAll)
+
+	// Stand in for a drain that can't keep up
+	n.draining = true
+	for i := 0; i < keyEventQueueLimit+100; i++ {
+		n.keyEvent(0, "set", "k")
+	}
+	assert.Len(t, n.queue, keyEventQueueLimit)
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"cli-t/internal/shared/glob"
+	"cli-t/internal/shared/logger"
+	"cli-t/internal/tools/redis/protocol"
+
+	"sort"
+	"sync"
+)
+
+// pubSub is the message broker: channel and pattern subscriptions
+// mapped to the clients that should receive them.
+type pubSub struct {
+	mu       sync.RWMutex
+	channels map[string]map[*client]struct{}
+	patterns map[string]map[*client]struct{}
+}
+
+func newPubSub() *pubSub {
+	return &pubSub{
+		channels: make(map[string]map[*client]struct{}),
+		patterns: make(map[string]map[*client]struct{}),
+	}
+}
+
+// subscribe adds c to channel. Returns c's total subscription count.
+func (ps *pubSub) subscribe(c *client, channel string) int {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if _, ok := c.channels[channel]; !ok {
+		c.channels[channel] = struct{}{}
+		if ps.channels[channel] == nil {
+			ps.channels[channel] = make(map[*client]struct{})
+		}
+		ps.channels[channel][c] = struct{}{}
+	}
+	return len(c.channels) + len(c.patterns)
+}
+
+// unsubscribe removes c from channel. Returns c's remaining subscription count.
+func (ps *pubSub) unsubscribe(c *client, channel string) int {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if _, ok := c.channels[channel]; ok {
+		delete(c.channels, channel)
+		delete(ps.channels[channel], c)
+		if len(ps.channels[channel]) == 0 {
+			delete(ps.channels, channel)
+		}
+	}
+	return len(c.channels) + len(c.patterns)
+}
+
+func (ps *pubSub) psubscribe(c *client, pattern string) int {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if _, ok := c.patterns[pattern]; !ok {
+		c.patterns[pattern] = struct{}{}
+		if ps.patterns[pattern] == nil {
+			ps.patterns[pattern] = make(map[*client]struct{})
+		}
+		ps.patterns[pattern][c] = struct{}{}
+	}
+	return len(c.channels) + len(c.patterns)
+}
+
+func (ps *pubSub) punsubscribe(c *client, pattern string) int {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if _, ok := c.patterns[pattern]; ok {
+		delete(c.patterns, pattern)
+		delete(ps.patterns[pattern], c)
+		if len(ps.patterns[pattern]) == 0 {
+			delete(ps.patterns, pattern)
+		}
+	}
+	return len(c.channels) + len(c.patterns)
+}
+
+// subscriptions returns c's channels (or patterns), sorted
+func (ps *pubSub) subscriptions(c *client, patterns bool) []string {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	set := c.channels
+	if patterns {
+		set = c.patterns
+	}
+
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (ps *pubSub) subscriptionCount(c *client) int {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	return len(c.channels) + len(c.patterns)
+}
+
+// counts returns the channel and pattern subscription counts separately
+func (ps *pubSub) counts(c *client) (channels, patterns int) {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	return len(c.channels), len(c.patterns)
+}
+
+// removeClient drops every subscription of a disconnecting client
+func (ps *pubSub) removeClient(c *client) {
+	for _, channel := range ps.subscriptions(c, false) {
+		ps.unsubscribe(c, channel)
+	}
+	for _, pattern := range ps.subscriptions(c, true) {
+		ps.punsubscribe(c, pattern)
+	}
+}
+
+// publish sends message to every subscriber of channel and every matching
+// pattern subscriber. Returns the number of clients that received it.
+func (ps *pubSub) publish(channel, message string) int {
+	type delivery struct {
+		c     *client
+		reply protocol.RESPValue
+	}
+
+	// Collect recipients under the lock, queue outside of it. push doesn't
+	// wait for the socket, a subscriber that stops reading is dropped once
+	// its queue is full instead of stalling every publisher.
+	ps.mu.RLock()
+	deliveries := []delivery{}
+	for c := range ps.channels[channel] {
+		deliveries = append(deliveries, delivery{c, stringPush("message", channel, message)})
+	}
+	for pattern, subscribers := range ps.patterns {
+		if !glob.Match(pattern, channel) {
+			continue
+		}
+		for c := range subscribers {
+			deliveries = append(deliveries, delivery{c, stringPush("pmessage", pattern, channel, message)})
+		}
+	}
+	ps.mu.RUnlock()
+
+	for _, d := range deliveries {
+		if err := d.c.push(d.reply); err != nil {
+			logger.Debug("Failed to deliver message", "channel", channel, "error", err)
+		}
+	}
+	return len(deliveries)
+}
+
+// activeChannels lists channels with at least one subscriber matching pattern
+// ("" matches all)
+func (ps *pubSub) activeChannels(pattern string) []string {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	channels := []string{}
+	for channel := range ps.channels {
+		if pattern == "" || glob.Match(pattern, channel) {
+			channels = append(channels, channel)
+		}
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+func (ps *pubSub) numSub(channel string) int {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	return len(ps.channels[channel])
+}
+
+func (ps *pubSub) numPat() int {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	return len(ps.patterns)
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"cli-t/internal/tools/redis/protocol"
+
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPubSub_ChannelAndPattern(t *testing.T) {
+	s, sub, subR := connect(t)
+	pub, pubR := attach(t, s)
+
+	send(t, sub, string(stringArray([]string{"SUBSCRIBE", "news", "alerts"}).Serialize()))
+	assert.Equal(t, resp2(subscriptionReply("subscribe", "news", 1)), readReply(t, subR))
+	assert.Equal(t, resp2(subscriptionReply("subscribe", "alerts", 2)), readReply(t, subR))
+
+	assert.Equal(t, resp2(subscriptionReply("psubscribe", "news.*", 3)), do(t, sub, subR, "PSUBSCRIBE", "news.*"))
+
+	// Only the exact channel subscription matches "news"
+	assert.Equal(t, protocol.Integer{Value: 1}, do(t, pub, pubR, "PUBLISH", "news", "hello"))
+	assert.Equal(t, stringArray([]string{"message", "news", "hello"}), readReply(t, subR))
+
+	// Only the pattern matches "news.sport"
+	assert.Equal(t, protocol.Integer{Value: 1}, do(t, pub, pubR, "PUBLISH", "news.sport", "goal"))
+	assert.Equal(t, stringArray([]string{"pmessage", "news.*", "news.sport", "goal"}), readReply(t, subR))
+
+	assert.Equal(t, protocol.Integer{Value: 0}, do(t, pub, pubR, "PUBLISH", "nobody", "x"))
+
+	// Introspection
+	assert.Equal(t, stringArray([]string{"alerts", "news"}), do(t, pub, pubR, "PUBSUB", "CHANNELS"))
+	assert.Equal(t, stringArray([]string{"news"}), do(t, pub, pubR, "PUBSUB", "CHANNELS", "n*"))
+	assert.Equal(t, protocol.Array{Elements: []protocol.RESPValue{
+		protocol.BulkString{Value: "news"}, protocol.Integer{Value: 1},
+		protocol.BulkString{Value: "none"}, protocol.Integer{Value: 0},
+	}}, do(t, pub, pubR, "PUBSUB", "NUMSUB", "news", "none"))
+	assert.Equal(t, protocol.Integer{Value: 1}, do(t, pub, pubR, "PUBSUB", "NUMPAT"))
+}
+
+func TestPubSub_SubscribedMode(t *testing.T) {
+	_, conn, r := connect(t)
+
+	do(t, conn, r, "SUBSCRIBE", "ch")
+
+	reply, ok := do(t, conn, r, "GET", "key").(protocol.Error)
+	assert.True(t, ok)
+	assert.Contains(t, reply.Message, "only (P)SUBSCRIBE")
+
+	assert.Equal(t, stringArray([]string{"pong", ""}), do(t, conn, r, "PING"))
+
+	// Leaving every channel restores normal mode
+	assert.Equal(t, resp2(subscriptionReply("unsubscribe", "ch", 0)), do(t, conn, r, "UNSUBSCRIBE"))
+	assert.Equal(t, protocol.SimpleString{Value: "PONG"}, do(t, conn, r, "PING"))
+}
+
+func TestPubSub_DisconnectCleansUp(t *testing.T) {
+	s, conn, r := connect(t)
+
+	do(t, conn, r, "SUBSCRIBE", "ch")
+	assert.Equal(t, 1, s.pubsub.numSub("ch"))
+
+	conn.Close()
+	assert.Eventually(t, func() bool { return s.pubsub.numSub("ch") == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestPubSub_SlowSubscriberIsDropped(t *testing.T) {
+	s, sub, subR := connect(t)
+	pub, pubR := attach(t, s)
+
+	do(t, sub, subR, "SUBSCRIBE", "ch")
+
+	// The subscriber stops reading: PUBLISH must not wait for it, and once
+	// its queue is over the limit it is disconnected
+	message := strings.Repeat("x", 1<<20)
+	for i := 0; i < 2*pushOutputLimit/len(message); i++ {
+		do(t, pub, pubR, "PUBLISH", "ch", message)
+	}
+	assert.Eventually(t, func() bool {
+		return s.pubsub.numSub("ch") == 0
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, protocol.Integer{Value: 0}, do(t, pub, pubR, "PUBLISH", "ch", "late"))
+}
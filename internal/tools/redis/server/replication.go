@@ -0,0 +1,745 @@
+package server
+
+import (
+	"cli-t/internal/shared/logger"
+	"cli-t/internal/tools/redis/persistence"
+	"cli-t/internal/tools/redis/protocol"
+
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	replicaOutputLimit = 256 << 20 // bytes queued for a slow replica before it is dropped
+	replicaRetryDelay  = time.Second
+	replicaAckPeriod   = time.Second
+	replicaDialTimeout = 5 * time.Second
+)
+
+var (
+	errReadOnly    = errors.New("READONLY You can't write against a read only replica.")
+	errLinkStopped = errors.New("replication link stopped")
+)
+
+// replication is the primary/replica state. Every instance starts as a
+// primary; REPLICAOF (or --replicaof) turns it into a replica of another.
+type replication struct {
+	mu sync.Mutex
+
+	replID     string // identifies the history the offset counts
+	offset     int64  // bytes of write stream produced (primary) or applied (replica)
+	selectedDB int    // database the stream is in, -1 when unknown
+
+	replicas map[*client]*replica // replicas fed by this instance
+	link     *replicaLink         // non-nil while following a primary
+}
+
+func newReplication() *replication {
+	return &replication{
+		replID:     newReplID(),
+		selectedDB: -1,
+		replicas:   make(map[*client]*replica),
+	}
+}
+
+// newReplID returns 40 random hex characters, like redis' run ids
+func newReplID() string {
+	id := make([]byte, 20)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// following reports whether this instance is a replica
+func (r *replication) following() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.link != nil
+}
+
+// feed appends commands to the replication stream: the offset moves and
+// every replica gets a copy. Callers hold propMu, so the stream keeps the
+// order the writes were propagated in.
+func (r *replication) feed(commands [][]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Passed on from a primary, they may SELECT anything
+	r.selectedDB = -1
+	r.enqueue(commands)
+}
+
+// feedWrites appends writes made here, with the SELECTs they need
+func (r *replication) feedWrites(commands []dbCommand) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.enqueue(withSelect(commands, &r.selectedDB))
+}
+
+// Private helper - assumes r.mu is held!
+func (r *replication) enqueue(commands [][]string) {
+	// A primary without replicas has nobody to count bytes for
+	if len(r.replicas) == 0 && r.link == nil {
+		return
+	}
+
+	buf := encodeCommands(commands)
+	r.offset += int64(len(buf))
+	for _, rep := range r.replicas {
+		rep.enqueue(buf)
+	}
+}
+
+// dropReplicas disconnects every replica, they reconnect and full sync again
+func (r *replication) dropReplicas() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for c := range r.replicas {
+		c.conn.Close()
+	}
+}
+
+func (r *replication) removeReplica(c *client) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.replicas, c)
+}
+
+// encodeCommands serializes commands the way they travel to replicas.
+// Both ends encode the same way, so offsets agree.
+func encodeCommands(commands [][]string) []byte {
+	var buf []byte
+	for _, args := range commands {
+		buf = append(buf, stringArray(args).Serialize()...)
+	}
+	return buf
+}
+
+// replica is a connected replica as seen from its primary
+type replica struct {
+	c          *client
+	listenPort string // announced with REPLCONF listening-port
+	ackOffset  int64  // last offset the replica confirmed, guarded by replication.mu
+	online     bool   // snapshot sent, streaming commands
+
+	mu      sync.Mutex
+	pending [][]byte
+	size    int
+	wake    chan struct{} // capacity 1, signalled when pending grows
+}
+
+// enqueue never blocks the writer: the stream is buffered per replica and a
+// replica that falls too far behind is dropped instead
+func (rep *replica) enqueue(buf []byte) {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	if rep.size+len(buf) > replicaOutputLimit {
+		logger.Warn("Replica output buffer limit reached, dropping it", "addr", rep.c.conn.RemoteAddr().String())
+		rep.c.conn.Close()
+		return
+	}
+	rep.pending = append(rep.pending, buf)
+	rep.size += len(buf)
+
+	select {
+	case rep.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (rep *replica) take() [][]byte {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	pending := rep.pending
+	rep.pending, rep.size = nil, 0
+	return pending
+}
+
+// SYNC: full resync with the snapshot only, the original protocol
+func (s *Server) handleSync(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	return s.fullResync(c, false)
+}
+
+// PSYNC replid offset: we have no backlog, so every PSYNC is a full resync
+func (s *Server) handlePSync(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	return s.fullResync(c, true)
+}
+
+// fullResync runs exclusively: the snapshot and the start of the stream
+// happen with no write in between, so the replica misses nothing
+func (s *Server) fullResync(c *client, announce bool) protocol.RESPValue {
+	s.repl.mu.Lock()
+	if _, already := s.repl.replicas[c]; already {
+		s.repl.mu.Unlock()
+		return protocol.Error{Message: "ERR replica already syncing"}
+	}
+	if s.repl.link != nil && s.repl.link.state() != linkConnected {
+		s.repl.mu.Unlock()
+		return protocol.Error{Message: "NOMASTERLINK Can't SYNC while not connected with my master"}
+	}
+	rep := &replica{c: c, listenPort: c.replicaPort, wake: make(chan struct{}, 1)}
+	s.repl.replicas[c] = rep
+	replID, offset := s.repl.replID, s.repl.offset
+	s.repl.mu.Unlock()
+
+	copyData := s.beginDataset()
+	if announce {
+		// Written right away, it must reach the replica before the snapshot
+		c.writeReply(protocol.SimpleString{Value: fmt.Sprintf("FULLRESYNC %s %d", replID, offset)}, true)
+	}
+
+	logger.Info("Replica asks for synchronization", "addr", c.conn.RemoteAddr().String())
+	go s.serveReplica(rep, copyData)
+	return rawReply(nil)
+}
+
+// serveReplica copies and sends the snapshot, then streams writes until
+// the replica goes away. Encoding and sending run without any lock held.
+func (s *Server) serveReplica(rep *replica, copyData func() persistence.Dataset) {
+	data := copyData()
+	logger.Debug("Snapshot for replica taken", "addr", rep.c.conn.RemoteAddr().String(), "keys", data.Keys())
+
+	var rdb bytes.Buffer
+	if err := persistence.WriteRDB(&rdb, data); err != nil {
+		logger.Error("Encoding the snapshot for a replica failed", "error", err)
+		rep.c.conn.Close()
+		return
+	}
+
+	payload := append([]byte(fmt.Sprintf("$%d\r\n", rdb.Len())), rdb.Bytes()...)
+	if err := rep.c.writeReply(rawReply(payload), true); err != nil {
+		rep.c.conn.Close()
+		return
+	}
+
+	s.repl.mu.Lock()
+	rep.online = true
+	s.repl.mu.Unlock()
+	logger.Info("Synchronization with replica succeeded", "addr", rep.c.conn.RemoteAddr().String())
+
+	for {
+		select {
+		case <-rep.wake:
+		case <-rep.c.disconnected:
+			return
+		case <-s.shutdown:
+			return
+		}
+
+		pending := rep.take()
+		for i, buf := range pending {
+			if err := rep.c.writeReply(rawReply(buf), i == len(pending)-1); err != nil {
+				rep.c.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// REPLCONF option value: the handshake and the replica's offset acks
+func (s *Server) handleReplConf(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	strs, ok := bulkStrings(args)
+	if !ok || len(strs)%2 == 0 {
+		return protocol.Error{Message: "ERR syntax error"}
+	}
+
+	for i := 1; i < len(strs); i += 2 {
+		switch strings.ToLower(strs[i]) {
+		case "listening-port":
+			if _, err := strconv.Atoi(strs[i+1]); err != nil {
+				return protocol.Error{Message: "ERR value is not an integer or out of range"}
+			}
+			c.replicaPort = strs[i+1]
+		case "capa":
+			// nothing optional to negotiate
+		case "ack":
+			offset, err := strconv.ParseInt(strs[i+1], 10, 64)
+			if err == nil {
+				s.repl.mu.Lock()
+				if rep := s.repl.replicas[c]; rep != nil {
+					rep.ackOffset = offset
+				}
+				s.repl.mu.Unlock()
+			}
+			return rawReply(nil) // acks are never answered
+		default:
+			return protocol.Error{Message: "ERR Unrecognized REPLCONF option: " + strs[i]}
+		}
+	}
+	return protocol.SimpleString{Value: "OK"}
+}
+
+// Replica side
+
+type linkState string
+
+const (
+	linkConnect    linkState = "connect"    // waiting to (re)connect
+	linkConnecting linkState = "connecting" // handshake
+	linkSync       linkState = "sync"       // receiving the snapshot
+	linkConnected  linkState = "connected"  // streaming
+)
+
+// replicaLink is the connection to the primary we follow
+type replicaLink struct {
+	host string
+	port string
+	stop chan struct{}
+
+	mu       sync.Mutex
+	conn     net.Conn
+	current  linkState
+	lastIO   time.Time
+	stopOnce sync.Once
+}
+
+func (l *replicaLink) addr() string {
+	return net.JoinHostPort(l.host, l.port)
+}
+
+func (l *replicaLink) state() linkState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.current
+}
+
+func (l *replicaLink) setState(state linkState) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.current = state
+	l.lastIO = time.Now()
+}
+
+// setConn records the connection so close can interrupt a blocked read
+func (l *replicaLink) setConn(conn net.Conn) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	select {
+	case <-l.stop:
+		return false
+	default:
+	}
+	l.conn = conn
+	return true
+}
+
+func (l *replicaLink) close() {
+	l.stopOnce.Do(func() {
+		close(l.stop)
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.conn != nil {
+			l.conn.Close()
+		}
+	})
+}
+
+// REPLICAOF host port | REPLICAOF NO ONE (SLAVEOF is the old name).
+// Runs exclusively, so no replicated write is applied after the switch.
+func (s *Server) handleReplicaOf(args []protocol.RESPValue) protocol.RESPValue {
+	strs, ok := bulkStrings(args)
+	if !ok {
+		return protocol.Error{Message: "ERR syntax error"}
+	}
+
+	if strings.EqualFold(strs[1], "no") && strings.EqualFold(strs[2], "one") {
+		if s.stopReplication() {
+			logger.Info("MASTER MODE enabled (user request)")
+		}
+		return protocol.SimpleString{Value: "OK"}
+	}
+
+	port, err := strconv.Atoi(strs[2])
+	if err != nil || port <= 0 || port > 65535 {
+		return protocol.Error{Message: "ERR Invalid master port"}
+	}
+
+	if link := s.currentLink(); link != nil && link.host == strs[1] && link.port == strs[2] {
+		return protocol.SimpleString{Value: "OK Already connected to specified master"}
+	}
+	s.startReplication(strs[1], strs[2])
+	return protocol.SimpleString{Value: "OK"}
+}
+
+func (s *Server) currentLink() *replicaLink {
+	s.repl.mu.Lock()
+	defer s.repl.mu.Unlock()
+	return s.repl.link
+}
+
+// startReplication (re)points this instance at a primary
+func (s *Server) startReplication(host, port string) {
+	link := &replicaLink{host: host, port: port, stop: make(chan struct{}), current: linkConnect}
+
+	s.repl.mu.Lock()
+	previous := s.repl.link
+	s.repl.link = link
+	s.repl.mu.Unlock()
+
+	if previous != nil {
+		previous.close()
+	}
+
+	logger.Info("Connecting to MASTER", "addr", link.addr())
+	go s.runReplicaLink(link)
+}
+
+// stopReplication turns a replica into a primary, keeping its dataset.
+// A new replication id makes its own replicas resync.
+func (s *Server) stopReplication() bool {
+	s.repl.mu.Lock()
+	link := s.repl.link
+	s.repl.link = nil
+	if link != nil {
+		s.repl.replID = newReplID()
+	}
+	s.repl.mu.Unlock()
+
+	if link == nil {
+		return false
+	}
+	link.close()
+	s.repl.dropReplicas()
+	return true
+}
+
+// runReplicaLink keeps following the primary, reconnecting after errors,
+// until the link is replaced, stopped, or the server shuts down
+func (s *Server) runReplicaLink(link *replicaLink) {
+	for {
+		err := s.syncWithPrimary(link)
+
+		select {
+		case <-link.stop:
+			return
+		case <-s.shutdown:
+			return
+		default:
+		}
+
+		link.setState(linkConnect)
+		logger.Warn("Connection with master lost, retrying", "addr", link.addr(), "error", err)
+
+		select {
+		case <-link.stop:
+			return
+		case <-s.shutdown:
+			return
+		case <-time.After(replicaRetryDelay):
+		}
+	}
+}
+
+// syncWithPrimary runs one connection: handshake, full sync, then applying
+// the write stream until an error
+func (s *Server) syncWithPrimary(link *replicaLink) error {
+	link.setState(linkConnecting)
+	conn, err := net.DialTimeout("tcp", link.addr(), replicaDialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if !link.setConn(conn) {
+		return errLinkStopped
+	}
+
+	writer := bufio.NewWriter(conn)
+	reader := protocol.NewReader(conn)
+	call := func(args ...string) (protocol.RESPValue, error) {
+		if _, err := writer.Write(stringArray(args).Serialize()); err != nil {
+			return nil, err
+		}
+		if err := writer.Flush(); err != nil {
+			return nil, err
+		}
+		reply, err := reader.ReadValue()
+		if err != nil {
+			return nil, err
+		}
+		if errReply, failed := reply.(protocol.Error); failed {
+			return nil, fmt.Errorf("master replied to %s: %s", args[0], errReply.Message)
+		}
+		return reply, nil
+	}
+
+	// Handshake
+	if password := s.config().MasterAuth; password != "" {
+		if _, err := call("AUTH", password); err != nil {
+			return err
+		}
+	}
+	if _, err := call("PING"); err != nil {
+		return err
+	}
+	if _, err := call("REPLCONF", "listening-port", strconv.Itoa(s.listenPort())); err != nil {
+		return err
+	}
+	reply, err := call("PSYNC", "?", "-1")
+	if err != nil {
+		return err
+	}
+	status, _ := reply.(protocol.SimpleString)
+	fields := strings.Fields(status.Value)
+	if len(fields) != 3 || fields[0] != "FULLRESYNC" {
+		return fmt.Errorf("unexpected PSYNC reply %q", status.Value)
+	}
+	replID := fields[1]
+	offset, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return fmt.Errorf("unexpected PSYNC offset %q", fields[2])
+	}
+
+	// Full sync
+	link.setState(linkSync)
+	payload, err := reader.ReadPayload()
+	if err != nil {
+		return err
+	}
+	data, err := persistence.ReadRDB(bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("loading the master's snapshot: %w", err)
+	}
+	if err := s.loadFromPrimary(link, data, replID, offset); err != nil {
+		return err
+	}
+	logger.Info("MASTER <-> REPLICA sync: Finished with success", "keys", data.Keys(), "bytes", len(payload))
+
+	// Acks let the primary show how far behind we are
+	done := make(chan struct{})
+	defer close(done)
+	go s.ackPrimary(writer, done)
+
+	return s.applyStream(link, reader)
+}
+
+// loadFromPrimary swaps the dataset for the primary's snapshot
+func (s *Server) loadFromPrimary(link *replicaLink, data persistence.Dataset, replID string, offset int64) error {
+	s.execMu.Lock()
+	defer s.execMu.Unlock()
+
+	if s.currentLink() != link {
+		return errLinkStopped
+	}
+
+	if err := s.loadDataset(data); err != nil {
+		return err
+	}
+
+	s.repl.mu.Lock()
+	s.repl.replID, s.repl.offset = replID, offset
+	s.repl.mu.Unlock()
+	// Our own replicas have an outdated history now
+	s.repl.dropReplicas()
+
+	if s.aof != nil {
+		if err := s.startAOFRewrite(); err != nil {
+			logger.Warn("Can't rewrite the AOF after the sync", "error", err)
+		}
+	}
+
+	link.setState(linkConnected)
+	return nil
+}
+
+// applyStream executes the primary's writes as they arrive. MULTI/EXEC
+// blocks are applied at once, so local readers never see half of one.
+func (s *Server) applyStream(link *replicaLink, reader *protocol.Reader) error {
+	primary := newClient(nil)
+
+	var batch [][]string
+	inMulti := false
+	for {
+		msg, err := reader.ReadCommand()
+		if err != nil {
+			return err
+		}
+		link.setState(linkConnected)
+
+		arr, _ := msg.(protocol.Array)
+		args, ok := bulkStrings(arr.Elements)
+		if !ok || len(args) == 0 {
+			return fmt.Errorf("%w: malformed command from master", protocol.ErrProtocol)
+		}
+
+		switch name := strings.ToUpper(args[0]); {
+		case name == "MULTI":
+			inMulti, batch = true, nil
+			continue
+		case inMulti && name != "EXEC":
+			batch = append(batch, args)
+			continue
+		case name == "EXEC":
+			inMulti = false
+		default:
+			batch = [][]string{args}
+		}
+
+		if err := s.applyReplicated(link, primary, batch); err != nil {
+			return err
+		}
+		batch = nil
+	}
+}
+
+// applyReplicated runs a batch from the primary as one write, logs it to
+// our AOF and passes the same bytes on to our own replicas
+func (s *Server) applyReplicated(link *replicaLink, primary *client, commands [][]string) error {
+	s.execMu.Lock()
+	defer s.execMu.Unlock()
+
+	if s.currentLink() != link {
+		return errLinkStopped
+	}
+
+	// The primary already checked these: accept past expiries like a reload
+	s.loading = true
+	var writes []dbCommand
+	for _, args := range commands {
+		spec, reply, err := s.applyCommand(primary, args)
+		if err != nil {
+			s.loading = false
+			return err
+		}
+		if errReply, failed := reply.(protocol.Error); failed {
+			logger.Warn("Replicated command failed", "command", args[0], "error", errReply.Message)
+		} else if spec.write {
+			writes = append(writes, dbCommand{primary.db, args})
+		}
+	}
+	s.loading = false
+
+	s.propMu.Lock()
+	defer s.propMu.Unlock()
+	s.appendToAOF(writes)
+	s.repl.feed(wrapMulti(commands))
+	return nil
+}
+
+// ackPrimary reports our offset every second, like REPLCONF ACK in redis
+func (s *Server) ackPrimary(writer *bufio.Writer, done <-chan struct{}) {
+	ticker := time.NewTicker(replicaAckPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		s.repl.mu.Lock()
+		offset := s.repl.offset
+		s.repl.mu.Unlock()
+
+		ack := stringArray([]string{"REPLCONF", "ACK", strconv.FormatInt(offset, 10)}).Serialize()
+		if _, err := writer.Write(ack); err != nil {
+			return
+		}
+		if err := writer.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// listenPort is the port replicas announce, the real one when bound to :0
+func (s *Server) listenPort() int {
+	if s.listener != nil {
+		if addr, ok := s.listener.Addr().(*net.TCPAddr); ok {
+			return addr.Port
+		}
+	}
+	return s.port
+}
+
+// ROLE
+func (s *Server) handleRole(args []protocol.RESPValue) protocol.RESPValue {
+	s.repl.mu.Lock()
+	defer s.repl.mu.Unlock()
+
+	if link := s.repl.link; link != nil {
+		port, _ := strconv.ParseInt(link.port, 10, 64)
+		return protocol.Array{Elements: []protocol.RESPValue{
+			protocol.BulkString{Value: "slave"},
+			protocol.BulkString{Value: link.host},
+			protocol.Integer{Value: port},
+			protocol.BulkString{Value: string(link.state())},
+			protocol.Integer{Value: s.repl.offset},
+		}}
+	}
+
+	replicas := make([]protocol.RESPValue, 0, len(s.repl.replicas))
+	for _, rep := range s.repl.replicas {
+		host, _, _ := net.SplitHostPort(rep.c.conn.RemoteAddr().String())
+		replicas = append(replicas, stringArray([]string{
+			host, rep.listenPort, strconv.FormatInt(rep.ackOffset, 10),
+		}))
+	}
+	return protocol.Array{Elements: []protocol.RESPValue{
+		protocol.BulkString{Value: "master"},
+		protocol.Integer{Value: s.repl.offset},
+		protocol.Array{Elements: replicas},
+	}}
+}
+
+// replicationInfo is the "# Replication" section of INFO
+func (s *Server) replicationInfo() []string {
+	s.repl.mu.Lock()
+	defer s.repl.mu.Unlock()
+
+	var lines []string
+	if link := s.repl.link; link != nil {
+		state := link.state()
+		linkStatus := "down"
+		if state == linkConnected {
+			linkStatus = "up"
+		}
+		lines = append(lines,
+			"role:slave",
+			"master_host:"+link.host,
+			"master_port:"+link.port,
+			"master_link_status:"+linkStatus,
+			"master_sync_in_progress:"+boolFlag(state == linkSync),
+			"slave_repl_offset:"+strconv.FormatInt(s.repl.offset, 10),
+			"slave_read_only:"+boolFlag(s.config().ReplicaReadOnly),
+		)
+	} else {
+		lines = append(lines, "role:master")
+	}
+
+	lines = append(lines, "connected_slaves:"+strconv.Itoa(len(s.repl.replicas)))
+	i := 0
+	for _, rep := range s.repl.replicas {
+		host, _, _ := net.SplitHostPort(rep.c.conn.RemoteAddr().String())
+		state := "wait_bgsave"
+		if rep.online {
+			state = "online"
+		}
+		lines = append(lines, fmt.Sprintf("slave%d:ip=%s,port=%s,state=%s,offset=%d",
+			i, host, rep.listenPort, state, rep.ackOffset))
+		i++
+	}
+
+	return append(lines,
+		"master_replid:"+s.repl.replID,
+		"master_repl_offset:"+strconv.FormatInt(s.repl.offset, 10),
+	)
+}
+
+// boolFlag renders a boolean the way INFO does
+func boolFlag(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
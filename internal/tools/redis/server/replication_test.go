@@ -0,0 +1,124 @@
+package server
+
+import (
+	"cli-t/internal/tools/redis/protocol"
+
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// follow makes replica a replica of primary and waits for the full sync
+func follow(t *testing.T, replica, primary *Server, run func(args ...string) protocol.RESPValue) {
+	t.Helper()
+
+	host, port, _ := strings.Cut(primary.listener.Addr().String(), ":")
+	require.Equal(t, protocol.SimpleString{Value: "OK"}, run("REPLICAOF", host, port))
+	t.Cleanup(func() { replica.stopReplication() })
+
+	require.Eventually(t, func() bool {
+		link := replica.currentLink()
+		return link != nil && link.state() == linkConnected
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestReplication_FullSyncThenStream(t *testing.T) {
+	primary, pconn, pr := connect(t)
+	onPrimary := func(args ...string) protocol.RESPValue { return do(t, pconn, pr, args...) }
+	replica, rconn, rr := connect(t)
+	replica.cfg.ReplicaReadOnly = true
+	onReplica := func(args ...string) protocol.RESPValue { return do(t, rconn, rr, args...) }
+
+	// Written before the replica connects: arrives with the snapshot
+	onPrimary("SET", "before", "1")
+	onPrimary("RPUSH", "list", "a", "b")
+	onReplica("SET", "stale", "x") // dropped by the full sync
+
+	follow(t, replica, primary, onReplica)
+	assert.Equal(t, protocol.BulkString{Value: "1"}, onReplica("GET", "before"))
+	assert.Equal(t, protocol.Integer{Value: 0}, onReplica("EXISTS", "stale"))
+
+	// Written afterwards: streamed, transactions included
+	onPrimary("SET", "after", "2", "EX", "100")
+	onPrimary("MULTI")
+	onPrimary("INCR", "counter")
+	onPrimary("LPOP", "list")
+	onPrimary("EXEC")
+
+	require.Eventually(t, func() bool {
+		return onReplica("GET", "counter") == protocol.BulkString{Value: "1"}
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, protocol.BulkString{Value: "2"}, onReplica("GET", "after"))
+	assert.Greater(t, onReplica("TTL", "after").(protocol.Integer).Value, int64(90))
+	assert.Equal(t, stringArray([]string{"b"}), onReplica("LRANGE", "list", "0", "-1"))
+
+	// Both sides agree on the offset once the replica acked it
+	var offset protocol.RESPValue
+	require.Eventually(t, func() bool {
+		role := onPrimary("ROLE").(protocol.Array)
+		offset = role.Elements[1]
+		replicas := role.Elements[2].(protocol.Array).Elements
+		if len(replicas) != 1 {
+			return false
+		}
+		acked := replicas[0].(protocol.Array).Elements[2].(protocol.BulkString).Value
+		return acked == strconv.FormatInt(offset.(protocol.Integer).Value, 10)
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.NotEqual(t, protocol.Integer{Value: 0}, offset)
+	assert.Equal(t, offset, onReplica("ROLE").(protocol.Array).Elements[4])
+}
+
+func TestReplication_ReadOnlyReplica(t *testing.T) {
+	primary, _, _ := connect(t)
+	replica, rconn, rr := connect(t)
+	replica.cfg.ReplicaReadOnly = true
+	onReplica := func(args ...string) protocol.RESPValue { return do(t, rconn, rr, args...) }
+
+	follow(t, replica, primary, onReplica)
+
+	readOnly := protocol.Error{Message: errReadOnly.Error()}
+	assert.Equal(t, readOnly, onReplica("SET", "k", "v"))
+	assert.Equal(t, readOnly, onReplica("BLPOP", "queue", "1"))
+	assert.Equal(t, protocol.BulkString{IsNull: true}, onReplica("GET", "k"))
+
+	role := onReplica("ROLE").(protocol.Array)
+	assert.Equal(t, protocol.BulkString{Value: "slave"}, role.Elements[0])
+	assert.Equal(t, protocol.BulkString{Value: "connected"}, role.Elements[3])
+	info := onReplica("INFO", "replication").(protocol.BulkString)
+	assert.Contains(t, info.Value, "role:slave\r\n")
+	assert.Contains(t, info.Value, "master_link_status:up\r\n")
+
+	// Promoted: writable again, and a primary without replicas
+	assert.Equal(t, protocol.SimpleString{Value: "OK"}, onReplica("REPLICAOF", "NO", "ONE"))
+	assert.Equal(t, protocol.SimpleString{Value: "OK"}, onReplica("SET", "k", "v"))
+	role = onReplica("ROLE").(protocol.Array)
+	assert.Equal(t, protocol.BulkString{Value: "master"}, role.Elements[0])
+	assert.Contains(t, onReplica("INFO").(protocol.BulkString).Value, "role:master\r\n")
+}
+
+func TestReplication_Databases(t *testing.T) {
+	primary, pconn, pr := connect(t)
+	onPrimary := func(args ...string) protocol.RESPValue { return do(t, pconn, pr, args...) }
+	replica, rconn, rr := connect(t)
+	onReplica := func(args ...string) protocol.RESPValue { return do(t, rconn, rr, args...) }
+
+	onPrimary("SELECT", "2")
+	onPrimary("SET", "synced", "1")
+	follow(t, replica, primary, onReplica)
+
+	// Streamed writes carry the database they ran in
+	onPrimary("SET", "streamed", "2")
+	onPrimary("SELECT", "0")
+	onPrimary("SET", "streamed", "0")
+
+	require.Eventually(t, func() bool {
+		return onReplica("GET", "streamed") == protocol.BulkString{Value: "0"}
+	}, 5*time.Second, 10*time.Millisecond)
+	onReplica("SELECT", "2")
+	assert.Equal(t, protocol.BulkString{Value: "1"}, onReplica("GET", "synced"))
+	assert.Equal(t, protocol.BulkString{Value: "2"}, onReplica("GET", "streamed"))
+}
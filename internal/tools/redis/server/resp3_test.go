@@ -0,0 +1,103 @@
+package server
+
+import (
+	"cli-t/internal/tools/redis/protocol"
+
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// helloField looks up one entry of the HELLO map
+func helloField(t *testing.T, reply protocol.RESPValue, name string) protocol.RESPValue {
+	t.Helper()
+	hello, ok := reply.(protocol.Map)
+	require.True(t, ok, "HELLO replied %#v", reply)
+	for _, entry := range hello.Entries {
+		if entry.Key == (protocol.BulkString{Value: name}) {
+			return entry.Value
+		}
+	}
+	t.Fatalf("no %q in HELLO", name)
+	return nil
+}
+
+func TestHello(t *testing.T) {
+	_, conn, r := connect(t)
+
+	// Without a version HELLO just describes the connection, still in RESP2
+	hello := do(t, conn, r, "HELLO")
+	assert.IsType(t, protocol.Array{}, hello)
+
+	hello = do(t, conn, r, "HELLO", "3", "SETNAME", "worker")
+	assert.Equal(t, protocol.Integer{Value: 3}, helloField(t, hello, "proto"))
+	assert.Equal(t, protocol.BulkString{Value: "master"}, helloField(t, hello, "role"))
+	assert.Equal(t, protocol.BulkString{Value: "worker"}, do(t, conn, r, "CLIENT", "GETNAME"))
+
+	assert.Equal(t, "NOPROTO unsupported protocol version", do(t, conn, r, "HELLO", "4").(protocol.Error).Message)
+	assert.IsType(t, protocol.Error{}, do(t, conn, r, "HELLO", "3", "AUTH", "default"))
+
+	// And back
+	assert.IsType(t, protocol.Array{}, do(t, conn, r, "HELLO", "2"))
+	assert.Equal(t, protocol.BulkString{IsNull: true}, do(t, conn, r, "GET", "missing"))
+}
+
+func TestHello_Auth(t *testing.T) {
+	s, conn, r := connect(t)
+	do(t, conn, r, "CONFIG", "SET", "requirepass", "secret")
+
+	other, otherR := attach(t, s)
+	assert.Equal(t, "NOAUTH", do(t, other, otherR, "HELLO", "3").(protocol.Error).Message[:6])
+	assert.Equal(t, errorReply(errWrongPass), do(t, other, otherR, "HELLO", "3", "AUTH", "default", "wrong"))
+	hello := do(t, other, otherR, "HELLO", "3", "AUTH", "default", "secret")
+	assert.Equal(t, protocol.Integer{Value: 3}, helloField(t, hello, "proto"))
+	assert.Equal(t, protocol.SimpleString{Value: "PONG"}, do(t, other, otherR, "PING"))
+}
+
+func TestRESP3Replies(t *testing.T) {
+	s, conn, r := connect(t)
+	do(t, conn, r, "HELLO", "3")
+
+	do(t, conn, r, "HSET", "h", "a", "1", "b", "2")
+	assert.Equal(t, protocol.Map{Entries: []protocol.MapEntry{
+		{Key: protocol.BulkString{Value: "a"}, Value: protocol.BulkString{Value: "1"}},
+		{Key: protocol.BulkString{Value: "b"}, Value: protocol.BulkString{Value: "2"}},
+	}}, do(t, conn, r, "HGETALL", "h"))
+
+	do(t, conn, r, "SADD", "s", "x")
+	assert.Equal(t, protocol.Set{Elements: []protocol.RESPValue{protocol.BulkString{Value: "x"}}}, do(t, conn, r, "SMEMBERS", "s"))
+
+	do(t, conn, r, "ZADD", "z", "1.5", "m")
+	assert.Equal(t, protocol.Double{Value: 1.5}, do(t, conn, r, "ZSCORE", "z", "m"))
+	assert.Equal(t, protocol.Null{}, do(t, conn, r, "ZSCORE", "z", "nope"))
+	do(t, conn, r, "ZADD", "z", "2", "n")
+	pairs := protocol.Array{Elements: []protocol.RESPValue{
+		protocol.Array{Elements: []protocol.RESPValue{protocol.BulkString{Value: "m"}, protocol.Double{Value: 1.5}}},
+		protocol.Array{Elements: []protocol.RESPValue{protocol.BulkString{Value: "n"}, protocol.Double{Value: 2}}},
+	}}
+	assert.Equal(t, pairs, do(t, conn, r, "ZRANGE", "z", "0", "-1", "WITHSCORES"))
+	assert.Equal(t, pairs, do(t, conn, r, "ZRANGEBYSCORE", "z", "-inf", "+inf", "WITHSCORES"))
+	assert.Equal(t, stringArray([]string{"m", "n"}), do(t, conn, r, "ZRANGE", "z", "0", "-1"))
+	assert.Equal(t, protocol.Null{}, do(t, conn, r, "GET", "missing"))
+
+	config := do(t, conn, r, "CONFIG", "GET", "maxmemory").(protocol.Map)
+	require.Len(t, config.Entries, 1)
+	assert.Equal(t, protocol.BulkString{Value: "0"}, config.Entries[0].Value)
+
+	info := do(t, conn, r, "INFO", "server").(protocol.Verbatim)
+	assert.Equal(t, "txt", info.Format)
+
+	// The same commands still answer RESP2 clients the old way
+	other, otherR := attach(t, s)
+	assert.Equal(t, stringArray([]string{"a", "1", "b", "2"}), do(t, other, otherR, "HGETALL", "h"))
+	assert.Equal(t, protocol.BulkString{Value: "1.5"}, do(t, other, otherR, "ZSCORE", "z", "m"))
+	assert.Equal(t, stringArray([]string{"m", "1.5", "n", "2"}), do(t, other, otherR, "ZRANGE", "z", "0", "-1", "WITHSCORES"))
+
+	// Messages are pushes, and a RESP3 subscriber can still run commands
+	assert.Equal(t, subscriptionReply("subscribe", "ch", 1), do(t, conn, r, "SUBSCRIBE", "ch"))
+	assert.Equal(t, protocol.BulkString{Value: "1"}, do(t, conn, r, "HGET", "h", "a"))
+	assert.Equal(t, protocol.SimpleString{Value: "PONG"}, do(t, conn, r, "PING"))
+	do(t, other, otherR, "PUBLISH", "ch", "hi")
+	assert.Equal(t, stringPush("message", "ch", "hi"), readReply(t, r))
+}
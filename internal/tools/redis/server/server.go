@@ -3,51 +3,186 @@ package server
 import (
 	"cli-t/internal/shared/logger"
 	inmemory "cli-t/internal/shared/store/inmemory"
+	"cli-t/internal/tools/redis/persistence"
 	"cli-t/internal/tools/redis/protocol"
 
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// Config holds the server settings that come from command line flags
+type Config struct {
+	Host string
+	Port int
+
+	Databases int // number of logical databases, DefaultDatabases when 0
+
+	DumpPath     string        // snapshot file, "" disables persistence
+	SaveInterval time.Duration // automatic BGSAVE period, 0 disables it
+
+	AppendOnly     bool                    // log every write to the AOF
+	AppendFilename string                  // AOF path
+	AppendFsync    persistence.FsyncPolicy // always, everysec or no
+
+	MaxMemory        int64                   // bytes, 0 means no limit
+	MaxMemoryPolicy  inmemory.EvictionPolicy // what to evict once over the limit
+	MaxMemorySamples int                     // keys compared per eviction
+
+	ReplicaOf       string // host:port of the primary to follow, "" starts as a primary
+	ReplicaReadOnly bool   // refuse writes from clients while following a primary
+	MasterAuth      string // password sent to the primary with AUTH, "" sends none
+
+	RequirePass string // password of the default user, "" lets every client in
+
+	NotifyKeyspaceEvents KeyspaceEvents // keyspace notifications to publish, 0 publishes none
+}
+
+// DefaultDatabases is how many databases SELECT can choose from, like
+// redis' databases setting
+const DefaultDatabases = 16
+
 type Server struct {
-	host  string
-	port  int
-	store inmemory.Store
-
-	listener net.Listener      // TCP listener
-	clients  map[net.Conn]bool // Active connections
-	mu       sync.Mutex        // Protect clients map
-	shutdown chan struct{}     // Signal to stop
+	host string
+	port int
+	dbs  []inmemory.Store // the logical databases, swapped by SWAPDB under execMu
+	cfg  Config
+
+	listener     net.Listener      // TCP listener
+	clients      map[int64]*client // Active connections by client id
+	mu           sync.Mutex        // Protect clients map
+	nextClientID atomic.Int64
+	shutdown     chan struct{} // Signal to stop
+
+	configMu sync.RWMutex // guards the cfg fields CONFIG SET can change
+	stats    serverStats  // INFO counters
+
+	pubsub   *pubSub           // channel/pattern subscriptions
+	notify   *keyspaceNotifier // publishes keyspace notifications
+	monitors *monitors         // clients that ran MONITOR
+	watches  *watchRegistry    // WATCHed keys
+	blocking *blockedClients   // clients waiting in BLPOP & co
+	execMu   sync.RWMutex      // commands share it, EXEC and whole-keyspace commands take it exclusively
+	keyLocks keyLocks          // writes sharing execMu lock their keys here
+	propMu   sync.Mutex        // one propagation at a time: guards aofDB, orders the AOF and replicas alike
+
+	snapshot snapshotState    // SAVE/BGSAVE bookkeeping
+	aof      *persistence.AOF // nil unless appendonly
+	loading  bool             // replaying the AOF or applying the primary's stream
+	aofDB    int              // database the AOF's last command ran in, -1 when unknown
+
+	repl *replication // primary/replica role, replicas and offsets
+
+	acl *aclRegistry // users and their permissions
 }
 
-func New(host string, port int, store inmemory.Store) *Server {
-	return &Server{
-		host:     host,
-		port:     port,
-		store:    store,
-		clients:  make(map[net.Conn]bool),
+// New creates a server whose database 0 is store
+func New(cfg Config, store inmemory.Store) *Server {
+	if cfg.Databases <= 0 {
+		cfg.Databases = DefaultDatabases
+	}
+	if cfg.MaxMemoryPolicy == "" {
+		cfg.MaxMemoryPolicy = inmemory.NoEviction
+	}
+	if cfg.MaxMemorySamples <= 0 {
+		cfg.MaxMemorySamples = inmemory.DefaultEvictionSamples
+	}
+
+	s := &Server{
+		host:     cfg.Host,
+		port:     cfg.Port,
+		dbs:      make([]inmemory.Store, cfg.Databases),
+		cfg:      cfg,
+		clients:  make(map[int64]*client),
 		shutdown: make(chan struct{}),
+		pubsub:   newPubSub(),
+		watches:  newWatchRegistry(),
+		blocking: newBlockedClients(),
+		repl:     newReplication(),
+		acl:      newACLRegistry(cfg.RequirePass),
+		monitors: newMonitors(),
+		aofDB:    -1,
 	}
+	s.notify = newKeyspaceNotifier(s.pubsub, cfg.NotifyKeyspaceEvents)
+	s.stats.startTime = time.Now()
+
+	s.dbs[0] = store
+	for i := 1; i < len(s.dbs); i++ {
+		s.dbs[i] = inmemory.New()
+	}
+	for i, db := range s.dbs {
+		s.hookDB(i)
+		db.SetMaxMemory(cfg.MaxMemory, cfg.MaxMemoryPolicy, cfg.MaxMemorySamples)
+	}
+	return s
+}
+
+// keyChanged is the change hook of database db, called for every modified
+// key
+func (s *Server) keyChanged(db int, key string) {
+	// Every write to a key invalidates WATCHes on it
+	s.watches.keyModified(db, key)
+	// ... and may be the push a blocked client waits for
+	s.blocking.keyModified(db, key)
+	s.snapshot.dirty.Add(1)
 }
 
 func (s *Server) Start(ctx context.Context) error {
 	addr := fmt.Sprintf("%s:%d", s.host, s.port)
 
+	// Restore the dataset before anyone can connect
+	if err := s.loadData(); err != nil {
+		return err
+	}
+
 	// Listen on TCP (NOT http.Server!)
 	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		return err
 	}
-	s.listener = listener
 
 	logger.Info("Redis server listening", "addr", addr)
+	return s.serve(ctx, listener)
+}
 
-	// Start background expiry worker
-	go s.store.StartExpiryWorker(ctx)
-	logger.Info("Started expiry cleanup worker")
+// Serve is Start on a listener the caller opened, e.g. on port 0 in tests.
+// Clients connecting meanwhile wait until the dataset is restored.
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	if err := s.loadData(); err != nil {
+		listener.Close()
+		return err
+	}
+
+	logger.Info("Redis server listening", "addr", listener.Addr().String())
+	return s.serve(ctx, listener)
+}
+
+// serve runs the background workers and accepts clients until Stop
+func (s *Server) serve(ctx context.Context, listener net.Listener) error {
+	s.listener = listener
+
+	// Start background expiry workers
+	for _, db := range s.dbs {
+		go db.StartExpiryWorker(ctx)
+	}
+	logger.Info("Started expiry cleanup workers", "databases", len(s.dbs))
+
+	if s.cfg.DumpPath != "" && s.cfg.SaveInterval > 0 {
+		go s.saveLoop(ctx)
+	}
+
+	if s.cfg.ReplicaOf != "" {
+		host, port, err := net.SplitHostPort(s.cfg.ReplicaOf)
+		if err != nil {
+			return fmt.Errorf("invalid replicaof address: %w", err)
+		}
+		s.startReplication(host, port)
+	}
 
 	// Accept connections loop
 	for {
@@ -73,6 +208,9 @@ func (s *Server) Stop(ctx context.Context) error { // ← Return error
 	// 1. Stop accepting new connections
 	close(s.shutdown)
 	s.listener.Close()
+	if link := s.currentLink(); link != nil {
+		link.close()
+	}
 
 	// 2. Wait for existing connections to finish (or timeout)
 	done := make(chan struct{})
@@ -80,8 +218,8 @@ func (s *Server) Stop(ctx context.Context) error { // ← Return error
 	go func() {
 		// Close all active clients
 		s.mu.Lock()
-		for conn := range s.clients {
-			conn.Close()
+		for _, c := range s.clients {
+			c.conn.Close()
 		}
 		s.mu.Unlock()
 		close(done)
@@ -91,42 +229,70 @@ func (s *Server) Stop(ctx context.Context) error { // ← Return error
 	select {
 	case <-done:
 		logger.Info("All clients closed gracefully")
-		return nil
 	case <-ctx.Done():
 		logger.Warn("Shutdown timeout exceeded, forcing close")
 		return ctx.Err()
 	}
+
+	// 4. Like redis, save on shutdown when automatic saving is configured
+	if s.cfg.DumpPath != "" && s.cfg.SaveInterval > 0 {
+		if err := s.save(); err != nil {
+			return fmt.Errorf("saving snapshot on shutdown: %w", err)
+		}
+	}
+
+	if s.aof != nil {
+		if err := s.aof.Close(); err != nil {
+			return fmt.Errorf("closing the AOF: %w", err)
+		}
+	}
+	return nil
 }
 
 // Make sure connection is persistent so tcp handshake is not happening on every hit
 // TODO: can set a ideal timeout
 func (s *Server) handleClient(conn net.Conn) {
+	c := newClient(conn)
+	c.id = s.nextClientID.Add(1)
+	if s.acl.defaultNoPass() {
+		c.login(defaultUser)
+	}
+
 	// Track this client
 	s.mu.Lock()
-	s.clients[conn] = true
+	s.clients[c.id] = c
 	s.mu.Unlock()
+	s.stats.connectionsReceived.Add(1)
 
-	remoteAddr := conn.RemoteAddr().String()
-	logger.Info("Client connected", "addr", remoteAddr)
+	remoteAddr := c.addr
+	logger.Info("Client connected", "addr", remoteAddr, "id", c.id)
 
 	defer func() {
-		s.closeClient(conn)
+		s.pubsub.removeClient(c)
+		s.monitors.remove(c)
+		s.watches.unwatchAll(c)
+		s.repl.removeReplica(c)
+		s.closeClient(c)
 		logger.Info("Client disconnected", "addr", remoteAddr)
 	}()
 
-	// Buffer gets overwritten each time : fast reuse
-	/*
-		Known issue for now :
-		Partial Reads (Message Split Across Packets) : one command in multiple packet
-		Multiple Commands in One Read : multiple command in one packet
-		we will test them then fix this issue
-	*/
-	buffer := make([]byte, 4096)
+	// Reader keeps partial frames between reads, so commands split across
+	// packets and pipelined commands in one packet both work.
+	reader := protocol.NewReader(conn)
+
+	commands := make(chan incoming)
+	done := make(chan struct{})
+	defer close(done)
+	go c.readLoop(reader, commands, done)
 
 	for { // ← Keep reading until client disconnects!
-		n, err := conn.Read(buffer)
-		if err != nil {
-			if err == io.EOF {
+		next := <-commands
+		if err := next.err; err != nil {
+			if errors.Is(err, protocol.ErrProtocol) {
+				// Can't find the next command boundary anymore: reply and drop
+				logger.Warn("Protocol error", "addr", remoteAddr, "error", err)
+				c.writeReply(protocol.Error{Message: "ERR " + err.Error()}, true)
+			} else if err == io.EOF {
 				logger.Debug("Client disconnected")
 			} else {
 				logger.Error("Read error", "error", err)
@@ -134,25 +300,34 @@ func (s *Server) handleClient(conn net.Conn) {
 			return // Exit loop, defer calls Close()
 		}
 
-		// Parse command
-		data := buffer[:n]
-		msg, _, err := protocol.Parse(data)
-		if err != nil {
-			conn.Write([]byte("-ERR protocol error\r\n"))
-			continue // ← Stay in loop, don't close!
+		// Handle command
+		response := s.handleCommand(c, next.msg)
+
+		// Answer a whole pipelined batch with a single write
+		flush := !next.more || c.closeAfterReply
+		if err := c.writeReply(response, flush); err != nil {
+			logger.Error("Write error", "error", err)
+			return
 		}
 
-		// Handle command
-		response := s.handleCommand(msg)
-		conn.Write(response.Serialize())
+		if c.closeAfterReply {
+			return
+		}
 
 		// ← Loop back, read next command from SAME client
 	}
 }
 
-func (s *Server) closeClient(conn net.Conn) {
-	conn.Close()
+func (s *Server) closeClient(c *client) {
+	c.conn.Close()
 	s.mu.Lock()
-	delete(s.clients, conn)
+	delete(s.clients, c.id)
 	s.mu.Unlock()
 }
+
+// config returns a copy of the settings, safe while CONFIG SET runs
+func (s *Server) config() Config {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return s.cfg
+}
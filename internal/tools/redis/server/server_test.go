@@ -0,0 +1,213 @@
+package server
+
+import (
+	inmemory "cli-t/internal/shared/store/inmemory"
+	"cli-t/internal/tools/redis/protocol"
+
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// connect starts a fresh server on a loopback port and opens one client
+func connect(t *testing.T) (*Server, net.Conn, *protocol.Reader) {
+	t.Helper()
+
+	s := New(Config{Host: "127.0.0.1"}, inmemory.New())
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s.listener = listener
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.handleClient(conn)
+		}
+	}()
+
+	conn, r := attach(t, s)
+	return s, conn, r
+}
+
+// attach opens another client connection to a running test server
+func attach(t *testing.T, s *Server) (net.Conn, *protocol.Reader) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", s.listener.Addr().String())
+	require.NoError(t, err)
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	t.Cleanup(func() { conn.Close() })
+	return conn, protocol.NewReader(conn)
+}
+
+// send writes raw bytes to the server
+func send(t *testing.T, conn net.Conn, chunks ...string) {
+	t.Helper()
+	for _, chunk := range chunks {
+		_, err := conn.Write([]byte(chunk))
+		require.NoError(t, err)
+	}
+}
+
+func readReply(t *testing.T, r *protocol.Reader) protocol.RESPValue {
+	t.Helper()
+	v, err := r.ReadValue()
+	require.NoError(t, err)
+	return v
+}
+
+func TestHandleClient_Pipelined(t *testing.T) {
+	_, conn, r := connect(t)
+
+	send(t, conn, "*3\r\n$3\r\nSET\r\n$1\r\na\r\n$1\r\n1\r\n"+
+		"*2\r\n$4\r\nINCR\r\n$1\r\na\r\n"+
+		"*2\r\n$3\r\nGET\r\n$1\r\na\r\n")
+
+	assert.Equal(t, protocol.SimpleString{Value: "OK"}, readReply(t, r))
+	assert.Equal(t, protocol.Integer{Value: 2}, readReply(t, r))
+	assert.Equal(t, protocol.BulkString{Value: "2"}, readReply(t, r))
+}
+
+func TestHandleClient_SplitCommand(t *testing.T) {
+	_, conn, r := connect(t)
+
+	send(t, conn, "*2\r\n$4\r\nEC", "HO\r\n$5\r\nhel", "lo\r\n")
+
+	assert.Equal(t, protocol.BulkString{Value: "hello"}, readReply(t, r))
+}
+
+func TestHandleClient_Inline(t *testing.T) {
+	_, conn, r := connect(t)
+
+	send(t, conn, "PING\r\nSET greeting \"hi there\"\r\nGET greeting\r\n")
+
+	assert.Equal(t, protocol.SimpleString{Value: "PONG"}, readReply(t, r))
+	assert.Equal(t, protocol.SimpleString{Value: "OK"}, readReply(t, r))
+	assert.Equal(t, protocol.BulkString{Value: "hi there"}, readReply(t, r))
+}
+
+func TestHandleClient_ProtocolErrorClosesConnection(t *testing.T) {
+	_, conn, r := connect(t)
+
+	send(t, conn, "*1\r\n$abc\r\n")
+
+	reply, ok := readReply(t, r).(protocol.Error)
+	require.True(t, ok)
+	assert.Contains(t, reply.Message, "protocol error")
+
+	_, err := r.ReadValue()
+	assert.Error(t, err)
+}
+
+// do sends one command and returns its reply
+func do(t *testing.T, conn net.Conn, r *protocol.Reader, args ...string) protocol.RESPValue {
+	t.Helper()
+	send(t, conn, string(stringArray(args).Serialize()))
+	return readReply(t, r)
+}
+
+// resp2 is how a reply reaches a RESP2 client, RESP3 types flattened
+func resp2(value protocol.RESPValue) protocol.RESPValue {
+	return protocol.ToVersion(value, protocol.RESP2)
+}
+
+func TestHashCommands(t *testing.T) {
+	_, conn, r := connect(t)
+
+	assert.Equal(t, protocol.Integer{Value: 2}, do(t, conn, r, "HSET", "user", "name", "ada", "lang", "go"))
+	assert.Equal(t, protocol.BulkString{Value: "ada"}, do(t, conn, r, "HGET", "user", "name"))
+	assert.Equal(t, protocol.BulkString{IsNull: true}, do(t, conn, r, "HGET", "user", "nope"))
+	assert.Equal(t, stringArray([]string{"lang", "go", "name", "ada"}), do(t, conn, r, "HGETALL", "user"))
+	assert.Equal(t, protocol.Integer{Value: 10}, do(t, conn, r, "HINCRBY", "user", "visits", "10"))
+	assert.Equal(t, protocol.Integer{Value: 1}, do(t, conn, r, "HEXISTS", "user", "visits"))
+	assert.Equal(t, protocol.Integer{Value: 2}, do(t, conn, r, "HDEL", "user", "visits", "lang"))
+	assert.Equal(t, protocol.Integer{Value: 1}, do(t, conn, r, "HLEN", "user"))
+
+	// Wrong type both ways
+	do(t, conn, r, "SET", "plain", "value")
+	assert.Equal(t, errorReply(inmemory.ErrWrongType), do(t, conn, r, "HGET", "plain", "f"))
+	assert.Equal(t, errorReply(inmemory.ErrWrongType), do(t, conn, r, "GET", "user"))
+
+	assert.Equal(t, wrongArgs("hset"), do(t, conn, r, "HSET", "user", "dangling"))
+}
+
+func TestSortedSetCommands(t *testing.T) {
+	_, conn, r := connect(t)
+
+	assert.Equal(t, protocol.Integer{Value: 3}, do(t, conn, r, "ZADD", "lb", "1", "a", "2.5", "b", "3", "c"))
+	assert.Equal(t, stringArray([]string{"c", "3", "b", "2.5"}),
+		do(t, conn, r, "ZRANGE", "lb", "0", "1", "REV", "WITHSCORES"))
+	assert.Equal(t, stringArray([]string{"b", "c"}), do(t, conn, r, "ZRANGEBYSCORE", "lb", "(1", "+inf"))
+	assert.Equal(t, stringArray([]string{"b"}), do(t, conn, r, "ZRANGE", "lb", "(1", "+inf", "BYSCORE", "LIMIT", "0", "1"))
+	assert.Equal(t, protocol.BulkString{Value: "4.5"}, do(t, conn, r, "ZINCRBY", "lb", "2", "b"))
+	assert.Equal(t, protocol.Integer{Value: 2}, do(t, conn, r, "ZRANK", "lb", "b"))
+	assert.Equal(t, protocol.BulkString{IsNull: true}, do(t, conn, r, "ZRANK", "lb", "zz"))
+	assert.Equal(t, errorReply(inmemory.ErrNotFloat), do(t, conn, r, "ZADD", "lb", "abc", "x"))
+
+	assert.Equal(t, protocol.Integer{Value: 2}, do(t, conn, r, "SADD", "s1", "x", "y"))
+	assert.Equal(t, protocol.Integer{Value: 2}, do(t, conn, r, "SADD", "s2", "y", "z"))
+	assert.Equal(t, stringArray([]string{"y"}), do(t, conn, r, "SINTER", "s1", "s2"))
+	assert.Equal(t, errorReply(inmemory.ErrWrongType), do(t, conn, r, "SCARD", "lb"))
+}
+
+// BenchmarkHandleCommandParallel runs GET and SET from many clients through
+// handleCommand (no network), with 0%, 10% and 50% writes, e.g.
+// go test -run x -bench HandleCommand -cpu 1,8 ./internal/tools/redis/server
+func BenchmarkHandleCommandParallel(b *testing.B) {
+	const keys = 10000
+	gets := make([]protocol.RESPValue, keys)
+	sets := make([]protocol.RESPValue, keys)
+	for i := range gets {
+		key := "key:" + strconv.Itoa(i)
+		gets[i] = stringArray([]string{"GET", key})
+		sets[i] = stringArray([]string{"SET", key, "value"})
+	}
+
+	for _, writes := range []int{0, 10, 50} {
+		b.Run("writes="+strconv.Itoa(writes)+"%", func(b *testing.B) {
+			s := New(Config{}, inmemory.New())
+			setup := newClient(nil)
+			setup.authenticated = true
+			for _, set := range sets {
+				s.handleCommand(setup, set)
+			}
+
+			var next atomic.Int64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				c := newClient(nil)
+				c.authenticated = true
+				i := int(next.Add(1)) * 7919
+				for pb.Next() {
+					if i%100 < writes {
+						s.handleCommand(c, sets[i%keys])
+					} else {
+						s.handleCommand(c, gets[i%keys])
+					}
+					i += 13
+				}
+			})
+		})
+	}
+}
+
+func TestCommandTable_WritesLockTheirKeys(t *testing.T) {
+	// Writes that share execMu are only serialized through their keys: one
+	// that names none must run exclusively (or block, which does too)
+	for name, spec := range commandTable {
+		if spec.write && !spec.exclusive && !spec.blocking {
+			assert.True(t, spec.hasKeys(), "%s is a shared write without keys", name)
+		}
+	}
+}
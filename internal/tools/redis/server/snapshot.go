@@ -0,0 +1,156 @@
+package server
+
+import (
+	"cli-t/internal/shared/logger"
+	"cli-t/internal/tools/redis/persistence"
+	"cli-t/internal/tools/redis/protocol"
+
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	errBgSaveInProgress = errors.New("ERR Background save already in progress")
+	errNoDumpFile       = errors.New("no dump file configured (--db-file)")
+)
+
+// snapshotState tracks persistence progress
+type snapshotState struct {
+	mu         sync.Mutex   // one writer of the dump file at a time
+	inProgress atomic.Bool  // a BGSAVE goroutine is running
+	dirty      atomic.Int64 // changes since the last successful save
+	lastSave   atomic.Int64 // unix seconds of the last successful save
+}
+
+// loadSnapshot restores the dump file, if there is one
+func (s *Server) loadSnapshot() error {
+	s.snapshot.lastSave.Store(time.Now().Unix())
+	if s.cfg.DumpPath == "" {
+		return nil
+	}
+
+	start := time.Now()
+	data, err := persistence.LoadRDB(s.cfg.DumpPath)
+	if err != nil {
+		return err
+	}
+
+	if err := s.loadDataset(data); err != nil {
+		return err
+	}
+	s.snapshot.dirty.Store(0)
+
+	logger.Info("DB loaded from disk", "path", s.cfg.DumpPath, "keys", data.Keys(), "duration", time.Since(start))
+	return nil
+}
+
+// save writes a snapshot synchronously (SAVE, shutdown)
+func (s *Server) save() error {
+	if s.cfg.DumpPath == "" {
+		return errNoDumpFile
+	}
+
+	s.snapshot.mu.Lock()
+	defer s.snapshot.mu.Unlock()
+
+	dirty := s.snapshot.dirty.Load()
+	if err := persistence.SaveRDB(s.cfg.DumpPath, s.dataset()); err != nil {
+		return err
+	}
+
+	// Writes that raced with the save stay counted for the next one
+	s.snapshot.dirty.Add(-dirty)
+	s.snapshot.lastSave.Store(time.Now().Unix())
+	logger.Info("DB saved on disk", "path", s.cfg.DumpPath)
+	return nil
+}
+
+// bgsave fixes the snapshot now, then copies and writes it in the background
+func (s *Server) bgsave() error {
+	if s.cfg.DumpPath == "" {
+		return errNoDumpFile
+	}
+	if !s.snapshot.inProgress.CompareAndSwap(false, true) {
+		return errBgSaveInProgress
+	}
+
+	// This is the "fork": the databases are only marked, writes made from
+	// now on keep the values the copy needs
+	dirty := s.snapshot.dirty.Load()
+	copyData := s.beginDataset()
+
+	go func() {
+		defer s.snapshot.inProgress.Store(false)
+
+		s.snapshot.mu.Lock()
+		defer s.snapshot.mu.Unlock()
+
+		data := copyData()
+
+		if err := persistence.SaveRDB(s.cfg.DumpPath, data); err != nil {
+			logger.Error("Background saving error", "error", err)
+			return
+		}
+
+		s.snapshot.dirty.Add(-dirty)
+		s.snapshot.lastSave.Store(time.Now().Unix())
+		logger.Info("Background saving terminated with success", "path", s.cfg.DumpPath)
+	}()
+	return nil
+}
+
+// saveLoop runs BGSAVE every SaveInterval when something changed
+func (s *Server) saveLoop(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.SaveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.shutdown:
+			return
+		case <-ticker.C:
+			if s.snapshot.dirty.Load() == 0 {
+				continue
+			}
+			// Locked like BGSAVE, so the databases are marked together
+			s.execMu.Lock()
+			err := s.bgsave()
+			s.execMu.Unlock()
+			if err != nil && err != errBgSaveInProgress {
+				logger.Error("Automatic save failed", "error", err)
+			}
+		}
+	}
+}
+
+// SAVE
+func (s *Server) handleSave(args []protocol.RESPValue) protocol.RESPValue {
+	if s.snapshot.inProgress.Load() {
+		return errorReply(errBgSaveInProgress)
+	}
+	if err := s.save(); err != nil {
+		logger.Error("Saving error", "error", err)
+		return protocol.Error{Message: "ERR " + err.Error()}
+	}
+	return protocol.SimpleString{Value: "OK"}
+}
+
+// BGSAVE
+func (s *Server) handleBgSave(args []protocol.RESPValue) protocol.RESPValue {
+	if err := s.bgsave(); err == errBgSaveInProgress {
+		return errorReply(err)
+	} else if err != nil {
+		return protocol.Error{Message: "ERR " + err.Error()}
+	}
+	return protocol.SimpleString{Value: "Background saving started"}
+}
+
+// LASTSAVE
+func (s *Server) handleLastSave(args []protocol.RESPValue) protocol.RESPValue {
+	return protocol.Integer{Value: s.snapshot.lastSave.Load()}
+}
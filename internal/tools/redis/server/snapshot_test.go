@@ -0,0 +1,82 @@
+package server
+
+import (
+	inmemory "cli-t/internal/shared/store/inmemory"
+	"cli-t/internal/tools/redis/protocol"
+
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot_SaveAndReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.rdb")
+
+	s, conn, r := connect(t)
+	s.cfg.DumpPath = path
+
+	do(t, conn, r, "SET", "greeting", "hi")
+	do(t, conn, r, "HSET", "user", "name", "ann")
+	do(t, conn, r, "ZADD", "board", "10", "ann")
+	assert.Equal(t, protocol.SimpleString{Value: "OK"}, do(t, conn, r, "SAVE"))
+	assert.Equal(t, int64(0), s.snapshot.dirty.Load())
+
+	do(t, conn, r, "SADD", "tags", "go")
+	assert.Equal(t, protocol.SimpleString{Value: "Background saving started"}, do(t, conn, r, "BGSAVE"))
+	assert.Eventually(t, func() bool { return !s.snapshot.inProgress.Load() }, time.Second, 10*time.Millisecond)
+
+	// A fresh server restores everything before serving
+	store := inmemory.New()
+	restored := New(Config{DumpPath: path}, store)
+	require.NoError(t, restored.loadSnapshot())
+
+	value, ok := store.Get("greeting")
+	assert.True(t, ok)
+	assert.Equal(t, "hi", value.Data)
+	name, _, _ := store.HGet("user", "name")
+	assert.Equal(t, "ann", name)
+	score, _, _ := store.ZScore("board", "ann")
+	assert.Equal(t, 10.0, score)
+	isMember, _ := store.SIsMember("tags", "go")
+	assert.True(t, isMember)
+}
+
+func TestSnapshot_BgSaveKeepsItsPointInTime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.rdb")
+
+	s, conn, r := connect(t)
+	s.cfg.DumpPath = path
+
+	do(t, conn, r, "SET", "greeting", "hi")
+	do(t, conn, r, "HSET", "user", "name", "ann")
+
+	// Hold the dump file so the background copy waits: the writes below
+	// come after BGSAVE returned and must not end up in the dump
+	s.snapshot.mu.Lock()
+	do(t, conn, r, "BGSAVE")
+	do(t, conn, r, "SET", "greeting", "bye")
+	do(t, conn, r, "HSET", "user", "name", "bob")
+	do(t, conn, r, "SET", "late", "x")
+	s.snapshot.mu.Unlock()
+	assert.Eventually(t, func() bool { return !s.snapshot.inProgress.Load() }, time.Second, 10*time.Millisecond)
+
+	store := inmemory.New()
+	require.NoError(t, New(Config{DumpPath: path}, store).loadSnapshot())
+	value, _ := store.Get("greeting")
+	assert.Equal(t, "hi", value.Data)
+	name, _, _ := store.HGet("user", "name")
+	assert.Equal(t, "ann", name)
+	assert.Equal(t, 0, store.Exists("late"))
+}
+
+func TestSnapshot_CorruptFileRefusesToStart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.rdb")
+	require.NoError(t, os.WriteFile(path, []byte("garbage"), 0o644))
+
+	s := New(Config{DumpPath: path}, inmemory.New())
+	assert.Error(t, s.loadSnapshot())
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	inmemory "cli-t/internal/shared/store/inmemory"
+	"cli-t/internal/tools/redis/protocol"
+
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// entry is one stream entry as a reply: [id, [field, value, ...]]
+func entry(id string, fields ...string) protocol.Array {
+	return protocol.Array{Elements: []protocol.RESPValue{protocol.BulkString{Value: id}, stringArray(fields)}}
+}
+
+func entries(items ...protocol.Array) protocol.Array {
+	elements := make([]protocol.RESPValue, len(items))
+	for i, item := range items {
+		elements[i] = item
+	}
+	return protocol.Array{Elements: elements}
+}
+
+// streamReply is the RESP2 XREAD reply for one stream
+func streamReply(key string, items protocol.Array) protocol.Array {
+	return protocol.Array{Elements: []protocol.RESPValue{
+		protocol.Array{Elements: []protocol.RESPValue{protocol.BulkString{Value: key}, items}},
+	}}
+}
+
+func TestStreamCommands(t *testing.T) {
+	_, conn, r := connect(t)
+
+	assert.Equal(t, protocol.BulkString{Value: "1-1"}, do(t, conn, r, "XADD", "s", "1-1", "temp", "20"))
+	assert.Equal(t, protocol.BulkString{Value: "1-2"}, do(t, conn, r, "XADD", "s", "1-*", "temp", "21"))
+	assert.Equal(t, protocol.BulkString{Value: "2-0"}, do(t, conn, r, "XADD", "s", "MAXLEN", "~", "10", "2-0", "temp", "22"))
+	assert.Equal(t, protocol.Error{Message: "ERR The ID specified in XADD is equal or smaller than the target stream top item"},
+		do(t, conn, r, "XADD", "s", "1-5", "temp", "0"))
+	assert.Equal(t, protocol.Error{Message: "ERR wrong number of arguments for 'xadd' command"}, do(t, conn, r, "XADD", "s", "*", "odd"))
+	assert.Equal(t, protocol.BulkString{IsNull: true}, do(t, conn, r, "XADD", "none", "NOMKSTREAM", "*", "a", "b"))
+	assert.Equal(t, protocol.SimpleString{Value: "stream"}, do(t, conn, r, "TYPE", "s"))
+	assert.Equal(t, protocol.Integer{Value: 3}, do(t, conn, r, "XLEN", "s"))
+
+	assert.Equal(t, entries(entry("1-1", "temp", "20"), entry("1-2", "temp", "21")), do(t, conn, r, "XRANGE", "s", "-", "1"))
+	assert.Equal(t, entries(entry("2-0", "temp", "22")), do(t, conn, r, "XRANGE", "s", "(1-2", "+"))
+	assert.Equal(t, entries(entry("2-0", "temp", "22"), entry("1-2", "temp", "21")), do(t, conn, r, "XREVRANGE", "s", "+", "-", "COUNT", "2"))
+	assert.Equal(t, protocol.Error{Message: "ERR Invalid stream ID specified as stream command argument"}, do(t, conn, r, "XRANGE", "s", "x", "+"))
+
+	assert.Equal(t, protocol.Integer{Value: 1}, do(t, conn, r, "XDEL", "s", "1-1", "9-9"))
+	assert.Equal(t, protocol.Integer{Value: 1}, do(t, conn, r, "XTRIM", "s", "MINID", "2"))
+	assert.Equal(t, protocol.Integer{Value: 1}, do(t, conn, r, "XLEN", "s"))
+	assert.Equal(t, protocol.SimpleString{Value: "OK"}, do(t, conn, r, "XSETID", "s", "5-0"))
+	assert.Equal(t, protocol.BulkString{Value: "5-1"}, do(t, conn, r, "XADD", "s", "5-*", "temp", "23"))
+
+	// Non-blocking XREAD: everything after the given IDs, nothing after "$"
+	assert.Equal(t, streamReply("s", entries(entry("5-1", "temp", "23"))), do(t, conn, r, "XREAD", "STREAMS", "s", "2-0"))
+	assert.Equal(t, protocol.Array{IsNull: true}, do(t, conn, r, "XREAD", "COUNT", "1", "STREAMS", "s", "$"))
+	assert.Equal(t, protocol.Error{Message: "ERR Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified."},
+		do(t, conn, r, "XREAD", "STREAMS", "s", "t", "0"))
+
+	do(t, conn, r, "SET", "str", "x")
+	assert.Equal(t, protocol.Error{Message: inmemory.ErrWrongType.Error()}, do(t, conn, r, "XADD", "str", "*", "a", "b"))
+}
+
+func TestXRead_BlocksUntilAdd(t *testing.T) {
+	s, conn, r := connect(t)
+	writer, writerR := attach(t, s)
+	do(t, writer, writerR, "XADD", "events", "1-0", "old", "1")
+
+	// "$" only waits for what's added after the command
+	send(t, conn, string(stringArray([]string{"XREAD", "BLOCK", "0", "STREAMS", "other", "events", "$", "$"}).Serialize()))
+	assert.Eventually(t, func() bool { return s.blocking.waiting(0, "events") == 1 }, time.Second, 5*time.Millisecond)
+
+	do(t, writer, writerR, "XADD", "events", "2-0", "new", "1")
+	assert.Equal(t, streamReply("events", entries(entry("2-0", "new", "1"))), readReply(t, r))
+	assert.Equal(t, 0, s.blocking.waiting(0, "events"))
+
+	start := time.Now()
+	assert.Equal(t, protocol.Array{IsNull: true}, do(t, conn, r, "XREAD", "BLOCK", "50", "STREAMS", "events", "$"))
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	// RESP3 gets a map from key to entries
+	do(t, conn, r, "HELLO", "3")
+	reply := do(t, conn, r, "XREAD", "STREAMS", "events", "0")
+	assert.Equal(t, protocol.Map{Entries: []protocol.MapEntry{
+		{Key: protocol.BulkString{Value: "events"}, Value: entries(entry("1-0", "old", "1"), entry("2-0", "new", "1"))},
+	}}, reply)
+}
+
+func TestConsumerGroupCommands(t *testing.T) {
+	s, conn, r := connect(t)
+	other, otherR := attach(t, s)
+
+	assert.Equal(t, protocol.SimpleString{Value: "OK"}, do(t, conn, r, "XGROUP", "CREATE", "jobs", "workers", "$", "MKSTREAM"))
+	assert.Equal(t, protocol.Error{Message: "BUSYGROUP Consumer Group name already exists"}, do(t, conn, r, "XGROUP", "CREATE", "jobs", "workers", "0"))
+
+	// A consumer blocked on ">" gets the next entry
+	send(t, other, string(stringArray([]string{"XREADGROUP", "GROUP", "workers", "bob", "BLOCK", "0", "STREAMS", "jobs", ">"}).Serialize()))
+	assert.Eventually(t, func() bool { return s.blocking.waiting(0, "jobs") == 1 }, time.Second, 5*time.Millisecond)
+	do(t, conn, r, "XADD", "jobs", "1-0", "task", "a")
+	assert.Equal(t, streamReply("jobs", entries(entry("1-0", "task", "a"))), readReply(t, otherR))
+
+	do(t, conn, r, "XADD", "jobs", "2-0", "task", "b")
+	assert.Equal(t, streamReply("jobs", entries(entry("2-0", "task", "b"))),
+		do(t, conn, r, "XREADGROUP", "GROUP", "workers", "alice", "COUNT", "5", "STREAMS", "jobs", ">"))
+	assert.Equal(t, protocol.Array{IsNull: true}, do(t, conn, r, "XREADGROUP", "GROUP", "workers", "alice", "STREAMS", "jobs", ">"))
+
+	// History never blocks, even when empty
+	assert.Equal(t, streamReply("jobs", entries()), do(t, conn, r, "XREADGROUP", "GROUP", "workers", "carol", "BLOCK", "0", "STREAMS", "jobs", "0"))
+
+	assert.Equal(t, protocol.Array{Elements: []protocol.RESPValue{
+		protocol.Integer{Value: 2},
+		protocol.BulkString{Value: "1-0"},
+		protocol.BulkString{Value: "2-0"},
+		protocol.Array{Elements: []protocol.RESPValue{stringArray([]string{"alice", "1"}), stringArray([]string{"bob", "1"})}},
+	}}, do(t, conn, r, "XPENDING", "jobs", "workers"))
+
+	pending := do(t, conn, r, "XPENDING", "jobs", "workers", "-", "+", "10", "bob").(protocol.Array)
+	require.Len(t, pending.Elements, 1)
+	details := pending.Elements[0].(protocol.Array).Elements
+	assert.Equal(t, protocol.BulkString{Value: "1-0"}, details[0])
+	assert.Equal(t, protocol.Integer{Value: 1}, details[3])
+
+	// Bob died: alice claims his entry
+	assert.Equal(t, stringArray([]string{"1-0"}), do(t, conn, r, "XCLAIM", "jobs", "workers", "alice", "0", "1-0", "JUSTID"))
+	assert.Equal(t, entries(entry("1-0", "task", "a")), do(t, conn, r, "XCLAIM", "jobs", "workers", "alice", "0", "1-0", "RETRYCOUNT", "5"))
+	assert.Equal(t, entries(), do(t, conn, r, "XCLAIM", "jobs", "workers", "alice", "3600000", "1-0"))
+
+	assert.Equal(t, protocol.Integer{Value: 2}, do(t, conn, r, "XACK", "jobs", "workers", "1-0", "2-0", "3-0"))
+	assert.Equal(t, protocol.Integer{Value: 0}, do(t, conn, r, "XPENDING", "jobs", "workers").(protocol.Array).Elements[0])
+
+	assert.Equal(t, protocol.Error{Message: "NOGROUP No such key 'jobs' or consumer group 'nope'"},
+		do(t, conn, r, "XREADGROUP", "GROUP", "nope", "alice", "BLOCK", "0", "STREAMS", "jobs", ">"))
+	assert.Equal(t, protocol.Integer{Value: 0}, do(t, conn, r, "XGROUP", "DELCONSUMER", "jobs", "workers", "bob"))
+	assert.Equal(t, protocol.Integer{Value: 1}, do(t, conn, r, "XGROUP", "CREATECONSUMER", "jobs", "workers", "dave"))
+	assert.Equal(t, protocol.Integer{Value: 1}, do(t, conn, r, "XGROUP", "DESTROY", "jobs", "workers"))
+}
+
+func TestStreamKeysAndFlags(t *testing.T) {
+	spec := commandTable["XREADGROUP"]
+	args := stringArray([]string{"XREADGROUP", "GROUP", "streams", "c", "COUNT", "1", "STREAMS", "a", "b", ">", ">"}).Elements
+	assert.Equal(t, []string{"a", "b"}, commandKeys(spec, args))
+	assert.Contains(t, spec.info().Elements[2].(protocol.Array).Elements, protocol.SimpleString{Value: "movablekeys"})
+
+	// XREAD only reads, so a read-only replica serves it
+	assert.False(t, commandTable["XREAD"].write)
+	assert.Contains(t, commandTable["XREAD"].categories(), "read")
+}
+
+func TestAOF_StreamReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	s, _, run := connectAOF(t, path)
+
+	id := run("XADD", "s", "*", "n", "1").(protocol.BulkString).Value
+	run("XADD", "s", "*", "n", "2")
+	run("XGROUP", "CREATE", "s", "g", "0")
+	run("XREADGROUP", "GROUP", "g", "alice", "COUNT", "1", "STREAMS", "s", ">")
+	run("XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", "0")
+	run("XCLAIM", "s", "g", "bob", "0", id)
+	require.NoError(t, s.aof.Sync())
+
+	store := reload(t, path)
+	all, err := store.XRange("s", inmemory.StreamID{}, inmemory.MaxStreamID, 0, false)
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assert.Equal(t, id, all[0].ID.String())
+
+	// Same group position and PEL: delivered twice to alice, claimed by bob
+	pending, err := store.XPending("s", "g", inmemory.XPendingOptions{End: inmemory.MaxStreamID, Count: 10})
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, "bob", pending[0].Consumer)
+	assert.Equal(t, int64(3), pending[0].Deliveries)
+	next, err := store.XReadGroup("s", "g", "alice", inmemory.XReadGroupOptions{New: true})
+	require.NoError(t, err)
+	require.Len(t, next, 1)
+	assert.Equal(t, all[1].ID, next[0].ID)
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"cli-t/internal/tools/redis/protocol"
+
+	"sync"
+)
+
+// Commands that act on the transaction itself instead of being queued
+var transactionCommands = map[string]bool{
+	"MULTI":   true,
+	"EXEC":    true,
+	"DISCARD": true,
+	"WATCH":   true,
+	"UNWATCH": true,
+	"QUIT":    true,
+}
+
+// queuedCommand is a command waiting for EXEC
+type queuedCommand struct {
+	spec *commandSpec
+	args []protocol.RESPValue
+}
+
+// transaction is the MULTI state of one client
+type transaction struct {
+	queued  []queuedCommand
+	aborted bool // a command failed to queue (unknown / wrong arity)
+}
+
+// dbKey is a key of one database
+type dbKey struct {
+	db  int
+	key string
+}
+
+// watchRegistry tracks WATCHed keys. The store calls keyModified on every
+// write, which flags each client watching that key so its EXEC aborts.
+type watchRegistry struct {
+	mu   sync.Mutex
+	keys map[dbKey]map[*client]struct{}
+}
+
+func newWatchRegistry() *watchRegistry {
+	return &watchRegistry{
+		keys: make(map[dbKey]map[*client]struct{}),
+	}
+}
+
+func (w *watchRegistry) watch(c *client, db int, name string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	key := dbKey{db, name}
+	if _, ok := c.watched[key]; ok {
+		return
+	}
+	c.watched[key] = struct{}{}
+
+	if w.keys[key] == nil {
+		w.keys[key] = make(map[*client]struct{})
+	}
+	w.keys[key][c] = struct{}{}
+}
+
+// unwatchAll forgets every key c watches and resets its dirty flag
+func (w *watchRegistry) unwatchAll(c *client) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for key := range c.watched {
+		delete(w.keys[key], c)
+		if len(w.keys[key]) == 0 {
+			delete(w.keys, key)
+		}
+	}
+	c.watched = make(map[dbKey]struct{})
+	c.watchDirty = false
+}
+
+// keyModified is the store's change hook (called with the store lock held)
+func (w *watchRegistry) keyModified(db int, key string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for c := range w.keys[dbKey{db, key}] {
+		c.watchDirty = true
+	}
+}
+
+// dbModified flags every client watching a key of db, whose content was
+// replaced as a whole (SWAPDB, FLUSHDB)
+func (w *watchRegistry) dbModified(db int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for key, clients := range w.keys {
+		if key.db != db {
+			continue
+		}
+		for c := range clients {
+			c.watchDirty = true
+		}
+	}
+}
+
+func (w *watchRegistry) isDirty(c *client) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return c.watchDirty
+}
+
+// MULTI
+func (s *Server) handleMulti(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if c.tx != nil {
+		return protocol.Error{Message: "ERR MULTI calls can not be nested"}
+	}
+	c.tx = &transaction{}
+	return protocol.SimpleString{Value: "OK"}
+}
+
+// EXEC runs the queued commands; handleCommand holds execMu exclusively
+// while it does, so no other client's command can interleave.
+func (s *Server) handleExec(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if c.tx == nil {
+		return protocol.Error{Message: "ERR EXEC without MULTI"}
+	}
+
+	tx := c.tx
+	c.tx = nil
+	dirty := s.watches.isDirty(c)
+	s.watches.unwatchAll(c)
+
+	if tx.aborted {
+		return protocol.Error{Message: "EXECABORT Transaction discarded because of previous errors."}
+	}
+
+	// A watched key changed since WATCH: abort with a null reply
+	if dirty {
+		return protocol.Array{IsNull: true}
+	}
+
+	// One eviction pass up front: a transaction can't stop half way
+	for _, queued := range tx.queued {
+		if queued.spec.denyOOM {
+			if oom := s.freeMemory(); oom != nil {
+				return oom
+			}
+			break
+		}
+	}
+
+	// Writes are collected while executing and logged as one MULTI/EXEC
+	c.execing = true
+	replies := make([]protocol.RESPValue, len(tx.queued))
+	for i, queued := range tx.queued {
+		replies[i] = queued.spec.handler(s, c, queued.args)
+
+		if _, failed := replies[i].(protocol.Error); queued.spec.write && !queued.spec.propagates && !failed {
+			if args, ok := bulkStrings(queued.args); ok {
+				s.alsoPropagate(c, s.propagationForm(c, args))
+			}
+		}
+	}
+	c.execing = false
+
+	writes := c.txWrites
+	c.txWrites = nil
+	s.propagate(writes...)
+	return protocol.Array{Elements: replies}
+}
+
+// DISCARD
+func (s *Server) handleDiscard(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if c.tx == nil {
+		return protocol.Error{Message: "ERR DISCARD without MULTI"}
+	}
+	c.tx = nil
+	s.watches.unwatchAll(c)
+	return protocol.SimpleString{Value: "OK"}
+}
+
+// WATCH key [key ...]
+func (s *Server) handleWatch(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	if c.tx != nil {
+		return protocol.Error{Message: "ERR WATCH inside MULTI is not allowed"}
+	}
+
+	keys, ok := bulkStrings(args[1:])
+	if !ok {
+		return protocol.Error{Message: "ERR key must be a string"}
+	}
+
+	for _, key := range keys {
+		s.watches.watch(c, c.db, key)
+	}
+	return protocol.SimpleString{Value: "OK"}
+}
+
+// UNWATCH
+func (s *Server) handleUnwatch(c *client, args []protocol.RESPValue) protocol.RESPValue {
+	s.watches.unwatchAll(c)
+	return protocol.SimpleString{Value: "OK"}
+}
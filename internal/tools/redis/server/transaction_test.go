@@ -0,0 +1,91 @@
+package server
+
+import (
+	"cli-t/internal/tools/redis/protocol"
+
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransaction_Exec(t *testing.T) {
+	_, conn, r := connect(t)
+
+	assert.Equal(t, protocol.SimpleString{Value: "OK"}, do(t, conn, r, "MULTI"))
+	assert.Equal(t, protocol.SimpleString{Value: "QUEUED"}, do(t, conn, r, "SET", "a", "1"))
+	assert.Equal(t, protocol.SimpleString{Value: "QUEUED"}, do(t, conn, r, "HSET", "a", "f", "v"))
+	assert.Equal(t, protocol.SimpleString{Value: "QUEUED"}, do(t, conn, r, "GET", "a"))
+
+	// Runtime errors don't abort the rest of the transaction
+	reply, ok := do(t, conn, r, "EXEC").(protocol.Array)
+	assert.True(t, ok)
+	assert.Len(t, reply.Elements, 3)
+	assert.Equal(t, protocol.SimpleString{Value: "OK"}, reply.Elements[0])
+	assert.IsType(t, protocol.Error{}, reply.Elements[1])
+	assert.Equal(t, protocol.BulkString{Value: "1"}, reply.Elements[2])
+
+	assert.Equal(t, protocol.Error{Message: "ERR EXEC without MULTI"}, do(t, conn, r, "EXEC"))
+}
+
+func TestTransaction_Errors(t *testing.T) {
+	_, conn, r := connect(t)
+
+	do(t, conn, r, "MULTI")
+	assert.Equal(t, protocol.Error{Message: "ERR MULTI calls can not be nested"}, do(t, conn, r, "MULTI"))
+	assert.Equal(t, protocol.Error{Message: "ERR WATCH inside MULTI is not allowed"}, do(t, conn, r, "WATCH", "k"))
+
+	// A command that fails to queue poisons the whole transaction
+	do(t, conn, r, "SET", "k", "v")
+	assert.IsType(t, protocol.Error{}, do(t, conn, r, "GET"))
+	assert.Equal(t, protocol.Error{Message: "EXECABORT Transaction discarded because of previous errors."}, do(t, conn, r, "EXEC"))
+	assert.Equal(t, protocol.BulkString{IsNull: true}, do(t, conn, r, "GET", "k"))
+
+	do(t, conn, r, "MULTI")
+	do(t, conn, r, "SET", "k", "v")
+	assert.Equal(t, protocol.SimpleString{Value: "OK"}, do(t, conn, r, "DISCARD"))
+	assert.Equal(t, protocol.BulkString{IsNull: true}, do(t, conn, r, "GET", "k"))
+	assert.Equal(t, protocol.Error{Message: "ERR DISCARD without MULTI"}, do(t, conn, r, "DISCARD"))
+}
+
+func TestTransaction_Watch(t *testing.T) {
+	s, conn, r := connect(t)
+	other, otherR := attach(t, s)
+
+	do(t, conn, r, "SET", "balance", "10")
+
+	// Untouched watched key: EXEC runs
+	do(t, conn, r, "WATCH", "balance")
+	do(t, conn, r, "MULTI")
+	do(t, conn, r, "INCR", "balance")
+	assert.Equal(t, protocol.Array{Elements: []protocol.RESPValue{protocol.Integer{Value: 11}}}, do(t, conn, r, "EXEC"))
+
+	// Another client writes the key between WATCH and EXEC: EXEC aborts
+	do(t, conn, r, "WATCH", "balance")
+	do(t, other, otherR, "SET", "balance", "100")
+	do(t, conn, r, "MULTI")
+	do(t, conn, r, "INCR", "balance")
+	assert.Equal(t, protocol.Array{IsNull: true}, do(t, conn, r, "EXEC"))
+	assert.Equal(t, protocol.BulkString{Value: "100"}, do(t, conn, r, "GET", "balance"))
+
+	// EXEC forgets the watches, so the next transaction goes through
+	do(t, other, otherR, "SET", "balance", "5")
+	do(t, conn, r, "MULTI")
+	do(t, conn, r, "INCR", "balance")
+	assert.Equal(t, protocol.Array{Elements: []protocol.RESPValue{protocol.Integer{Value: 6}}}, do(t, conn, r, "EXEC"))
+
+	// UNWATCH drops watches too
+	do(t, conn, r, "WATCH", "balance")
+	do(t, other, otherR, "DEL", "balance")
+	do(t, conn, r, "UNWATCH")
+	do(t, conn, r, "MULTI")
+	do(t, conn, r, "SET", "balance", "1")
+	assert.Equal(t, protocol.Array{Elements: []protocol.RESPValue{protocol.SimpleString{Value: "OK"}}}, do(t, conn, r, "EXEC"))
+
+	// A no-op write (member already present) doesn't touch the key
+	do(t, conn, r, "SADD", "set", "x")
+	do(t, conn, r, "WATCH", "set")
+	do(t, other, otherR, "SADD", "set", "x")
+	do(t, conn, r, "MULTI")
+	do(t, conn, r, "SCARD", "set")
+	assert.Equal(t, protocol.Array{Elements: []protocol.RESPValue{protocol.Integer{Value: 1}}}, do(t, conn, r, "EXEC"))
+}